@@ -19,6 +19,11 @@ type Error struct {
 	// `err.Error()`. This field is required.
 	Message string `json:"message"`
 
+	// Code identifies common errors, so that clients can handle them
+	// without depending on the wording of Message. It is omitted for errors
+	// that do not have a code.
+	Code string `json:"code,omitempty"`
+
 	// TODO: add a Param field with the (omitempty option in the json tag)
 	// to indicate that the error was caused by an invalid, missing, or
 	// incorrect parameter. This is not trivial as the API does not
@@ -31,6 +36,16 @@ type Error struct {
 	// be valid or invalid depending on the current state of a module.
 }
 
+// Error codes returned in the Code field of an Error.
+const (
+	ErrCodeEmptyFilename         = "EMPTY_FILENAME"
+	ErrCodeInsufficientAllowance = "INSUFFICIENT_ALLOWANCE"
+	ErrCodePathOverload          = "PATH_OVERLOAD"
+	ErrCodeUnknownPath           = "UNKNOWN_PATH"
+	ErrCodeWalletLocked          = "WALLET_LOCKED"
+	ErrCodeZeroWindow            = "ZERO_WINDOW"
+)
+
 // Error implements the error interface for the Error type. It returns only the
 // Message field.
 func (err Error) Error() string {
@@ -92,7 +107,7 @@ func HttpPOSTAuthenticated(url string, data string, password string) (resp *http
 func RequireUserAgent(h http.Handler, ua string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		if !strings.Contains(req.UserAgent(), ua) {
-			WriteError(w, Error{"Browser access disabled due to security vulnerability. Use Sia-UI or siac."}, http.StatusBadRequest)
+			WriteError(w, Error{Message: "Browser access disabled due to security vulnerability. Use Sia-UI or siac."}, http.StatusBadRequest)
 			return
 		}
 		h.ServeHTTP(w, req)
@@ -111,7 +126,7 @@ func RequirePassword(h httprouter.Handle, password string) httprouter.Handle {
 		_, pass, ok := req.BasicAuth()
 		if !ok || pass != password {
 			w.Header().Set("WWW-Authenticate", "Basic realm=\"SiaAPI\"")
-			WriteError(w, Error{"API authentication failed."}, http.StatusUnauthorized)
+			WriteError(w, Error{Message: "API authentication failed."}, http.StatusUnauthorized)
 			return
 		}
 		h(w, req, ps)
@@ -206,9 +221,22 @@ func New(requiredUserAgent string, requiredPassword string, cs modules.Consensus
 	if api.renter != nil {
 		router.GET("/renter", api.renterHandlerGET)
 		router.POST("/renter", RequirePassword(api.renterHandlerPOST, requiredPassword))
+		router.POST("/renter/validate", RequirePassword(api.renterValidateHandler, requiredPassword))
+		router.GET("/renter/backup", RequirePassword(api.renterBackupHandler, requiredPassword))
+		router.POST("/renter/contract/cancel", RequirePassword(api.renterContractCancelHandler, requiredPassword))
 		router.GET("/renter/contracts", api.renterContractsHandler)
+		router.GET("/renter/contracts/expiring", api.renterContractsExpiringHandler)
+		router.GET("/renter/contracts/metrics", api.renterContractsMetricsHandler)
 		router.GET("/renter/downloads", api.renterDownloadsHandler)
+		router.POST("/renter/downloads/clear", RequirePassword(api.renterDownloadsClearHandler, requiredPassword))
+		router.GET("/renter/file/*siapath", api.renterFileHandler)
 		router.GET("/renter/files", api.renterFilesHandler)
+		router.GET("/renter/prices", api.renterPricesHandler)
+		router.GET("/renter/recoverable", api.renterRecoverableHandler)
+		router.POST("/renter/restore", RequirePassword(api.renterRestoreHandler, requiredPassword))
+		if build.DEBUG {
+			router.GET("/renter/debug/cachedaddress", api.renterDebugCachedAddressHandler)
+		}
 
 		// TODO: re-enable these routes once the new .sia format has been
 		// standardized and implemented.
@@ -217,14 +245,19 @@ func New(requiredUserAgent string, requiredPassword string, cs modules.Consensus
 		// router.GET("/renter/share", RequirePassword(api.renterShareHandler, requiredPassword))
 		// router.GET("/renter/shareascii", RequirePassword(api.renterShareAsciiHandler, requiredPassword))
 
+		router.POST("/renter/delete", RequirePassword(api.renterDeleteHandler, requiredPassword))
 		router.POST("/renter/delete/*siapath", RequirePassword(api.renterDeleteHandler, requiredPassword))
 		router.GET("/renter/download/*siapath", RequirePassword(api.renterDownloadHandler, requiredPassword))
 		router.POST("/renter/rename/*siapath", RequirePassword(api.renterRenameHandler, requiredPassword))
+		router.POST("/renter/repair", RequirePassword(api.renterRepairHandler, requiredPassword))
 		router.POST("/renter/upload/*siapath", RequirePassword(api.renterUploadHandler, requiredPassword))
+		router.POST("/renter/uploads/cancel/*siapath", RequirePassword(api.renterUploadCancelHandler, requiredPassword))
+		router.GET("/renter/uploads/stream", api.renterUploadsStreamHandler)
 
 		// HostDB endpoints.
 		router.GET("/hostdb/active", api.renterHostsActiveHandler)
 		router.GET("/hostdb/all", api.renterHostsAllHandler)
+		router.GET("/hostdb/host/:pubkey", api.renterHostHandler)
 	}
 
 	// TransactionPool API Calls
@@ -254,13 +287,13 @@ func New(requiredUserAgent string, requiredPassword string, cs modules.Consensus
 	}
 
 	// Apply UserAgent middleware and return the API
-	api.router = RequireUserAgent(router, requiredUserAgent)
+	api.router = RequireUserAgent(CurrencyFormat(router), requiredUserAgent)
 	return api
 }
 
 // UnrecognizedCallHandler handles calls to unknown pages (404).
 func UnrecognizedCallHandler(w http.ResponseWriter, req *http.Request) {
-	WriteError(w, Error{"404 - Refer to API.md"}, http.StatusNotFound)
+	WriteError(w, Error{Message: "404 - Refer to API.md"}, http.StatusNotFound)
 }
 
 // WriteError an error to the API caller.
@@ -279,6 +312,9 @@ func WriteError(w http.ResponseWriter, err Error, code int) {
 // error is written instead. The Content-Type of the response header is set
 // accordingly.
 func WriteJSON(w http.ResponseWriter, obj interface{}) {
+	if _, ok := w.(siacoinResponseWriter); ok {
+		obj = siacoinValues(obj)
+	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	err := json.NewEncoder(w).Encode(obj)
 	if _, isJsonErr := err.(*json.SyntaxError); isJsonErr {
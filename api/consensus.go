@@ -36,12 +36,12 @@ func (api *API) consensusValidateTransactionsetHandler(w http.ResponseWriter, re
 	var txnset []types.Transaction
 	err := json.NewDecoder(req.Body).Decode(&txnset)
 	if err != nil {
-		WriteError(w, Error{"could not decode transaction set: " + err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "could not decode transaction set: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 	_, err = api.cs.TryTransactionSet(txnset)
 	if err != nil {
-		WriteError(w, Error{"transaction set validation failed: " + err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "transaction set validation failed: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 	WriteSuccess(w)
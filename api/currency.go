@@ -0,0 +1,182 @@
+package api
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// currencyFormatHastings formats currency fields as a decimal string of
+	// hastings. This is the default.
+	currencyFormatHastings = "hastings"
+
+	// currencyFormatSC formats currency fields as a decimal string of
+	// siacoins followed by the unit, e.g. "1.5 SC".
+	currencyFormatSC = "sc"
+)
+
+var (
+	currencyType      = reflect.TypeOf(types.Currency{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// siacoinResponseWriter marks a response whose currency fields should be
+// written in siacoins. WriteJSON checks for it.
+type siacoinResponseWriter struct {
+	http.ResponseWriter
+}
+
+// Flush implements http.Flusher if the underlying ResponseWriter does, so
+// that streaming endpoints keep working.
+func (w siacoinResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// CloseNotify implements http.CloseNotifier. If the underlying ResponseWriter
+// does not support it, the returned channel never fires.
+func (w siacoinResponseWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return nil
+}
+
+// CurrencyFormat is middleware that selects how currency fields are written
+// in JSON responses, using the format query parameter. Without the
+// parameter, currencies are written in hastings.
+func CurrencyFormat(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch format := req.URL.Query().Get("format"); format {
+		case "", currencyFormatHastings:
+			h.ServeHTTP(w, req)
+		case currencyFormatSC:
+			h.ServeHTTP(siacoinResponseWriter{w}, req)
+		default:
+			WriteError(w, Error{Message: fmt.Sprintf("unknown format %q: must be %q or %q", format, currencyFormatHastings, currencyFormatSC)}, http.StatusBadRequest)
+		}
+	})
+}
+
+// formatSiacoins returns c as an exact decimal number of siacoins followed by
+// the unit.
+func formatSiacoins(c types.Currency) string {
+	sc := new(big.Rat).SetFrac(c.Big(), types.SiacoinPrecision.Big()).FloatString(24)
+	sc = strings.TrimRight(strings.TrimRight(sc, "0"), ".")
+	return sc + " SC"
+}
+
+// siacoinValues returns the JSON representation of obj with every
+// types.Currency written in siacoins. If obj cannot be converted, it is
+// returned unchanged.
+func siacoinValues(obj interface{}) interface{} {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return obj
+	}
+	// Decode numbers as json.Number so that large integers keep their
+	// precision.
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var data interface{}
+	if err := dec.Decode(&data); err != nil {
+		return obj
+	}
+	return convertCurrencies(reflect.ValueOf(obj), data)
+}
+
+// convertCurrencies replaces the currencies in data, the decoded JSON of v,
+// with their siacoin representation.
+func convertCurrencies(v reflect.Value, data interface{}) interface{} {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return data
+		}
+		v = v.Elem()
+	}
+	if v.Type() == currencyType {
+		return formatSiacoins(v.Interface().(types.Currency))
+	}
+	// Types with their own JSON encoding are left as is.
+	if v.Type().Implements(jsonMarshalerType) {
+		return data
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if obj, ok := data.(map[string]interface{}); ok {
+			convertStructCurrencies(v, obj)
+		}
+	case reflect.Slice, reflect.Array:
+		if arr, ok := data.([]interface{}); ok {
+			for i := 0; i < len(arr) && i < v.Len(); i++ {
+				arr[i] = convertCurrencies(v.Index(i), arr[i])
+			}
+		}
+	case reflect.Map:
+		if obj, ok := data.(map[string]interface{}); ok {
+			for _, k := range v.MapKeys() {
+				key := fmt.Sprint(k.Interface())
+				if k.Type().Implements(textMarshalerType) {
+					text, err := k.Interface().(encoding.TextMarshaler).MarshalText()
+					if err != nil {
+						continue
+					}
+					key = string(text)
+				}
+				if d, ok := obj[key]; ok {
+					obj[key] = convertCurrencies(v.MapIndex(k), d)
+				}
+			}
+		}
+	}
+	return data
+}
+
+// convertStructCurrencies replaces the currencies in obj, the decoded JSON of
+// the struct v, following the field naming rules of encoding/json.
+func convertStructCurrencies(v reflect.Value, obj map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		fv := v.Field(i)
+
+		// The fields of untagged embedded structs are inlined.
+		if f.Anonymous && name == "" {
+			for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct && fv.Type() != currencyType && !fv.Type().Implements(jsonMarshalerType) {
+				convertStructCurrencies(fv, obj)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if d, ok := obj[name]; ok {
+			obj[name] = convertCurrencies(fv, d)
+		}
+	}
+}
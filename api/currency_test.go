@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestFormatSiacoins tests that formatSiacoins writes exact siacoin amounts.
+func TestFormatSiacoins(t *testing.T) {
+	tests := []struct {
+		c  types.Currency
+		sc string
+	}{
+		{types.ZeroCurrency, "0 SC"},
+		{types.SiacoinPrecision, "1 SC"},
+		{types.SiacoinPrecision.Mul64(3).Div64(2), "1.5 SC"},
+		{types.SiacoinPrecision.Mul64(1000), "1000 SC"},
+		{types.NewCurrency64(1), "0.000000000000000000000001 SC"},
+	}
+	for _, test := range tests {
+		if sc := formatSiacoins(test.c); sc != test.sc {
+			t.Errorf("formatSiacoins(%v): expected %v, got %v", test.c, test.sc, sc)
+		}
+	}
+}
+
+// TestSiacoinValues tests that siacoinValues converts only the currency
+// fields of an object, including those of nested and embedded structs.
+func TestSiacoinValues(t *testing.T) {
+	type inner struct {
+		Price types.Currency `json:"price"`
+	}
+	type embedded struct {
+		Fee types.Currency `json:"fee"`
+	}
+	obj := struct {
+		embedded
+		Balance types.Currency            `json:"balance"`
+		Height  types.BlockHeight         `json:"height"`
+		Hidden  types.Currency            `json:"-"`
+		Inner   inner                     `json:"inner"`
+		List    []types.Currency          `json:"list"`
+		Map     map[string]types.Currency `json:"map"`
+		Ptr     *types.Currency           `json:"ptr"`
+	}{
+		embedded: embedded{Fee: types.SiacoinPrecision.Mul64(2)},
+		Balance:  types.SiacoinPrecision.Mul64(3).Div64(2),
+		Height:   12,
+		Hidden:   types.SiacoinPrecision,
+		Inner:    inner{Price: types.SiacoinPrecision.Div64(4)},
+		List:     []types.Currency{types.SiacoinPrecision, types.ZeroCurrency},
+		Map:      map[string]types.Currency{"foo": types.SiacoinPrecision.Mul64(5)},
+	}
+
+	// The default representation should be hastings.
+	var hastings map[string]interface{}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &hastings); err != nil {
+		t.Fatal(err)
+	}
+	if hastings["balance"] != "1500000000000000000000000" {
+		t.Fatal("expected balance in hastings, got", hastings["balance"])
+	}
+
+	// Every currency should be in siacoins, and nothing else should change.
+	var sc map[string]interface{}
+	b, err = json.Marshal(siacoinValues(obj))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &sc); err != nil {
+		t.Fatal(err)
+	}
+	if sc["balance"] != "1.5 SC" {
+		t.Error("expected balance of 1.5 SC, got", sc["balance"])
+	}
+	if sc["fee"] != "2 SC" {
+		t.Error("expected embedded fee of 2 SC, got", sc["fee"])
+	}
+	if sc["height"] != 12.0 {
+		t.Error("expected height to be unchanged, got", sc["height"])
+	}
+	if _, exists := sc["Hidden"]; exists {
+		t.Error("ignored field was written")
+	}
+	if price := sc["inner"].(map[string]interface{})["price"]; price != "0.25 SC" {
+		t.Error("expected nested price of 0.25 SC, got", price)
+	}
+	if list := sc["list"].([]interface{}); list[0] != "1 SC" || list[1] != "0 SC" {
+		t.Error("expected list of siacoins, got", list)
+	}
+	if foo := sc["map"].(map[string]interface{})["foo"]; foo != "5 SC" {
+		t.Error("expected map value of 5 SC, got", foo)
+	}
+	if sc["ptr"] != nil {
+		t.Error("expected nil pointer to be written as null, got", sc["ptr"])
+	}
+}
+
+// TestCurrencyFormat tests the format query parameter of the API.
+func TestCurrencyFormat(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestCurrencyFormat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// The mined coins should be reported in hastings by default.
+	var wg WalletGET
+	if err := st.getAPI("/wallet", &wg); err != nil {
+		t.Fatal(err)
+	}
+	if wg.ConfirmedSiacoinBalance.IsZero() {
+		t.Fatal("expected a nonzero balance")
+	}
+	var hastings map[string]interface{}
+	if err := st.getAPI("/wallet?format=hastings", &hastings); err != nil {
+		t.Fatal(err)
+	}
+	if hastings["confirmedsiacoinbalance"] != wg.ConfirmedSiacoinBalance.String() {
+		t.Fatal("expected balance in hastings, got", hastings["confirmedsiacoinbalance"])
+	}
+
+	// With format=sc, the same balance should be reported in siacoins.
+	var sc map[string]interface{}
+	if err := st.getAPI("/wallet?format=sc", &sc); err != nil {
+		t.Fatal(err)
+	}
+	if sc["confirmedsiacoinbalance"] != formatSiacoins(wg.ConfirmedSiacoinBalance) {
+		t.Fatal("expected balance in siacoins, got", sc["confirmedsiacoinbalance"])
+	}
+	if sc["unlocked"] != true {
+		t.Fatal("non-currency fields should be unchanged:", sc["unlocked"])
+	}
+
+	// An unknown format should be rejected.
+	if err := st.stdGetAPI("/wallet?format=foo"); err == nil {
+		t.Fatal("expected an unknown format to be rejected")
+	}
+}
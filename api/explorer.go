@@ -203,14 +203,14 @@ func (api *API) explorerBlocksHandler(w http.ResponseWriter, req *http.Request,
 	var height types.BlockHeight
 	_, err := fmt.Sscan(ps.ByName("height"), &height)
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 
 	// Fetch and return the explorer block.
 	block, exists := api.cs.BlockAtHeight(height)
 	if !exists {
-		WriteError(w, Error{"no block found at input height in call to /explorer/block"}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "no block found at input height in call to /explorer/block"}, http.StatusBadRequest)
 		return
 	}
 	WriteJSON(w, ExplorerBlockGET{
@@ -253,7 +253,7 @@ func (api *API) explorerHashHandler(w http.ResponseWriter, req *http.Request, ps
 	if err != nil {
 		addr, err := scanAddress(ps.ByName("hash"))
 		if err != nil {
-			WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+			WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 			return
 		}
 		hash = crypto.Hash(addr)
@@ -262,7 +262,7 @@ func (api *API) explorerHashHandler(w http.ResponseWriter, req *http.Request, ps
 	// TODO: lookups on the zero hash are too expensive to allow. Need a
 	// better way to handle this case.
 	if hash == (crypto.Hash{}) {
-		WriteError(w, Error{"can't lookup the empty unlock hash"}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "can't lookup the empty unlock hash"}, http.StatusBadRequest)
 		return
 	}
 
@@ -348,7 +348,7 @@ func (api *API) explorerHashHandler(w http.ResponseWriter, req *http.Request, ps
 	}
 
 	// Hash not found, return an error.
-	WriteError(w, Error{"unrecognized hash used as input to /explorer/hash"}, http.StatusBadRequest)
+	WriteError(w, Error{Message: "unrecognized hash used as input to /explorer/hash"}, http.StatusBadRequest)
 }
 
 // explorerHandler handles API calls to /explorer
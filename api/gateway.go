@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/NebulousLabs/Sia/modules"
 
@@ -12,18 +13,33 @@ import (
 type GatewayGET struct {
 	NetAddress modules.NetAddress `json:"netaddress"`
 	Peers      []modules.Peer     `json:"peers"`
+	PeerCount  int                `json:"peercount"`
 }
 
-// gatewayHandler handles the API call asking for the gatway status.
+// gatewayHandler handles the API call asking for the gatway status. If sort is
+// set to latency, the peers are sorted by ping latency, fastest first.
 func (api *API) gatewayHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	peers := api.gateway.Peers()
+	var peers []modules.Peer
+	switch sortKey := req.FormValue("sort"); sortKey {
+	case "":
+		peers = api.gateway.Peers()
+	case "latency":
+		peers = api.gateway.PeersByLatency()
+	default:
+		WriteError(w, Error{Message: "invalid sort key " + strconv.Quote(sortKey) + "; must be latency"}, http.StatusBadRequest)
+		return
+	}
 	// nil slices are marshalled as 'null' in JSON, whereas 0-length slices are
 	// marshalled as '[]'. The latter is preferred, indicating that the value
 	// exists but contains no elements.
 	if peers == nil {
 		peers = make([]modules.Peer, 0)
 	}
-	WriteJSON(w, GatewayGET{api.gateway.Address(), peers})
+	WriteJSON(w, GatewayGET{
+		NetAddress: api.gateway.Address(),
+		Peers:      peers,
+		PeerCount:  len(peers),
+	})
 }
 
 // gatewayConnectHandler handles the API call to add a peer to the gateway.
@@ -31,7 +47,7 @@ func (api *API) gatewayConnectHandler(w http.ResponseWriter, req *http.Request,
 	addr := modules.NetAddress(ps.ByName("netaddress"))
 	err := api.gateway.Connect(addr)
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 
@@ -43,7 +59,7 @@ func (api *API) gatewayDisconnectHandler(w http.ResponseWriter, req *http.Reques
 	addr := modules.NetAddress(ps.ByName("netaddress"))
 	err := api.gateway.Disconnect(addr)
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 
@@ -22,8 +22,42 @@ func TestGatewayStatus(t *testing.T) {
 
 	var info GatewayGET
 	st.getAPI("/gateway", &info)
-	if len(info.Peers) != 0 {
-		t.Fatal("/gateway gave bad peer list:", info.Peers)
+	if len(info.Peers) != 0 || info.PeerCount != 0 {
+		t.Fatal("/gateway gave bad peer list:", info.Peers, info.PeerCount)
+	}
+}
+
+// TestGatewaySortLatency checks that /gateway accepts sort=latency and rejects
+// unknown sort keys.
+func TestGatewaySortLatency(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestGatewaySortLatency")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	peer, err := gateway.New("localhost:0", false, build.TempDir("api", "TestGatewaySortLatency2", "gateway"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	if err = st.stdPostAPI("/gateway/connect/"+string(peer.Address()), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var info GatewayGET
+	if err = st.getAPI("/gateway?sort=latency", &info); err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Peers) != 1 || info.Peers[0].NetAddress != peer.Address() || info.PeerCount != 1 {
+		t.Fatal("/gateway?sort=latency gave bad peer list:", info.Peers, info.PeerCount)
+	}
+	if err = st.stdGetAPI("/gateway?sort=foo"); err == nil {
+		t.Fatal("expected an unknown sort key to be rejected")
 	}
 }
 
@@ -57,6 +91,9 @@ func TestGatewayPeerConnect(t *testing.T) {
 	if len(info.Peers) != 1 || info.Peers[0].NetAddress != peer.Address() {
 		t.Fatal("/gateway/connect did not connect to peer", peer.Address())
 	}
+	if info.PeerCount != 1 {
+		t.Fatal("/gateway reported wrong peer count:", info.PeerCount)
+	}
 }
 
 // TestGatewayPeerDisconnect checks that /gateway/disconnect removes the
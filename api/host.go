@@ -13,7 +13,7 @@ import (
 var (
 	// errNoPath is returned when a call fails to provide a nonempty string
 	// for the path parameter.
-	errNoPath = Error{"path parameter is required"}
+	errNoPath = Error{Message: "path parameter is required"}
 
 	// errStorageFolderNotFound is returned if a call is made looking for a
 	// storage folder which does not appear to exist within the storage
@@ -95,14 +95,14 @@ func (api *API) hostHandlerPOST(w http.ResponseWriter, req *http.Request, _ http
 		if req.FormValue(qs) != "" { // skip empty values
 			_, err := fmt.Sscan(req.FormValue(qs), qsVars[qs])
 			if err != nil {
-				WriteError(w, Error{"Malformed " + qs}, http.StatusBadRequest)
+				WriteError(w, Error{Message: "Malformed " + qs}, http.StatusBadRequest)
 				return
 			}
 		}
 	}
 	err := api.host.SetInternalSettings(settings)
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 	WriteSuccess(w)
@@ -118,7 +118,7 @@ func (api *API) hostAnnounceHandler(w http.ResponseWriter, req *http.Request, _
 		err = api.host.Announce()
 	}
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 	WriteSuccess(w)
@@ -138,12 +138,12 @@ func (api *API) storageFoldersAddHandler(w http.ResponseWriter, req *http.Reques
 	var folderSize uint64
 	_, err := fmt.Sscan(req.FormValue("size"), &folderSize)
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 	err = api.host.AddStorageFolder(folderPath, folderSize)
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 	WriteSuccess(w)
@@ -153,26 +153,26 @@ func (api *API) storageFoldersAddHandler(w http.ResponseWriter, req *http.Reques
 func (api *API) storageFoldersResizeHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	folderPath := req.FormValue("path")
 	if folderPath == "" {
-		WriteError(w, Error{"path parameter is required"}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "path parameter is required"}, http.StatusBadRequest)
 		return
 	}
 
 	storageFolders := api.host.StorageFolders()
 	folderIndex, err := folderIndex(folderPath, storageFolders)
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 
 	var newSize uint64
 	_, err = fmt.Sscan(req.FormValue("newsize"), &newSize)
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 	err = api.host.ResizeStorageFolder(folderIndex, newSize)
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 	WriteSuccess(w)
@@ -183,21 +183,21 @@ func (api *API) storageFoldersResizeHandler(w http.ResponseWriter, req *http.Req
 func (api *API) storageFoldersRemoveHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	folderPath := req.FormValue("path")
 	if folderPath == "" {
-		WriteError(w, Error{"path parameter is required"}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "path parameter is required"}, http.StatusBadRequest)
 		return
 	}
 
 	storageFolders := api.host.StorageFolders()
 	folderIndex, err := folderIndex(folderPath, storageFolders)
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 
 	force := req.FormValue("force") == "true"
 	err = api.host.RemoveStorageFolder(folderIndex, force)
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 	WriteSuccess(w)
@@ -208,12 +208,12 @@ func (api *API) storageFoldersRemoveHandler(w http.ResponseWriter, req *http.Req
 func (api *API) storageSectorsDeleteHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	sectorRoot, err := scanHash(ps.ByName("merkleroot"))
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 	err = api.host.DeleteSector(sectorRoot)
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 	WriteSuccess(w)
@@ -49,7 +49,7 @@ func (api *API) minerStopHandler(w http.ResponseWriter, req *http.Request, _ htt
 func (api *API) minerHeaderHandlerGET(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	bhfw, target, err := api.miner.HeaderForWork()
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 	w.Write(encoding.MarshalAll(target, bhfw))
@@ -61,12 +61,12 @@ func (api *API) minerHeaderHandlerPOST(w http.ResponseWriter, req *http.Request,
 	var bh types.BlockHeader
 	err := encoding.NewDecoder(req.Body).Decode(&bh)
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 	err = api.miner.SubmitHeader(bh)
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 	WriteSuccess(w)
@@ -4,14 +4,27 @@ package api
 // zeroing them out.
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
+	"mime"
 	"net/http"
+	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/renter"
+	"github.com/NebulousLabs/Sia/modules/renter/contractor"
 	"github.com/NebulousLabs/Sia/types"
 
 	"github.com/julienschmidt/httprouter"
@@ -62,14 +75,81 @@ var (
 		Dev:      types.BlockHeight(1),
 		Testing:  types.BlockHeight(1),
 	}).(types.BlockHeight)
+
+	// uploadStreamInterval is the interval at which /renter/uploads/stream
+	// checks for changes in upload progress, and at which /renter/upload
+	// checks whether the first piece of a file has been placed.
+	uploadStreamInterval = build.Select(build.Var{
+		Standard: time.Second,
+		Dev:      time.Second,
+		Testing:  50 * time.Millisecond,
+	}).(time.Duration)
+
+	// uploadPlacementTimeout is how long /renter/upload waits for the first
+	// piece of a file to be placed when reportcontracts is set.
+	uploadPlacementTimeout = build.Select(build.Var{
+		Standard: 5 * time.Minute,
+		Dev:      time.Minute,
+		Testing:  20 * time.Second,
+	}).(time.Duration)
 )
 
+// errorCode returns the error code for an error returned by the renter, or the
+// empty string if the error does not have a code.
+func errorCode(err error) string {
+	switch err {
+	case renter.ErrEmptyFilename:
+		return ErrCodeEmptyFilename
+	case renter.ErrPathOverload:
+		return ErrCodePathOverload
+	case renter.ErrUnknownPath, renter.ErrDownloadUnknownPath:
+		return ErrCodeUnknownPath
+	case contractor.ErrInsufficientAllowance:
+		return ErrCodeInsufficientAllowance
+	case contractor.ErrAllowanceZeroWindow:
+		return ErrCodeZeroWindow
+	case contractor.ErrWalletLocked:
+		return ErrCodeWalletLocked
+	}
+	return ""
+}
+
 type (
 	// RenterGET contains various renter metrics.
 	RenterGET struct {
 		Settings         modules.RenterSettings `json:"settings"`
 		FinancialMetrics RenterFinancialMetrics `json:"financialmetrics"`
 		CurrentPeriod    types.BlockHeight      `json:"currentperiod"`
+
+		// ActiveContracts is the number of contracts the renter currently
+		// holds with online hosts, and TargetContracts is the number of
+		// hosts requested by the allowance. ContractsWarning is set when the
+		// renter holds fewer contracts than its allowance requests.
+		ActiveContracts  int  `json:"activecontracts"`
+		TargetContracts  int  `json:"targetcontracts"`
+		ContractsWarning bool `json:"contractswarning"`
+
+		// PeriodEnd is the height at which the contracts of the current
+		// period end, and BlocksRemaining is the number of blocks until then.
+		// RenewalPending is set once the current period has entered the
+		// allowance's renew window. All three are zero without an allowance.
+		PeriodEnd       types.BlockHeight `json:"periodend"`
+		BlocksRemaining types.BlockHeight `json:"blocksremaining"`
+		RenewalPending  bool              `json:"renewalpending"`
+
+		// UploadQueueDepth is the number of uploads waiting for a slot
+		// because the renter is already uploading
+		// Settings.MaxConcurrentUploads files.
+		UploadQueueDepth int `json:"uploadqueuedepth"`
+
+		// TotalStored is the sum of the sizes of the renter's files, and
+		// ContractedCapacity is the storage, in bytes, that the renter's
+		// contracts were paid for when they were formed or renewed.
+		// Utilization is TotalStored as a percentage of ContractedCapacity,
+		// or 0 if there is no capacity.
+		TotalStored        uint64  `json:"totalstored"`
+		ContractedCapacity uint64  `json:"contractedcapacity"`
+		Utilization        float64 `json:"utilization"`
 	}
 
 	// RenterFinancialMetrics contains metrics about how much the Renter has
@@ -85,21 +165,63 @@ type (
 
 		// Amount of money in the allowance that has not been spent.
 		Unspent types.Currency `json:"unspent"`
+
+		// Amount of money in the allowance that is held back as a safety
+		// margin when sizing contracts.
+		Reserved types.Currency `json:"reserved"`
+
+		// Amount of money in the allowance that was held back for upload and
+		// download costs when the current contracts were sized. Zero if the
+		// hosts did not charge for bandwidth.
+		BandwidthReserved types.Currency `json:"bandwidthreserved"`
 	}
 
 	// RenterContract represents a contract formed by the renter.
 	RenterContract struct {
+		BlocksRemaining types.BlockHeight    `json:"blocksremaining"`
 		EndHeight       types.BlockHeight    `json:"endheight"`
+		HostPublicKey   string               `json:"hostpublickey"`
 		ID              types.FileContractID `json:"id"`
 		LastTransaction types.Transaction    `json:"lasttransaction"`
 		NetAddress      modules.NetAddress   `json:"netaddress"`
 		RenterFunds     types.Currency       `json:"renterfunds"`
 		Size            uint64               `json:"size"`
+		WillRenew       bool                 `json:"willrenew"`
+
+		// Spending on the contract, broken down by category. RenterFunds plus
+		// each spending category adds up to TotalCost.
+		DownloadSpending types.Currency `json:"downloadspending"`
+		FeeSpending      types.Currency `json:"feespending"`
+		StorageSpending  types.Currency `json:"storagespending"`
+		UploadSpending   types.Currency `json:"uploadspending"`
+		TotalCost        types.Currency `json:"totalcost"`
 	}
 
-	// RenterContracts contains the renter's contracts.
+	// RenterContracts contains the renter's contracts. Failures lists the
+	// recent failed attempts to form contracts, and is only included if
+	// requested.
 	RenterContracts struct {
-		Contracts []RenterContract `json:"contracts"`
+		Contracts []RenterContract      `json:"contracts"`
+		Failures  []modules.HostFailure `json:"failures,omitempty"`
+	}
+
+	// NegotiationPhaseMetrics summarizes how long a phase of contract
+	// negotiation took across the renter's contracts.
+	NegotiationPhaseMetrics struct {
+		Min time.Duration `json:"min"`
+		Max time.Duration `json:"max"`
+		Avg time.Duration `json:"avg"`
+	}
+
+	// RenterContractsMetricsGET summarizes the negotiation phase durations of
+	// the renter's current contracts.
+	RenterContractsMetricsGET struct {
+		Contracts      int                     `json:"contracts"`
+		Dial           NegotiationPhaseMetrics `json:"dial"`
+		VerifySettings NegotiationPhaseMetrics `json:"verifysettings"`
+		FundAndSign    NegotiationPhaseMetrics `json:"fundandsign"`
+		Exchange       NegotiationPhaseMetrics `json:"exchange"`
+		Submit         NegotiationPhaseMetrics `json:"submit"`
 	}
 
 	// DownloadQueue contains the renter's download queue.
@@ -107,9 +229,61 @@ type (
 		Downloads []modules.DownloadInfo `json:"downloads"`
 	}
 
-	// RenterFiles lists the files known to the renter.
+	// RenterDownloadsClear contains the number of downloads removed from the
+	// download queue by /renter/downloads/clear.
+	RenterDownloadsClear struct {
+		Cleared int `json:"cleared"`
+	}
+
+	// RenterDelete contains the number of file entries removed by deleting a
+	// prefix.
+	RenterDelete struct {
+		Deleted int `json:"deleted"`
+	}
+
+	// RenterUploadPOST contains the contracts storing the first pieces of an
+	// uploaded file. It is only returned if reportcontracts was set.
+	RenterUploadPOST struct {
+		Contracts []types.FileContractID `json:"contracts"`
+	}
+
+	// RenterUploadDir contains the number of files queued by a recursive
+	// upload of a directory.
+	RenterUploadDir struct {
+		Queued int `json:"queued"`
+	}
+
+	// RenterUploadEvent is a single event sent by /renter/uploads/stream,
+	// reporting the progress of an upload.
+	RenterUploadEvent struct {
+		SiaPath        string  `json:"siapath"`
+		UploadProgress float64 `json:"uploadprogress"`
+		UploadedBytes  uint64  `json:"uploadedbytes"`
+	}
+
+	// RenterPricesGET contains the estimated prices of forming contracts with
+	// the current set of hosts.
+	RenterPricesGET struct {
+		modules.RenterPriceEstimation
+	}
+
+	// RenterEstimatePOST contains the estimated contracts returned by a dry
+	// run of POST /renter.
+	RenterEstimatePOST struct {
+		modules.RenterContractEstimate
+	}
+
+	// RenterFile describes a single file known to the renter.
+	RenterFile struct {
+		File modules.FileInfo `json:"file"`
+	}
+
+	// RenterFiles lists the files known to the renter. Total is the number of
+	// files known to the renter, which may be more than the number listed if
+	// the list was paginated.
 	RenterFiles struct {
 		Files []modules.FileInfo `json:"files"`
+		Total int                `json:"total"`
 	}
 
 	// RenterLoad lists files that were loaded into the renter.
@@ -117,6 +291,18 @@ type (
 		FilesAdded []string `json:"filesadded"`
 	}
 
+	// RenterRecoverable lists, for each file known to the renter, whether it
+	// can currently be reconstructed from the renter's live contracts.
+	RenterRecoverable struct {
+		Files []modules.FileRecoverability `json:"files"`
+	}
+
+	// RenterRepairPOST contains the number of files that were queued for
+	// repair.
+	RenterRepairPOST struct {
+		FilesNeedingRepair int `json:"filesneedingrepair"`
+	}
+
 	// RenterShareASCII contains an ASCII-encoded .sia file.
 	RenterShareASCII struct {
 		ASCIIsia string `json:"asciisia"`
@@ -124,13 +310,30 @@ type (
 
 	// ActiveHosts lists active hosts on the network.
 	ActiveHosts struct {
-		Hosts []modules.HostDBEntry `json:"hosts"`
+		Hosts []ExtendedHostDBEntry `json:"hosts"`
+	}
+
+	// ExtendedHostDBEntry is a host along with the score that the hostdb
+	// assigns to it when selecting hosts and the percentage of its recent
+	// scans that succeeded. Score is nil if the host has not been scored.
+	ExtendedHostDBEntry struct {
+		modules.HostDBEntry
+		Score  *types.Currency `json:"score,omitempty"`
+		Uptime float64         `json:"uptime"`
 	}
 
 	// AllHosts lists all hosts that the renter is aware of.
 	AllHosts struct {
 		Hosts []modules.HostDBEntry `json:"hosts"`
 	}
+
+	// RenterCachedAddressGET reports whether the renter is holding a
+	// negotiation address left over from a failed contract negotiation, and
+	// how many negotiations have reused it.
+	RenterCachedAddressGET struct {
+		Held   bool `json:"held"`
+		Reuses int  `json:"reuses"`
+	}
 )
 
 // renterHandlerGET handles the API call to /renter.
@@ -141,6 +344,8 @@ func (api *API) renterHandlerGET(w http.ResponseWriter, req *http.Request, _ htt
 	// AllContracts method to include contracts that are offline.
 	var fm RenterFinancialMetrics
 	fm.Unspent = settings.Allowance.Funds
+	fm.Reserved = api.renter.ReservedFunds()
+	fm.BandwidthReserved = api.renter.BandwidthReserve()
 	contracts := api.renter.(interface {
 		AllContracts() []modules.RenterContract
 	}).AllContracts()
@@ -159,20 +364,66 @@ func (api *API) renterHandlerGET(w http.ResponseWriter, req *http.Request, _ htt
 		}
 	}
 
+	// Contracts omits contracts whose hosts are offline, so they are not
+	// counted as active.
+	activeContracts := api.renter.Contracts()
+	active := len(activeContracts)
+	target := int(settings.Allowance.Hosts)
+
+	var stored, capacity uint64
+	for _, f := range api.renter.FileList() {
+		stored += f.Filesize
+	}
+	for _, c := range activeContracts {
+		// Contracts formed before their capacity was recorded are credited
+		// with the data they hold.
+		contractCapacity := c.Capacity
+		if held := uint64(len(c.MerkleRoots)) * modules.SectorSize; held > contractCapacity {
+			contractCapacity = held
+		}
+		capacity += contractCapacity
+	}
+	var utilization float64
+	if capacity != 0 {
+		utilization = 100 * float64(stored) / float64(capacity)
+	}
+
+	var periodEnd, remaining types.BlockHeight
+	if settings.Allowance.Period != 0 {
+		periodEnd = periodStart + settings.Allowance.Period
+		if height := api.cs.Height(); height < periodEnd {
+			remaining = periodEnd - height
+		}
+	}
+
 	WriteJSON(w, RenterGET{
 		Settings:         settings,
 		FinancialMetrics: fm,
 		CurrentPeriod:    periodStart,
+
+		ActiveContracts:  active,
+		TargetContracts:  target,
+		ContractsWarning: active < target,
+
+		PeriodEnd:       periodEnd,
+		BlocksRemaining: remaining,
+		RenewalPending:  settings.Allowance.Period != 0 && remaining <= settings.Allowance.RenewWindow,
+
+		UploadQueueDepth: api.renter.UploadQueueDepth(),
+
+		TotalStored:        stored,
+		ContractedCapacity: capacity,
+		Utilization:        utilization,
 	})
 }
 
-// renterHandlerPOST handles the API call to set the Renter's settings.
-func (api *API) renterHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+// scanAllowance parses the allowance in the form values of req. The returned
+// error, if any, is an Error.
+func scanAllowance(req *http.Request) (modules.Allowance, error) {
 	// Scan the allowance amount.
 	funds, ok := scanAmount(req.FormValue("funds"))
 	if !ok {
-		WriteError(w, Error{"unable to parse funds"}, http.StatusBadRequest)
-		return
+		return modules.Allowance{}, Error{Message: "unable to parse funds"}
 	}
 
 	// Scan the number of hosts to use. (optional parameter)
@@ -180,12 +431,10 @@ func (api *API) renterHandlerPOST(w http.ResponseWriter, req *http.Request, _ ht
 	if req.FormValue("hosts") != "" {
 		_, err := fmt.Sscan(req.FormValue("hosts"), &hosts)
 		if err != nil {
-			WriteError(w, Error{"unable to parse hosts: " + err.Error()}, http.StatusBadRequest)
-			return
+			return modules.Allowance{}, Error{Message: "unable to parse hosts: " + err.Error()}
 		}
 		if hosts != 0 && hosts < requiredHosts {
-			WriteError(w, Error{fmt.Sprintf("insufficient number of hosts, need at least %v but have %v", recommendedHosts, hosts)}, http.StatusBadRequest)
-			return
+			return modules.Allowance{}, Error{Message: fmt.Sprintf("insufficient number of hosts, need at least %v but have %v", recommendedHosts, hosts)}
 		}
 	} else {
 		hosts = recommendedHosts
@@ -195,8 +444,7 @@ func (api *API) renterHandlerPOST(w http.ResponseWriter, req *http.Request, _ ht
 	var period types.BlockHeight
 	_, err := fmt.Sscan(req.FormValue("period"), &period)
 	if err != nil {
-		WriteError(w, Error{"unable to parse period: " + err.Error()}, http.StatusBadRequest)
-		return
+		return modules.Allowance{}, Error{Message: "unable to parse period: " + err.Error()}
 	}
 
 	// Scan the renew window. (optional parameter)
@@ -204,55 +452,311 @@ func (api *API) renterHandlerPOST(w http.ResponseWriter, req *http.Request, _ ht
 	if req.FormValue("renewwindow") != "" {
 		_, err = fmt.Sscan(req.FormValue("renewwindow"), &renewWindow)
 		if err != nil {
-			WriteError(w, Error{"unable to parse renewwindow: " + err.Error()}, http.StatusBadRequest)
-			return
+			return modules.Allowance{}, Error{Message: "unable to parse renewwindow: " + err.Error()}
+		}
+		// A zero renew window is only valid when the allowance is being
+		// cancelled, which is signaled by a zero period.
+		if renewWindow == 0 && period != 0 {
+			return modules.Allowance{}, Error{Message: fmt.Sprintf("invalid renewwindow %v: renew window must be greater than 0", renewWindow), Code: ErrCodeZeroWindow}
+		}
+		if renewWindow != 0 && renewWindow >= period {
+			return modules.Allowance{}, Error{Message: fmt.Sprintf("invalid renewwindow %v: renew window must be less than the period of %v blocks", renewWindow, period)}
 		}
 		if renewWindow != 0 && renewWindow < requiredRenewWindow {
-			WriteError(w, Error{fmt.Sprintf("renew window is too small, must be at least %v blocks but have %v blocks", requiredRenewWindow, renewWindow)}, http.StatusBadRequest)
-			return
+			return modules.Allowance{}, Error{Message: fmt.Sprintf("renew window is too small, must be at least %v blocks but have %v blocks", requiredRenewWindow, renewWindow)}
 		}
 	} else {
 		renewWindow = period / 2
 	}
 
+	// Scan the maximum storage price. (optional parameter)
+	var maxPrice types.Currency
+	if req.FormValue("maxprice") != "" {
+		maxPrice, ok = scanAmount(req.FormValue("maxprice"))
+		if !ok {
+			return modules.Allowance{}, Error{Message: "unable to parse maxprice"}
+		}
+	}
+
+	return modules.Allowance{
+		Funds:            funds,
+		Hosts:            hosts,
+		Period:           period,
+		RenewWindow:      renewWindow,
+		MaxContractPrice: maxPrice,
+	}, nil
+}
+
+// renterHandlerPOST handles the API call to set the Renter's settings.
+func (api *API) renterHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	allowance, err := scanAllowance(req)
+	if err != nil {
+		WriteError(w, err.(Error), http.StatusBadRequest)
+		return
+	}
+
+	// If this is a dry run, estimate the contracts instead of forming them.
+	if req.FormValue("dryrun") == "true" {
+		estimate, err := api.renter.EstimateContracts(allowance)
+		if err != nil {
+			WriteError(w, Error{Message: err.Error(), Code: errorCode(err)}, http.StatusBadRequest)
+			return
+		}
+		WriteJSON(w, RenterEstimatePOST{
+			RenterContractEstimate: estimate,
+		})
+		return
+	}
+
+	settings := api.renter.Settings()
+
+	// Scan the maximum number of hosts. (optional parameter)
+	maxHosts := settings.MaxHosts
+	if req.FormValue("maxhosts") != "" {
+		_, err = fmt.Sscan(req.FormValue("maxhosts"), &maxHosts)
+		if err != nil {
+			WriteError(w, Error{Message: "unable to parse maxhosts: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Scan the funding margin. (optional parameter)
+	fundingMargin := settings.FundingMargin
+	if req.FormValue("fundingmargin") != "" {
+		fundingMargin, err = strconv.ParseFloat(req.FormValue("fundingmargin"), 64)
+		if err != nil {
+			WriteError(w, Error{Message: "unable to parse fundingmargin: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Scan the bandwidth reserve. (optional parameter)
+	bandwidthReserve := settings.BandwidthReserve
+	if req.FormValue("bandwidthreserve") != "" {
+		bandwidthReserve, err = strconv.ParseFloat(req.FormValue("bandwidthreserve"), 64)
+		if err != nil {
+			WriteError(w, Error{Message: "unable to parse bandwidthreserve: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Scan the upload concurrency limit. (optional parameter)
+	maxUploads := settings.MaxConcurrentUploads
+	if req.FormValue("maxconcurrentuploads") != "" {
+		var n uint64
+		_, err = fmt.Sscan(req.FormValue("maxconcurrentuploads"), &n)
+		if err != nil {
+			WriteError(w, Error{Message: "unable to parse maxconcurrentuploads: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		maxUploads = int(n)
+	}
+
+	// Scan the debug logging setting. (optional parameter)
+	debugLogging := settings.DebugLogging
+	if req.FormValue("debuglogging") != "" {
+		debugLogging, err = strconv.ParseBool(req.FormValue("debuglogging"))
+		if err != nil {
+			WriteError(w, Error{Message: "unable to parse debuglogging: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Set the settings in the renter.
 	err = api.renter.SetSettings(modules.RenterSettings{
-		Allowance: modules.Allowance{
-			Funds:       funds,
-			Hosts:       hosts,
-			Period:      period,
-			RenewWindow: renewWindow,
-		},
+		Allowance:            allowance,
+		MaxHosts:             maxHosts,
+		FundingMargin:        fundingMargin,
+		BandwidthReserve:     bandwidthReserve,
+		MaxConcurrentUploads: maxUploads,
+		DebugLogging:         debugLogging,
 	})
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error(), Code: errorCode(err)}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterValidateHandler handles the API call to check whether an allowance
+// could be set, without setting it.
+func (api *API) renterValidateHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	allowance, err := scanAllowance(req)
+	if err != nil {
+		WriteError(w, err.(Error), http.StatusBadRequest)
+		return
+	}
+	if err = api.renter.ValidateAllowance(allowance); err != nil {
+		WriteError(w, Error{Message: err.Error(), Code: errorCode(err)}, http.StatusBadRequest)
 		return
 	}
 	WriteSuccess(w)
 }
 
+// renterContractCancelHandler handles the API call to cancel a single
+// contract.
+func (api *API) renterContractCancelHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	id, err := scanHash(req.FormValue("id"))
+	if err != nil {
+		WriteError(w, Error{Message: "unable to parse id: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	err = api.renter.CancelContract(types.FileContractID(id))
+	if err != nil {
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterContract converts c into the RenterContract type returned by the API.
+func (api *API) renterContract(c modules.RenterContract, height types.BlockHeight) RenterContract {
+	var remaining types.BlockHeight
+	if c.EndHeight() > height {
+		remaining = c.EndHeight() - height
+	}
+	return RenterContract{
+		BlocksRemaining: remaining,
+		EndHeight:       c.EndHeight(),
+		HostPublicKey:   c.HostPublicKey.String(),
+		ID:              c.ID,
+		NetAddress:      c.NetAddress,
+		LastTransaction: c.LastRevisionTxn,
+		RenterFunds:     c.RenterFunds(),
+		Size:            c.LastRevision.NewFileSize,
+		WillRenew:       api.renter.WillRenew(c.ID),
+
+		DownloadSpending: c.DownloadSpending,
+		FeeSpending:      c.ContractFee.Add(c.TxnFee).Add(c.SiafundFee),
+		StorageSpending:  c.StorageSpending,
+		UploadSpending:   c.UploadSpending,
+		TotalCost:        c.TotalCost.Add(c.TxnFee),
+	}
+}
+
 // renterContractsHandler handles the API call to request the Renter's contracts.
-func (api *API) renterContractsHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+func (api *API) renterContractsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	failures := req.FormValue("failures") == "true"
+
+	height := api.cs.Height()
 	contracts := []RenterContract{}
 	for _, c := range api.renter.Contracts() {
-		contracts = append(contracts, RenterContract{
-			EndHeight:       c.EndHeight(),
-			ID:              c.ID,
-			NetAddress:      c.NetAddress,
-			LastTransaction: c.LastRevisionTxn,
-			RenterFunds:     c.RenterFunds(),
-			Size:            c.LastRevision.NewFileSize,
-		})
+		contracts = append(contracts, api.renterContract(c, height))
+	}
+	rc := RenterContracts{
+		Contracts: contracts,
+	}
+	if failures {
+		rc.Failures = api.renter.RecentFailures()
+	}
+	WriteJSON(w, rc)
+}
+
+// renterDebugCachedAddressHandler handles the API call to request the state of
+// the contractor's cached negotiation address. It is only available in debug
+// builds.
+func (api *API) renterDebugCachedAddressHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	held, reuses := api.renter.(interface {
+		CachedAddress() (bool, int)
+	}).CachedAddress()
+	WriteJSON(w, RenterCachedAddressGET{
+		Held:   held,
+		Reuses: reuses,
+	})
+}
+
+// renterContractsExpiringHandler handles the API call to request the
+// Renter's contracts whose proof window starts within a number of blocks.
+func (api *API) renterContractsExpiringHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var within types.BlockHeight
+	if _, err := fmt.Sscan(req.FormValue("within"), &within); err != nil {
+		WriteError(w, Error{Message: "unable to parse within: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	height := api.cs.Height()
+	contracts := []RenterContract{}
+	for _, c := range api.renter.ExpiringContracts(within) {
+		contracts = append(contracts, api.renterContract(c, height))
 	}
 	WriteJSON(w, RenterContracts{
 		Contracts: contracts,
 	})
 }
 
-// renterDownloadsHandler handles the API call to request the download queue.
-func (api *API) renterDownloadsHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+// summarizePhase returns the minimum, maximum, and average of durations.
+func summarizePhase(durations []time.Duration) NegotiationPhaseMetrics {
+	if len(durations) == 0 {
+		return NegotiationPhaseMetrics{}
+	}
+	pm := NegotiationPhaseMetrics{Min: durations[0], Max: durations[0]}
+	var total time.Duration
+	for _, d := range durations {
+		if d < pm.Min {
+			pm.Min = d
+		}
+		if d > pm.Max {
+			pm.Max = d
+		}
+		total += d
+	}
+	pm.Avg = total / time.Duration(len(durations))
+	return pm
+}
+
+// renterContractsMetricsHandler handles the API call to request the
+// negotiation metrics of the renter's contracts.
+func (api *API) renterContractsMetricsHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	metrics := api.renter.NegotiationMetrics()
+	var dial, verify, fundAndSign, exchange, submit []time.Duration
+	for _, m := range metrics {
+		dial = append(dial, m.Dial)
+		verify = append(verify, m.VerifySettings)
+		fundAndSign = append(fundAndSign, m.FundAndSign)
+		exchange = append(exchange, m.Exchange)
+		submit = append(submit, m.Submit)
+	}
+	WriteJSON(w, RenterContractsMetricsGET{
+		Contracts:      len(metrics),
+		Dial:           summarizePhase(dial),
+		VerifySettings: summarizePhase(verify),
+		FundAndSign:    summarizePhase(fundAndSign),
+		Exchange:       summarizePhase(exchange),
+		Submit:         summarizePhase(submit),
+	})
+}
+
+// renterDownloadsHandler handles the API call to request the download queue,
+// optionally filtered by download status.
+func (api *API) renterDownloadsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	status := req.FormValue("status")
+	switch status {
+	case "", modules.DownloadStatusActive, modules.DownloadStatusCompleted, modules.DownloadStatusErrored:
+	default:
+		WriteError(w, Error{Message: "status must be active, completed, or errored"}, http.StatusBadRequest)
+		return
+	}
+
+	downloads := api.renter.DownloadQueue()
+	if status != "" {
+		filtered := downloads[:0]
+		for _, d := range downloads {
+			if d.Status == status {
+				filtered = append(filtered, d)
+			}
+		}
+		downloads = filtered
+	}
 	WriteJSON(w, RenterDownloadQueue{
-		Downloads: api.renter.DownloadQueue(),
+		Downloads: downloads,
+	})
+}
+
+// renterDownloadsClearHandler handles the API call to remove completed and
+// errored downloads from the download queue.
+func (api *API) renterDownloadsClearHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	WriteJSON(w, RenterDownloadsClear{
+		Cleared: api.renter.ClearDownloads(),
 	})
 }
 
@@ -260,13 +764,13 @@ func (api *API) renterDownloadsHandler(w http.ResponseWriter, _ *http.Request, _
 func (api *API) renterLoadHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	source := req.FormValue("source")
 	if !filepath.IsAbs(source) {
-		WriteError(w, Error{"source must be an absolute path"}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "source must be an absolute path"}, http.StatusBadRequest)
 		return
 	}
 
 	files, err := api.renter.LoadSharedFiles(source)
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error(), Code: errorCode(err)}, http.StatusBadRequest)
 		return
 	}
 
@@ -278,7 +782,59 @@ func (api *API) renterLoadHandler(w http.ResponseWriter, req *http.Request, _ ht
 func (api *API) renterLoadAsciiHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	files, err := api.renter.LoadSharedFilesAscii(req.FormValue("asciisia"))
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error(), Code: errorCode(err)}, http.StatusBadRequest)
+		return
+	}
+
+	WriteJSON(w, RenterLoad{FilesAdded: files})
+}
+
+// renterBackupKey returns the key that encrypts renter backups, derived from
+// the wallet's primary seed.
+func (api *API) renterBackupKey() (crypto.TwofishKey, error) {
+	if api.wallet == nil {
+		return crypto.TwofishKey{}, errors.New("backups require the wallet module")
+	}
+	seed, _, err := api.wallet.PrimarySeed()
+	if err != nil {
+		return crypto.TwofishKey{}, err
+	}
+	return crypto.TwofishKey(crypto.HashAll("renter backup", seed)), nil
+}
+
+// renterBackupHandler handles the API call to stream an encrypted backup of
+// the renter's files and contracts.
+func (api *API) renterBackupHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	key, err := api.renterBackupKey()
+	if err != nil {
+		WriteError(w, Error{Message: "unable to create backup: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "renter.backup"}))
+	cw := &countingWriter{w: w}
+	err = api.renter.Backup(cw, key)
+	// If the backup fails partway through, the response is cut short, and
+	// restoring it will fail.
+	if err != nil && cw.n == 0 {
+		w.Header().Del("Content-Disposition")
+		WriteError(w, Error{Message: "unable to create backup: " + err.Error()}, http.StatusInternalServerError)
+	}
+}
+
+// renterRestoreHandler handles the API call to restore the renter's files and
+// contracts from a backup supplied in the request body.
+func (api *API) renterRestoreHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	key, err := api.renterBackupKey()
+	if err != nil {
+		WriteError(w, Error{Message: "unable to restore backup: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	files, err := api.renter.Restore(req.Body, key)
+	if err != nil {
+		WriteError(w, Error{Message: "unable to restore backup: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 
@@ -290,63 +846,463 @@ func (api *API) renterLoadAsciiHandler(w http.ResponseWriter, req *http.Request,
 func (api *API) renterRenameHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	err := api.renter.RenameFile(strings.TrimPrefix(ps.ByName("siapath"), "/"), req.FormValue("newsiapath"))
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error(), Code: errorCode(err)}, http.StatusBadRequest)
+		return
+	}
+
+	WriteSuccess(w)
+}
+
+// renterRepairHandler handles the API call to repair the renter's files, or
+// a single file, immediately.
+func (api *API) renterRepairHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	n, err := api.renter.Repair(req.FormValue("siapath"))
+	if err != nil {
+		WriteError(w, Error{Message: err.Error(), Code: errorCode(err)}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, RenterRepairPOST{
+		FilesNeedingRepair: n,
+	})
+}
+
+// renterUploadCancelHandler handles the API call to cancel an in-progress
+// upload.
+func (api *API) renterUploadCancelHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	err := api.renter.CancelUpload(strings.TrimPrefix(ps.ByName("siapath"), "/"))
+	if err != nil {
+		WriteError(w, Error{Message: err.Error(), Code: errorCode(err)}, http.StatusBadRequest)
 		return
 	}
 
 	WriteSuccess(w)
 }
 
-// renterFilesHandler handles the API call to list all of the files.
+// renterFileHandler handles the API call to return the status of a single
+// file.
+func (api *API) renterFileHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	file, err := api.renter.File(strings.TrimPrefix(ps.ByName("siapath"), "/"))
+	if err != nil {
+		WriteError(w, Error{Message: err.Error(), Code: errorCode(err)}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, RenterFile{
+		File: file,
+	})
+}
+
+// renterPricesHandler handles the API call to estimate the prices of forming
+// contracts with the current set of hosts.
+func (api *API) renterPricesHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	estimate, err := api.renter.PriceEstimation()
+	if err != nil {
+		WriteError(w, Error{Message: "unable to estimate prices: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, RenterPricesGET{
+		RenterPriceEstimation: estimate,
+	})
+}
+
+// sortedFiles is a list of files that can be sorted using the sort package.
+type sortedFiles struct {
+	files []modules.FileInfo
+	less  func(a, b modules.FileInfo) bool
+}
+
+// Len returns the number of files.
+func (sf sortedFiles) Len() int { return len(sf.files) }
+
+// Less returns whether file i should be listed before file j.
+func (sf sortedFiles) Less(i, j int) bool { return sf.less(sf.files[i], sf.files[j]) }
+
+// Swap swaps two files.
+func (sf sortedFiles) Swap(i, j int) { sf.files[i], sf.files[j] = sf.files[j], sf.files[i] }
+
+// fileSortKeys maps the keys that /renter/files can be sorted by to the
+// orderings they describe.
+var fileSortKeys = map[string]func(a, b modules.FileInfo) bool{
+	"siapath":        func(a, b modules.FileInfo) bool { return a.SiaPath < b.SiaPath },
+	"filesize":       func(a, b modules.FileInfo) bool { return a.Filesize < b.Filesize },
+	"uploadprogress": func(a, b modules.FileInfo) bool { return a.UploadProgress < b.UploadProgress },
+}
+
+// renterFilesHandler handles the API call to list all of the files. The files
+// are sorted by siapath unless another sort key is provided, and offset and
+// limit select a page of the sorted list. If the request's If-None-Match
+// header matches the current ETag of the list, 304 Not Modified is returned.
 func (api *API) renterFilesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var offset, limit uint64
+	if req.FormValue("offset") != "" {
+		if _, err := fmt.Sscan(req.FormValue("offset"), &offset); err != nil {
+			WriteError(w, Error{Message: "unable to parse offset: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	if req.FormValue("limit") != "" {
+		if _, err := fmt.Sscan(req.FormValue("limit"), &limit); err != nil {
+			WriteError(w, Error{Message: "unable to parse limit: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	sortKey := req.FormValue("sort")
+	if sortKey == "" {
+		sortKey = "siapath"
+	}
+	less, ok := fileSortKeys[sortKey]
+	if !ok {
+		WriteError(w, Error{Message: "invalid sort key " + strconv.Quote(sortKey) + "; must be siapath, filesize, or uploadprogress"}, http.StatusBadRequest)
+		return
+	}
+	order := req.FormValue("order")
+	if order != "" && order != "asc" && order != "desc" {
+		WriteError(w, Error{Message: "invalid order " + strconv.Quote(order) + "; must be asc or desc"}, http.StatusBadRequest)
+		return
+	}
+
+	// Sort by siapath first, so that files with equal sort keys are always
+	// listed in the same order.
+	files := api.renter.FileList()
+	sort.Sort(sortedFiles{files, fileSortKeys["siapath"]})
+
+	// Skip the response if the client already has it.
+	etag, err := filesETag(files, req.URL.RawQuery)
+	if err != nil {
+		WriteError(w, Error{Message: "unable to compute ETag: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	if etagMatches(req.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var sorter sort.Interface = sortedFiles{files, less}
+	if order == "desc" {
+		sorter = sort.Reverse(sorter)
+	}
+	sort.Stable(sorter)
+
+	// Select the requested page.
+	total := len(files)
+	if offset > uint64(len(files)) {
+		offset = uint64(len(files))
+	}
+	files = files[offset:]
+	if limit != 0 && limit < uint64(len(files)) {
+		files = files[:limit]
+	}
 	WriteJSON(w, RenterFiles{
-		Files: api.renter.FileList(),
+		Files: files,
+		Total: total,
 	})
 }
 
-// renterDeleteHandler handles the API call to delete a file entry from the
-// renter.
+// filesETag returns a weak ETag for a /renter/files response. The ETag is a
+// hash of every file's info, so it changes whenever a file is added, removed,
+// or updated, and of the query, which selects the page and its format.
+func filesETag(files []modules.FileInfo, query string) (string, error) {
+	b, err := json.Marshal(files)
+	if err != nil {
+		return "", err
+	}
+	return `W/"` + crypto.HashAll(b, query).String() + `"`, nil
+}
+
+// etagMatches reports whether the If-None-Match header matches etag. ETags are
+// compared weakly, as required for If-None-Match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// recoverabilityBySiaPath sorts file recoverability reports by siapath.
+type recoverabilityBySiaPath []modules.FileRecoverability
+
+func (fs recoverabilityBySiaPath) Len() int           { return len(fs) }
+func (fs recoverabilityBySiaPath) Less(i, j int) bool { return fs[i].SiaPath < fs[j].SiaPath }
+func (fs recoverabilityBySiaPath) Swap(i, j int)      { fs[i], fs[j] = fs[j], fs[i] }
+
+// renterRecoverableHandler handles the API call to report which files can
+// currently be recovered from the renter's live contracts. Files are sorted by
+// siapath.
+func (api *API) renterRecoverableHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	files := api.renter.Recoverable()
+	sort.Sort(recoverabilityBySiaPath(files))
+	WriteJSON(w, RenterRecoverable{
+		Files: files,
+	})
+}
+
+// uploadTracker records the last reported progress of each active upload, so
+// that only changes in progress are streamed.
+type uploadTracker struct {
+	progress map[string]float64
+	done     map[string]struct{}
+}
+
+// newUploadTracker returns an uploadTracker which ignores the files that have
+// already finished uploading.
+func newUploadTracker(files []modules.FileInfo) *uploadTracker {
+	ut := &uploadTracker{
+		progress: make(map[string]float64),
+		done:     make(map[string]struct{}),
+	}
+	for _, f := range files {
+		if f.UploadProgress >= 100 {
+			ut.done[f.SiaPath] = struct{}{}
+		}
+	}
+	return ut
+}
+
+// update returns an event for each upload whose progress has changed since
+// the last call. Uploads that have completed are reported one final time and
+// are then dropped.
+func (ut *uploadTracker) update(files []modules.FileInfo) []RenterUploadEvent {
+	var events []RenterUploadEvent
+	seen := make(map[string]struct{})
+	for _, f := range files {
+		seen[f.SiaPath] = struct{}{}
+		if _, done := ut.done[f.SiaPath]; done {
+			continue
+		}
+		if prev, exists := ut.progress[f.SiaPath]; exists && prev == f.UploadProgress {
+			continue
+		}
+		progress := f.UploadProgress
+		if progress > 100 {
+			progress = 100
+		}
+		events = append(events, RenterUploadEvent{
+			SiaPath:        f.SiaPath,
+			UploadProgress: progress,
+			UploadedBytes:  uint64(float64(f.Filesize) * progress / 100),
+		})
+		if progress >= 100 {
+			delete(ut.progress, f.SiaPath)
+			ut.done[f.SiaPath] = struct{}{}
+		} else {
+			ut.progress[f.SiaPath] = f.UploadProgress
+		}
+	}
+	// Stop tracking files that have been deleted.
+	for siaPath := range ut.progress {
+		if _, exists := seen[siaPath]; !exists {
+			delete(ut.progress, siaPath)
+		}
+	}
+	return events
+}
+
+// renterUploadsStreamHandler handles the API call to stream the progress of
+// active uploads as server-sent events. The stream remains open until the
+// client disconnects.
+func (api *API) renterUploadsStreamHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		WriteError(w, Error{Message: "streaming is not supported by this connection"}, http.StatusInternalServerError)
+		return
+	}
+	// Request.Context is not available in Go 1.6, so CloseNotifier is used
+	// to detect disconnecting clients.
+	var closeChan <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		closeChan = cn.CloseNotify()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	tracker := newUploadTracker(api.renter.FileList())
+	for {
+		for _, e := range tracker.update(api.renter.FileList()) {
+			b, err := json.Marshal(e)
+			if err != nil {
+				build.Critical("failed to encode upload event:", err)
+				return
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", b); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+
+		select {
+		case <-closeChan:
+			return
+		case <-time.After(uploadStreamInterval):
+		}
+	}
+}
+
+// renterDeleteHandler handles the API call to delete a file entry, or every
+// file entry beneath a prefix, from the renter.
 func (api *API) renterDeleteHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
-	err := api.renter.DeleteFile(strings.TrimPrefix(ps.ByName("siapath"), "/"))
+	siaPath := strings.TrimPrefix(ps.ByName("siapath"), "/")
+	if prefix := req.FormValue("prefix"); prefix != "" {
+		if siaPath != "" {
+			WriteError(w, Error{Message: "cannot delete a siapath and a prefix at the same time"}, http.StatusBadRequest)
+			return
+		}
+		deleted, err := api.renter.DeleteFolder(prefix)
+		if err != nil {
+			WriteError(w, Error{Message: err.Error(), Code: errorCode(err)}, http.StatusBadRequest)
+			return
+		}
+		WriteJSON(w, RenterDelete{Deleted: deleted})
+		return
+	}
+
+	err := api.renter.DeleteFile(siaPath)
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error(), Code: errorCode(err)}, http.StatusBadRequest)
 		return
 	}
 
 	WriteSuccess(w)
 }
 
-// renterDownloadHandler handles the API call to download a file.
+// renterDownloadHandler handles the API call to download a file. If no
+// destination is provided, the file is streamed in the response body.
 func (api *API) renterDownloadHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	siaPath := strings.TrimPrefix(ps.ByName("siapath"), "/")
+
+	// Parse the requested section of the file, if any.
+	var offset, length uint64
+	if req.FormValue("offset") != "" {
+		if _, err := fmt.Sscan(req.FormValue("offset"), &offset); err != nil {
+			WriteError(w, Error{Message: "unable to parse offset: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	if req.FormValue("length") != "" {
+		if _, err := fmt.Sscan(req.FormValue("length"), &length); err != nil {
+			WriteError(w, Error{Message: "unable to parse length: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
 	destination := req.FormValue("destination")
+	if destination == "" {
+		api.renterDownloadStream(w, siaPath, offset, length)
+		return
+	}
 	// Check that the destination path is absolute.
 	if !filepath.IsAbs(destination) {
-		WriteError(w, Error{"destination must be an absolute path"}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "destination must be an absolute path"}, http.StatusBadRequest)
 		return
 	}
 
-	err := api.renter.Download(strings.TrimPrefix(ps.ByName("siapath"), "/"), destination)
-	if err != nil {
-		WriteError(w, Error{"download failed: " + err.Error()}, http.StatusInternalServerError)
+	// Download the whole file unless a section was requested.
+	var err error
+	if req.FormValue("offset") == "" && req.FormValue("length") == "" {
+		err = api.renter.Download(siaPath, destination)
+	} else {
+		err = api.renter.DownloadSection(siaPath, destination, offset, length)
+	}
+	if err == renter.ErrDownloadOffset || err == renter.ErrDownloadLength {
+		WriteError(w, Error{Message: "download failed: " + err.Error(), Code: errorCode(err)}, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		WriteError(w, Error{Message: "download failed: " + err.Error(), Code: errorCode(err)}, http.StatusInternalServerError)
 		return
 	}
 
 	WriteSuccess(w)
 }
 
+// countingWriter is an io.Writer that counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n uint64
+}
+
+// Write writes p to the underlying writer.
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += uint64(n)
+	return n, err
+}
+
+// CloseNotify implements http.CloseNotifier if the underlying writer does, so
+// that a streaming download is aborted when its client goes away. Otherwise,
+// the returned channel never fires.
+func (cw *countingWriter) CloseNotify() <-chan bool {
+	if cn, ok := cw.w.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return nil
+}
+
+// renterDownloadStream downloads a section of a file and writes it to the
+// response body as it is recovered.
+func (api *API) renterDownloadStream(w http.ResponseWriter, siaPath string, offset, length uint64) {
+	// Determine the size of the response before any data is written.
+	var file modules.FileInfo
+	var exists bool
+	for _, fi := range api.renter.FileList() {
+		if fi.SiaPath == siaPath {
+			file, exists = fi, true
+			break
+		}
+	}
+	if !exists {
+		WriteError(w, Error{Message: "download failed: " + renter.ErrDownloadUnknownPath.Error(), Code: ErrCodeUnknownPath}, http.StatusBadRequest)
+		return
+	}
+	if offset >= file.Filesize {
+		WriteError(w, Error{Message: "download failed: " + renter.ErrDownloadOffset.Error()}, http.StatusBadRequest)
+		return
+	}
+	if length == 0 {
+		length = file.Filesize - offset
+	} else if length > file.Filesize-offset {
+		WriteError(w, Error{Message: "download failed: " + renter.ErrDownloadLength.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	// The headers are only sent once the first bytes of the file are written,
+	// so an error can still be reported if the download fails before then.
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatUint(length, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(siaPath)}))
+	cw := &countingWriter{w: w}
+	err := api.renter.DownloadStream(siaPath, cw, offset, length)
+	if err == nil {
+		return
+	}
+	// If the download fails partway through, the response is cut short, which
+	// the client can detect from the Content-Length.
+	if cw.n == 0 {
+		w.Header().Del("Content-Length")
+		w.Header().Del("Content-Disposition")
+		WriteError(w, Error{Message: "download failed: " + err.Error(), Code: errorCode(err)}, http.StatusInternalServerError)
+	}
+}
+
 // renterShareHandler handles the API call to create a '.sia' file that
 // shares a set of file.
 func (api *API) renterShareHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	destination := req.FormValue("destination")
 	// Check that the destination path is absolute.
 	if !filepath.IsAbs(destination) {
-		WriteError(w, Error{"destination must be an absolute path"}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "destination must be an absolute path"}, http.StatusBadRequest)
 		return
 	}
 
 	err := api.renter.ShareFiles(strings.Split(req.FormValue("siapaths"), ","), destination)
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error(), Code: errorCode(err)}, http.StatusBadRequest)
 		return
 	}
 
@@ -358,7 +1314,7 @@ func (api *API) renterShareHandler(w http.ResponseWriter, req *http.Request, ps
 func (api *API) renterShareAsciiHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	ascii, err := api.renter.ShareFilesAscii(strings.Split(req.FormValue("siapaths"), ","))
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error(), Code: errorCode(err)}, http.StatusBadRequest)
 		return
 	}
 	WriteJSON(w, RenterShareASCII{
@@ -370,7 +1326,7 @@ func (api *API) renterShareAsciiHandler(w http.ResponseWriter, req *http.Request
 func (api *API) renterUploadHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	source := req.FormValue("source")
 	if !filepath.IsAbs(source) {
-		WriteError(w, Error{"source must be an absolute path"}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "source must be an absolute path"}, http.StatusBadRequest)
 		return
 	}
 
@@ -379,7 +1335,7 @@ func (api *API) renterUploadHandler(w http.ResponseWriter, req *http.Request, ps
 	if req.FormValue("datapieces") != "" || req.FormValue("paritypieces") != "" {
 		// Check that both values have been supplied.
 		if req.FormValue("datapieces") == "" || req.FormValue("paritypieces") == "" {
-			WriteError(w, Error{"must provide both the datapieces paramaeter and the paritypieces parameter if specifying erasure coding parameters"}, http.StatusBadRequest)
+			WriteError(w, Error{Message: "must provide both the datapieces paramaeter and the paritypieces parameter if specifying erasure coding parameters"}, http.StatusBadRequest)
 			return
 		}
 
@@ -387,53 +1343,263 @@ func (api *API) renterUploadHandler(w http.ResponseWriter, req *http.Request, ps
 		var dataPieces, parityPieces int
 		_, err := fmt.Sscan(req.FormValue("datapieces"), &dataPieces)
 		if err != nil {
-			WriteError(w, Error{"unable to read parameter 'datapieces': " + err.Error()}, http.StatusBadRequest)
+			WriteError(w, Error{Message: "unable to read parameter 'datapieces': " + err.Error()}, http.StatusBadRequest)
 			return
 		}
 		_, err = fmt.Sscan(req.FormValue("paritypieces"), &parityPieces)
 		if err != nil {
-			WriteError(w, Error{"unable to read parameter 'paritypieces': " + err.Error()}, http.StatusBadRequest)
+			WriteError(w, Error{Message: "unable to read parameter 'paritypieces': " + err.Error()}, http.StatusBadRequest)
 			return
 		}
 
-		// Verify that sane values for parityPieces and redundancy are being
-		// supplied.
+		// Verify that sane values for dataPieces, parityPieces, and
+		// redundancy are being supplied.
+		if dataPieces < 1 {
+			WriteError(w, Error{Message: renter.ErrZeroDataPieces.Error()}, http.StatusBadRequest)
+			return
+		}
 		if parityPieces < requiredParityPieces {
-			WriteError(w, Error{fmt.Sprintf("a minimum of %v parity pieces is required, but %v parity pieces requested", parityPieces, requiredParityPieces)}, http.StatusBadRequest)
+			WriteError(w, Error{Message: fmt.Sprintf("a minimum of %v parity pieces is required, but %v parity pieces requested", parityPieces, requiredParityPieces)}, http.StatusBadRequest)
 			return
 		}
 		redundancy := float64(dataPieces+parityPieces) / float64(dataPieces)
 		if float64(dataPieces+parityPieces)/float64(dataPieces) < requiredRedundancy {
-			WriteError(w, Error{fmt.Sprintf("a redundancy of %.2f is required, but redundancy of %.2f supplied", redundancy, requiredRedundancy)}, http.StatusBadRequest)
+			WriteError(w, Error{Message: fmt.Sprintf("a redundancy of %.2f is required, but redundancy of %.2f supplied", redundancy, requiredRedundancy)}, http.StatusBadRequest)
 			return
 		}
 
 		// Create the erasure coder.
 		ec, err = renter.NewRSCode(dataPieces, parityPieces)
 		if err != nil {
-			WriteError(w, Error{"unable to encode file using the provided parameters: " + err.Error()}, http.StatusBadRequest)
+			WriteError(w, Error{Message: "unable to encode file using the provided parameters: " + err.Error()}, http.StatusBadRequest)
 			return
 		}
 	}
 
+	// Parse the hosts that the upload is pinned to, if any.
+	var hosts []types.SiaPublicKey
+	if req.FormValue("hosts") != "" {
+		for _, s := range strings.Split(req.FormValue("hosts"), ",") {
+			var pk types.SiaPublicKey
+			if err := pk.LoadString(strings.TrimSpace(s)); err != nil {
+				WriteError(w, Error{Message: "unable to parse hosts: " + err.Error()}, http.StatusBadRequest)
+				return
+			}
+			hosts = append(hosts, pk)
+		}
+	}
+
+	up := modules.FileUploadParams{
+		Source:         source,
+		SiaPath:        strings.TrimPrefix(ps.ByName("siapath"), "/"),
+		ErasureCode:    ec,
+		IdempotencyKey: req.FormValue("idempotencykey"),
+		Hosts:          hosts,
+	}
+
+	// Directories are only uploaded if a recursive upload was requested, in
+	// which case every file in the directory is uploaded.
+	if info, err := os.Stat(source); err == nil && info.IsDir() {
+		if req.FormValue("recursive") != "true" {
+			WriteError(w, Error{Message: "source is a directory; set recursive to true to upload it"}, http.StatusBadRequest)
+			return
+		}
+		queued, err := api.uploadDir(up)
+		if err != nil {
+			WriteError(w, Error{Message: fmt.Sprintf("upload failed after queueing %v files: %v", queued, err)}, http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, RenterUploadDir{Queued: queued})
+		return
+	}
+
 	// Call the renter to upload the file.
-	err := api.renter.Upload(modules.FileUploadParams{
-		Source:      source,
-		SiaPath:     strings.TrimPrefix(ps.ByName("siapath"), "/"),
-		ErasureCode: ec,
-	})
+	err := api.renter.Upload(up)
 	if err != nil {
-		WriteError(w, Error{"upload failed: " + err.Error()}, http.StatusInternalServerError)
+		WriteError(w, Error{Message: "upload failed: " + err.Error(), Code: errorCode(err)}, http.StatusInternalServerError)
+		return
+	}
+	if req.FormValue("reportcontracts") == "true" {
+		contracts, err := api.waitForPlacement(up.SiaPath)
+		if err != nil {
+			WriteError(w, Error{Message: "upload failed: " + err.Error(), Code: errorCode(err)}, http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, RenterUploadPOST{Contracts: contracts})
 		return
 	}
 	WriteSuccess(w)
 }
 
+// waitForPlacement blocks until at least one piece of the file at siaPath has
+// been uploaded, and returns the contracts storing the file's pieces. If no
+// piece is placed within uploadPlacementTimeout, an empty list is returned;
+// the upload continues in the background.
+func (api *API) waitForPlacement(siaPath string) ([]types.FileContractID, error) {
+	deadline := time.After(uploadPlacementTimeout)
+	for {
+		file, err := api.renter.File(siaPath)
+		if err != nil {
+			return nil, err
+		}
+		if len(file.Contracts) > 0 {
+			return file.Contracts, nil
+		}
+		if file.UploadError != "" {
+			return nil, errors.New(file.UploadError)
+		}
+		select {
+		case <-deadline:
+			return []types.FileContractID{}, nil
+		case <-time.After(uploadStreamInterval):
+		}
+	}
+}
+
+// uploadDir uploads every regular file under the directory dir.Source, using
+// dir.SiaPath joined with the file's path relative to the directory as the
+// file's siapath. The remaining upload params are used for every file, except
+// that a non-empty idempotency key is extended with the file's relative path.
+// Symlinks are skipped. The number of files queued for upload is returned.
+func (api *API) uploadDir(dir modules.FileUploadParams) (queued int, err error) {
+	err = filepath.Walk(dir.Source, func(source string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir.Source, source)
+		if err != nil {
+			return err
+		}
+		up := dir
+		up.Source = source
+		up.SiaPath = path.Join(dir.SiaPath, filepath.ToSlash(rel))
+		if dir.IdempotencyKey != "" {
+			up.IdempotencyKey = dir.IdempotencyKey + "/" + filepath.ToSlash(rel)
+		}
+		err = api.renter.Upload(up)
+		if err != nil {
+			return fmt.Errorf("%v: %v", source, err)
+		}
+		queued++
+		return nil
+	})
+	return queued, err
+}
+
+// hostFilter restricts the hosts returned by /hostdb/active to those that are
+// affordable and have enough remaining storage. Nil price ceilings are not
+// applied.
+type hostFilter struct {
+	maxContractPrice    *types.Currency
+	maxStoragePrice     *types.Currency
+	minRemainingStorage uint64
+}
+
+// parseHostFilter parses a hostFilter from the query string of req.
+func parseHostFilter(req *http.Request) (hostFilter, error) {
+	var hf hostFilter
+	prices := []struct {
+		name  string
+		price **types.Currency
+	}{
+		{"maxcontractprice", &hf.maxContractPrice},
+		{"maxstorageprice", &hf.maxStoragePrice},
+	}
+	for _, p := range prices {
+		if req.FormValue(p.name) == "" {
+			continue
+		}
+		i, ok := new(big.Int).SetString(req.FormValue(p.name), 10)
+		if !ok || i.Sign() < 0 {
+			return hostFilter{}, errors.New("unable to parse " + p.name)
+		}
+		price := types.NewCurrency(i)
+		*p.price = &price
+	}
+	if req.FormValue("minremainingstorage") != "" {
+		_, err := fmt.Sscan(req.FormValue("minremainingstorage"), &hf.minRemainingStorage)
+		if err != nil {
+			return hostFilter{}, errors.New("unable to parse minremainingstorage: " + err.Error())
+		}
+	}
+	return hf, nil
+}
+
+// apply returns the hosts that pass the filter, preserving their order.
+func (hf hostFilter) apply(hosts []modules.HostDBEntry) []modules.HostDBEntry {
+	filtered := make([]modules.HostDBEntry, 0, len(hosts))
+	for _, host := range hosts {
+		if hf.maxContractPrice != nil && host.ContractPrice.Cmp(*hf.maxContractPrice) > 0 {
+			continue
+		}
+		if hf.maxStoragePrice != nil && host.StoragePrice.Cmp(*hf.maxStoragePrice) > 0 {
+			continue
+		}
+		if host.RemainingStorage < hf.minRemainingStorage {
+			continue
+		}
+		filtered = append(filtered, host)
+	}
+	return filtered
+}
+
+// sortedHosts is a list of hosts that can be sorted by score using the sort
+// package. Hosts with higher scores are listed first, and hosts without scores
+// are listed last.
+type sortedHosts []ExtendedHostDBEntry
+
+// Len returns the number of hosts.
+func (sh sortedHosts) Len() int { return len(sh) }
+
+// Less returns whether host i should be listed before host j.
+func (sh sortedHosts) Less(i, j int) bool {
+	if sh[i].Score == nil || sh[j].Score == nil {
+		return sh[j].Score == nil && sh[i].Score != nil
+	}
+	return sh[i].Score.Cmp(*sh[j].Score) > 0
+}
+
+// Swap swaps two hosts.
+func (sh sortedHosts) Swap(i, j int) { sh[i], sh[j] = sh[j], sh[i] }
+
+// extendHostDBEntry adds the host's score and uptime to a HostDBEntry.
+func (api *API) extendHostDBEntry(host modules.HostDBEntry) ExtendedHostDBEntry {
+	entry := ExtendedHostDBEntry{
+		HostDBEntry: host,
+		Uptime:      host.ScanHistory.Uptime(),
+	}
+	if score, ok := api.renter.HostWeight(host.PublicKey); ok {
+		entry.Score = &score
+	}
+	return entry
+}
+
 // renterHostsActiveHandler handles the API call asking for the list of active
 // hosts.
 func (api *API) renterHostsActiveHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	hf, err := parseHostFilter(req)
+	if err != nil {
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	sortKey := req.FormValue("sort")
+	if sortKey != "" && sortKey != "score" {
+		WriteError(w, Error{Message: "invalid sort key " + strconv.Quote(sortKey) + "; must be score"}, http.StatusBadRequest)
+		return
+	}
+
 	var numHosts uint64
-	hosts := api.renter.ActiveHosts()
+	activeHosts := hf.apply(api.renter.ActiveHosts())
+	hosts := make([]ExtendedHostDBEntry, 0, len(activeHosts))
+	for _, host := range activeHosts {
+		hosts = append(hosts, api.extendHostDBEntry(host))
+	}
+	if sortKey == "score" {
+		sort.Stable(sortedHosts(hosts))
+	}
 
 	if req.FormValue("numhosts") == "" {
 		// Default value for 'numhosts' is all of them.
@@ -442,7 +1608,7 @@ func (api *API) renterHostsActiveHandler(w http.ResponseWriter, req *http.Reques
 		// Parse the value for 'numhosts'.
 		_, err := fmt.Sscan(req.FormValue("numhosts"), &numHosts)
 		if err != nil {
-			WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+			WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 			return
 		}
 
@@ -463,3 +1629,21 @@ func (api *API) renterHostsAllHandler(w http.ResponseWriter, req *http.Request,
 		Hosts: api.renter.AllHosts(),
 	})
 }
+
+// renterHostHandler handles the API call asking for the details of a single
+// host, identified by its public key.
+func (api *API) renterHostHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var pk types.SiaPublicKey
+	if err := pk.LoadString(ps.ByName("pubkey")); err != nil {
+		WriteError(w, Error{Message: "unable to parse public key: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	for _, host := range api.renter.AllHosts() {
+		if host.PublicKey.Algorithm != pk.Algorithm || !bytes.Equal(host.PublicKey.Key, pk.Key) {
+			continue
+		}
+		WriteJSON(w, api.extendHostDBEntry(host))
+		return
+	}
+	WriteError(w, Error{Message: "no host with public key " + pk.String()}, http.StatusNotFound)
+}
@@ -1,8 +1,14 @@
 package api
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/url"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -11,6 +17,7 @@ import (
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/renter"
 	"github.com/NebulousLabs/Sia/modules/renter/contractor"
 	"github.com/NebulousLabs/Sia/types"
@@ -124,9 +131,9 @@ func TestRenterConflicts(t *testing.T) {
 
 	// Upload using the same nickname.
 	err = st.stdPostAPI("/renter/upload/foo/bar.sia/test", uploadValues)
-	expectedErr := Error{"upload failed: " + renter.ErrPathOverload.Error()}
+	expectedErr := Error{Message: "upload failed: " + renter.ErrPathOverload.Error(), Code: ErrCodePathOverload}
 	if err != expectedErr {
-		t.Fatalf("expected %v, got %v", Error{"upload failed: " + renter.ErrPathOverload.Error()}, err)
+		t.Fatalf("expected %v, got %v", expectedErr, err)
 	}
 
 	// Upload using nickname that conflicts with folder.
@@ -226,6 +233,198 @@ func TestRenterHostsActiveHandler(t *testing.T) {
 	}
 }
 
+// TestRenterHostsActiveFilter checks that /hostdb/active can be filtered by
+// price and remaining storage.
+func TestRenterHostsActiveFilter(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterHostsActiveFilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+	stH1, err := blankServerTester("TestRenterHostsActiveFilter - Host 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stH1.server.Close()
+	testGroup := []*serverTester{st, stH1}
+	if err = fullyConnectNodes(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = fundAllNodes(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = addStorageToAllHosts(testGroup); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make the second host more expensive, and give it more storage.
+	priceValues := url.Values{}
+	priceValues.Set("mincontractprice", "1000")
+	priceValues.Set("minstorageprice", "100")
+	if err = st.stdPostAPI("/host", priceValues); err != nil {
+		t.Fatal(err)
+	}
+	priceValues.Set("mincontractprice", "2000")
+	priceValues.Set("minstorageprice", "200")
+	if err = stH1.stdPostAPI("/host", priceValues); err != nil {
+		t.Fatal(err)
+	}
+	extraDir := filepath.Join(stH1.dir, "extra")
+	if err = os.MkdirAll(extraDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err = stH1.stdPostAPI("/host/storage/folders/add", url.Values{"path": {extraDir}, "size": {"1048576"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = announceAllHosts(testGroup); err != nil {
+		t.Fatal(err)
+	}
+
+	// Determine the settings of each host.
+	var ah ActiveHosts
+	if err = st.getAPI("/hostdb/active", &ah); err != nil {
+		t.Fatal(err)
+	}
+	if len(ah.Hosts) != 2 {
+		t.Fatal("expected 2 active hosts, got", len(ah.Hosts))
+	}
+	cheap, expensive := ah.Hosts[0], ah.Hosts[1]
+	if cheap.StoragePrice.Cmp(expensive.StoragePrice) > 0 {
+		cheap, expensive = expensive, cheap
+	}
+	if cheap.ContractPrice.Cmp(expensive.ContractPrice) >= 0 || cheap.RemainingStorage >= expensive.RemainingStorage {
+		t.Fatal("hosts were not announced with the expected settings:", cheap.HostExternalSettings, expensive.HostExternalSettings)
+	}
+
+	tests := []struct {
+		query    string
+		expected []modules.NetAddress
+	}{
+		{"", []modules.NetAddress{cheap.NetAddress, expensive.NetAddress}},
+		{"maxcontractprice=" + cheap.ContractPrice.String(), []modules.NetAddress{cheap.NetAddress}},
+		{"maxstorageprice=" + cheap.StoragePrice.String(), []modules.NetAddress{cheap.NetAddress}},
+		{"maxstorageprice=0", nil},
+		{"maxstorageprice=" + expensive.StoragePrice.String(), []modules.NetAddress{cheap.NetAddress, expensive.NetAddress}},
+		{fmt.Sprintf("minremainingstorage=%v", expensive.RemainingStorage), []modules.NetAddress{expensive.NetAddress}},
+		{fmt.Sprintf("minremainingstorage=%v&maxstorageprice=%v", expensive.RemainingStorage, cheap.StoragePrice), nil},
+	}
+	for _, test := range tests {
+		if err = st.getAPI("/hostdb/active?"+test.query, &ah); err != nil {
+			t.Fatal(err)
+		}
+		if len(ah.Hosts) != len(test.expected) {
+			t.Errorf("%q: expected %v hosts, got %v", test.query, len(test.expected), len(ah.Hosts))
+			continue
+		}
+		found := make(map[modules.NetAddress]bool)
+		for _, host := range ah.Hosts {
+			found[host.NetAddress] = true
+		}
+		for _, addr := range test.expected {
+			if !found[addr] {
+				t.Errorf("%q: expected %v to be returned", test.query, addr)
+			}
+		}
+	}
+
+	// The filter should be applied before numhosts.
+	if err = st.getAPI("/hostdb/active?numhosts=1&maxcontractprice="+cheap.ContractPrice.String(), &ah); err != nil {
+		t.Fatal(err)
+	}
+	if len(ah.Hosts) != 1 || ah.Hosts[0].NetAddress != cheap.NetAddress {
+		t.Error("expected only the cheap host to be returned, got", ah.Hosts)
+	}
+
+	// Invalid values should be rejected.
+	for _, query := range []string{"maxcontractprice=-1", "maxstorageprice=abc", "minremainingstorage=-1"} {
+		if err = st.getAPI("/hostdb/active?"+query, &ah); err == nil {
+			t.Errorf("%q: expecting an error", query)
+		}
+	}
+}
+
+// TestRenterHostsActiveSort checks that /hostdb/active reports the score of
+// each host and can sort the hosts by score.
+func TestRenterHostsActiveSort(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterHostsActiveSort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+	stH1, err := blankServerTester("TestRenterHostsActiveSort - Host 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stH1.server.Close()
+	testGroup := []*serverTester{st, stH1}
+	if err = fullyConnectNodes(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = fundAllNodes(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = addStorageToAllHosts(testGroup); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make the second host much more expensive, so that it scores lower.
+	priceValues := url.Values{}
+	priceValues.Set("mincontractprice", "1000")
+	priceValues.Set("minstorageprice", "100")
+	if err = st.stdPostAPI("/host", priceValues); err != nil {
+		t.Fatal(err)
+	}
+	priceValues.Set("mincontractprice", "100000")
+	priceValues.Set("minstorageprice", "100000")
+	if err = stH1.stdPostAPI("/host", priceValues); err != nil {
+		t.Fatal(err)
+	}
+	if err = announceAllHosts(testGroup); err != nil {
+		t.Fatal(err)
+	}
+
+	var ah ActiveHosts
+	if err = st.getAPI("/hostdb/active?sort=score", &ah); err != nil {
+		t.Fatal(err)
+	}
+	if len(ah.Hosts) != 2 {
+		t.Fatal("expected 2 active hosts, got", len(ah.Hosts))
+	}
+	for _, host := range ah.Hosts {
+		if host.Score == nil || host.Score.IsZero() {
+			t.Fatal("expected every active host to have a score:", host.NetAddress)
+		}
+	}
+	if ah.Hosts[0].Score.Cmp(*ah.Hosts[1].Score) <= 0 {
+		t.Error("hosts were not sorted by descending score:", ah.Hosts[0].Score, ah.Hosts[1].Score)
+	}
+	if ah.Hosts[0].StoragePrice.Cmp(ah.Hosts[1].StoragePrice) >= 0 {
+		t.Error("expected the cheaper host to have the higher score")
+	}
+
+	// Sorting should happen before numhosts is applied.
+	best := ah.Hosts[0].NetAddress
+	if err = st.getAPI("/hostdb/active?sort=score&numhosts=1", &ah); err != nil {
+		t.Fatal(err)
+	}
+	if len(ah.Hosts) != 1 || ah.Hosts[0].NetAddress != best {
+		t.Error("expected only the highest scoring host to be returned, got", ah.Hosts)
+	}
+
+	// Unknown sort keys should be rejected.
+	if err = st.getAPI("/hostdb/active?sort=price", &ah); err == nil {
+		t.Error("expecting an error for an unknown sort key")
+	}
+}
+
 // TestRenterHostsAllHandler checks that announcing a host adds it to the list
 // of all hosts.
 func TestRenterHostsAllHandler(t *testing.T) {
@@ -259,6 +458,66 @@ func TestRenterHostsAllHandler(t *testing.T) {
 	}
 }
 
+// TestRenterHostHandler checks that a single host can be looked up by its
+// public key.
+func TestRenterHostHandler(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterHostHandler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and look it up by the key reported in /hostdb/all.
+	if err = st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	var ah AllHosts
+	if err = st.getAPI("/hostdb/all", &ah); err != nil {
+		t.Fatal(err)
+	}
+	if len(ah.Hosts) != 1 {
+		t.Fatalf("expected 1 host, got %v", len(ah.Hosts))
+	}
+	pk := ah.Hosts[0].PublicKey
+	var host ExtendedHostDBEntry
+	if err = st.getAPI("/hostdb/host/"+pk.String(), &host); err != nil {
+		t.Fatal(err)
+	}
+	settings := st.host.ExternalSettings()
+	if host.PublicKey.String() != pk.String() {
+		t.Error("wrong host returned:", host.PublicKey.String())
+	}
+	if host.NetAddress != settings.NetAddress || host.StoragePrice.Cmp(settings.StoragePrice) != 0 || host.MaxDuration != settings.MaxDuration {
+		t.Errorf("returned settings do not match the host's: %v %v", host.HostExternalSettings, settings)
+	}
+	if len(host.ScanHistory) == 0 {
+		t.Error("expected the host to have been scanned")
+	}
+	if host.Score == nil {
+		t.Error("expected the active host to have a score")
+	}
+
+	// Looking up an unknown host should return a 404.
+	unknown := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: make([]byte, 32)}
+	resp, err := HttpGET("http://" + st.server.listener.Addr().String() + "/hostdb/host/" + unknown.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Error("expected 404 for an unknown host, got", resp.Status)
+	}
+
+	// Malformed keys should be rejected.
+	if err = st.getAPI("/hostdb/host/foo", &host); err == nil {
+		t.Error("expected an error for a malformed public key")
+	}
+}
+
 // TestRenterHandlerContracts checks that contract formation between a host and
 // renter behaves as expected, and that contract spending is the right amount.
 func TestRenterHandlerContracts(t *testing.T) {
@@ -322,21 +581,21 @@ func TestRenterHandlerContracts(t *testing.T) {
 	}
 }
 
-// TestRenterHandlerGetAndPost checks that valid /renter calls successfully set
-// allowance values, while /renter calls with invalid allowance values are
-// correctly handled.
-func TestRenterHandlerGetAndPost(t *testing.T) {
+// TestRenterContractsEndHeight checks that /renter/contracts reports the end
+// height negotiated for each contract, along with how long until the contract
+// ends and whether it will be renewed.
+func TestRenterContractsEndHeight(t *testing.T) {
 	if testing.Short() {
 		t.SkipNow()
 	}
 	t.Parallel()
-	st, err := createServerTester("TestRenterHandlerGetAndPost")
+	st, err := createServerTester("TestRenterContractsEndHeight")
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer st.server.Close()
 
-	// Anounce the host and start accepting contracts.
+	// Announce the host and form a contract with it.
 	if err := st.announceHost(); err != nil {
 		t.Fatal(err)
 	}
@@ -346,8 +605,6 @@ func TestRenterHandlerGetAndPost(t *testing.T) {
 	if err = st.setHostStorage(); err != nil {
 		t.Fatal(err)
 	}
-
-	// Set an allowance for the renter, allowing a contract to be formed.
 	allowanceValues := url.Values{}
 	allowanceValues.Set("funds", testFunds)
 	allowanceValues.Set("period", testPeriod)
@@ -355,85 +612,1259 @@ func TestRenterHandlerGetAndPost(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// Check that a call to /renter returns the expected values.
-	var get RenterGET
-	if err = st.getAPI("/renter", &get); err != nil {
+	var rc RenterContracts
+	if err = st.getAPI("/renter/contracts", &rc); err != nil {
 		t.Fatal(err)
 	}
-	// Check the renter's funds.
-	expectedFunds, ok := scanAmount(testFunds)
-	if !ok {
-		t.Fatal("scanAmount failed")
+	if len(rc.Contracts) != 1 {
+		t.Fatalf("expected renter to have 1 contract; got %v", len(rc.Contracts))
 	}
-	if got := get.Settings.Allowance.Funds; got.Cmp(expectedFunds) != 0 {
-		t.Fatalf("expected funds to be %v; got %v", expectedFunds, got)
+	contracts := st.renter.Contracts()
+	if len(contracts) != 1 {
+		t.Fatalf("expected renter to have 1 contract; got %v", len(contracts))
 	}
-	// Check the renter's period.
-	intPeriod, err := strconv.Atoi(testPeriod)
-	if err != nil {
+	contract := rc.Contracts[0]
+	if contract.EndHeight != contracts[0].FileContract.WindowStart {
+		t.Fatalf("expected end height to be %v; got %v", contracts[0].FileContract.WindowStart, contract.EndHeight)
+	}
+	if height := st.cs.Height(); contract.BlocksRemaining != contract.EndHeight-height {
+		t.Fatalf("expected %v blocks remaining; got %v", contract.EndHeight-height, contract.BlocksRemaining)
+	}
+	if !contract.WillRenew {
+		t.Fatal("expected contract to be renewed")
+	}
+
+	// Mining a block should bring the contract one block closer to its end.
+	if _, err = st.miner.AddBlock(); err != nil {
 		t.Fatal(err)
 	}
-	expectedPeriod := types.BlockHeight(intPeriod)
-	if got := get.Settings.Allowance.Period; got != expectedPeriod {
-		t.Fatalf("expected period to be %v; got %v", expectedPeriod, got)
+	if err = st.getAPI("/renter/contracts", &rc); err != nil {
+		t.Fatal(err)
 	}
-	// Check the renter's renew window.
-	expectedRenewWindow := expectedPeriod / 2
-	if got := get.Settings.Allowance.RenewWindow; got != expectedRenewWindow {
-		t.Fatalf("expected renew window to be %v; got %v", expectedRenewWindow, got)
+	if len(rc.Contracts) != 1 {
+		t.Fatalf("expected renter to have 1 contract; got %v", len(rc.Contracts))
 	}
+	if rc.Contracts[0].BlocksRemaining != contract.BlocksRemaining-1 {
+		t.Fatalf("expected %v blocks remaining; got %v", contract.BlocksRemaining-1, rc.Contracts[0].BlocksRemaining)
+	}
+}
 
-	// Try an empty funds string.
-	allowanceValues = url.Values{}
-	allowanceValues.Set("funds", "")
+// TestRenterContractsExpiring checks that /renter/contracts/expiring only
+// reports contracts that end within the requested number of blocks.
+func TestRenterContractsExpiring(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterContractsExpiring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// The within parameter is required.
+	var rc RenterContracts
+	if err = st.getAPI("/renter/contracts/expiring", &rc); err == nil {
+		t.Fatal("expected an error when within is missing")
+	}
+
+	// Announce the host and form a contract with it.
+	if err := st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
 	allowanceValues.Set("period", testPeriod)
-	err = st.stdPostAPI("/renter", allowanceValues)
-	if err == nil || err.Error() != "unable to parse funds" {
-		t.Errorf("expected error to be 'unable to parse funds'; got %v", err)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
 	}
-	// Try an invalid funds string. Can't test a negative value since
-	// ErrNegativeCurrency triggers a build.Critical, which calls a panic in
-	// debug mode.
-	allowanceValues.Set("funds", "0")
-	err = st.stdPostAPI("/renter", allowanceValues)
-	if err == nil || err.Error() != contractor.ErrInsufficientAllowance.Error() {
-		t.Errorf("expected error to be %v; got %v", contractor.ErrInsufficientAllowance, err)
+	if err = st.getAPI("/renter/contracts", &rc); err != nil {
+		t.Fatal(err)
 	}
-	// Try a empty period string.
+	if len(rc.Contracts) != 1 {
+		t.Fatalf("expected renter to have 1 contract; got %v", len(rc.Contracts))
+	}
+	remaining := rc.Contracts[0].BlocksRemaining
+
+	// The contract should only be reported once the window reaches its end
+	// height.
+	if err = st.getAPI(fmt.Sprintf("/renter/contracts/expiring?within=%v", remaining-1), &rc); err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.Contracts) != 0 {
+		t.Fatalf("expected no expiring contracts; got %v", len(rc.Contracts))
+	}
+	if err = st.getAPI(fmt.Sprintf("/renter/contracts/expiring?within=%v", remaining), &rc); err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.Contracts) != 1 {
+		t.Fatalf("expected 1 expiring contract; got %v", len(rc.Contracts))
+	}
+	if rc.Contracts[0].BlocksRemaining != remaining {
+		t.Fatalf("expected %v blocks remaining; got %v", remaining, rc.Contracts[0].BlocksRemaining)
+	}
+}
+
+// TestRenterContractsHostPublicKey checks that /renter/contracts reports the
+// public key that the host announced.
+func TestRenterContractsHostPublicKey(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterContractsHostPublicKey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and form a contract with it.
+	if err := st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+	allowanceValues := url.Values{}
 	allowanceValues.Set("funds", testFunds)
-	allowanceValues.Set("period", "")
-	err = st.stdPostAPI("/renter", allowanceValues)
-	if err == nil || !strings.HasPrefix(err.Error(), "unable to parse period: ") {
-		t.Errorf("expected error to begin with 'unable to parse period: '; got %v", err)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
 	}
-	// Try an invalid period string.
-	allowanceValues.Set("period", "-1")
-	err = st.stdPostAPI("/renter", allowanceValues)
-	if err == nil || !strings.Contains(err.Error(), "unable to parse period") {
-		t.Errorf("expected error to begin with 'unable to parse period'; got %v", err)
+
+	var ah ActiveHosts
+	if err = st.getAPI("/hostdb/active", &ah); err != nil {
+		t.Fatal(err)
 	}
-	// Try a period that will lead to a length-zero RenewWindow.
-	allowanceValues.Set("period", "1")
-	err = st.stdPostAPI("/renter", allowanceValues)
-	if err == nil || err.Error() != contractor.ErrAllowanceZeroWindow.Error() {
-		t.Errorf("expected error to be %v, got %v", contractor.ErrAllowanceZeroWindow, err)
+	if len(ah.Hosts) != 1 {
+		t.Fatalf("expected 1 active host; got %v", len(ah.Hosts))
+	}
+	var rc RenterContracts
+	if err = st.getAPI("/renter/contracts", &rc); err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.Contracts) != 1 {
+		t.Fatalf("expected renter to have 1 contract; got %v", len(rc.Contracts))
+	}
+	if expected := ah.Hosts[0].PublicKey.String(); rc.Contracts[0].HostPublicKey != expected {
+		t.Fatalf("expected host public key %v; got %v", expected, rc.Contracts[0].HostPublicKey)
 	}
 }
 
-// TestRenterLoadNonexistent checks that attempting to upload or download a
-// nonexistent file triggers the appropriate error.
-func TestRenterLoadNonexistent(t *testing.T) {
+// TestRenterContractCancel checks that a contract canceled through
+// /renter/contract/cancel is no longer listed by /renter/contracts.
+func TestRenterContractCancel(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterContractCancel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Anounce the host and start accepting contracts.
+	if err := st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+	var contracts RenterContracts
+	if err = st.getAPI("/renter/contracts", &contracts); err != nil {
+		t.Fatal(err)
+	}
+	if len(contracts.Contracts) != 1 {
+		t.Fatalf("expected renter to have 1 contract; got %v", len(contracts.Contracts))
+	}
+
+	// Try an invalid id.
+	cancelValues := url.Values{}
+	cancelValues.Set("id", "foo")
+	if err = st.stdPostAPI("/renter/contract/cancel", cancelValues); err == nil {
+		t.Fatal("expected error when canceling with an invalid id")
+	}
+
+	// Cancel the contract.
+	cancelValues.Set("id", contracts.Contracts[0].ID.String())
+	if err = st.stdPostAPI("/renter/contract/cancel", cancelValues); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.getAPI("/renter/contracts", &contracts); err != nil {
+		t.Fatal(err)
+	}
+	if len(contracts.Contracts) != 0 {
+		t.Fatalf("expected renter to have 0 contracts; got %v", len(contracts.Contracts))
+	}
+
+	// Canceling the contract again should fail.
+	err = st.stdPostAPI("/renter/contract/cancel", cancelValues)
+	if err == nil || err.Error() != contractor.ErrUnknownContract.Error() {
+		t.Fatalf("expected %v; got %v", contractor.ErrUnknownContract, err)
+	}
+}
+
+// TestRenterHandlerPOSTDryRun checks that a dry run of POST /renter returns
+// an estimate of the contracts without forming them.
+func TestRenterHandlerPOSTDryRun(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterHandlerPOSTDryRun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Anounce the host and start accepting contracts.
+	if err := st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	allowanceValues.Set("dryrun", "true")
+	var rep RenterEstimatePOST
+	if err = st.postAPI("/renter", allowanceValues, &rep); err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Contracts) != 1 || rep.Contracts[0].NetAddress != st.host.ExternalSettings().NetAddress {
+		t.Fatal("expected an estimate for the host, got", rep.Contracts)
+	} else if rep.Filesize == 0 || rep.TotalCost.Cmp(rep.Contracts[0].Cost) != 0 {
+		t.Fatal("estimate has the wrong filesize or cost:", rep.Filesize, rep.TotalCost)
+	}
+
+	// No allowance should have been set, and no contracts formed.
+	var get RenterGET
+	if err = st.getAPI("/renter", &get); err != nil {
+		t.Fatal(err)
+	}
+	if !get.Settings.Allowance.Funds.IsZero() {
+		t.Fatal("dry run set the allowance:", get.Settings.Allowance)
+	}
+	var rc RenterContracts
+	if err = st.getAPI("/renter/contracts", &rc); err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.Contracts) != 0 {
+		t.Fatal("dry run formed contracts:", rc.Contracts)
+	}
+
+	// Invalid allowances should be rejected.
+	allowanceValues.Set("period", "0")
+	if err = st.stdPostAPI("/renter", allowanceValues); err == nil {
+		t.Fatal("expected a dry run with a zero period to fail")
+	}
+}
+
+// TestRenterHandlerGetAndPost checks that valid /renter calls successfully set
+// allowance values, while /renter calls with invalid allowance values are
+// correctly handled.
+func TestRenterHandlerGetAndPost(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterHandlerGetAndPost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Anounce the host and start accepting contracts.
+	if err := st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Check that a call to /renter returns the expected values.
+	var get RenterGET
+	if err = st.getAPI("/renter", &get); err != nil {
+		t.Fatal(err)
+	}
+	// Check the renter's funds.
+	expectedFunds, ok := scanAmount(testFunds)
+	if !ok {
+		t.Fatal("scanAmount failed")
+	}
+	if got := get.Settings.Allowance.Funds; got.Cmp(expectedFunds) != 0 {
+		t.Fatalf("expected funds to be %v; got %v", expectedFunds, got)
+	}
+	// Check the renter's period.
+	intPeriod, err := strconv.Atoi(testPeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedPeriod := types.BlockHeight(intPeriod)
+	if got := get.Settings.Allowance.Period; got != expectedPeriod {
+		t.Fatalf("expected period to be %v; got %v", expectedPeriod, got)
+	}
+	// Check the renter's renew window.
+	expectedRenewWindow := expectedPeriod / 2
+	if got := get.Settings.Allowance.RenewWindow; got != expectedRenewWindow {
+		t.Fatalf("expected renew window to be %v; got %v", expectedRenewWindow, got)
+	}
+
+	// Try an empty funds string.
+	allowanceValues = url.Values{}
+	allowanceValues.Set("funds", "")
+	allowanceValues.Set("period", testPeriod)
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err == nil || err.Error() != "unable to parse funds" {
+		t.Errorf("expected error to be 'unable to parse funds'; got %v", err)
+	}
+	// Try an invalid funds string. Can't test a negative value since
+	// ErrNegativeCurrency triggers a build.Critical, which calls a panic in
+	// debug mode.
+	allowanceValues.Set("funds", "0")
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err == nil || err.Error() != contractor.ErrInsufficientAllowance.Error() {
+		t.Errorf("expected error to be %v; got %v", contractor.ErrInsufficientAllowance, err)
+	}
+	// Try a empty period string.
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", "")
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err == nil || !strings.HasPrefix(err.Error(), "unable to parse period: ") {
+		t.Errorf("expected error to begin with 'unable to parse period: '; got %v", err)
+	}
+	// Try an invalid period string.
+	allowanceValues.Set("period", "-1")
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err == nil || !strings.Contains(err.Error(), "unable to parse period") {
+		t.Errorf("expected error to begin with 'unable to parse period'; got %v", err)
+	}
+	// Try a period that will lead to a length-zero RenewWindow.
+	allowanceValues.Set("period", "1")
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err == nil || err.Error() != contractor.ErrAllowanceZeroWindow.Error() {
+		t.Errorf("expected error to be %v, got %v", contractor.ErrAllowanceZeroWindow, err)
+	}
+	// Try an explicit renew window.
+	allowanceValues.Set("period", testPeriod)
+	allowanceValues.Set("renewwindow", "3")
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.getAPI("/renter", &get); err != nil {
+		t.Fatal(err)
+	}
+	if got := get.Settings.Allowance.RenewWindow; got != 3 {
+		t.Fatalf("expected renew window to be 3; got %v", got)
+	}
+	// Try a renew window that is not smaller than the period.
+	allowanceValues.Set("renewwindow", testPeriod)
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err == nil || !strings.Contains(err.Error(), "invalid renewwindow "+testPeriod) {
+		t.Errorf("expected error to mention renewwindow %v; got %v", testPeriod, err)
+	}
+	// Try a zero renew window.
+	allowanceValues.Set("renewwindow", "0")
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err == nil || !strings.Contains(err.Error(), "invalid renewwindow 0") {
+		t.Errorf("expected error to mention renewwindow 0; got %v", err)
+	}
+	// Try an invalid maxprice string.
+	allowanceValues.Del("renewwindow")
+	allowanceValues.Set("maxprice", "foo")
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if err == nil || err.Error() != "unable to parse maxprice" {
+		t.Errorf("expected error to be 'unable to parse maxprice'; got %v", err)
+	}
+
+	// Set the contractor's limits.
+	allowanceValues.Del("maxprice")
+	allowanceValues.Set("maxhosts", "10")
+	allowanceValues.Set("fundingmargin", "0.2")
+	allowanceValues.Set("bandwidthreserve", "0.3")
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.getAPI("/renter", &get); err != nil {
+		t.Fatal(err)
+	}
+	if s := get.Settings; s.MaxHosts != 10 || s.FundingMargin != 0.2 || s.BandwidthReserve != 0.3 {
+		t.Fatalf("expected limits of 10, 0.2, and 0.3; got %v, %v, and %v", s.MaxHosts, s.FundingMargin, s.BandwidthReserve)
+	}
+	// Try invalid limits. The previous limits should be kept.
+	allowanceValues.Set("fundingmargin", "0.1")
+	allowanceValues.Set("maxhosts", "0")
+	if err = st.stdPostAPI("/renter", allowanceValues); err == nil {
+		t.Error("expected an error for maxhosts 0")
+	}
+	allowanceValues.Set("maxhosts", "10")
+	allowanceValues.Set("bandwidthreserve", "0.9")
+	if err = st.stdPostAPI("/renter", allowanceValues); err == nil {
+		t.Error("expected an error for bandwidthreserve 0.9")
+	}
+	if err = st.getAPI("/renter", &get); err != nil {
+		t.Fatal(err)
+	}
+	if s := get.Settings; s.MaxHosts != 10 || s.FundingMargin != 0.2 || s.BandwidthReserve != 0.3 {
+		t.Fatalf("expected the limits to be kept; got %v, %v, and %v", s.MaxHosts, s.FundingMargin, s.BandwidthReserve)
+	}
+}
+
+// TestRenterValidate checks that /renter/validate reports the same errors as
+// /renter [POST] without changing the renter's settings.
+func TestRenterValidate(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterValidate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Anounce the host and start accepting contracts.
+	if err := st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A valid allowance should be accepted, but not set.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter/validate", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+	var get RenterGET
+	if err = st.getAPI("/renter", &get); err != nil {
+		t.Fatal(err)
+	}
+	if !get.Settings.Allowance.Funds.IsZero() || get.Settings.Allowance.Period != 0 {
+		t.Fatal("validating an allowance should not set it:", get.Settings.Allowance)
+	}
+	var rc RenterContracts
+	if err = st.getAPI("/renter/contracts", &rc); err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.Contracts) != 0 {
+		t.Fatalf("validating an allowance should not form contracts; got %v", len(rc.Contracts))
+	}
+
+	// Try an empty funds string.
+	allowanceValues.Set("funds", "")
+	err = st.stdPostAPI("/renter/validate", allowanceValues)
+	if err == nil || err.Error() != "unable to parse funds" {
+		t.Errorf("expected error to be 'unable to parse funds'; got %v", err)
+	}
+	// Try funds that cannot cover any contracts.
+	allowanceValues.Set("funds", "0")
+	err = st.stdPostAPI("/renter/validate", allowanceValues)
+	expectedErr := Error{Message: contractor.ErrInsufficientAllowance.Error(), Code: ErrCodeInsufficientAllowance}
+	if err != expectedErr {
+		t.Errorf("expected error to be %v; got %v", expectedErr, err)
+	}
+	// Try an empty period string.
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", "")
+	err = st.stdPostAPI("/renter/validate", allowanceValues)
+	if err == nil || !strings.HasPrefix(err.Error(), "unable to parse period: ") {
+		t.Errorf("expected error to begin with 'unable to parse period: '; got %v", err)
+	}
+	// Try an invalid period string.
+	allowanceValues.Set("period", "-1")
+	err = st.stdPostAPI("/renter/validate", allowanceValues)
+	if err == nil || !strings.Contains(err.Error(), "unable to parse period") {
+		t.Errorf("expected error to begin with 'unable to parse period'; got %v", err)
+	}
+	// Try a period that will lead to a length-zero RenewWindow.
+	allowanceValues.Set("period", "1")
+	err = st.stdPostAPI("/renter/validate", allowanceValues)
+	expectedErr = Error{Message: contractor.ErrAllowanceZeroWindow.Error(), Code: ErrCodeZeroWindow}
+	if err != expectedErr {
+		t.Errorf("expected error to be %v, got %v", expectedErr, err)
+	}
+	// Try a renew window that is not smaller than the period.
+	allowanceValues.Set("period", testPeriod)
+	allowanceValues.Set("renewwindow", testPeriod)
+	err = st.stdPostAPI("/renter/validate", allowanceValues)
+	if err == nil || !strings.Contains(err.Error(), "invalid renewwindow "+testPeriod) {
+		t.Errorf("expected error to mention renewwindow %v; got %v", testPeriod, err)
+	}
+	// Try a zero renew window.
+	allowanceValues.Set("renewwindow", "0")
+	err = st.stdPostAPI("/renter/validate", allowanceValues)
+	if err == nil || !strings.Contains(err.Error(), "invalid renewwindow 0") {
+		t.Errorf("expected error to mention renewwindow 0; got %v", err)
+	}
+	// Try an invalid maxprice string.
+	allowanceValues.Del("renewwindow")
+	allowanceValues.Set("maxprice", "foo")
+	err = st.stdPostAPI("/renter/validate", allowanceValues)
+	if err == nil || err.Error() != "unable to parse maxprice" {
+		t.Errorf("expected error to be 'unable to parse maxprice'; got %v", err)
+	}
+}
+
+// TestRenterPeriodRemaining checks that /renter reports the end of the
+// current period and the number of blocks remaining, and that a renewal is
+// reported as pending once the renew window is reached.
+func TestRenterPeriodRemaining(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterPeriodRemaining")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Without an allowance, there is no period.
+	var get RenterGET
+	if err = st.getAPI("/renter", &get); err != nil {
+		t.Fatal(err)
+	}
+	if get.PeriodEnd != 0 || get.BlocksRemaining != 0 || get.RenewalPending {
+		t.Fatalf("expected no period, got %v/%v/%v", get.PeriodEnd, get.BlocksRemaining, get.RenewalPending)
+	}
+
+	// Anounce the host and start accepting contracts.
+	if err := st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", "10")
+	allowanceValues.Set("renewwindow", "5")
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.getAPI("/renter", &get); err != nil {
+		t.Fatal(err)
+	}
+	if get.PeriodEnd != get.CurrentPeriod+10 {
+		t.Fatalf("expected period to end at %v, got %v", get.CurrentPeriod+10, get.PeriodEnd)
+	}
+	if get.BlocksRemaining != get.PeriodEnd-st.cs.Height() {
+		t.Fatalf("expected %v blocks remaining, got %v", get.PeriodEnd-st.cs.Height(), get.BlocksRemaining)
+	}
+
+	// Each block brings the end of the period closer, until the renew window
+	// is reached.
+	for remaining := get.BlocksRemaining; remaining > 5; {
+		if _, err = st.miner.AddBlock(); err != nil {
+			t.Fatal(err)
+		}
+		remaining--
+		if err = st.getAPI("/renter", &get); err != nil {
+			t.Fatal(err)
+		}
+		if get.BlocksRemaining != remaining {
+			t.Fatalf("expected %v blocks remaining, got %v", remaining, get.BlocksRemaining)
+		}
+		if get.RenewalPending != (remaining <= 5) {
+			t.Fatalf("expected renewal pending to be %v with %v blocks remaining", remaining <= 5, remaining)
+		}
+	}
+}
+
+// TestRenterLoadNonexistent checks that attempting to upload or download a
+// nonexistent file triggers the appropriate error.
+func TestRenterLoadNonexistent(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterLoadNonexistent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Anounce the host and start accepting contracts.
+	if err := st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Try uploading a nonexistent file.
+	fakepath := filepath.Join(st.dir, "dne.dat")
+	uploadValues := url.Values{}
+	uploadValues.Set("source", fakepath)
+	err = st.stdPostAPI("/renter/upload/dne", uploadValues)
+	if err == nil {
+		t.Errorf("expected error when uploading nonexistent file")
+	}
+
+	// Try downloading a nonexistent file.
+	downpath := filepath.Join(st.dir, "dnedown.dat")
+	err = st.stdGetAPI("/renter/download/dne?destination=" + downpath)
+	if err == nil || err.Error() != "download failed: no file with that path" {
+		t.Errorf("expected error to be 'download failed: no file with that path'; got %v instead", err)
+	}
+
+	// The renter's downloads queue should be empty.
+	var queue RenterDownloadQueue
+	if err = st.getAPI("/renter/downloads", &queue); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.Downloads) != 0 {
+		t.Fatalf("expected renter to have 0 downloads in the queue; got %v", len(queue.Downloads))
+	}
+}
+
+// TestErrorCode checks that errorCode returns the right code for each error
+// that has one.
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{renter.ErrEmptyFilename, ErrCodeEmptyFilename},
+		{renter.ErrPathOverload, ErrCodePathOverload},
+		{renter.ErrUnknownPath, ErrCodeUnknownPath},
+		{renter.ErrDownloadUnknownPath, ErrCodeUnknownPath},
+		{contractor.ErrInsufficientAllowance, ErrCodeInsufficientAllowance},
+		{contractor.ErrAllowanceZeroWindow, ErrCodeZeroWindow},
+		{contractor.ErrWalletLocked, ErrCodeWalletLocked},
+		{renter.ErrDownloadOffset, ""},
+		{errors.New("no file known with that path"), ""},
+	}
+	for _, test := range tests {
+		if code := errorCode(test.err); code != test.code {
+			t.Errorf("expected code %q for %q, got %q", test.code, test.err, code)
+		}
+	}
+}
+
+// TestRenterErrorCodes checks that the renter API returns the error code of
+// each known error alongside its message.
+func TestRenterErrorCodes(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterErrorCodes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// A zero renew window is rejected by the API.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	allowanceValues.Set("renewwindow", "0")
+	err = st.stdPostAPI("/renter", allowanceValues)
+	if apiErr, ok := err.(Error); !ok || apiErr.Code != ErrCodeZeroWindow {
+		t.Errorf("expected code %v; got %#v", ErrCodeZeroWindow, err)
+	}
+
+	// Renaming a nonexistent file.
+	renameValues := url.Values{}
+	renameValues.Set("newsiapath", "newdne")
+	err = st.stdPostAPI("/renter/rename/dne", renameValues)
+	expectedErr := Error{Message: renter.ErrUnknownPath.Error(), Code: ErrCodeUnknownPath}
+	if err != expectedErr {
+		t.Errorf("expected %#v; got %#v", expectedErr, err)
+	}
+
+	// Renaming to an empty path.
+	renameValues.Set("newsiapath", "")
+	err = st.stdPostAPI("/renter/rename/dne", renameValues)
+	expectedErr = Error{Message: renter.ErrEmptyFilename.Error(), Code: ErrCodeEmptyFilename}
+	if err != expectedErr {
+		t.Errorf("expected %#v; got %#v", expectedErr, err)
+	}
+
+	// Downloading a nonexistent file, both to disk and as a stream. The
+	// messages are unchanged.
+	downpath := filepath.Join(st.dir, "dnedown.dat")
+	err = st.stdGetAPI("/renter/download/dne?destination=" + downpath)
+	expectedErr = Error{Message: "download failed: no file with that path", Code: ErrCodeUnknownPath}
+	if err != expectedErr {
+		t.Errorf("expected %#v; got %#v", expectedErr, err)
+	}
+	err = st.stdGetAPI("/renter/download/dne")
+	if err != expectedErr {
+		t.Errorf("expected %#v; got %#v", expectedErr, err)
+	}
+}
+
+// TestRenterHandlerRename checks that valid /renter/rename calls are
+// successful, and that invalid calls fail with the appropriate error.
+func TestRenterHandlerRename(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterHandlerRename")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Anounce the host and start accepting contracts.
+	if err := st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Try renaming a nonexistent file.
+	renameValues := url.Values{}
+	renameValues.Set("newsiapath", "newdne")
+	err = st.stdPostAPI("/renter/rename/dne", renameValues)
+	if err == nil || err.Error() != renter.ErrUnknownPath.Error() {
+		t.Errorf("expected error to be %v; got %v", renter.ErrUnknownPath, err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a file.
+	path1 := filepath.Join(st.dir, "test1.dat")
+	if err = createRandFile(path1, 512); err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload to host.
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path1)
+	if err = st.stdPostAPI("/renter/upload/test1", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Try renaming to an empty string.
+	renameValues.Set("newsiapath", "")
+	err = st.stdPostAPI("/renter/rename/test1", renameValues)
+	if err == nil || err.Error() != renter.ErrEmptyFilename.Error() {
+		t.Fatalf("expected error to be %v; got %v", renter.ErrEmptyFilename, err)
+	}
+
+	// Rename the file.
+	renameValues.Set("newsiapath", "newtest1")
+	if err = st.stdPostAPI("/renter/rename/test1", renameValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Should be able to continue uploading and downloading using the new name.
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].UploadProgress < 10); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].UploadProgress < 10 {
+		t.Fatal("upload is not succeeding:", rf.Files[0])
+	}
+	err = st.stdGetAPI("/renter/download/newtest1?destination=" + filepath.Join(st.dir, "testdown2.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create and upload another file.
+	path2 := filepath.Join(st.dir, "test2.dat")
+	if err = createRandFile(path2, 512); err != nil {
+		t.Fatal(err)
+	}
+	uploadValues.Set("source", path2)
+	if err = st.stdPostAPI("/renter/upload/test2", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+	// Try renaming to a name that's already taken.
+	renameValues.Set("newsiapath", "newtest1")
+	err = st.stdPostAPI("/renter/rename/test2", renameValues)
+	if err == nil || err.Error() != renter.ErrPathOverload.Error() {
+		t.Errorf("expected error to be %v; got %v", renter.ErrPathOverload, err)
+	}
+}
+
+// TestRenterHandlerRenameFolder checks that renaming a folder moves every file
+// beneath it.
+func TestRenterHandlerRenameFolder(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterHandlerRenameFolder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Anounce the host and start accepting contracts.
+	if err := st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a file and upload it to several paths beneath foo/bar.
+	path := filepath.Join(st.dir, "test.dat")
+	if err = createRandFile(path, 512); err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	for _, siaPath := range []string{"foo/bar/1", "foo/bar/2", "foo/bar/qux/3", "foo/other"} {
+		if err = st.stdPostAPI("/renter/upload/"+siaPath, uploadValues); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Try renaming the folder to an empty string.
+	renameValues := url.Values{}
+	renameValues.Set("newsiapath", "")
+	err = st.stdPostAPI("/renter/rename/foo/bar", renameValues)
+	if err == nil || err.Error() != renter.ErrEmptyFilename.Error() {
+		t.Fatalf("expected error to be %v; got %v", renter.ErrEmptyFilename, err)
+	}
+
+	// Rename the folder.
+	renameValues.Set("newsiapath", "baz")
+	if err = st.stdPostAPI("/renter/rename/foo/bar", renameValues); err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	if err = st.getAPI("/renter/files", &rf); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]bool{"baz/1": true, "baz/2": true, "baz/qux/3": true, "foo/other": true}
+	if len(rf.Files) != len(expected) {
+		t.Fatal("unexpected files after rename:", rf.Files)
+	}
+	for _, f := range rf.Files {
+		if !expected[f.SiaPath] {
+			t.Error("unexpected file after rename:", f.SiaPath)
+		}
+	}
+
+	// Renaming onto an existing file should fail and move nothing.
+	if err = st.stdPostAPI("/renter/upload/taken/1", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+	renameValues.Set("newsiapath", "taken")
+	err = st.stdPostAPI("/renter/rename/baz", renameValues)
+	if err == nil || err.Error() != renter.ErrPathOverload.Error() {
+		t.Errorf("expected error to be %v; got %v", renter.ErrPathOverload, err)
+	}
+	if err = st.getAPI("/renter/files", &rf); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range rf.Files {
+		if strings.HasPrefix(f.SiaPath, "taken/") && f.SiaPath != "taken/1" {
+			t.Error("file was moved by a failed rename:", f.SiaPath)
+		}
+	}
+}
+
+// TestRenterHandlerDelete checks that deleting a valid file from the renter
+// goes as planned and that attempting to delete a nonexistent file fails with
+// the appropriate error.
+func TestRenterHandlerDelete(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterHandlerDelete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Anounce the host and start accepting contracts.
+	if err := st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a file.
+	path := filepath.Join(st.dir, "test.dat")
+	if err = createRandFile(path, 1024); err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload to host.
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete the file.
+	if err = st.stdPostAPI("/renter/delete/test", url.Values{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The renter's list of files should now be empty.
+	var files RenterFiles
+	if err = st.getAPI("/renter/files", &files); err != nil {
+		t.Fatal(err)
+	}
+	if len(files.Files) != 0 {
+		t.Fatalf("renter's list of files should be empty; got %v instead", files)
+	}
+
+	// Try deleting a nonexistent file.
+	err = st.stdPostAPI("/renter/delete/dne", url.Values{})
+	if err == nil || err.Error() != renter.ErrUnknownPath.Error() {
+		t.Errorf("expected error to be %v, got %v", renter.ErrUnknownPath, err)
+	}
+}
+
+// TestRenterHandlerDeletePrefix checks that every file beneath a prefix can be
+// deleted with a single call.
+func TestRenterHandlerDeletePrefix(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterHandlerDeletePrefix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Anounce the host and start accepting contracts.
+	if err := st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a file.
+	path := filepath.Join(st.dir, "test.dat")
+	if err = createRandFile(path, 1024); err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload several copies of the file under foo/, and one outside of it.
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	for _, siaPath := range []string{"foo/1", "foo/2", "foo/bar/3", "foobar"} {
+		if err = st.stdPostAPI("/renter/upload/"+siaPath, uploadValues); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Delete the folder.
+	var rd RenterDelete
+	if err = st.postAPI("/renter/delete", url.Values{"prefix": {"foo"}}, &rd); err != nil {
+		t.Fatal(err)
+	}
+	if rd.Deleted != 3 {
+		t.Fatal("expected 3 files to be deleted, got", rd.Deleted)
+	}
+
+	// Only the file outside of the folder should remain.
+	var files RenterFiles
+	if err = st.getAPI("/renter/files", &files); err != nil {
+		t.Fatal(err)
+	}
+	if len(files.Files) != 1 || files.Files[0].SiaPath != "foobar" {
+		t.Fatal("expected only foobar to remain, got", files.Files)
+	}
+
+	// Try deleting a prefix that matches nothing.
+	err = st.stdPostAPI("/renter/delete", url.Values{"prefix": {"foo"}})
+	if err == nil || err.Error() != renter.ErrUnknownPath.Error() {
+		t.Errorf("expected error to be %v, got %v", renter.ErrUnknownPath, err)
+	}
+
+	// An exact-match delete should still work.
+	if err = st.stdPostAPI("/renter/delete/foobar", url.Values{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Tests that the /renter/upload call checks for relative paths.
+func TestRenterRelativePathErrorUpload(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	// TODO: t.Parallel()
+	st, err := createServerTester("TestRenterRelativePathErrorUpload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Anounce the host and start accepting contracts.
+	if err := st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	renterUploadAbsoluteError := "source must be an absolute path"
+
+	// Create a file.
+	path := filepath.Join(st.dir, "test.dat")
+	if err = createRandFile(path, 1024); err != nil {
+		t.Fatal(err)
+	}
+
+	// This should fail.
+	uploadValues := url.Values{}
+	uploadValues.Set("source", "test.dat")
+	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err.Error() != renterUploadAbsoluteError {
+		t.Fatal(err)
+	}
+
+	// As should this.
+	uploadValues = url.Values{}
+	uploadValues.Set("source", "../test.dat")
+	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err.Error() != renterUploadAbsoluteError {
+		t.Fatal(err)
+	}
+
+	// This should succeed.
+	uploadValues = url.Values{}
+	uploadValues.Set("source", path)
+	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Tests that the /renter/download call checks for relative paths.
+func TestRenterRelativePathErrorDownload(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterRelativePathErrorUpload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Anounce the host and start accepting contracts.
+	if err := st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	renterDownloadAbsoluteError := "destination must be an absolute path"
+
+	// Create a file.
+	path := filepath.Join(st.dir, "test.dat")
+	if err = createRandFile(path, 1024); err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// This should fail.
+	downloadPath := "test1.dat"
+	if err = st.stdGetAPI("/renter/download/test?destination=" + downloadPath); err.Error() != renterDownloadAbsoluteError {
+		t.Fatal(err)
+	}
+
+	// This should fail.
+	downloadPath = "../test1.dat"
+	if err = st.stdGetAPI("/renter/download/test?destination=" + downloadPath); err.Error() != renterDownloadAbsoluteError {
+		t.Fatal(err)
+	}
+
+	// This should fail.
+	downloadPath = filepath.Join(st.dir, "test1.dat")
+	err = st.stdGetAPI("/renter/download/test?destination=" + downloadPath)
+	if err == nil {
+		t.Log(downloadPath)
+		t.Fatal("expecting an error")
+	}
+}
+
+// TestUploadTracker checks that uploadTracker only reports changes in upload
+// progress, and reports completed uploads exactly once.
+func TestUploadTracker(t *testing.T) {
+	ut := newUploadTracker([]modules.FileInfo{
+		{SiaPath: "done", Filesize: 100, UploadProgress: 100},
+		{SiaPath: "foo", Filesize: 100, UploadProgress: 0},
+	})
+
+	// The already-completed file should not be reported.
+	events := ut.update([]modules.FileInfo{
+		{SiaPath: "done", Filesize: 100, UploadProgress: 100},
+		{SiaPath: "foo", Filesize: 100, UploadProgress: 0},
+	})
+	if len(events) != 1 || events[0].SiaPath != "foo" {
+		t.Fatal("expected a single event for foo, got", events)
+	}
+
+	// Unchanged progress should not be reported.
+	events = ut.update([]modules.FileInfo{{SiaPath: "foo", Filesize: 100, UploadProgress: 0}})
+	if len(events) != 0 {
+		t.Fatal("expected no events, got", events)
+	}
+
+	events = ut.update([]modules.FileInfo{{SiaPath: "foo", Filesize: 100, UploadProgress: 50}})
+	if len(events) != 1 || events[0].UploadProgress != 50 || events[0].UploadedBytes != 50 {
+		t.Fatal("expected progress event for foo, got", events)
+	}
+
+	// Completion should be reported once, and then the file dropped.
+	events = ut.update([]modules.FileInfo{{SiaPath: "foo", Filesize: 100, UploadProgress: 100}})
+	if len(events) != 1 || events[0].UploadProgress != 100 || events[0].UploadedBytes != 100 {
+		t.Fatal("expected completion event for foo, got", events)
+	}
+	events = ut.update([]modules.FileInfo{{SiaPath: "foo", Filesize: 100, UploadProgress: 100}})
+	if len(events) != 0 {
+		t.Fatal("completed upload was reported twice:", events)
+	}
+}
+
+// TestRenterUploadsStream checks that /renter/uploads/stream reports the
+// progress of an upload.
+func TestRenterUploadsStream(t *testing.T) {
 	if testing.Short() {
 		t.SkipNow()
 	}
 	t.Parallel()
-	st, err := createServerTester("TestRenterLoadNonexistent")
+	st, err := createServerTester("TestRenterUploadsStream")
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer st.server.Close()
 
-	// Anounce the host and start accepting contracts.
+	// Announce the host and start accepting contracts.
 	if err := st.announceHost(); err != nil {
 		t.Fatal(err)
 	}
@@ -452,138 +1883,236 @@ func TestRenterLoadNonexistent(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// Try uploading a nonexistent file.
-	fakepath := filepath.Join(st.dir, "dne.dat")
-	uploadValues := url.Values{}
-	uploadValues.Set("source", fakepath)
-	err = st.stdPostAPI("/renter/upload/dne", uploadValues)
-	if err == nil {
-		t.Errorf("expected error when uploading nonexistent file")
+	// Open the stream before starting the upload.
+	resp, err := HttpGET("http://" + st.server.listener.Addr().String() + "/renter/uploads/stream")
+	if err != nil {
+		t.Fatal(err)
 	}
-
-	// Try downloading a nonexistent file.
-	downpath := filepath.Join(st.dir, "dnedown.dat")
-	err = st.stdGetAPI("/renter/download/dne?destination=" + downpath)
-	if err == nil || err.Error() != "download failed: no file with that path" {
-		t.Errorf("expected error to be 'download failed: no file with that path'; got %v instead", err)
+	defer resp.Body.Close()
+	if non2xx(resp.StatusCode) {
+		t.Fatal(decodeError(resp))
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatal("wrong content type:", ct)
 	}
 
-	// The renter's downloads queue should be empty.
-	var queue RenterDownloadQueue
-	if err = st.getAPI("/renter/downloads", &queue); err != nil {
+	// Create a file and upload it.
+	path := filepath.Join(st.dir, "test.dat")
+	if err := createRandFile(path, 1024); err != nil {
 		t.Fatal(err)
 	}
-	if len(queue.Downloads) != 0 {
-		t.Fatalf("expected renter to have 0 downloads in the queue; got %v", len(queue.Downloads))
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	if err := st.stdPostAPI("/renter/upload/test", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read events until the upload has progressed as far as it can with a
+	// single host (one piece, 10% at current redundancy).
+	eventChan := make(chan RenterUploadEvent)
+	go func() {
+		defer close(eventChan)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+			var e RenterUploadEvent
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+				t.Error(err)
+				return
+			}
+			eventChan <- e
+		}
+	}()
+	var last RenterUploadEvent
+	timeout := time.After(10 * time.Second)
+	for last.UploadProgress < 10 {
+		select {
+		case e, ok := <-eventChan:
+			if !ok {
+				t.Fatal("stream closed unexpectedly")
+			}
+			if e.SiaPath != "test" {
+				t.Fatal("event for unexpected file:", e)
+			}
+			if e.UploadProgress < last.UploadProgress {
+				t.Fatal("upload progress decreased:", last.UploadProgress, e.UploadProgress)
+			}
+			last = e
+		case <-timeout:
+			t.Fatal("upload progress was not streamed; last event:", last)
+		}
+	}
+	if last.UploadedBytes == 0 {
+		t.Fatal("uploaded bytes not reported:", last)
 	}
 }
 
-// TestRenterHandlerRename checks that valid /renter/rename calls are
-// successful, and that invalid calls fail with the appropriate error.
-func TestRenterHandlerRename(t *testing.T) {
+// TestRenterUploadDir checks that a directory tree can be uploaded with a
+// single call to /renter/upload.
+func TestRenterUploadDir(t *testing.T) {
 	if testing.Short() {
 		t.SkipNow()
 	}
 	t.Parallel()
-	st, err := createServerTester("TestRenterHandlerRename")
+	st, err := createServerTester("TestRenterUploadDir")
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer st.server.Close()
 
-	// Anounce the host and start accepting contracts.
-	if err := st.announceHost(); err != nil {
+	// Announce the host.
+	if err = st.announceHost(); err != nil {
 		t.Fatal(err)
 	}
-	if err = st.acceptContracts(); err != nil {
+
+	// Create a small directory tree, including a symlink that should be
+	// skipped.
+	dir := filepath.Join(st.dir, "uploaddir")
+	if err = os.MkdirAll(filepath.Join(dir, "sub", "subsub"), 0700); err != nil {
 		t.Fatal(err)
 	}
-	if err = st.setHostStorage(); err != nil {
+	for _, name := range []string{"a.dat", "sub/b.dat", "sub/subsub/c.dat"} {
+		if err = createRandFile(filepath.Join(dir, filepath.FromSlash(name)), 1024); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.Symlink(filepath.Join(dir, "a.dat"), filepath.Join(dir, "link.dat")); err != nil {
 		t.Fatal(err)
 	}
 
-	// Try renaming a nonexistent file.
-	renameValues := url.Values{}
-	renameValues.Set("newsiapath", "newdne")
-	err = st.stdPostAPI("/renter/rename/dne", renameValues)
-	if err == nil || err.Error() != renter.ErrUnknownPath.Error() {
-		t.Errorf("expected error to be %v; got %v", renter.ErrUnknownPath, err)
+	// Uploading a directory without recursive set should fail.
+	uploadValues := url.Values{}
+	uploadValues.Set("source", dir)
+	if err = st.stdPostAPI("/renter/upload/foo", uploadValues); err == nil {
+		t.Fatal("expected directory upload without recursive to fail")
 	}
 
-	// Set an allowance for the renter, allowing a contract to be formed.
-	allowanceValues := url.Values{}
-	allowanceValues.Set("funds", testFunds)
-	allowanceValues.Set("period", testPeriod)
-	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
-		t.Fatal(err)
+	// The source must still be absolute.
+	uploadValues.Set("recursive", "true")
+	uploadValues.Set("source", "uploaddir")
+	if err = st.stdPostAPI("/renter/upload/foo", uploadValues); err == nil || !strings.Contains(err.Error(), "absolute path") {
+		t.Fatal("expected absolute path error, got", err)
 	}
 
-	// Create a file.
-	path1 := filepath.Join(st.dir, "test1.dat")
-	if err = createRandFile(path1, 512); err != nil {
+	uploadValues.Set("source", dir)
+	var rud RenterUploadDir
+	if err = st.postAPI("/renter/upload/foo", uploadValues, &rud); err != nil {
 		t.Fatal(err)
 	}
+	if rud.Queued != 3 {
+		t.Fatal("expected 3 files to be queued, got", rud.Queued)
+	}
 
-	// Upload to host.
-	uploadValues := url.Values{}
-	uploadValues.Set("source", path1)
-	if err = st.stdPostAPI("/renter/upload/test1", uploadValues); err != nil {
+	var rf RenterFiles
+	if err = st.getAPI("/renter/files", &rf); err != nil {
 		t.Fatal(err)
 	}
-
-	// Try renaming to an empty string.
-	renameValues.Set("newsiapath", "")
-	err = st.stdPostAPI("/renter/rename/test1", renameValues)
-	if err == nil || err.Error() != renter.ErrEmptyFilename.Error() {
-		t.Fatalf("expected error to be %v; got %v", renter.ErrEmptyFilename, err)
+	paths := make(map[string]bool)
+	for _, f := range rf.Files {
+		paths[f.SiaPath] = true
 	}
-
-	// Rename the file.
-	renameValues.Set("newsiapath", "newtest1")
-	if err = st.stdPostAPI("/renter/rename/test1", renameValues); err != nil {
-		t.Fatal(err)
+	if len(paths) != 3 || !paths["foo/a.dat"] || !paths["foo/sub/b.dat"] || !paths["foo/sub/subsub/c.dat"] {
+		t.Fatal("directory was not uploaded to the expected siapaths:", paths)
 	}
+}
 
-	// Should be able to continue uploading and downloading using the new name.
-	var rf RenterFiles
-	for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].UploadProgress < 10); i++ {
-		st.getAPI("/renter/files", &rf)
-		time.Sleep(100 * time.Millisecond)
-	}
-	if len(rf.Files) != 1 || rf.Files[0].UploadProgress < 10 {
-		t.Fatal("upload is not succeeding:", rf.Files[0])
+// TestRenterFilesPagination checks that /renter/files can be sorted and
+// paginated.
+func TestRenterFilesPagination(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
 	}
-	err = st.stdGetAPI("/renter/download/newtest1?destination=" + filepath.Join(st.dir, "testdown2.dat"))
+	t.Parallel()
+	st, err := createServerTester("TestRenterFilesPagination")
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer st.server.Close()
 
-	// Create and upload another file.
-	path2 := filepath.Join(st.dir, "test2.dat")
-	if err = createRandFile(path2, 512); err != nil {
+	// Anounce the host and start accepting contracts.
+	if err := st.announceHost(); err != nil {
 		t.Fatal(err)
 	}
-	uploadValues.Set("source", path2)
-	if err = st.stdPostAPI("/renter/upload/test2", uploadValues); err != nil {
+	if err = st.acceptContracts(); err != nil {
 		t.Fatal(err)
 	}
-	// Try renaming to a name that's already taken.
-	renameValues.Set("newsiapath", "newtest1")
-	err = st.stdPostAPI("/renter/rename/test2", renameValues)
-	if err == nil || err.Error() != renter.ErrPathOverload.Error() {
-		t.Errorf("expected error to be %v; got %v", renter.ErrPathOverload, err)
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload several files of varying sizes.
+	sizes := map[string]int{"a": 300, "b": 100, "c": 200, "d": 100}
+	for siaPath, size := range sizes {
+		path := filepath.Join(st.dir, siaPath+".dat")
+		if err = createRandFile(path, size); err != nil {
+			t.Fatal(err)
+		}
+		uploadValues := url.Values{}
+		uploadValues.Set("source", path)
+		if err = st.stdPostAPI("/renter/upload/"+siaPath, uploadValues); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"", "abcd"},
+		{"?order=desc", "dcba"},
+		{"?sort=filesize", "bdca"},
+		{"?sort=filesize&order=desc", "acbd"},
+		{"?limit=2", "ab"},
+		{"?offset=1&limit=2", "bc"},
+		{"?offset=3", "d"},
+		{"?offset=10", ""},
+		{"?sort=filesize&offset=1&limit=2", "dc"},
+	}
+	for _, test := range tests {
+		var rf RenterFiles
+		if err = st.getAPI("/renter/files"+test.query, &rf); err != nil {
+			t.Fatal(err)
+		}
+		var order string
+		for _, f := range rf.Files {
+			order += f.SiaPath
+		}
+		if order != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.query, test.expected, order)
+		}
+		if rf.Total != len(sizes) {
+			t.Errorf("%q: expected a total of %v, got %v", test.query, len(sizes), rf.Total)
+		}
+	}
+
+	// Invalid sort keys and orders should be rejected.
+	if err = st.getAPI("/renter/files?sort=name", &RenterFiles{}); err == nil || !strings.Contains(err.Error(), "invalid sort key") {
+		t.Error("expected an invalid sort key error, got", err)
+	}
+	if err = st.getAPI("/renter/files?order=up", &RenterFiles{}); err == nil || !strings.Contains(err.Error(), "invalid order") {
+		t.Error("expected an invalid order error, got", err)
 	}
 }
 
-// TestRenterHandlerDelete checks that deleting a valid file from the renter
-// goes as planned and that attempting to delete a nonexistent file fails with
-// the appropriate error.
-func TestRenterHandlerDelete(t *testing.T) {
+// TestRenterFileHandler checks that /renter/file returns the status of a
+// single file.
+func TestRenterFileHandler(t *testing.T) {
 	if testing.Short() {
 		t.SkipNow()
 	}
 	t.Parallel()
-	st, err := createServerTester("TestRenterHandlerDelete")
+	st, err := createServerTester("TestRenterFileHandler")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -608,47 +2137,43 @@ func TestRenterHandlerDelete(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// Create a file.
+	// Upload a nested file.
 	path := filepath.Join(st.dir, "test.dat")
 	if err = createRandFile(path, 1024); err != nil {
 		t.Fatal(err)
 	}
-
-	// Upload to host.
 	uploadValues := url.Values{}
 	uploadValues.Set("source", path)
-	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err != nil {
-		t.Fatal(err)
-	}
-
-	// Delete the file.
-	if err = st.stdPostAPI("/renter/delete/test", url.Values{}); err != nil {
+	if err = st.stdPostAPI("/renter/upload/foo/bar/test", uploadValues); err != nil {
 		t.Fatal(err)
 	}
 
-	// The renter's list of files should now be empty.
-	var files RenterFiles
-	if err = st.getAPI("/renter/files", &files); err != nil {
+	// Fetch the file.
+	var rf RenterFile
+	if err = st.getAPI("/renter/file/foo/bar/test", &rf); err != nil {
 		t.Fatal(err)
 	}
-	if len(files.Files) != 0 {
-		t.Fatalf("renter's list of files should be empty; got %v instead", files)
+	if rf.File.SiaPath != "foo/bar/test" || rf.File.Filesize != 1024 {
+		t.Fatal("unexpected file info:", rf.File)
 	}
 
-	// Try deleting a nonexistent file.
-	err = st.stdPostAPI("/renter/delete/dne", url.Values{})
-	if err == nil || err.Error() != renter.ErrUnknownPath.Error() {
-		t.Errorf("expected error to be %v, got %v", renter.ErrUnknownPath, err)
+	// Nonexistent files and folders should return an error.
+	for _, siaPath := range []string{"dne", "foo/bar", "foo/bar/"} {
+		err = st.getAPI("/renter/file/"+siaPath, &rf)
+		if err == nil || err.Error() != renter.ErrUnknownPath.Error() {
+			t.Errorf("%q: expected error to be %v, got %v", siaPath, renter.ErrUnknownPath, err)
+		}
 	}
 }
 
-// Tests that the /renter/upload call checks for relative paths.
-func TestRenterRelativePathErrorUpload(t *testing.T) {
+// TestRenterUploadErasureCode checks that the erasure coding parameters of an
+// upload are validated, stored with the file, and reported in its metadata.
+func TestRenterUploadErasureCode(t *testing.T) {
 	if testing.Short() {
 		t.SkipNow()
 	}
-	// TODO: t.Parallel()
-	st, err := createServerTester("TestRenterRelativePathErrorUpload")
+	t.Parallel()
+	st, err := createServerTester("TestRenterUploadErasureCode")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -673,43 +2198,56 @@ func TestRenterRelativePathErrorUpload(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	renterUploadAbsoluteError := "source must be an absolute path"
-
 	// Create a file.
 	path := filepath.Join(st.dir, "test.dat")
 	if err = createRandFile(path, 1024); err != nil {
 		t.Fatal(err)
 	}
 
-	// This should fail.
+	// An erasure code without data pieces should be rejected.
 	uploadValues := url.Values{}
-	uploadValues.Set("source", "test.dat")
-	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err.Error() != renterUploadAbsoluteError {
-		t.Fatal(err)
-	}
-
-	// As should this.
-	uploadValues = url.Values{}
-	uploadValues.Set("source", "../test.dat")
-	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err.Error() != renterUploadAbsoluteError {
-		t.Fatal(err)
-	}
-
-	// This should succeed.
-	uploadValues = url.Values{}
 	uploadValues.Set("source", path)
-	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err != nil {
-		t.Fatal(err)
+	uploadValues.Set("datapieces", "0")
+	uploadValues.Set("paritypieces", "1")
+	err = st.stdPostAPI("/renter/upload/zero", uploadValues)
+	if err == nil || err.Error() != renter.ErrZeroDataPieces.Error() {
+		t.Fatalf("expected error to be %v; got %v", renter.ErrZeroDataPieces, err)
+	}
+
+	// Upload the file with custom schemes, and check that the parameters are
+	// reported for each.
+	schemes := []struct {
+		siaPath      string
+		dataPieces   int
+		parityPieces int
+	}{
+		{"small", 2, 1},
+		{"large", 4, 8},
+	}
+	for _, scheme := range schemes {
+		uploadValues.Set("datapieces", strconv.Itoa(scheme.dataPieces))
+		uploadValues.Set("paritypieces", strconv.Itoa(scheme.parityPieces))
+		if err = st.stdPostAPI("/renter/upload/"+scheme.siaPath, uploadValues); err != nil {
+			t.Fatal(err)
+		}
+		var rf RenterFile
+		if err = st.getAPI("/renter/file/"+scheme.siaPath, &rf); err != nil {
+			t.Fatal(err)
+		}
+		if rf.File.DataPieces != scheme.dataPieces || rf.File.ParityPieces != scheme.parityPieces {
+			t.Errorf("%v: expected %v+%v, got %v+%v", scheme.siaPath, scheme.dataPieces, scheme.parityPieces, rf.File.DataPieces, rf.File.ParityPieces)
+		}
 	}
 }
 
-// Tests that the /renter/download call checks for relative paths.
-func TestRenterRelativePathErrorDownload(t *testing.T) {
+// TestRenterUploadIdempotencyKey checks that retrying an upload with the same
+// idempotency key returns the original result without creating another file.
+func TestRenterUploadIdempotencyKey(t *testing.T) {
 	if testing.Short() {
 		t.SkipNow()
 	}
 	t.Parallel()
-	st, err := createServerTester("TestRenterRelativePathErrorUpload")
+	st, err := createServerTester("TestRenterUploadIdempotencyKey")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -734,36 +2272,188 @@ func TestRenterRelativePathErrorDownload(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	renterDownloadAbsoluteError := "destination must be an absolute path"
-
 	// Create a file.
 	path := filepath.Join(st.dir, "test.dat")
 	if err = createRandFile(path, 1024); err != nil {
 		t.Fatal(err)
 	}
+
+	// Upload the file twice with the same key. Both uploads should succeed.
 	uploadValues := url.Values{}
 	uploadValues.Set("source", path)
-	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err != nil {
+	uploadValues.Set("idempotencykey", "foo")
+	err1 := st.stdPostAPI("/renter/upload/test", uploadValues)
+	err2 := st.stdPostAPI("/renter/upload/test", uploadValues)
+	if err1 != nil || err2 != nil {
+		t.Fatalf("expected both uploads to succeed, got %v and %v", err1, err2)
+	}
+
+	// Only one file should have been created.
+	var rf RenterFiles
+	if err = st.getAPI("/renter/files", &rf); err != nil {
 		t.Fatal(err)
 	}
+	if len(rf.Files) != 1 || rf.Files[0].SiaPath != "test" {
+		t.Fatal("expected a single uploaded file, got", rf.Files)
+	}
 
-	// This should fail.
-	downloadPath := "test1.dat"
-	if err = st.stdGetAPI("/renter/download/test?destination=" + downloadPath); err.Error() != renterDownloadAbsoluteError {
+	// Without the key, the retry is processed again and conflicts with the
+	// original upload.
+	uploadValues.Del("idempotencykey")
+	err = st.stdPostAPI("/renter/upload/test", uploadValues)
+	if err == nil || err.Error() != "upload failed: "+renter.ErrPathOverload.Error() {
+		t.Fatalf("expected %v, got %v", renter.ErrPathOverload, err)
+	}
+
+	// A failed upload is also replayed: reusing the key of an upload that
+	// conflicted returns the same error.
+	uploadValues.Set("idempotencykey", "bar")
+	err1 = st.stdPostAPI("/renter/upload/test", uploadValues)
+	err2 = st.stdPostAPI("/renter/upload/test", uploadValues)
+	if err1 == nil || err2 == nil || err1.Error() != err2.Error() {
+		t.Fatalf("expected matching errors, got %v and %v", err1, err2)
+	}
+}
+
+// TestRenterPricesHandler checks that /renter/prices reports the prices of the
+// announced hosts.
+func TestRenterPricesHandler(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterPricesHandler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+	stH1, err := blankServerTester("TestRenterPricesHandler - Host 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stH1.server.Close()
+	testGroup := []*serverTester{st, stH1}
+	if err = fullyConnectNodes(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = fundAllNodes(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = addStorageToAllHosts(testGroup); err != nil {
 		t.Fatal(err)
 	}
 
-	// This should fail.
-	downloadPath = "../test1.dat"
-	if err = st.stdGetAPI("/renter/download/test?destination=" + downloadPath); err.Error() != renterDownloadAbsoluteError {
+	// Give the hosts different prices.
+	priceValues := url.Values{}
+	priceValues.Set("mincontractprice", "20000000000000000000000000") // 20 SC
+	priceValues.Set("minstorageprice", "100000000000")
+	if err = st.stdPostAPI("/host", priceValues); err != nil {
+		t.Fatal(err)
+	}
+	priceValues.Set("mincontractprice", "40000000000000000000000000") // 40 SC
+	priceValues.Set("minstorageprice", "300000000000")
+	if err = stH1.stdPostAPI("/host", priceValues); err != nil {
+		t.Fatal(err)
+	}
+	if err = announceAllHosts(testGroup); err != nil {
 		t.Fatal(err)
 	}
 
-	// This should fail.
-	downloadPath = filepath.Join(st.dir, "test1.dat")
-	err = st.stdGetAPI("/renter/download/test?destination=" + downloadPath)
-	if err == nil {
-		t.Log(downloadPath)
-		t.Fatal("expecting an error")
+	// Without an allowance, more hosts are needed for an estimate.
+	var rp RenterPricesGET
+	if err = st.getAPI("/renter/prices", &rp); err == nil {
+		t.Fatal("expected an error when there are too few hosts for an estimate")
+	}
+
+	// Set an allowance that uses both hosts.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("hosts", "2")
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	var ah ActiveHosts
+	if err = st.getAPI("/hostdb/active", &ah); err != nil {
+		t.Fatal(err)
+	}
+	if len(ah.Hosts) != 2 {
+		t.Fatal("expected 2 active hosts, got", len(ah.Hosts))
+	}
+	averageStoragePrice := ah.Hosts[0].StoragePrice.Add(ah.Hosts[1].StoragePrice).Div64(2)
+	averageContractPrice := ah.Hosts[0].ContractPrice.Add(ah.Hosts[1].ContractPrice).Div64(2)
+
+	if err = st.getAPI("/renter/prices", &rp); err != nil {
+		t.Fatal(err)
+	}
+	if rp.AverageStoragePrice.Cmp(averageStoragePrice) != 0 || rp.MedianStoragePrice.Cmp(averageStoragePrice) != 0 {
+		t.Errorf("expected average and median storage price to be %v, got %v and %v", averageStoragePrice, rp.AverageStoragePrice, rp.MedianStoragePrice)
+	}
+	if rp.AverageContractPrice.Cmp(averageContractPrice) != 0 || rp.MedianContractPrice.Cmp(averageContractPrice) != 0 {
+		t.Errorf("expected average and median contract price to be %v, got %v and %v", averageContractPrice, rp.AverageContractPrice, rp.MedianContractPrice)
+	}
+	if rp.Hosts != 2 || fmt.Sprint(rp.Period) != testPeriod {
+		t.Error("estimate did not use the allowance:", rp.Hosts, rp.Period)
+	}
+	minStorageCost := averageStoragePrice.Mul(modules.BytesPerTerabyte).Mul64(2)
+	if rp.StorageTerabyteCost.Cmp(minStorageCost) <= 0 {
+		t.Errorf("expected storage cost to exceed %v, got %v", minStorageCost, rp.StorageTerabyteCost)
+	}
+}
+
+// TestRenterContractsFailures checks that /renter/contracts reports failed
+// contract formations when requested.
+func TestRenterContractsFailures(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterContractsFailures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host, but don't accept contracts.
+	if err = st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+	hostValues := url.Values{}
+	hostValues.Set("acceptingcontracts", "false")
+	if err = st.stdPostAPI("/host", hostValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Setting an allowance should fail, since the host rejects the contract.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err == nil {
+		t.Fatal("expected setting the allowance to fail")
+	}
+
+	// Failures are only reported when requested.
+	var rc RenterContracts
+	if err = st.getAPI("/renter/contracts", &rc); err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.Failures) != 0 {
+		t.Fatal("failures were reported without being requested:", rc.Failures)
+	}
+	if err = st.getAPI("/renter/contracts?failures=true", &rc); err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.Contracts) != 0 {
+		t.Fatal("expected no contracts, got", len(rc.Contracts))
+	}
+	if len(rc.Failures) != 1 {
+		t.Fatal("expected 1 failure, got", rc.Failures)
+	}
+	if !strings.Contains(rc.Failures[0].Error, "not accepting contracts") || rc.Failures[0].Time.IsZero() {
+		t.Error("unexpected failure:", rc.Failures[0])
 	}
 }
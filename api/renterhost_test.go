@@ -5,8 +5,11 @@ package api
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/url"
+	"os"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -14,6 +17,8 @@ import (
 	"time"
 
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/renter"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 // TestHostAndRentVanilla sets up an integration test where a host and renter
@@ -154,6 +159,43 @@ func TestHostAndRentVanilla(t *testing.T) {
 	if len(queue.Downloads) != 2 {
 		t.Fatalf("expected renter to have 1 download in the queue; got %v", len(queue.Downloads))
 	}
+
+	// Both downloads have completed, so none should be active.
+	if err = st.getAPI("/renter/downloads?status=completed", &queue); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.Downloads) != 2 {
+		t.Fatalf("expected 2 completed downloads; got %v", len(queue.Downloads))
+	}
+	for _, d := range queue.Downloads {
+		if d.Received != d.Filesize || d.StartTime.IsZero() || d.Error != "" {
+			t.Fatal("completed download has bad info:", d)
+		}
+	}
+	if err = st.getAPI("/renter/downloads?status=active", &queue); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.Downloads) != 0 {
+		t.Fatalf("expected 0 active downloads; got %v", len(queue.Downloads))
+	}
+	if err = st.getAPI("/renter/downloads?status=foo", &queue); err == nil {
+		t.Fatal("expected an error for an unknown status")
+	}
+
+	// Clearing the queue should remove both downloads.
+	var clear RenterDownloadsClear
+	if err = st.postAPI("/renter/downloads/clear", url.Values{}, &clear); err != nil {
+		t.Fatal(err)
+	}
+	if clear.Cleared != 2 {
+		t.Fatalf("expected 2 downloads to be cleared; got %v", clear.Cleared)
+	}
+	if err = st.getAPI("/renter/downloads", &queue); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.Downloads) != 0 {
+		t.Fatalf("expected an empty download queue; got %v", len(queue.Downloads))
+	}
 }
 
 // TestHostAndRentMultiHost sets up an integration test where three hosts and a
@@ -799,3 +841,1595 @@ func TestRenterParallelDelete(t *testing.T) {
 		t.Fatal("file was not deleted properly:", rf.Files)
 	}
 }
+
+// TestRenterDownloadSection tests downloading a section of a file, and
+// resuming a partial download using an offset.
+func TestRenterDownloadSection(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterDownloadSection")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	if err = st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", "10")
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a file that spans several chunks.
+	path := filepath.Join(st.dir, "test.dat")
+	fileSize := modules.SectorSize*3 + 100
+	if err = createRandFile(path, int(fileSize)); err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].UploadProgress < 10); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].UploadProgress < 10 {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+	orig, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Download a range from the middle of the file, crossing a chunk
+	// boundary.
+	offset, length := modules.SectorSize-10, modules.SectorSize+20
+	downpath := filepath.Join(st.dir, "middle.dat")
+	err = st.stdGetAPI(fmt.Sprintf("/renter/download/test?destination=%v&offset=%v&length=%v", downpath, offset, length))
+	if err != nil {
+		t.Fatal(err)
+	}
+	download, err := ioutil.ReadFile(downpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(download, orig[offset:offset+length]) {
+		t.Fatal("data mismatch when downloading a section of a file")
+	}
+
+	// Download the first part of the file, then resume from where it left
+	// off.
+	split := modules.SectorSize + 50
+	firstpath := filepath.Join(st.dir, "first.dat")
+	err = st.stdGetAPI(fmt.Sprintf("/renter/download/test?destination=%v&length=%v", firstpath, split))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restpath := filepath.Join(st.dir, "rest.dat")
+	err = st.stdGetAPI(fmt.Sprintf("/renter/download/test?destination=%v&offset=%v", restpath, split))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := ioutil.ReadFile(firstpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest, err := ioutil.ReadFile(restpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(append(first, rest...), orig) {
+		t.Fatal("data mismatch when resuming a download")
+	}
+
+	// Out-of-range requests should fail.
+	err = st.stdGetAPI(fmt.Sprintf("/renter/download/test?destination=%v&offset=%v", downpath, fileSize))
+	if err == nil || !strings.Contains(err.Error(), renter.ErrDownloadOffset.Error()) {
+		t.Fatalf("expected %v, got %v", renter.ErrDownloadOffset, err)
+	}
+	err = st.stdGetAPI(fmt.Sprintf("/renter/download/test?destination=%v&offset=10&length=%v", downpath, fileSize))
+	if err == nil || !strings.Contains(err.Error(), renter.ErrDownloadLength.Error()) {
+		t.Fatalf("expected %v, got %v", renter.ErrDownloadLength, err)
+	}
+}
+
+// TestRenterUploadReportContracts tests that /renter/upload reports the
+// contracts storing a file when reportcontracts is set, and that the same
+// contracts are listed by /renter/file.
+func TestRenterUploadReportContracts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterUploadReportContracts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and form a contract.
+	if err = st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a file, waiting for its first piece to be placed.
+	path := filepath.Join(st.dir, "test.dat")
+	if err = createRandFile(path, 1024); err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	uploadValues.Set("reportcontracts", "true")
+	var rup RenterUploadPOST
+	if err = st.postAPI("/renter/upload/test", uploadValues, &rup); err != nil {
+		t.Fatal(err)
+	}
+	if len(rup.Contracts) == 0 {
+		t.Fatal("upload did not report any contracts")
+	}
+
+	// The reported contracts should be among the renter's active contracts.
+	var rc RenterContracts
+	if err = st.getAPI("/renter/contracts", &rc); err != nil {
+		t.Fatal(err)
+	}
+	active := make(map[types.FileContractID]struct{})
+	for _, c := range rc.Contracts {
+		active[c.ID] = struct{}{}
+	}
+	for _, id := range rup.Contracts {
+		if _, exists := active[id]; !exists {
+			t.Fatal("reported contract is not an active contract:", id)
+		}
+	}
+
+	// /renter/file should list the contracts as well.
+	var rf RenterFile
+	if err = st.getAPI("/renter/file/test", &rf); err != nil {
+		t.Fatal(err)
+	}
+	if len(rf.File.Contracts) < len(rup.Contracts) {
+		t.Fatalf("expected at least %v contracts for the file, got %v", len(rup.Contracts), len(rf.File.Contracts))
+	}
+	for _, id := range rf.File.Contracts {
+		if _, exists := active[id]; !exists {
+			t.Fatal("file lists a contract that is not active:", id)
+		}
+	}
+}
+
+// TestRenterUploadReportContractsTimeout tests that /renter/upload succeeds
+// with an empty list of contracts if no piece is placed before the call stops
+// waiting.
+func TestRenterUploadReportContractsTimeout(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	// Not parallel: the test shortens the package-level placement timeout.
+	defer func(timeout time.Duration) { uploadPlacementTimeout = timeout }(uploadPlacementTimeout)
+	uploadPlacementTimeout = time.Nanosecond
+
+	st, err := createServerTester("TestRenterUploadReportContractsTimeout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and form a contract.
+	if err = st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// The call should give up waiting before the first piece is placed.
+	path := filepath.Join(st.dir, "test.dat")
+	if err = createRandFile(path, 1024); err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	uploadValues.Set("reportcontracts", "true")
+	var rup RenterUploadPOST
+	if err = st.postAPI("/renter/upload/test", uploadValues, &rup); err != nil {
+		t.Fatal(err)
+	}
+	if rup.Contracts == nil || len(rup.Contracts) != 0 {
+		t.Fatal("expected an empty list of contracts, got", rup.Contracts)
+	}
+
+	// The upload should continue in the background.
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].UploadProgress < 10); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].UploadProgress < 10 {
+		t.Fatal("the upload did not continue after the call returned:", rf.Files)
+	}
+}
+
+// TestRenterUploadReplication tests the upload and download pipeline using a
+// replication code instead of Reed-Solomon.
+func TestRenterUploadReplication(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterUploadReplication")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and form a contract.
+	if err = st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a file that spans several chunks, storing a single replica on
+	// the host.
+	path := filepath.Join(st.dir, "test.dat")
+	fileSize := modules.SectorSize*2 + 100
+	if err = createRandFile(path, int(fileSize)); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := renter.NewReplicationCode(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.renter.Upload(modules.FileUploadParams{
+		Source:      path,
+		SiaPath:     "test",
+		ErasureCode: rc,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].UploadProgress < 100); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].UploadProgress < 100 {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+	if rf.Files[0].DataPieces != 1 || rf.Files[0].ParityPieces != 0 {
+		t.Fatal("file does not report the replication code:", rf.Files[0])
+	}
+
+	// Download the file and compare it to the original.
+	downpath := filepath.Join(st.dir, "down.dat")
+	if err = st.stdGetAPI("/renter/download/test?destination=" + downpath); err != nil {
+		t.Fatal(err)
+	}
+	orig, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	download, err := ioutil.ReadFile(downpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(orig, download) {
+		t.Fatal("data mismatch when downloading a replicated file")
+	}
+}
+
+// TestRenterDownloadStream tests downloading a file, and a section of a file,
+// through the response body.
+func TestRenterDownloadStream(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterDownloadStream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	if err = st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", "10")
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a file that spans several chunks.
+	path := filepath.Join(st.dir, "test.dat")
+	fileSize := modules.SectorSize*3 + 100
+	if err = createRandFile(path, int(fileSize)); err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	if err = st.stdPostAPI("/renter/upload/foo/test.dat", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].UploadProgress < 10); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].UploadProgress < 10 {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+	orig, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Download the whole file through the response body.
+	resp, err := HttpGET("http://" + st.server.listener.Addr().String() + "/renter/download/foo/test.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	download, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status code:", resp.StatusCode, string(download))
+	}
+	if resp.ContentLength != int64(fileSize) {
+		t.Fatalf("expected Content-Length %v, got %v", fileSize, resp.ContentLength)
+	}
+	if cd := resp.Header.Get("Content-Disposition"); cd != `attachment; filename=test.dat` {
+		t.Fatal("unexpected Content-Disposition:", cd)
+	}
+	if !bytes.Equal(download, orig) {
+		t.Fatal("data mismatch when streaming a download")
+	}
+
+	// Download a section of the file through the response body.
+	offset, length := modules.SectorSize-10, modules.SectorSize+20
+	resp, err = HttpGET(fmt.Sprintf("http://%v/renter/download/foo/test.dat?offset=%v&length=%v", st.server.listener.Addr(), offset, length))
+	if err != nil {
+		t.Fatal(err)
+	}
+	download, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ContentLength != int64(length) {
+		t.Fatalf("expected Content-Length %v, got %v", length, resp.ContentLength)
+	}
+	if !bytes.Equal(download, orig[offset:offset+length]) {
+		t.Fatal("data mismatch when streaming a section of a file")
+	}
+
+	// Requests for unknown files or out-of-range sections should fail.
+	if err = st.stdGetAPI("/renter/download/bar"); err == nil {
+		t.Fatal("expected an error when streaming an unknown file")
+	}
+	err = st.stdGetAPI(fmt.Sprintf("/renter/download/foo/test.dat?offset=%v", fileSize))
+	if err == nil || !strings.Contains(err.Error(), renter.ErrDownloadOffset.Error()) {
+		t.Fatalf("expected %v, got %v", renter.ErrDownloadOffset, err)
+	}
+}
+
+// TestRenterContractSpending checks that /renter/contracts reports the
+// spending on each contract, and that the spending adds up to the total cost
+// of the contract.
+func TestRenterContractSpending(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterContractSpending")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and start accepting contracts.
+	if err = st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Set an allowance for the renter, allowing a contract to be formed.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// checkContracts checks that the spending of each contract adds up.
+	checkContracts := func() []RenterContract {
+		var rc RenterContracts
+		if err := st.getAPI("/renter/contracts", &rc); err != nil {
+			t.Fatal(err)
+		}
+		if len(rc.Contracts) != 1 {
+			t.Fatalf("expected renter to have 1 contract; got %v", len(rc.Contracts))
+		}
+		for _, c := range rc.Contracts {
+			if c.FeeSpending.IsZero() {
+				t.Error("expected contract to have non-zero fee spending")
+			}
+			sum := c.RenterFunds.Add(c.DownloadSpending).Add(c.FeeSpending).Add(c.StorageSpending).Add(c.UploadSpending)
+			if sum.Cmp(c.TotalCost) != 0 {
+				t.Errorf("contract spending does not add up: %v + spending = %v, total cost is %v", c.RenterFunds, sum, c.TotalCost)
+			}
+		}
+		return rc.Contracts
+	}
+	contract := checkContracts()[0]
+	if !contract.UploadSpending.IsZero() || !contract.StorageSpending.IsZero() || !contract.DownloadSpending.IsZero() {
+		t.Fatal("expected a new contract to have no upload, storage, or download spending:", contract)
+	}
+
+	// Upload a file.
+	path := filepath.Join(st.dir, "test.dat")
+	if err = createRandFile(path, 1024); err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].UploadProgress < 10); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].UploadProgress < 10 {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+	contract = checkContracts()[0]
+	if contract.UploadSpending.IsZero() || contract.StorageSpending.IsZero() {
+		t.Fatal("expected upload and storage spending after uploading:", contract)
+	}
+	if !contract.DownloadSpending.IsZero() {
+		t.Fatal("expected no download spending before downloading:", contract)
+	}
+
+	// Download the file.
+	downpath := filepath.Join(st.dir, "testdown.dat")
+	if err = st.stdGetAPI("/renter/download/test?destination=" + downpath); err != nil {
+		t.Fatal(err)
+	}
+	downloaded := checkContracts()[0]
+	if downloaded.DownloadSpending.IsZero() {
+		t.Fatal("expected download spending after downloading:", downloaded)
+	}
+	if downloaded.UploadSpending.Cmp(contract.UploadSpending) != 0 || downloaded.StorageSpending.Cmp(contract.StorageSpending) != 0 {
+		t.Fatal("downloading should not change upload or storage spending")
+	}
+}
+
+// TestRenterContractsMetrics checks that /renter/contracts/metrics summarizes
+// the negotiation of the renter's contracts.
+func TestRenterContractsMetrics(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterContractsMetrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Without any contracts, the metrics should be empty.
+	var rcm RenterContractsMetricsGET
+	if err = st.getAPI("/renter/contracts/metrics", &rcm); err != nil {
+		t.Fatal(err)
+	}
+	if rcm.Contracts != 0 || rcm.Dial.Max != 0 {
+		t.Fatal("expected empty metrics, got", rcm)
+	}
+
+	// Announce the host and form a contract.
+	if err = st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = st.getAPI("/renter/contracts/metrics", &rcm); err != nil {
+		t.Fatal(err)
+	}
+	if rcm.Contracts != 1 {
+		t.Fatal("expected metrics for 1 contract, got", rcm.Contracts)
+	}
+	for _, pm := range []NegotiationPhaseMetrics{rcm.Dial, rcm.VerifySettings, rcm.FundAndSign, rcm.Exchange, rcm.Submit} {
+		// with a single contract, the min, max, and average are the same
+		if pm.Min <= 0 || pm.Min != pm.Max || pm.Min != pm.Avg {
+			t.Error("bad phase metrics:", pm)
+		}
+	}
+}
+
+// TestRenterStorageUtilization checks that /renter reports the amount of data
+// stored by the renter and how much of the contracted storage it uses.
+func TestRenterStorageUtilization(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterStorageUtilization")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Announce the host and form a contract.
+	if err = st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+	// Estimate the size of the contracts before forming them.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	allowanceValues.Set("dryrun", "true")
+	var rep RenterEstimatePOST
+	if err = st.postAPI("/renter", allowanceValues, &rep); err != nil {
+		t.Fatal(err)
+	}
+	allowanceValues.Del("dryrun")
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing has been stored yet, but the contracts have been paid for.
+	var rg RenterGET
+	if err = st.getAPI("/renter", &rg); err != nil {
+		t.Fatal(err)
+	}
+	if rg.TotalStored != 0 || rg.Utilization != 0 {
+		t.Fatal("expected no stored data, got", rg.TotalStored, rg.Utilization)
+	}
+	if rg.ActiveContracts != 1 {
+		t.Fatal("expected 1 contract, got", rg.ActiveContracts)
+	}
+	capacity := rep.Filesize
+	if capacity == 0 || rg.ContractedCapacity != capacity {
+		t.Fatalf("expected contracted capacity of %v, got %v", capacity, rg.ContractedCapacity)
+	}
+
+	// Upload a file and wait for it to reach the host.
+	path := filepath.Join(st.dir, "test.dat")
+	fileSize := 1024
+	if err = createRandFile(path, fileSize); err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].UploadProgress < 10); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].UploadProgress < 10 {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+
+	// The file should be reflected in the storage metrics.
+	if err = st.getAPI("/renter", &rg); err != nil {
+		t.Fatal(err)
+	}
+	if rg.TotalStored != uint64(fileSize) {
+		t.Fatalf("expected %v bytes stored, got %v", fileSize, rg.TotalStored)
+	}
+	if rg.ContractedCapacity != capacity {
+		t.Fatalf("uploading changed the contracted capacity from %v to %v", capacity, rg.ContractedCapacity)
+	}
+	if expected := 100 * float64(fileSize) / float64(capacity); rg.Utilization != expected {
+		t.Fatalf("expected utilization of %v%%, got %v%%", expected, rg.Utilization)
+	}
+}
+
+// TestRenterUploadError checks that a file that cannot be repaired to its
+// target redundancy reports an upload error in /renter/files.
+func TestRenterUploadError(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterUploadError")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Form a contract with the only host.
+	if err = st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a file. With the default erasure coding, a single host can only
+	// store one piece of each chunk.
+	path := filepath.Join(st.dir, "test.dat")
+	if err = createRandFile(path, 1024); err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].UploadError == ""); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].UploadError == "" {
+		t.Fatal("file did not report an upload error:", rf.Files)
+	}
+	target := float64(rf.Files[0].DataPieces+rf.Files[0].ParityPieces) / float64(rf.Files[0].DataPieces)
+	if rf.Files[0].Redundancy >= target {
+		t.Fatalf("expected redundancy below %v, got %v", target, rf.Files[0].Redundancy)
+	}
+}
+
+// TestRenterRepair checks that POST /renter/repair restores the redundancy
+// of a degraded file once a new host is available.
+func TestRenterRepair(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterRepair - Host1andRenter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+	stH1, err := blankServerTester("TestRenterRepair - Host 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stH1.server.Close()
+	testGroup := []*serverTester{st, stH1}
+
+	if err = fullyConnectNodes(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = fundAllNodes(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = addStorageToAllHosts(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = announceAllHosts(testGroup); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the first host accepts contracts, so the file can only be stored
+	// at half of its target redundancy.
+	rejectValues := url.Values{}
+	rejectValues.Set("acceptingcontracts", "false")
+	if err = stH1.stdPostAPI("/host", rejectValues); err != nil {
+		t.Fatal(err)
+	}
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("hosts", "2")
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(st.dir, "test.dat")
+	if err = createRandFile(path, 1024); err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	uploadValues.Set("datapieces", "1")
+	uploadValues.Set("paritypieces", "1")
+	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].Redundancy < 1); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].Redundancy != 1 {
+		t.Fatal("expected the file to be uploaded at a redundancy of 1:", rf.Files)
+	}
+
+	// Once the second host accepts contracts, the contractor forms a contract
+	// with it on the next block.
+	acceptValues := url.Values{}
+	acceptValues.Set("acceptingcontracts", "true")
+	if err = stH1.stdPostAPI("/host", acceptValues); err != nil {
+		t.Fatal(err)
+	}
+	var rg RenterGET
+	for i := 0; i < 50 && rg.ActiveContracts != 2; i++ {
+		if _, err = st.miner.AddBlock(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(200 * time.Millisecond)
+		st.getAPI("/renter", &rg)
+	}
+	if rg.ActiveContracts != 2 {
+		t.Fatal("expected a contract with the second host, got", rg.ActiveContracts, "contracts")
+	}
+
+	// Repairing should queue the degraded file, and the repair loop should
+	// upload its missing pieces to the new host.
+	var rp RenterRepairPOST
+	if err = st.postAPI("/renter/repair", url.Values{}, &rp); err != nil {
+		t.Fatal(err)
+	}
+	if rp.FilesNeedingRepair != 1 {
+		t.Fatal("expected 1 file to need repair, got", rp.FilesNeedingRepair)
+	}
+	for i := 0; i < 200 && rf.Files[0].Redundancy < 2; i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if rf.Files[0].Redundancy != 2 {
+		t.Fatal("repair did not restore the file's redundancy:", rf.Files[0].Redundancy)
+	}
+
+	// A fully redundant file should not be queued again.
+	if err = st.postAPI("/renter/repair", url.Values{}, &rp); err != nil {
+		t.Fatal(err)
+	}
+	if rp.FilesNeedingRepair != 0 {
+		t.Fatal("expected no files to need repair, got", rp.FilesNeedingRepair)
+	}
+}
+
+// TestRenterContractsWarning checks that /renter reports the number of active
+// and target contracts, and warns when fewer contracts were formed than the
+// allowance requests.
+func TestRenterContractsWarning(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterContractsWarning - Host1andRenter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+	stH1, err := blankServerTester("TestRenterContractsWarning - Host 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stH1.server.Close()
+	stH2, err := blankServerTester("TestRenterContractsWarning - Host 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stH2.server.Close()
+	testGroup := []*serverTester{st, stH1, stH2}
+
+	// Without an allowance, there is nothing to warn about.
+	var get RenterGET
+	if err = st.getAPI("/renter", &get); err != nil {
+		t.Fatal(err)
+	}
+	if get.ActiveContracts != 0 || get.TargetContracts != 0 || get.ContractsWarning {
+		t.Fatalf("expected no contracts and no warning, got %v/%v/%v", get.ActiveContracts, get.TargetContracts, get.ContractsWarning)
+	}
+
+	// Announce all three hosts so that the renter's hostdb knows about them.
+	if err = fullyConnectNodes(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = fundAllNodes(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = addStorageToAllHosts(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = announceAllHosts(testGroup); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only one of the hosts remains available for contracts.
+	rejectValues := url.Values{}
+	rejectValues.Set("acceptingcontracts", "false")
+	for _, h := range []*serverTester{stH1, stH2} {
+		if err = h.stdPostAPI("/host", rejectValues); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("hosts", "3")
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = st.getAPI("/renter", &get); err != nil {
+		t.Fatal(err)
+	}
+	if get.ActiveContracts != 1 {
+		t.Error("expected 1 active contract, got", get.ActiveContracts)
+	}
+	if get.TargetContracts != 3 {
+		t.Error("expected 3 target contracts, got", get.TargetContracts)
+	}
+	if !get.ContractsWarning {
+		t.Error("expected a warning when fewer contracts than requested were formed")
+	}
+}
+
+// TestRenterUploadCancel checks that an in-progress upload can be canceled,
+// and that canceling an unknown or completed upload fails.
+func TestRenterUploadCancel(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterUploadCancel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Form a contract with the host.
+	if err = st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Canceling an unknown upload should fail.
+	err = st.stdPostAPI("/renter/uploads/cancel/dne", url.Values{})
+	if err == nil || err.Error() != renter.ErrUnknownPath.Error() {
+		t.Fatalf("expected %v, got %v", renter.ErrUnknownPath, err)
+	}
+
+	// Start a large upload. With the default erasure coding, a single host
+	// can never bring the upload to completion.
+	path := filepath.Join(st.dir, "large.dat")
+	if err = createRandFile(path, int(200*modules.SectorSize)); err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	if err = st.stdPostAPI("/renter/upload/large", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].UploadProgress == 0); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].UploadProgress == 0 {
+		t.Fatal("upload did not start:", rf.Files)
+	}
+
+	// Cancel the upload mid-flight.
+	if err = st.stdPostAPI("/renter/uploads/cancel/large", url.Values{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.getAPI("/renter/files", &rf); err != nil {
+		t.Fatal(err)
+	}
+	if len(rf.Files) != 0 {
+		t.Fatal("canceled upload is still listed:", rf.Files)
+	}
+	err = st.stdPostAPI("/renter/uploads/cancel/large", url.Values{})
+	if err == nil || err.Error() != renter.ErrUnknownPath.Error() {
+		t.Fatalf("expected %v, got %v", renter.ErrUnknownPath, err)
+	}
+
+	// The uploaded pieces should be removed from the host, and no more
+	// pieces should be uploaded.
+	var rc RenterContracts
+	for i := 0; i < 200; i++ {
+		if err = st.getAPI("/renter/contracts", &rc); err != nil {
+			t.Fatal(err)
+		}
+		if len(rc.Contracts) == 1 && rc.Contracts[0].Size == 0 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(rc.Contracts) != 1 || rc.Contracts[0].Size != 0 {
+		t.Fatal("pieces of the canceled upload were not removed from the host:", rc.Contracts)
+	}
+	if _, err = os.Stat(filepath.Join(st.dir, "renter", "large"+renter.ShareExtension)); !os.IsNotExist(err) {
+		t.Fatal("metadata of the canceled upload was not removed:", err)
+	}
+
+	// Canceling a completed upload should fail.
+	path = filepath.Join(st.dir, "small.dat")
+	if err = createRandFile(path, 1024); err != nil {
+		t.Fatal(err)
+	}
+	uploadValues = url.Values{}
+	uploadValues.Set("source", path)
+	uploadValues.Set("datapieces", "1")
+	uploadValues.Set("paritypieces", "0")
+	if err = st.stdPostAPI("/renter/upload/small", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].UploadProgress < 100); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].UploadProgress < 100 {
+		t.Fatal("upload did not complete:", rf.Files)
+	}
+	if err = st.stdPostAPI("/renter/uploads/cancel/small", url.Values{}); err == nil {
+		t.Fatal("expected an error when canceling a completed upload")
+	}
+}
+
+// TestRenterUploadDeduplication checks that uploading a file identical to a
+// previously uploaded file references the sectors that are already stored on
+// the host, and that the sectors remain usable after the first file is
+// deleted.
+func TestRenterUploadDeduplication(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterUploadDeduplication")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Form a contract with the host.
+	if err = st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// uploadFile uploads the file at path to siapath and returns the size of
+	// the renter's contract once the host stores a piece of every chunk.
+	path := filepath.Join(st.dir, "test.dat")
+	if err = createRandFile(path, int(20*modules.SectorSize)); err != nil {
+		t.Fatal(err)
+	}
+	uploadFile := func(siapath string) uint64 {
+		uploadValues := url.Values{}
+		uploadValues.Set("source", path)
+		if err := st.stdPostAPI("/renter/upload/"+siapath, uploadValues); err != nil {
+			t.Fatal(err)
+		}
+		// With a single host, only one of the 9 pieces of each chunk can be
+		// uploaded.
+		var rf RenterFile
+		for i := 0; i < 200 && rf.File.UploadProgress < 11; i++ {
+			st.getAPI("/renter/file/"+siapath, &rf)
+			time.Sleep(100 * time.Millisecond)
+		}
+		if rf.File.UploadProgress < 11 {
+			t.Fatal("upload did not succeed:", rf.File)
+		}
+		var rc RenterContracts
+		if err := st.getAPI("/renter/contracts", &rc); err != nil {
+			t.Fatal(err)
+		}
+		if len(rc.Contracts) != 1 {
+			t.Fatal("expected 1 contract, got", len(rc.Contracts))
+		}
+		return rc.Contracts[0].Size
+	}
+
+	// The second upload of the same file should not transfer any sectors.
+	firstSize := uploadFile("original")
+	if firstSize == 0 {
+		t.Fatal("first upload did not store any data on the host")
+	}
+	secondSize := uploadFile("copy")
+	if secondSize-firstSize > firstSize/10 {
+		t.Fatalf("second upload grew the contract from %v to %v bytes", firstSize, secondSize)
+	}
+
+	// Deleting the original must not affect the copy.
+	if err = st.stdPostAPI("/renter/delete/original", url.Values{}); err != nil {
+		t.Fatal(err)
+	}
+	downpath := filepath.Join(st.dir, "copy.dat")
+	if err = st.stdGetAPI("/renter/download/copy?destination=" + downpath); err != nil {
+		t.Fatal(err)
+	}
+	orig, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	download, err := ioutil.ReadFile(downpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(orig, download) {
+		t.Fatal("data mismatch when downloading the deduplicated file")
+	}
+}
+
+// TestRenterUploadPinnedHost checks that a file pinned to a host only has its
+// pieces uploaded to that host.
+func TestRenterUploadPinnedHost(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterUploadPinnedHost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+	stH1, err := blankServerTester("TestRenterUploadPinnedHost - Host 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stH1.server.Close()
+	stH2, err := blankServerTester("TestRenterUploadPinnedHost - Host 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stH2.server.Close()
+	testGroup := []*serverTester{st, stH1, stH2}
+
+	// Connect the testers, fund them, and announce every host.
+	if err = fullyConnectNodes(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = fundAllNodes(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = addStorageToAllHosts(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = announceAllHosts(testGroup); err != nil {
+		t.Fatal(err)
+	}
+
+	// Form a contract with each host.
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", "50000000000000000000000000000") // 50k SC
+	allowanceValues.Set("hosts", "3")
+	allowanceValues.Set("period", "5")
+	allowanceValues.Set("renewwindow", "2")
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+	var rc RenterContracts
+	if err = st.getAPI("/renter/contracts", &rc); err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.Contracts) != 3 {
+		t.Fatal("expected 3 contracts, got", len(rc.Contracts))
+	}
+	pinned := rc.Contracts[0].HostPublicKey
+
+	// Create a file to upload.
+	path := filepath.Join(st.dir, "test.dat")
+	if err = createRandFile(path, 1024); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pinning the upload to a host without a contract should fail.
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	uploadValues.Set("hosts", "ed25519:"+strings.Repeat("00", 32))
+	err = st.stdPostAPI("/renter/upload/unknown", uploadValues)
+	if err == nil || !strings.Contains(err.Error(), "no contract with pinned host") {
+		t.Fatal("expected upload to an unknown host to fail, got", err)
+	}
+
+	// Pin the upload to a single host. Only one of the 9 pieces of each
+	// chunk can be uploaded to it.
+	uploadValues.Set("hosts", pinned)
+	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFile
+	for i := 0; i < 200 && rf.File.UploadProgress < 11; i++ {
+		st.getAPI("/renter/file/test", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if rf.File.UploadProgress < 11 {
+		t.Fatal("upload did not succeed:", rf.File)
+	}
+
+	// Give the renter a chance to upload to the other hosts, then check that
+	// only the pinned host stores data.
+	time.Sleep(time.Second)
+	if err = st.getAPI("/renter/contracts", &rc); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range rc.Contracts {
+		if c.HostPublicKey == pinned && c.Size == 0 {
+			t.Error("pinned host does not store any data")
+		} else if c.HostPublicKey != pinned && c.Size != 0 {
+			t.Errorf("host %v is not pinned, but stores %v bytes", c.HostPublicKey, c.Size)
+		}
+	}
+}
+
+// TestRenterBackupRestore checks that a renter whose state has been wiped can
+// recover its files and contracts from a backup, and download its files
+// again.
+func TestRenterBackupRestore(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterBackupRestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+
+	// Form a contract with the host and upload a file.
+	if err = st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.acceptContracts(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.setHostStorage(); err != nil {
+		t.Fatal(err)
+	}
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(st.dir, "test.dat")
+	if err = createRandFile(path, 1024); err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	if err = st.stdPostAPI("/renter/upload/foo/test.dat", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || !rf.Files[0].Available); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || !rf.Files[0].Available {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+
+	// Back up the renter.
+	resp, err := HttpGET("http://" + st.server.listener.Addr().String() + "/renter/backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status code:", resp.StatusCode, string(backup))
+	}
+
+	// Wipe the renter's state by replacing it with a new renter.
+	if err = st.renter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := renter.New(st.cs, st.wallet, st.tpool, filepath.Join(st.dir, "restored "+modules.RenterDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.renter = r
+	st.server.api.renter = r
+	if err = st.getAPI("/renter/files", &rf); err != nil {
+		t.Fatal(err)
+	}
+	var rc RenterContracts
+	if err = st.getAPI("/renter/contracts", &rc); err != nil {
+		t.Fatal(err)
+	}
+	if len(rf.Files) != 0 || len(rc.Contracts) != 0 {
+		t.Fatal("new renter should have no files or contracts:", rf.Files, rc.Contracts)
+	}
+
+	// A corrupted backup should be rejected.
+	resp, err = HttpPOST("http://"+st.server.listener.Addr().String()+"/renter/restore", "not a backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatal("expected a corrupted backup to be rejected, got status", resp.StatusCode)
+	}
+
+	// Restore the backup.
+	resp, err = HttpPOST("http://"+st.server.listener.Addr().String()+"/renter/restore", string(backup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if non2xx(resp.StatusCode) {
+		t.Fatal(decodeError(resp))
+	}
+	resp.Body.Close()
+	if err = st.getAPI("/renter/files", &rf); err != nil {
+		t.Fatal(err)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].SiaPath != "foo/test.dat" {
+		t.Fatal("file was not restored:", rf.Files)
+	}
+	if err = st.getAPI("/renter/contracts", &rc); err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.Contracts) != 1 {
+		t.Fatal("contract was not restored:", rc.Contracts)
+	}
+
+	// The new renter learns about the host from the blockchain, after which
+	// the restored file can be downloaded.
+	var ah ActiveHosts
+	for i := 0; i < 50 && len(ah.Hosts) == 0; i++ {
+		st.getAPI("/hostdb/active", &ah)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(ah.Hosts) == 0 {
+		t.Fatal("restored renter did not find the host")
+	}
+	downpath := filepath.Join(st.dir, "testdown.dat")
+	if err = st.stdGetAPI("/renter/download/foo/test.dat?destination=" + downpath); err != nil {
+		t.Fatal(err)
+	}
+	orig, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	download, err := ioutil.ReadFile(downpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(orig, download) {
+		t.Fatal("data mismatch when downloading a restored file")
+	}
+}
+
+// TestRenterFilesETag tests that /renter/files honors If-None-Match, returning
+// 304 while the file list is unchanged and 200 once a file is uploaded. The
+// file is stored on several hosts, so that its info lists several contracts.
+func TestRenterFilesETag(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterFilesETag - Host1andRenter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+	stH1, err := blankServerTester("TestRenterFilesETag - Host2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stH1.server.Close()
+	testGroup := []*serverTester{st, stH1}
+
+	// Connect the testers, fund them, and announce both hosts.
+	if err = fullyConnectNodes(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = fundAllNodes(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = addStorageToAllHosts(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = announceAllHosts(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("hosts", "2")
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// getFiles fetches /renter/files with the given ETag, returning the status
+	// code and the ETag of the response.
+	getFiles := func(etag string) (int, string) {
+		req, err := http.NewRequest("GET", "http://"+st.server.listener.Addr().String()+"/renter/files", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("User-Agent", "Sia-Agent")
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode, resp.Header.Get("ETag")
+	}
+
+	// Fetch the empty file list, then fetch it again with its ETag.
+	code, etag := getFiles("")
+	if code != http.StatusOK {
+		t.Fatal("expected 200, got", code)
+	} else if etag == "" {
+		t.Fatal("response is missing an ETag")
+	}
+	if code, _ := getFiles(etag); code != http.StatusNotModified {
+		t.Fatal("expected 304 for an unchanged file list, got", code)
+	}
+
+	// Upload a file with 1-of-2 redundancy; the old ETag should no longer
+	// match.
+	path := filepath.Join(st.dir, "test.dat")
+	if err = createRandFile(path, 1024); err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	uploadValues.Set("datapieces", "1")
+	uploadValues.Set("paritypieces", "1")
+	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+	code, newETag := getFiles(etag)
+	if code != http.StatusOK {
+		t.Fatal("expected 200 after an upload, got", code)
+	} else if newETag == etag {
+		t.Fatal("ETag did not change after an upload")
+	}
+
+	// Wait for the upload to land on both hosts.
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].UploadProgress < 100 || len(rf.Files[0].Contracts) != 2); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].UploadProgress < 100 || len(rf.Files[0].Contracts) != 2 {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+
+	// Now that the file is stored on several contracts, its ETag should
+	// still be stable across requests.
+	_, etag = getFiles("")
+	for i := 0; i < 10; i++ {
+		if code, _ := getFiles(etag); code != http.StatusNotModified {
+			t.Fatal("expected 304 for an unchanged file list, got", code)
+		}
+	}
+}
+
+// TestRenterDownloadCorruptSector tests that a download succeeds from parity
+// when one host sends corrupt sector data, and that the bad piece is logged.
+func TestRenterDownloadCorruptSector(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester("TestRenterDownloadCorruptSector - Host1andRenter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.Close()
+	stH1, err := blankServerTester("TestRenterDownloadCorruptSector - Host2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stH1.server.Close()
+	testGroup := []*serverTester{st, stH1}
+
+	// Connect the testers, fund them, and announce both hosts.
+	if err = fullyConnectNodes(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = fundAllNodes(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = addStorageToAllHosts(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	if err = announceAllHosts(testGroup); err != nil {
+		t.Fatal(err)
+	}
+	allowanceValues := url.Values{}
+	allowanceValues.Set("funds", testFunds)
+	allowanceValues.Set("hosts", "2")
+	allowanceValues.Set("period", testPeriod)
+	if err = st.stdPostAPI("/renter", allowanceValues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a file with 1-of-2 redundancy, so that each host stores a piece
+	// that can recover the file on its own.
+	path := filepath.Join(st.dir, "test.dat")
+	if err = createRandFile(path, 1024); err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	uploadValues.Set("datapieces", "1")
+	uploadValues.Set("paritypieces", "1")
+	if err = st.stdPostAPI("/renter/upload/test", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	for i := 0; i < 200 && (len(rf.Files) != 1 || rf.Files[0].UploadProgress < 100); i++ {
+		st.getAPI("/renter/files", &rf)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(rf.Files) != 1 || rf.Files[0].UploadProgress < 100 {
+		t.Fatal("the uploading is not succeeding for some reason:", rf.Files)
+	}
+
+	// Corrupt the sectors stored by the second host. The host stores each
+	// sector in its own file in the storage folder.
+	entries, err := ioutil.ReadDir(stH1.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupted := 0
+	for _, fi := range entries {
+		if !fi.Mode().IsRegular() || uint64(fi.Size()) != modules.SectorSize {
+			continue
+		}
+		if err = ioutil.WriteFile(filepath.Join(stH1.dir, fi.Name()), make([]byte, modules.SectorSize), 0600); err != nil {
+			t.Fatal(err)
+		}
+		corrupted++
+	}
+	if corrupted == 0 {
+		t.Fatal("no sectors found on the second host")
+	}
+
+	// Every download should succeed. The renter picks a host at random, so
+	// download until the corrupt host has been tried.
+	orig, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logPath := filepath.Join(st.dir, modules.RenterDir, modules.RenterDir+".log")
+	logged := false
+	for i := 0; i < 20 && !logged; i++ {
+		downpath := filepath.Join(st.dir, fmt.Sprintf("testdown%v.dat", i))
+		if err = st.stdGetAPI("/renter/download/test?destination=" + downpath); err != nil {
+			t.Fatal(err)
+		}
+		download, err := ioutil.ReadFile(downpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(orig, download) {
+			t.Fatal("data mismatch when downloading a file with a corrupt piece")
+		}
+		renterLog, err := ioutil.ReadFile(logPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logged = strings.Contains(string(renterLog), "host sent corrupt sector data")
+	}
+	if !logged {
+		t.Fatal("corrupt sector was not logged")
+	}
+}
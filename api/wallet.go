@@ -124,7 +124,7 @@ func (api *API) wallet033xHandler(w http.ResponseWriter, req *http.Request, _ ht
 	source := req.FormValue("source")
 	// Check that source is an absolute paths.
 	if !filepath.IsAbs(source) {
-		WriteError(w, Error{"error when calling /wallet/033x: source must be an absolute path"}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "error when calling /wallet/033x: source must be an absolute path"}, http.StatusBadRequest)
 		return
 	}
 	potentialKeys := encryptionKeys(req.FormValue("encryptionpassword"))
@@ -135,18 +135,18 @@ func (api *API) wallet033xHandler(w http.ResponseWriter, req *http.Request, _ ht
 			return
 		}
 		if err != nil && err != modules.ErrBadEncryptionKey {
-			WriteError(w, Error{"error when calling /wallet/033x: " + err.Error()}, http.StatusBadRequest)
+			WriteError(w, Error{Message: "error when calling /wallet/033x: " + err.Error()}, http.StatusBadRequest)
 			return
 		}
 	}
-	WriteError(w, Error{modules.ErrBadEncryptionKey.Error()}, http.StatusBadRequest)
+	WriteError(w, Error{Message: modules.ErrBadEncryptionKey.Error()}, http.StatusBadRequest)
 }
 
 // walletAddressHandler handles API calls to /wallet/address.
 func (api *API) walletAddressHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	unlockConditions, err := api.wallet.NextAddress()
 	if err != nil {
-		WriteError(w, Error{"error after call to /wallet/addresses: " + err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "error after call to /wallet/addresses: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 	WriteJSON(w, WalletAddressGET{
@@ -166,12 +166,12 @@ func (api *API) walletBackupHandler(w http.ResponseWriter, req *http.Request, _
 	destination := req.FormValue("destination")
 	// Check that the destination is absolute.
 	if !filepath.IsAbs(destination) {
-		WriteError(w, Error{"error when calling /wallet/backup: destination must be an absolute path"}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "error when calling /wallet/backup: destination must be an absolute path"}, http.StatusBadRequest)
 		return
 	}
 	err := api.wallet.CreateBackup(destination)
 	if err != nil {
-		WriteError(w, Error{"error after call to /wallet/backup: " + err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "error after call to /wallet/backup: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 	WriteSuccess(w)
@@ -185,7 +185,7 @@ func (api *API) walletInitHandler(w http.ResponseWriter, req *http.Request, _ ht
 	}
 	seed, err := api.wallet.Encrypt(encryptionKey)
 	if err != nil {
-		WriteError(w, Error{"error when calling /wallet/init: " + err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "error when calling /wallet/init: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 
@@ -195,7 +195,7 @@ func (api *API) walletInitHandler(w http.ResponseWriter, req *http.Request, _ ht
 	}
 	seedStr, err := modules.SeedToString(seed, dictID)
 	if err != nil {
-		WriteError(w, Error{"error when calling /wallet/init: " + err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "error when calling /wallet/init: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 	WriteJSON(w, WalletInitPOST{
@@ -212,7 +212,7 @@ func (api *API) walletSeedHandler(w http.ResponseWriter, req *http.Request, _ ht
 	}
 	seed, err := modules.StringToSeed(req.FormValue("seed"), dictID)
 	if err != nil {
-		WriteError(w, Error{"error when calling /wallet/seed: " + err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "error when calling /wallet/seed: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 
@@ -224,11 +224,11 @@ func (api *API) walletSeedHandler(w http.ResponseWriter, req *http.Request, _ ht
 			return
 		}
 		if err != nil && err != modules.ErrBadEncryptionKey {
-			WriteError(w, Error{"error when calling /wallet/seed: " + err.Error()}, http.StatusBadRequest)
+			WriteError(w, Error{Message: "error when calling /wallet/seed: " + err.Error()}, http.StatusBadRequest)
 			return
 		}
 	}
-	WriteError(w, Error{"error when calling /wallet/seed: " + modules.ErrBadEncryptionKey.Error()}, http.StatusBadRequest)
+	WriteError(w, Error{Message: "error when calling /wallet/seed: " + modules.ErrBadEncryptionKey.Error()}, http.StatusBadRequest)
 }
 
 // walletSiagkeyHandler handles API calls to /wallet/siagkey.
@@ -240,7 +240,7 @@ func (api *API) walletSiagkeyHandler(w http.ResponseWriter, req *http.Request, _
 	for _, keypath := range keyfiles {
 		// Check that all key paths are absolute paths.
 		if !filepath.IsAbs(keypath) {
-			WriteError(w, Error{"error when calling /wallet/siagkey: keyfiles contains a non-absolute path"}, http.StatusBadRequest)
+			WriteError(w, Error{Message: "error when calling /wallet/siagkey: keyfiles contains a non-absolute path"}, http.StatusBadRequest)
 			return
 		}
 	}
@@ -252,18 +252,18 @@ func (api *API) walletSiagkeyHandler(w http.ResponseWriter, req *http.Request, _
 			return
 		}
 		if err != nil && err != modules.ErrBadEncryptionKey {
-			WriteError(w, Error{"error when calling /wallet/siagkey: " + err.Error()}, http.StatusBadRequest)
+			WriteError(w, Error{Message: "error when calling /wallet/siagkey: " + err.Error()}, http.StatusBadRequest)
 			return
 		}
 	}
-	WriteError(w, Error{"error when calling /wallet/siagkey: " + modules.ErrBadEncryptionKey.Error()}, http.StatusBadRequest)
+	WriteError(w, Error{Message: "error when calling /wallet/siagkey: " + modules.ErrBadEncryptionKey.Error()}, http.StatusBadRequest)
 }
 
 // walletLockHanlder handles API calls to /wallet/lock.
 func (api *API) walletLockHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	err := api.wallet.Lock()
 	if err != nil {
-		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 	WriteSuccess(w)
@@ -279,26 +279,26 @@ func (api *API) walletSeedsHandler(w http.ResponseWriter, req *http.Request, _ h
 	// Get the primary seed information.
 	primarySeed, progress, err := api.wallet.PrimarySeed()
 	if err != nil {
-		WriteError(w, Error{"error after call to /wallet/seeds: " + err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "error after call to /wallet/seeds: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 	primarySeedStr, err := modules.SeedToString(primarySeed, dictionary)
 	if err != nil {
-		WriteError(w, Error{"error after call to /wallet/seeds: " + err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "error after call to /wallet/seeds: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 
 	// Get the list of seeds known to the wallet.
 	allSeeds, err := api.wallet.AllSeeds()
 	if err != nil {
-		WriteError(w, Error{"error after call to /wallet/seeds: " + err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "error after call to /wallet/seeds: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 	var allSeedsStrs []string
 	for _, seed := range allSeeds {
 		str, err := modules.SeedToString(seed, dictionary)
 		if err != nil {
-			WriteError(w, Error{"error after call to /wallet/seeds: " + err.Error()}, http.StatusBadRequest)
+			WriteError(w, Error{Message: "error after call to /wallet/seeds: " + err.Error()}, http.StatusBadRequest)
 			return
 		}
 		allSeedsStrs = append(allSeedsStrs, str)
@@ -314,18 +314,18 @@ func (api *API) walletSeedsHandler(w http.ResponseWriter, req *http.Request, _ h
 func (api *API) walletSiacoinsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	amount, ok := scanAmount(req.FormValue("amount"))
 	if !ok {
-		WriteError(w, Error{"could not read 'amount' from POST call to /wallet/siacoins"}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "could not read 'amount' from POST call to /wallet/siacoins"}, http.StatusBadRequest)
 		return
 	}
 	dest, err := scanAddress(req.FormValue("destination"))
 	if err != nil {
-		WriteError(w, Error{"error after call to /wallet/siacoins: " + err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "error after call to /wallet/siacoins: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 
 	txns, err := api.wallet.SendSiacoins(amount, dest)
 	if err != nil {
-		WriteError(w, Error{"error after call to /wallet/siacoins: " + err.Error()}, http.StatusInternalServerError)
+		WriteError(w, Error{Message: "error after call to /wallet/siacoins: " + err.Error()}, http.StatusInternalServerError)
 		return
 	}
 	var txids []types.TransactionID
@@ -341,18 +341,18 @@ func (api *API) walletSiacoinsHandler(w http.ResponseWriter, req *http.Request,
 func (api *API) walletSiafundsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	amount, ok := scanAmount(req.FormValue("amount"))
 	if !ok {
-		WriteError(w, Error{"could not read 'amount' from POST call to /wallet/siafunds"}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "could not read 'amount' from POST call to /wallet/siafunds"}, http.StatusBadRequest)
 		return
 	}
 	dest, err := scanAddress(req.FormValue("destination"))
 	if err != nil {
-		WriteError(w, Error{"error after call to /wallet/siafunds: " + err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "error after call to /wallet/siafunds: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 
 	txns, err := api.wallet.SendSiafunds(amount, dest)
 	if err != nil {
-		WriteError(w, Error{"error after call to /wallet/siafunds: " + err.Error()}, http.StatusInternalServerError)
+		WriteError(w, Error{Message: "error after call to /wallet/siafunds: " + err.Error()}, http.StatusInternalServerError)
 		return
 	}
 	var txids []types.TransactionID
@@ -371,13 +371,13 @@ func (api *API) walletTransactionHandler(w http.ResponseWriter, req *http.Reques
 	jsonID := "\"" + ps.ByName("id") + "\""
 	err := id.UnmarshalJSON([]byte(jsonID))
 	if err != nil {
-		WriteError(w, Error{"error after call to /wallet/history: " + err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "error after call to /wallet/history: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 
 	txn, ok := api.wallet.Transaction(id)
 	if !ok {
-		WriteError(w, Error{"error when calling /wallet/transaction/$(id): transaction not found"}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "error when calling /wallet/transaction/$(id): transaction not found"}, http.StatusBadRequest)
 		return
 	}
 	WriteJSON(w, WalletTransactionGETid{
@@ -389,23 +389,23 @@ func (api *API) walletTransactionHandler(w http.ResponseWriter, req *http.Reques
 func (api *API) walletTransactionsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	startheightStr, endheightStr := req.FormValue("startheight"), req.FormValue("endheight")
 	if startheightStr == "" || endheightStr == "" {
-		WriteError(w, Error{"startheight and endheight must be provided to a /wallet/transactions call."}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "startheight and endheight must be provided to a /wallet/transactions call."}, http.StatusBadRequest)
 		return
 	}
 	// Get the start and end blocks.
 	start, err := strconv.Atoi(startheightStr)
 	if err != nil {
-		WriteError(w, Error{"parsing integer value for parameter `startheight` failed: " + err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "parsing integer value for parameter `startheight` failed: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 	end, err := strconv.Atoi(endheightStr)
 	if err != nil {
-		WriteError(w, Error{"parsing integer value for parameter `endheight` failed: " + err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "parsing integer value for parameter `endheight` failed: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 	confirmedTxns, err := api.wallet.Transactions(types.BlockHeight(start), types.BlockHeight(end))
 	if err != nil {
-		WriteError(w, Error{"error after call to /wallet/transactions: " + err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "error after call to /wallet/transactions: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 	unconfirmedTxns := api.wallet.UnconfirmedTransactions()
@@ -424,7 +424,7 @@ func (api *API) walletTransactionsAddrHandler(w http.ResponseWriter, req *http.R
 	var addr types.UnlockHash
 	err := addr.UnmarshalJSON([]byte(jsonAddr))
 	if err != nil {
-		WriteError(w, Error{"error after call to /wallet/transactions: " + err.Error()}, http.StatusBadRequest)
+		WriteError(w, Error{Message: "error after call to /wallet/transactions: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 
@@ -446,9 +446,9 @@ func (api *API) walletUnlockHandler(w http.ResponseWriter, req *http.Request, _
 			return
 		}
 		if err != nil && err != modules.ErrBadEncryptionKey {
-			WriteError(w, Error{"error when calling /wallet/unlock: " + err.Error()}, http.StatusBadRequest)
+			WriteError(w, Error{Message: "error when calling /wallet/unlock: " + err.Error()}, http.StatusBadRequest)
 			return
 		}
 	}
-	WriteError(w, Error{"error when calling /wallet/unlock: " + modules.ErrBadEncryptionKey.Error()}, http.StatusBadRequest)
+	WriteError(w, Error{Message: "error when calling /wallet/unlock: " + modules.ErrBadEncryptionKey.Error()}, http.StatusBadRequest)
 }
@@ -144,6 +144,15 @@ type (
 		// Peers returns the addresses that the Gateway is currently connected to.
 		Peers() []Peer
 
+		// PeersByLatency returns the peers that the Gateway is currently
+		// connected to, sorted by ping round-trip time, fastest first. Peers
+		// that have never responded to a ping are listed last.
+		PeersByLatency() []Peer
+
+		// PeerCount returns the number of peers that the Gateway is currently
+		// connected to.
+		PeerCount() int
+
 		// RegisterRPC registers a function to handle incoming connections that
 		// supply the given RPC ID.
 		RegisterRPC(string, RPCFunc)
@@ -20,6 +20,22 @@ const (
 	// connect to itself, this number can be reduced.
 	maxLocalOutboundPeers = 3
 
+	// nodeBaseWeight is the selection weight given to a node that the gateway
+	// has no connection history for.
+	nodeBaseWeight = 10
+
+	// nodeMaxCountedSuccesses is the number of successful connections beyond
+	// which a node's selection weight stops increasing.
+	nodeMaxCountedSuccesses = 10
+
+	// nodeRecencyWeight is the maximum selection weight added to a node that
+	// the gateway has connected to recently.
+	nodeRecencyWeight = 50
+
+	// nodeSuccessWeight is the selection weight added to a node for each
+	// successful connection.
+	nodeSuccessWeight = 5
+
 	// minAcceptableVersion is the version below which the gateway will refuse to
 	// connect to peers and reject connection attempts.
 	//
@@ -45,6 +61,22 @@ var (
 		Testing:  uint64(3),
 	}).(uint64)
 
+	// maxSharedPeers defines the number of connected peers that will be
+	// shared with a peer that calls the SharePeers RPC.
+	maxSharedPeers = build.Select(build.Var{
+		Standard: uint64(10),
+		Dev:      uint64(5),
+		Testing:  uint64(3),
+	}).(uint64)
+
+	// nodeRecencyWindow defines how long after a successful connection a node
+	// continues to receive a selection bonus for having connected recently.
+	nodeRecencyWindow = build.Select(build.Var{
+		Standard: 7 * 24 * time.Hour,
+		Dev:      24 * time.Hour,
+		Testing:  time.Hour,
+	}).(time.Duration)
+
 	// nodePurgeDelay defines the amount of time that is waited between each
 	// iteration of the node purge loop.
 	nodePurgeDelay = build.Select(build.Var{
@@ -94,6 +126,30 @@ var (
 		Testing:  500 * time.Millisecond,
 	}).(time.Duration)
 
+	// broadcastRetryDelay defines the amount of time that is waited before
+	// retrying a broadcast to a peer that failed to receive it.
+	broadcastRetryDelay = build.Select(build.Var{
+		Standard: 10 * time.Second,
+		Dev:      5 * time.Second,
+		Testing:  100 * time.Millisecond,
+	}).(time.Duration)
+
+	// broadcastTimeout defines the amount of time a single broadcast RPC is
+	// allowed to take before it is considered failed.
+	broadcastTimeout = build.Select(build.Var{
+		Standard: 2 * time.Minute,
+		Dev:      30 * time.Second,
+		Testing:  5 * time.Second,
+	}).(time.Duration)
+
+	// defaultPingInterval defines the default amount of time that is waited
+	// between pings of each peer.
+	defaultPingInterval = build.Select(build.Var{
+		Standard: 2 * time.Minute,
+		Dev:      30 * time.Second,
+		Testing:  5 * time.Second,
+	}).(time.Duration)
+
 	// fullyConnectedThreshold defines the number of peers that the gateway can
 	// have before it stops accepting inbound connections.
 	fullyConnectedThreshold = build.Select(build.Var{
@@ -102,6 +158,65 @@ var (
 		Testing:  10,
 	}).(int)
 
+	// defaultMaxInboundPeers defines the default maximum number of inbound
+	// peers that the gateway will accept. Once the limit is reached, new
+	// inbound peers will replace existing ones. It is never lower than
+	// defaultMaxOutboundPeers.
+	defaultMaxInboundPeers = build.Select(build.Var{
+		Standard: 128,
+		Dev:      20,
+		Testing:  20,
+	}).(int)
+
+	// defaultMaxPingFailures defines the default number of consecutive pings
+	// that a peer can fail before the gateway disconnects from it.
+	defaultMaxPingFailures = build.Select(build.Var{
+		Standard: 3,
+		Dev:      3,
+		Testing:  2,
+	}).(int)
+
+	// defaultMaxOutboundPeers defines the default maximum number of outbound
+	// peers that the gateway will connect to.
+	defaultMaxOutboundPeers = build.Select(build.Var{
+		Standard: 8,
+		Dev:      8,
+		Testing:  20,
+	}).(int)
+
+	// defaultRelayCacheSize is the number of recently relayed objects that
+	// the gateway remembers in order to avoid relaying them again. An object
+	// relayed to several peers takes one entry per peer.
+	defaultRelayCacheSize = build.Select(build.Var{
+		Standard: 10000,
+		Dev:      5000,
+		Testing:  1000,
+	}).(int)
+
+	// defaultRelayCacheTTL is how long the gateway refuses to relay an object
+	// to a peer again after relaying it to that peer.
+	defaultRelayCacheTTL = build.Select(build.Var{
+		Standard: 10 * time.Minute,
+		Dev:      5 * time.Minute,
+		Testing:  10 * time.Second,
+	}).(time.Duration)
+
+	// maxBroadcastFailures defines the number of consecutive broadcasts a
+	// peer can fail to receive before the gateway disconnects from it.
+	maxBroadcastFailures = build.Select(build.Var{
+		Standard: 5,
+		Dev:      5,
+		Testing:  3,
+	}).(int)
+
+	// maxConcurrentBroadcasts defines the maximum number of broadcast RPCs
+	// that the gateway will make concurrently.
+	maxConcurrentBroadcasts = build.Select(build.Var{
+		Standard: 32,
+		Dev:      16,
+		Testing:  4,
+	}).(int)
+
 	// maxConcurrentOutboundPeerRequests defines the maximum number of peer
 	// connections that the gateway will try to form concurrently.
 	maxConcurrentOutboundPeerRequests = build.Select(build.Var{
@@ -110,6 +225,23 @@ var (
 		Testing:  2,
 	}).(int)
 
+	// maxReconnectBackoff defines the longest amount of time that the gateway
+	// will wait before trying to reconnect to a node that keeps failing.
+	maxReconnectBackoff = build.Select(build.Var{
+		Standard: 4 * time.Hour,
+		Dev:      10 * time.Minute,
+		Testing:  5 * time.Second,
+	}).(time.Duration)
+
+	// minReconnectBackoff defines the amount of time that the gateway waits
+	// before trying to reconnect to a node that failed a single connection
+	// attempt. The wait doubles with each consecutive failure.
+	minReconnectBackoff = build.Select(build.Var{
+		Standard: 30 * time.Second,
+		Dev:      10 * time.Second,
+		Testing:  100 * time.Millisecond,
+	}).(time.Duration)
+
 	// noNodesDelay defines the amount of time that is waited between
 	// iterations of the peer acquisition loop if the gateway does not have any
 	// nodes in the nodelist.
@@ -119,6 +251,14 @@ var (
 		Testing:  3 * time.Second,
 	}).(time.Duration)
 
+	// pingTimeout defines the amount of time that a peer has to respond to a
+	// ping.
+	pingTimeout = build.Select(build.Var{
+		Standard: time.Minute,
+		Dev:      20 * time.Second,
+		Testing:  time.Second,
+	}).(time.Duration)
+
 	// unwawntedLocalPeerDelay defines the amount of time that is waited
 	// between iterations of the permanentPeerManager if the gateway has at
 	// least a few outbound peers, but is not well connected, and the recently
@@ -131,6 +271,22 @@ var (
 		Testing:  100 * time.Millisecond,
 	}).(time.Duration)
 
+	// peerBootstrapInterval defines the amount of time that is waited
+	// between rounds of asking peers for their peers.
+	peerBootstrapInterval = build.Select(build.Var{
+		Standard: 10 * time.Minute,
+		Dev:      1 * time.Minute,
+		Testing:  3 * time.Second,
+	}).(time.Duration)
+
+	// versionCooldown defines how long the gateway waits before dialing a
+	// peer again after rejecting it because of its version.
+	versionCooldown = build.Select(build.Var{
+		Standard: 10 * time.Minute,
+		Dev:      1 * time.Minute,
+		Testing:  5 * time.Second,
+	}).(time.Duration)
+
 	// wellConnectedDelay defines the amount of time that is waited between
 	// iterations of the peer acquisition loop if the gateway is well
 	// connected.
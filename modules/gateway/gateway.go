@@ -183,10 +183,32 @@ type Gateway struct {
 	// and would block any threads.Flush() calls. So a second threadgroup is
 	// added which handles clean-shutdown for the peers, without blocking
 	// threads.Flush() calls.
-	nodes  map[modules.NetAddress]struct{}
+	nodes  map[modules.NetAddress]*node
 	peers  map[modules.NetAddress]*peer
 	peerTG siasync.ThreadGroup
 
+	// bans maps banned addresses to the time at which their ban expires.
+	bans map[modules.NetAddress]time.Time
+
+	// cooldowns maps the addresses of peers that were rejected because of
+	// their version to the time at which the gateway will dial them again.
+	cooldowns map[modules.NetAddress]time.Time
+
+	// maxInboundPeers and maxOutboundPeers are the maximum number of peers
+	// the gateway will hold in each direction.
+	maxInboundPeers  int
+	maxOutboundPeers int
+
+	// pingInterval is the amount of time between pings of each peer, and
+	// maxPingFailures is the number of consecutive failed pings after which
+	// a peer is disconnected.
+	pingInterval    time.Duration
+	maxPingFailures int
+
+	// relayCache holds the hashes of objects recently broadcast to each peer,
+	// which are not broadcast to that peer again.
+	relayCache *relayCache
+
 	// Utilities.
 	log        *persist.Logger
 	mu         sync.RWMutex
@@ -235,8 +257,18 @@ func New(addr string, bootstrap bool, persistDir string) (*Gateway, error) {
 		handlers: make(map[rpcID]modules.RPCFunc),
 		initRPCs: make(map[string]modules.RPCFunc),
 
-		peers: make(map[modules.NetAddress]*peer),
-		nodes: make(map[modules.NetAddress]struct{}),
+		peers:     make(map[modules.NetAddress]*peer),
+		nodes:     make(map[modules.NetAddress]*node),
+		bans:      make(map[modules.NetAddress]time.Time),
+		cooldowns: make(map[modules.NetAddress]time.Time),
+
+		maxInboundPeers:  defaultMaxInboundPeers,
+		maxOutboundPeers: defaultMaxOutboundPeers,
+
+		pingInterval:    defaultPingInterval,
+		maxPingFailures: defaultMaxPingFailures,
+
+		relayCache: newRelayCache(defaultRelayCacheSize, defaultRelayCacheTTL),
 
 		persistDir: persistDir,
 	}
@@ -267,10 +299,14 @@ func New(addr string, bootstrap bool, persistDir string) (*Gateway, error) {
 	// Register RPCs.
 	g.RegisterRPC("ShareNodes", g.shareNodes)
 	g.RegisterConnectCall("ShareNodes", g.requestNodes)
+	g.RegisterRPC("Ping", g.rpcPing)
+	g.RegisterRPC("SharePeers", g.rpcSharePeers)
 	// Establish the de-registration of the RPCs.
 	g.threads.OnStop(func() {
 		g.UnregisterRPC("ShareNodes")
 		g.UnregisterConnectCall("ShareNodes")
+		g.UnregisterRPC("Ping")
+		g.UnregisterRPC("SharePeers")
 	})
 
 	// Load the old node list. If it doesn't exist, no problem, but if it does,
@@ -336,6 +372,21 @@ func New(addr string, bootstrap bool, persistDir string) (*Gateway, error) {
 	})
 	go g.permanentNodePurger(nodePurgerClosedChan)
 
+	// Spawn the peer pinger and provide tools for ensuring clean shutdown.
+	peerPingerClosedChan := make(chan struct{})
+	g.threads.OnStop(func() {
+		<-peerPingerClosedChan
+	})
+	go g.permanentPeerPinger(peerPingerClosedChan)
+
+	// Spawn the peer bootstrapper and provide tools for ensuring clean
+	// shutdown.
+	peerBootstrapperClosedChan := make(chan struct{})
+	g.threads.OnStop(func() {
+		<-peerBootstrapperClosedChan
+	})
+	go g.permanentPeerBootstrapper(peerBootstrapperClosedChan)
+
 	// Spawn threads to take care of port forwarding and hostname discovery.
 	go g.threadedForwardPort(g.port)
 	go g.threadedLearnHostname()
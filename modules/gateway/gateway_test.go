@@ -92,6 +92,14 @@ func TestPeers(t *testing.T) {
 	if len(peers) != 1 || peers[0].NetAddress != g2.Address() {
 		t.Fatal("g1 has bad peer list:", peers)
 	}
+	if n := g1.PeerCount(); n != len(peers) {
+		t.Fatalf("PeerCount returned %v, but g1 has %v peers", n, len(peers))
+	}
+	// modifying the returned peers should not affect the gateway
+	peers[0].NetAddress = "foo.com:1234"
+	if peers = g1.Peers(); peers[0].NetAddress != g2.Address() {
+		t.Fatal("modifying the peer list modified the gateway's peers:", peers)
+	}
 	err = g1.Disconnect(g2.Address())
 	if err != nil {
 		t.Fatal("failed to disconnect:", err)
@@ -100,6 +108,9 @@ func TestPeers(t *testing.T) {
 	if len(peers) != 0 {
 		t.Fatal("g1 has peers after disconnect:", peers)
 	}
+	if n := g1.PeerCount(); n != 0 {
+		t.Fatal("g1 has a nonzero peer count after disconnect:", n)
+	}
 }
 
 // TestNew checks that a call to New is effective.
@@ -17,6 +17,25 @@ var (
 	errOurAddress = errors.New("can't add our own address")
 )
 
+// node is a potential peer, along with the metadata the gateway has gathered
+// about past connections to it.
+type node struct {
+	// LastConnected is the last time that the gateway successfully connected
+	// to the node.
+	LastConnected time.Time
+
+	// FailCount is the number of consecutive failed attempts to connect to
+	// the node.
+	FailCount int
+
+	// SuccessCount is the number of successful connections to the node.
+	SuccessCount int
+
+	// RetryAfter is the time before which the peer manager will not try to
+	// connect to the node again, following a failed connection attempt.
+	RetryAfter time.Time
+}
+
 // addNode adds an address to the set of nodes on the network.
 func (g *Gateway) addNode(addr modules.NetAddress) error {
 	if addr == g.myAddr {
@@ -28,7 +47,7 @@ func (g *Gateway) addNode(addr modules.NetAddress) error {
 	} else if net.ParseIP(addr.Host()) == nil {
 		return errors.New("address must be an IP address: " + string(addr))
 	}
-	g.nodes[addr] = struct{}{}
+	g.nodes[addr] = new(node)
 	return nil
 }
 
@@ -82,6 +101,57 @@ func (g *Gateway) removeNode(addr modules.NetAddress) error {
 	return nil
 }
 
+// recordNodeConnection updates the metadata of a node after an attempt to
+// connect to it. Addresses that are not in the node list are ignored. The
+// caller must hold g.mu as a writer.
+func (g *Gateway) recordNodeConnection(addr modules.NetAddress, success bool) {
+	n, exists := g.nodes[addr]
+	if !exists {
+		return
+	}
+	if success {
+		n.LastConnected = time.Now()
+		n.FailCount = 0
+		n.SuccessCount++
+		n.RetryAfter = time.Time{}
+	} else {
+		n.FailCount++
+		n.RetryAfter = time.Now().Add(jitter(reconnectBackoff(n.FailCount)))
+	}
+}
+
+// reconnectBackoff returns how long the gateway waits before trying to
+// reconnect to a node that has failed the given number of consecutive
+// connection attempts. The wait starts at minReconnectBackoff and doubles with
+// each failure, up to maxReconnectBackoff.
+func reconnectBackoff(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	d := minReconnectBackoff
+	for i := 1; i < failures && d < maxReconnectBackoff; i++ {
+		d *= 2
+	}
+	if d > maxReconnectBackoff {
+		d = maxReconnectBackoff
+	}
+	return d
+}
+
+// jitter returns a random duration between d/2 and d, so that nodes which
+// failed at the same time are not all retried at the same time.
+func jitter(d time.Duration) time.Duration {
+	half := int(d / 2 / time.Millisecond)
+	if half <= 0 {
+		return d
+	}
+	r, err := crypto.RandIntn(half + 1)
+	if err != nil {
+		return d
+	}
+	return d - time.Duration(r)*time.Millisecond
+}
+
 // randomNode returns a random node from the gateway. An error can be returned
 // if there are no nodes in the node list.
 func (g *Gateway) randomNode() (modules.NetAddress, error) {
@@ -107,6 +177,67 @@ func (g *Gateway) randomNode() (modules.NetAddress, error) {
 	return "", errNoPeers
 }
 
+// nodeWeight returns the relative likelihood that a node should be selected
+// as an outbound peer. Nodes that have connected successfully many times, and
+// nodes that have connected recently, are favored over nodes that have never
+// been connected to, while nodes that are failing are penalized. Every node
+// has a weight of at least 1, so that no node is ever excluded entirely.
+func nodeWeight(n node, now time.Time) int {
+	w := nodeBaseWeight
+	successes := n.SuccessCount
+	if successes > nodeMaxCountedSuccesses {
+		successes = nodeMaxCountedSuccesses
+	}
+	w += successes * nodeSuccessWeight
+	if !n.LastConnected.IsZero() {
+		age := now.Sub(n.LastConnected)
+		if age < 0 {
+			age = 0
+		}
+		if age < nodeRecencyWindow {
+			w += int(int64(nodeRecencyWeight) * int64(nodeRecencyWindow-age) / int64(nodeRecencyWindow))
+		}
+	}
+	w /= 1 + n.FailCount
+	if w < 1 {
+		w = 1
+	}
+	return w
+}
+
+// weightedNode returns a random node from the gateway, weighted according to
+// nodeWeight. Nodes that are backing off after a failed connection attempt
+// are not selected. An error is returned if there are no nodes available.
+func (g *Gateway) weightedNode() (modules.NetAddress, error) {
+	now := time.Now()
+	addrs := make([]modules.NetAddress, 0, len(g.nodes))
+	weights := make([]int, 0, len(g.nodes))
+	total := 0
+	for addr, n := range g.nodes {
+		if now.Before(n.RetryAfter) {
+			continue
+		}
+		w := nodeWeight(*n, now)
+		addrs = append(addrs, addr)
+		weights = append(weights, w)
+		total += w
+	}
+	if total == 0 {
+		return "", errNoPeers
+	}
+	r, err := crypto.RandIntn(total)
+	if err != nil {
+		return "", err
+	}
+	for i, w := range weights {
+		if r < w {
+			return addrs[i], nil
+		}
+		r -= w
+	}
+	return "", errNoPeers
+}
+
 // shareNodes is the receiving end of the ShareNodes RPC. It writes up to 10
 // randomly selected nodes to the caller.
 func (g *Gateway) shareNodes(conn modules.PeerConn) error {
@@ -143,6 +143,170 @@ func TestRandomNode(t *testing.T) {
 	}
 }
 
+// TestNodeWeight checks that nodeWeight favors reliable and recently
+// connected nodes, and never excludes a node entirely.
+func TestNodeWeight(t *testing.T) {
+	now := time.Now()
+	fresh := nodeWeight(node{}, now)
+	if fresh != nodeBaseWeight {
+		t.Fatalf("expected new node to have weight %v, got %v", nodeBaseWeight, fresh)
+	}
+	reliable := nodeWeight(node{SuccessCount: 5, LastConnected: now}, now)
+	if reliable <= fresh {
+		t.Error("reliable node should be weighted above a new node:", reliable, fresh)
+	}
+	stale := nodeWeight(node{SuccessCount: 5, LastConnected: now.Add(-2 * nodeRecencyWindow)}, now)
+	if stale >= reliable || stale <= fresh {
+		t.Error("stale node should be weighted between a new node and a recent node:", stale)
+	}
+	capped := nodeWeight(node{SuccessCount: 1000}, now)
+	if capped != nodeWeight(node{SuccessCount: nodeMaxCountedSuccesses}, now) {
+		t.Error("success bonus should be capped")
+	}
+	failing := nodeWeight(node{FailCount: 3}, now)
+	if failing >= fresh {
+		t.Error("failing node should be weighted below a new node:", failing, fresh)
+	}
+	if w := nodeWeight(node{FailCount: 1e6}, now); w != 1 {
+		t.Error("expected minimum weight of 1, got", w)
+	}
+}
+
+// TestWeightedNode checks that weightedNode selects reliable nodes more often
+// than unreliable ones.
+func TestWeightedNode(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	g := newTestingGateway("TestWeightedNode", t)
+	defer g.Close()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, err := g.weightedNode(); err != errNoPeers {
+		t.Fatal("expected errNoPeers, got", err)
+	}
+
+	const reliable, flaky = modules.NetAddress("111.111.111.111:1111"), modules.NetAddress("111.111.111.111:2222")
+	g.addNode(reliable)
+	g.addNode(flaky)
+	g.nodes[reliable].SuccessCount = 5
+	g.nodes[reliable].LastConnected = time.Now()
+	g.nodes[flaky].FailCount = 3
+
+	counts := make(map[modules.NetAddress]int)
+	for i := 0; i < 1000; i++ {
+		addr, err := g.weightedNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[addr]++
+	}
+	if counts[flaky] == 0 {
+		t.Error("flaky node was never selected")
+	}
+	if counts[reliable] < 5*counts[flaky] {
+		t.Errorf("reliable node was not favored: selected %v times vs %v", counts[reliable], counts[flaky])
+	}
+}
+
+// TestReconnectBackoff checks that the reconnection backoff doubles with each
+// consecutive failure, up to maxReconnectBackoff, and that jitter stays
+// within bounds.
+func TestReconnectBackoff(t *testing.T) {
+	if d := reconnectBackoff(0); d != 0 {
+		t.Error("expected no backoff without failures, got", d)
+	}
+	prev := time.Duration(0)
+	for failures := 1; failures < 100; failures++ {
+		d := reconnectBackoff(failures)
+		if d > maxReconnectBackoff {
+			t.Fatalf("backoff for %v failures exceeds the maximum: %v", failures, d)
+		} else if d < prev {
+			t.Fatalf("backoff for %v failures decreased: %v < %v", failures, d, prev)
+		} else if d != maxReconnectBackoff && d != 2*prev && failures > 1 {
+			t.Fatalf("backoff for %v failures did not double: %v -> %v", failures, prev, d)
+		}
+		prev = d
+	}
+	if d := reconnectBackoff(1); d != minReconnectBackoff {
+		t.Error("expected minReconnectBackoff after one failure, got", d)
+	}
+	if d := reconnectBackoff(3); d != 4*minReconnectBackoff {
+		t.Error("expected 4x minReconnectBackoff after three failures, got", d)
+	}
+	if d := reconnectBackoff(99); d != maxReconnectBackoff {
+		t.Error("expected maxReconnectBackoff after many failures, got", d)
+	}
+
+	for i := 0; i < 100; i++ {
+		if j := jitter(time.Minute); j < 30*time.Second || j > time.Minute {
+			t.Fatal("jittered duration out of bounds:", j)
+		}
+	}
+}
+
+// TestRecordNodeConnectionBackoff checks that failed connections prevent a
+// node from being selected until its backoff elapses, and that a successful
+// connection resets the backoff.
+func TestRecordNodeConnectionBackoff(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	g := newTestingGateway("TestRecordNodeConnectionBackoff", t)
+	defer g.Close()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.addNode(dummyNode); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each failure should push RetryAfter further into the future.
+	var prevRetry time.Duration
+	for failures := 1; failures <= 3; failures++ {
+		start := time.Now()
+		g.recordNodeConnection(dummyNode, false)
+		n := g.nodes[dummyNode]
+		if n.FailCount != failures {
+			t.Fatalf("expected FailCount %v, got %v", failures, n.FailCount)
+		}
+		retry := n.RetryAfter.Sub(start)
+		backoff := reconnectBackoff(failures)
+		if retry < backoff/2 || retry > backoff+time.Second {
+			t.Fatalf("retry after %v failures is %v, expected between %v and %v", failures, retry, backoff/2, backoff)
+		}
+		if retry < prevRetry/2 {
+			t.Fatalf("retry interval shrank from %v to %v", prevRetry, retry)
+		}
+		prevRetry = retry
+	}
+	if _, err := g.weightedNode(); err != errNoPeers {
+		t.Fatal("node should not be selected while backing off, got", err)
+	}
+
+	// Once the backoff elapses, the node can be selected again.
+	g.nodes[dummyNode].RetryAfter = time.Now().Add(-time.Second)
+	if addr, err := g.weightedNode(); err != nil || addr != dummyNode {
+		t.Fatal("node should be selected after its backoff elapses:", addr, err)
+	}
+
+	// A successful connection resets the backoff.
+	g.recordNodeConnection(dummyNode, false)
+	g.recordNodeConnection(dummyNode, true)
+	if n := g.nodes[dummyNode]; n.FailCount != 0 || !n.RetryAfter.IsZero() {
+		t.Fatal("successful connection did not reset the backoff:", n.FailCount, n.RetryAfter)
+	}
+	if addr, err := g.weightedNode(); err != nil || addr != dummyNode {
+		t.Fatal("recovered node should be selected:", addr, err)
+	}
+	g.recordNodeConnection(dummyNode, false)
+	if retry := g.nodes[dummyNode].RetryAfter.Sub(time.Now()); retry > minReconnectBackoff {
+		t.Fatal("backoff after recovering should restart at minReconnectBackoff, got", retry)
+	}
+}
+
 // TestShareNodes checks that two gateways will share nodes with eachother
 // following the desired sharing strategy.
 func TestShareNodes(t *testing.T) {
@@ -179,10 +343,10 @@ func TestShareNodes(t *testing.T) {
 
 	// remove all nodes from both peers
 	g1.mu.Lock()
-	g1.nodes = map[modules.NetAddress]struct{}{}
+	g1.nodes = map[modules.NetAddress]*node{}
 	g1.mu.Unlock()
 	g2.mu.Lock()
-	g2.nodes = map[modules.NetAddress]struct{}{}
+	g2.nodes = map[modules.NetAddress]*node{}
 	g2.mu.Unlock()
 
 	// SharePeers should now return no peers
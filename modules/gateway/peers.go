@@ -4,6 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/NebulousLabs/Sia/build"
@@ -14,8 +17,28 @@ import (
 )
 
 var (
+	errBadBanDuration   = errors.New("ban duration must be positive")
+	errBadPeerLimit     = errors.New("peer limits must be positive")
+	errNotBanned        = errors.New("that address is not banned")
 	errPeerExists       = errors.New("already connected to this peer")
 	errPeerRejectedConn = errors.New("peer rejected connection")
+
+	// ErrInvalidAddress is returned when a peer cannot be added because its
+	// address is not a valid host:port, or is a loopback or unspecified
+	// address.
+	ErrInvalidAddress = errors.New("invalid peer address")
+
+	// ErrPeerBanned is returned when a peer cannot be added because its
+	// address has been banned.
+	ErrPeerBanned = errors.New("peer is banned")
+
+	// ErrPeerLimitReached is returned when a peer cannot be added because the
+	// gateway already has the maximum number of peers in that direction.
+	ErrPeerLimitReached = errors.New("peer limit reached")
+
+	// ErrPeerVersionMismatch is returned when a peer cannot be added because
+	// its version is incompatible with the gateway's version.
+	ErrPeerVersionMismatch = errors.New("peer version is incompatible")
 )
 
 // insufficientVersionError indicates a peer's version is insufficient.
@@ -37,6 +60,18 @@ func (s invalidVersionError) Error() string {
 type peer struct {
 	modules.Peer
 	sess muxado.Session
+
+	// broadcastFailures is the number of consecutive broadcasts that have
+	// failed to reach the peer.
+	broadcastFailures int
+
+	// latency is the round-trip time of the most recent successful ping of
+	// the peer. It is zero if the peer has never responded to a ping.
+	latency time.Duration
+
+	// pingFailures is the number of consecutive pings that the peer has
+	// failed to respond to.
+	pingFailures int
 }
 
 func (p *peer) open() (modules.PeerConn, error) {
@@ -56,13 +91,71 @@ func (p *peer) accept() (modules.PeerConn, error) {
 }
 
 // addPeer adds a peer to the Gateway's peer list and spawns a listener thread
-// to handle its requests.
-func (g *Gateway) addPeer(p *peer) {
+// to handle its requests. ErrInvalidAddress is returned if the peer's address
+// is invalid, ErrPeerBanned is returned if the peer's address is banned, and
+// ErrPeerLimitReached is returned if the gateway already has the maximum
+// number of peers in the peer's direction. The caller must hold g.mu as a
+// writer.
+func (g *Gateway) addPeer(p *peer) error {
+	if p.NetAddress.IsValid() != nil {
+		return ErrInvalidAddress
+	}
+	if g.isBanned(p.NetAddress) {
+		return ErrPeerBanned
+	}
+	if p.Inbound && g.peerCount(true) >= g.maxInboundPeers {
+		return ErrPeerLimitReached
+	} else if !p.Inbound && g.peerCount(false) >= g.maxOutboundPeers {
+		return ErrPeerLimitReached
+	}
 	g.peers[p.NetAddress] = p
 	go g.threadedListenPeer(p)
+	return nil
+}
+
+// isBanned returns true if the address is currently banned. Expired bans are
+// removed. The caller must hold g.mu as a writer.
+func (g *Gateway) isBanned(addr modules.NetAddress) bool {
+	expiry, exists := g.bans[addr]
+	if !exists {
+		return false
+	}
+	if time.Now().After(expiry) {
+		delete(g.bans, addr)
+		return false
+	}
+	return true
 }
 
-// randomOutboundPeer returns a random outbound peer.
+// isCoolingDown returns true if the gateway recently rejected the address
+// because of its version. Expired cooldowns are removed. The caller must hold
+// g.mu as a writer.
+func (g *Gateway) isCoolingDown(addr modules.NetAddress) bool {
+	expiry, exists := g.cooldowns[addr]
+	if !exists {
+		return false
+	}
+	if time.Now().After(expiry) {
+		delete(g.cooldowns, addr)
+		return false
+	}
+	return true
+}
+
+// peerCount returns the number of inbound or outbound peers that the gateway
+// is connected to. The caller must hold g.mu.
+func (g *Gateway) peerCount(inbound bool) int {
+	n := 0
+	for _, p := range g.peers {
+		if p.Inbound == inbound {
+			n++
+		}
+	}
+	return n
+}
+
+// randomOutboundPeer returns a random outbound peer. The caller must hold
+// g.mu.
 func (g *Gateway) randomOutboundPeer() (modules.NetAddress, error) {
 	// Get the list of outbound peers.
 	var addrs []modules.NetAddress
@@ -158,7 +251,7 @@ func (g *Gateway) managedAcceptConnOldPeer(conn net.Conn, remoteVersion string)
 
 	// Old peers are unable to give us a dialback port, so we can't verify
 	// whether or not they are local peers.
-	g.acceptPeer(&peer{
+	return g.acceptPeer(&peer{
 		Peer: modules.Peer{
 			Inbound:    true,
 			Local:      false,
@@ -167,8 +260,6 @@ func (g *Gateway) managedAcceptConnOldPeer(conn net.Conn, remoteVersion string)
 		},
 		sess: muxado.Server(conn),
 	})
-
-	return nil
 }
 
 // managedAcceptConnNewPeer accepts connection requests from peers >= v1.0.0.
@@ -198,7 +289,7 @@ func (g *Gateway) managedAcceptConnNewPeer(conn net.Conn, remoteVersion string)
 		return fmt.Errorf("already connected to a peer on that address: %v", remoteAddr)
 	}
 	// Accept the peer.
-	g.acceptPeer(&peer{
+	return g.acceptPeer(&peer{
 		Peer: modules.Peer{
 			Inbound:    true,
 			Local:      local,
@@ -207,24 +298,23 @@ func (g *Gateway) managedAcceptConnNewPeer(conn net.Conn, remoteVersion string)
 		},
 		sess: muxado.Server(conn),
 	})
-	return nil
 }
 
 // acceptPeer makes room for the peer if necessary by kicking out existing
-// peers, then adds the peer to the peer list.
-func (g *Gateway) acceptPeer(p *peer) {
+// peers, then adds the peer to the peer list. The caller must hold g.mu as a
+// writer.
+func (g *Gateway) acceptPeer(p *peer) error {
 	// If we are not fully connected, add the peer without kicking any out.
-	if len(g.peers) < fullyConnectedThreshold {
-		g.addPeer(p)
-		return
+	if len(g.peers) < fullyConnectedThreshold && g.peerCount(true) < g.maxInboundPeers {
+		return g.addPeer(p)
 	}
 
 	// Select a peer to kick. Outbound peers and local peers are not
 	// available to be kicked.
 	var addrs []modules.NetAddress
-	for addr := range g.peers {
+	for addr, existing := range g.peers {
 		// Do not kick outbound peers or local peers.
-		if !p.Inbound || p.Local {
+		if !existing.Inbound || existing.Local {
 			continue
 		}
 
@@ -237,8 +327,7 @@ func (g *Gateway) acceptPeer(p *peer) {
 	}
 	if len(addrs) == 0 {
 		// There is nobody suitable to kick, therefore do not kick anyone.
-		g.addPeer(p)
-		return
+		return g.addPeer(p)
 	}
 
 	// Of the remaining options, select one at random.
@@ -250,7 +339,7 @@ func (g *Gateway) acceptPeer(p *peer) {
 	g.peers[kick].sess.Close()
 	delete(g.peers, kick)
 	g.log.Printf("INFO: disconnected from %v to make room for %v\n", kick, p.NetAddress)
-	g.addPeer(p)
+	return g.addPeer(p)
 }
 
 // acceptConnPortHandshake performs the port handshake and should be called on
@@ -300,9 +389,38 @@ func acceptableVersion(version string) error {
 	if build.VersionCmp(version, minAcceptableVersion) < 0 {
 		return insufficientVersionError(version)
 	}
+	if !compatibleVersions(build.Version, version) {
+		return ErrPeerVersionMismatch
+	}
 	return nil
 }
 
+// compatibleVersions reports whether a node running the local version can
+// communicate with a peer running the remote version. Both versions must be
+// valid. Following semantic versioning, a newer major version indicates a
+// protocol change that the local node does not understand. Older versions are
+// compatible down to minAcceptableVersion, since it is up to the newer node to
+// decide which older versions it still supports.
+func compatibleVersions(local, remote string) bool {
+	return majorVersion(remote) <= majorVersion(local)
+}
+
+// majorVersion returns the major version number of a valid version.
+func majorVersion(version string) int {
+	major, _ := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	return major
+}
+
+// incompatibleVersion returns true if err indicates that a peer was rejected
+// because of its version.
+func incompatibleVersion(err error) bool {
+	switch err.(type) {
+	case invalidVersionError, insufficientVersionError:
+		return true
+	}
+	return err == ErrPeerVersionMismatch
+}
+
 // connectVersionHandshake performs the version handshake and should be called
 // on the side making the connection request. The remote version is only
 // returned if err == nil.
@@ -360,7 +478,8 @@ func (g *Gateway) managedConnectOldPeer(conn net.Conn, remoteVersion string, rem
 
 	g.mu.Lock()
 	defer g.mu.Unlock()
-	g.addPeer(&peer{
+	g.recordNodeConnection(remoteAddr, true)
+	return g.addPeer(&peer{
 		Peer: modules.Peer{
 			Inbound:    false,
 			Local:      local,
@@ -369,7 +488,6 @@ func (g *Gateway) managedConnectOldPeer(conn net.Conn, remoteVersion string, rem
 		},
 		sess: muxado.Client(conn),
 	})
-	return nil
 }
 
 // managedConnectNewPeer connects to peers >= v1.0.0. The peer is added as a
@@ -395,7 +513,8 @@ func (g *Gateway) managedConnectNewPeer(conn net.Conn, remoteVersion string, rem
 
 	g.mu.Lock()
 	defer g.mu.Unlock()
-	g.addPeer(&peer{
+	g.recordNodeConnection(remoteAddr, true)
+	return g.addPeer(&peer{
 		Peer: modules.Peer{
 			Inbound:    false,
 			Local:      local,
@@ -404,7 +523,6 @@ func (g *Gateway) managedConnectNewPeer(conn net.Conn, remoteVersion string, rem
 		},
 		sess: muxado.Client(conn),
 	})
-	return nil
 }
 
 // managedConnect establishes a persistent connection to a peer, and adds it to
@@ -425,14 +543,27 @@ func (g *Gateway) managedConnect(addr modules.NetAddress) error {
 	}
 	g.mu.RLock()
 	_, exists := g.peers[addr]
+	full := g.peerCount(false) >= g.maxOutboundPeers
 	g.mu.RUnlock()
 	if exists {
 		return errPeerExists
 	}
+	if full {
+		return ErrPeerLimitReached
+	}
+	g.mu.Lock()
+	coolingDown := g.isCoolingDown(addr)
+	g.mu.Unlock()
+	if coolingDown {
+		return ErrPeerVersionMismatch
+	}
 
 	// Dial the peer and perform peer initialization.
 	conn, err := g.dial(addr)
 	if err != nil {
+		g.mu.Lock()
+		g.recordNodeConnection(addr, false)
+		g.mu.Unlock()
 		return err
 	}
 
@@ -440,6 +571,14 @@ func (g *Gateway) managedConnect(addr modules.NetAddress) error {
 	remoteVersion, err := connectVersionHandshake(conn, build.Version)
 	if err != nil {
 		conn.Close()
+		g.mu.Lock()
+		g.recordNodeConnection(addr, false)
+		// Don't redial peers with incompatible versions right away; they
+		// won't become compatible until they are upgraded.
+		if incompatibleVersion(err) {
+			g.cooldowns[addr] = time.Now().Add(versionCooldown)
+		}
+		g.mu.Unlock()
 		return err
 	}
 	if build.VersionCmp(remoteVersion, handshakeUpgradeVersion) < 0 {
@@ -495,13 +634,14 @@ func (g *Gateway) Disconnect(addr modules.NetAddress) error {
 	}
 	defer g.threads.Done()
 
-	g.mu.RLock()
+	// Check for and remove the peer under a single lock, so that concurrent
+	// calls cannot both succeed in disconnecting the same peer.
+	g.mu.Lock()
 	p, exists := g.peers[addr]
-	g.mu.RUnlock()
 	if !exists {
+		g.mu.Unlock()
 		return errors.New("not connected to that node")
 	}
-	g.mu.Lock()
 	delete(g.peers, addr)
 	g.mu.Unlock()
 	if err := p.sess.Close(); err != nil {
@@ -512,6 +652,58 @@ func (g *Gateway) Disconnect(addr modules.NetAddress) error {
 	return nil
 }
 
+// Ban disconnects from a peer, if connected, and refuses to connect to it or
+// accept connections from it until the duration has elapsed.
+func (g *Gateway) Ban(addr modules.NetAddress, d time.Duration) error {
+	if err := g.threads.Add(); err != nil {
+		return err
+	}
+	defer g.threads.Done()
+	if d <= 0 {
+		return errBadBanDuration
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.bans[addr] = time.Now().Add(d)
+	if p, exists := g.peers[addr]; exists {
+		p.sess.Close()
+		delete(g.peers, addr)
+		g.log.Println("INFO: disconnected from banned peer", addr)
+	}
+	return g.save()
+}
+
+// Unban removes the ban on an address.
+func (g *Gateway) Unban(addr modules.NetAddress) error {
+	if err := g.threads.Add(); err != nil {
+		return err
+	}
+	defer g.threads.Done()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.isBanned(addr) {
+		return errNotBanned
+	}
+	delete(g.bans, addr)
+	return g.save()
+}
+
+// SetMaxPeers sets the maximum number of outbound and inbound peers that the
+// Gateway will maintain. Existing peers are not disconnected if the new limits
+// are lower than the current number of peers.
+func (g *Gateway) SetMaxPeers(outbound, inbound int) error {
+	if outbound <= 0 || inbound <= 0 {
+		return errBadPeerLimit
+	}
+	g.mu.Lock()
+	g.maxOutboundPeers = outbound
+	g.maxInboundPeers = inbound
+	g.mu.Unlock()
+	return nil
+}
+
 // Peers returns the addresses currently connected to the Gateway.
 func (g *Gateway) Peers() []modules.Peer {
 	g.mu.RLock()
@@ -522,3 +714,29 @@ func (g *Gateway) Peers() []modules.Peer {
 	}
 	return peers
 }
+
+// PeersByLatency returns the peers that the Gateway is currently connected to,
+// sorted by the round-trip time of their most recent successful ping,
+// fastest first. Peers that have never responded to a ping are listed last.
+func (g *Gateway) PeersByLatency() []modules.Peer {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	peers := make([]*peer, 0, len(g.peers))
+	for _, p := range g.peers {
+		peers = append(peers, p)
+	}
+	sort.Stable(peersByLatency(peers))
+	sorted := make([]modules.Peer, len(peers))
+	for i, p := range peers {
+		sorted[i] = p.Peer
+	}
+	return sorted
+}
+
+// PeerCount returns the number of peers that the Gateway is currently
+// connected to.
+func (g *Gateway) PeerCount() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return len(g.peers)
+}
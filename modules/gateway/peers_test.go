@@ -3,6 +3,8 @@ package gateway
 import (
 	"net"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -48,6 +50,266 @@ func TestAddPeer(t *testing.T) {
 	}
 }
 
+// TestAddPeerInvalidAddress checks that addPeer validates the peer's address.
+func TestAddPeerInvalidAddress(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	g := newTestingGateway("TestAddPeerInvalidAddress", t)
+	defer g.Close()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	tests := []struct {
+		addr modules.NetAddress
+		err  error
+	}{
+		{"12.34.56.78:123", nil},
+		{"[2001:db8::1]:123", nil},
+		{"foo.com", ErrInvalidAddress},
+		{"2001:db8::1:123", ErrInvalidAddress},
+		{"0.0.0.0:123", ErrInvalidAddress},
+		// loopback addresses are allowed in testing builds
+		{"127.0.0.1:123", nil},
+	}
+	for _, tt := range tests {
+		err := g.addPeer(&peer{
+			Peer: modules.Peer{
+				NetAddress: tt.addr,
+			},
+			sess: muxado.Client(new(dummyConn)),
+		})
+		if err != tt.err {
+			t.Errorf("addPeer(%v): expected %v, got %v", tt.addr, tt.err, err)
+		}
+	}
+	if len(g.peers) != 3 {
+		t.Fatal("expected 3 peers, got", len(g.peers))
+	}
+}
+
+// TestAddPeerLimit checks that addPeer refuses peers once the gateway has the
+// maximum number of peers in that direction.
+func TestAddPeerLimit(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	g := newTestingGateway("TestAddPeerLimit", t)
+	defer g.Close()
+	if err := g.SetMaxPeers(0, 1); err != errBadPeerLimit {
+		t.Fatal("expected errBadPeerLimit, got", err)
+	}
+	if err := g.SetMaxPeers(2, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i := 0; i < 2; i++ {
+		err := g.addPeer(&peer{
+			Peer: modules.Peer{
+				NetAddress: modules.NetAddress("foo" + strconv.Itoa(i) + ".com:123"),
+			},
+			sess: muxado.Client(new(dummyConn)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := g.addPeer(&peer{
+		Peer: modules.Peer{
+			NetAddress: "foo.com:123",
+		},
+		sess: muxado.Client(new(dummyConn)),
+	})
+	if err != ErrPeerLimitReached {
+		t.Fatal("expected ErrPeerLimitReached, got", err)
+	}
+
+	// inbound peers are limited separately
+	for i := 0; i < 3; i++ {
+		err := g.addPeer(&peer{
+			Peer: modules.Peer{
+				NetAddress: modules.NetAddress("bar" + strconv.Itoa(i) + ".com:123"),
+				Inbound:    true,
+			},
+			sess: muxado.Client(new(dummyConn)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = g.addPeer(&peer{
+		Peer: modules.Peer{
+			NetAddress: "bar.com:123",
+			Inbound:    true,
+		},
+		sess: muxado.Client(new(dummyConn)),
+	})
+	if err != ErrPeerLimitReached {
+		t.Fatal("expected ErrPeerLimitReached, got", err)
+	}
+	if len(g.peers) != 5 {
+		t.Fatal("expected 5 peers, got", len(g.peers))
+	}
+}
+
+// TestAcceptPeerEviction checks that acceptPeer kicks an existing inbound peer
+// to make room for a new one once the inbound limit is reached, and never
+// kicks outbound or local peers.
+func TestAcceptPeerEviction(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	g := newTestingGateway("TestAcceptPeerEviction", t)
+	defer g.Close()
+	if err := g.SetMaxPeers(1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.addPeer(&peer{
+		Peer: modules.Peer{
+			NetAddress: "outbound.com:123",
+		},
+		sess: muxado.Client(new(dummyConn)),
+	})
+	g.addPeer(&peer{
+		Peer: modules.Peer{
+			NetAddress: "local.com:123",
+			Inbound:    true,
+			Local:      true,
+		},
+		sess: muxado.Client(new(dummyConn)),
+	})
+	g.addPeer(&peer{
+		Peer: modules.Peer{
+			NetAddress: "inbound.com:123",
+			Inbound:    true,
+		},
+		sess: muxado.Client(new(dummyConn)),
+	})
+
+	err := g.acceptPeer(&peer{
+		Peer: modules.Peer{
+			NetAddress: "new.com:123",
+			Inbound:    true,
+		},
+		sess: muxado.Client(new(dummyConn)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.peers["inbound.com:123"]; ok {
+		t.Fatal("inbound peer was not kicked")
+	}
+	for _, addr := range []modules.NetAddress{"outbound.com:123", "local.com:123", "new.com:123"} {
+		if _, ok := g.peers[addr]; !ok {
+			t.Fatal("expected gateway to be connected to", addr)
+		}
+	}
+
+	// with only outbound and local peers left to kick, the next peer should
+	// not be added
+	delete(g.peers, "new.com:123")
+	g.peers["local2.com:123"] = &peer{
+		Peer: modules.Peer{
+			NetAddress: "local2.com:123",
+			Inbound:    true,
+			Local:      true,
+		},
+		sess: muxado.Client(new(dummyConn)),
+	}
+	err = g.acceptPeer(&peer{
+		Peer: modules.Peer{
+			NetAddress: "new.com:123",
+			Inbound:    true,
+		},
+		sess: muxado.Client(new(dummyConn)),
+	})
+	if err != ErrPeerLimitReached {
+		t.Fatal("expected ErrPeerLimitReached, got", err)
+	}
+}
+
+// TestBan checks that banned peers cannot be added, and that bans can be
+// lifted or expire.
+func TestBan(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	g := newTestingGateway("TestBan", t)
+	defer g.Close()
+	newPeer := func() *peer {
+		return &peer{
+			Peer: modules.Peer{
+				NetAddress: "foo.com:123",
+			},
+			sess: muxado.Client(new(dummyConn)),
+		}
+	}
+
+	if err := g.Ban("foo.com:123", 0); err != errBadBanDuration {
+		t.Fatal("expected errBadBanDuration, got", err)
+	}
+	if err := g.Unban("foo.com:123"); err != errNotBanned {
+		t.Fatal("expected errNotBanned, got", err)
+	}
+
+	// banning a connected peer should disconnect it
+	g.mu.Lock()
+	err := g.addPeer(newPeer())
+	g.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Ban("foo.com:123", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	g.mu.Lock()
+	_, exists := g.peers["foo.com:123"]
+	err = g.addPeer(newPeer())
+	g.mu.Unlock()
+	if exists {
+		t.Fatal("banned peer was not disconnected")
+	}
+	if err != ErrPeerBanned {
+		t.Fatal("expected ErrPeerBanned, got", err)
+	}
+
+	// after unbanning, the peer can be added again
+	if err := g.Unban("foo.com:123"); err != nil {
+		t.Fatal(err)
+	}
+	g.mu.Lock()
+	err = g.addPeer(newPeer())
+	g.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// bans expire after their duration
+	if err := g.Ban("foo.com:123", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.isBanned("foo.com:123") {
+		t.Fatal("ban did not expire")
+	}
+	if _, exists := g.bans["foo.com:123"]; exists {
+		t.Fatal("expired ban was not removed")
+	}
+	if err := g.addPeer(newPeer()); err != nil {
+		t.Fatal(err)
+	}
+}
+
 // TestRandomInbountPeer checks that randomOutboundPeer returns the correct
 // peer.
 func TestRandomOutboundPeer(t *testing.T) {
@@ -334,15 +596,53 @@ func TestUnitAcceptableVersion(t *testing.T) {
 		"1",
 		"1.0",
 		"1.0.0",
+		"1.9.9",
+		build.Version,
+	}
+	for _, v := range validVersions {
+		err := acceptableVersion(v)
+		if err != nil {
+			t.Errorf("acceptableVersion returned %q for version %q, but expected nil", err, v)
+		}
+	}
+	incompatibleVersions := []string{
+		// newer major versions
+		"2",
+		"2.0.0",
 		"9",
 		"9.0",
 		"9.0.0",
 		"9.9.9",
 	}
-	for _, v := range validVersions {
+	for _, v := range incompatibleVersions {
 		err := acceptableVersion(v)
-		if err != nil {
-			t.Errorf("acceptableVersion returned %q for version %q, but expected nil", err, v)
+		if err != ErrPeerVersionMismatch {
+			t.Errorf("acceptableVersion returned %q for version %q, but expected ErrPeerVersionMismatch", err, v)
+		}
+	}
+}
+
+// TestUnitCompatibleVersions tests that compatibleVersions only rejects peers
+// with a newer major version.
+func TestUnitCompatibleVersions(t *testing.T) {
+	tests := []struct {
+		local, remote string
+		compatible    bool
+	}{
+		{"1.1.0", "1.1.0", true},
+		{"1.1.0", "1.0.0", true},
+		{"1.1.0", "1.9.9", true},
+		{"1.1.0", "1", true},
+		{"1.1.0", "0.4.0", true},
+		{"2.0.0", "1.1.0", true},
+		{"1.1.0", "2.0.0", false},
+		{"1.1.0", "2", false},
+		{"0.6.0", "1.0.0", false},
+		{"1.1.0", "9999.9999.9999", false},
+	}
+	for _, tt := range tests {
+		if compatibleVersions(tt.local, tt.remote) != tt.compatible {
+			t.Errorf("compatibleVersions(%q, %q) should be %v", tt.local, tt.remote, tt.compatible)
 		}
 	}
 }
@@ -480,17 +780,30 @@ func TestConnectRejectsVersions(t *testing.T) {
 			msg:     "Connect should succeed when the remote peer's version is 0.4.0",
 		},
 		// Test that Connect succeeds when the remote peer's version is > 0.4.0.
+		{
+			version: "1.0.0",
+			msg:     "Connect should succeed when the remote peer's version is 1.0.0",
+		},
+		{
+			version: build.Version,
+			msg:     "Connect should succeed when the remote peer's version is build.Version",
+		},
+		// Test that Connect fails when the remote peer's major version is
+		// newer than ours.
 		{
 			version: "9",
-			msg:     "Connect should succeed when the remote peer's version is 9",
+			errWant: ErrPeerVersionMismatch,
+			msg:     "Connect should fail when the remote peer's version is 9",
 		},
 		{
 			version: "9.9.9",
-			msg:     "Connect should succeed when the remote peer's version is 9.9.9",
+			errWant: ErrPeerVersionMismatch,
+			msg:     "Connect should fail when the remote peer's version is 9.9.9",
 		},
 		{
 			version: "9999.9999.9999",
-			msg:     "Connect should succeed when the remote peer's version is 9999.9999.9999",
+			errWant: ErrPeerVersionMismatch,
+			msg:     "Connect should fail when the remote peer's version is 9999.9999.9999",
 		},
 	}
 	for _, tt := range tests {
@@ -529,6 +842,74 @@ func TestConnectRejectsVersions(t *testing.T) {
 		}
 		<-doneChan
 		g.Disconnect(modules.NetAddress(listener.Addr().String()))
+		// Every test case dials the same address, so clear any cooldown
+		// caused by the remote peer's version.
+		g.mu.Lock()
+		delete(g.cooldowns, modules.NetAddress(listener.Addr().String()))
+		g.mu.Unlock()
+	}
+}
+
+// TestConnectVersionCooldown tests that Gateway.Connect does not redial a peer
+// that was rejected because of its version until the cooldown expires.
+func TestConnectVersionCooldown(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	g := newTestingGateway("TestConnectVersionCooldown", t)
+	defer g.Close()
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	addr := modules.NetAddress(listener.Addr().String())
+
+	// Mock a peer with a newer major version.
+	accepted := make(chan struct{}, 2)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- struct{}{}
+			acceptConnVersionHandshake(conn, "2.0.0")
+			conn.Close()
+		}
+	}()
+	if err := g.Connect(addr); err != ErrPeerVersionMismatch {
+		t.Fatal("expected ErrPeerVersionMismatch, got", err)
+	}
+	<-accepted
+	g.mu.RLock()
+	_, exists := g.peers[addr]
+	g.mu.RUnlock()
+	if exists {
+		t.Fatal("gateway should not have added a peer with an incompatible version")
+	}
+
+	// The peer should not be dialed again during the cooldown.
+	if err := g.Connect(addr); err != ErrPeerVersionMismatch {
+		t.Fatal("expected ErrPeerVersionMismatch, got", err)
+	}
+	select {
+	case <-accepted:
+		t.Fatal("gateway dialed a peer that was cooling down")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Once the cooldown expires, the peer should be dialed again.
+	g.mu.Lock()
+	g.cooldowns[addr] = time.Now().Add(-time.Second)
+	g.mu.Unlock()
+	if err := g.Connect(addr); err != ErrPeerVersionMismatch {
+		t.Fatal("expected ErrPeerVersionMismatch, got", err)
+	}
+	select {
+	case <-accepted:
+	case <-time.After(time.Second):
+		t.Fatal("gateway did not dial the peer after the cooldown expired")
 	}
 }
 
@@ -613,19 +994,34 @@ func TestAcceptConnRejectsVersions(t *testing.T) {
 		},
 		// Test that acceptConn succeeds when the remote peer's version is > 0.4.0.
 		{
-			remoteVersion:       "9",
+			remoteVersion:       "1.0.0",
 			versionResponseWant: build.Version,
-			msg:                 "acceptConn should accept a remote peer whose version is 9",
+			msg:                 "acceptConn should accept a remote peer whose version is 1.0.0",
 		},
 		{
-			remoteVersion:       "9.9.9",
+			remoteVersion:       build.Version,
 			versionResponseWant: build.Version,
-			msg:                 "acceptConn should accept a remote peer whose version is 9.9.9",
+			msg:                 "acceptConn should accept a remote peer whose version is build.Version",
+		},
+		// Test that acceptConn fails when the remote peer's major version is
+		// newer than ours.
+		{
+			remoteVersion:       "9",
+			versionResponseWant: "",
+			errWant:             errPeerRejectedConn,
+			msg:                 "acceptConn shouldn't accept a remote peer whose version is 9",
+		},
+		{
+			remoteVersion:       "9.9.9",
+			versionResponseWant: "",
+			errWant:             errPeerRejectedConn,
+			msg:                 "acceptConn shouldn't accept a remote peer whose version is 9.9.9",
 		},
 		{
 			remoteVersion:       "9999.9999.9999",
-			versionResponseWant: build.Version,
-			msg:                 "acceptConn should accept a remote peer whose version is 9999.9999.9999",
+			versionResponseWant: "",
+			errWant:             errPeerRejectedConn,
+			msg:                 "acceptConn shouldn't accept a remote peer whose version is 9999.9999.9999",
 		},
 	}
 	for _, tt := range tests {
@@ -687,6 +1083,64 @@ func TestDisconnect(t *testing.T) {
 	}
 }
 
+// TestConcurrentPeerAccess checks that the peer list can be safely modified
+// and read from multiple goroutines at once. It is most useful when run with
+// the race detector.
+func TestConcurrentPeerAccess(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	g := newTestingGateway("TestConcurrentPeerAccess", t)
+	defer g.Close()
+
+	const numPeers = 20
+	var wg sync.WaitGroup
+	var disconnects [numPeers]int32
+	for i := 0; i < numPeers; i++ {
+		i := i
+		addr := modules.NetAddress("foo" + strconv.Itoa(i) + ".com:123")
+		wg.Add(5)
+		go func() {
+			defer wg.Done()
+			g.mu.Lock()
+			g.addPeer(&peer{
+				Peer: modules.Peer{
+					NetAddress: addr,
+				},
+				sess: muxado.Client(new(dummyConn)),
+			})
+			g.mu.Unlock()
+		}()
+		go func() {
+			defer wg.Done()
+			g.Peers()
+		}()
+		go func() {
+			defer wg.Done()
+			g.mu.RLock()
+			g.randomOutboundPeer()
+			g.mu.RUnlock()
+		}()
+		// concurrent disconnects of the same peer should succeed at most once
+		for j := 0; j < 2; j++ {
+			go func() {
+				defer wg.Done()
+				if g.Disconnect(addr) == nil {
+					atomic.AddInt32(&disconnects[i], 1)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	for i := range disconnects {
+		if n := atomic.LoadInt32(&disconnects[i]); n > 1 {
+			t.Errorf("peer %v was disconnected %v times", i, n)
+		}
+	}
+}
+
 // TestPeerManager checks that the peer manager is properly spacing out peer
 // connection requests.
 func TestPeerManager(t *testing.T) {
@@ -704,8 +1158,8 @@ func TestPeerManager(t *testing.T) {
 
 	// g1's node list should only contain g2
 	g1.mu.Lock()
-	g1.nodes = map[modules.NetAddress]struct{}{}
-	g1.nodes[g2.Address()] = struct{}{}
+	g1.nodes = map[modules.NetAddress]*node{}
+	g1.nodes[g2.Address()] = new(node)
 	g1.mu.Unlock()
 
 	// when peerManager wakes up, it should connect to g2.
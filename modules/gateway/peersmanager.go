@@ -77,9 +77,10 @@ func (g *Gateway) permanentPeerManager(closedChan chan struct{}) {
 			continue
 		}
 
-		// Fetch a random node.
+		// Fetch a random node, favoring nodes that have been reliable in the
+		// past.
 		g.mu.RLock()
-		addr, err := g.randomNode()
+		addr, err := g.weightedNode()
 		g.mu.RUnlock()
 		// If there was an error, log the error and then wait a while before
 		// trying again.
@@ -1,7 +1,9 @@
 package gateway
 
 import (
+	"errors"
 	"path/filepath"
+	"time"
 
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/persist"
@@ -15,25 +17,117 @@ const (
 	logFile = modules.GatewayDir + ".log"
 )
 
-// persistMetadata contains the header and version strings that identify the
-// gateway persist file.
-var persistMetadata = persist.Metadata{
-	Header:  "Sia Node List",
-	Version: "0.3.3",
-}
+const (
+	// persistVersion is the version of the persistedPeers format.
+	persistVersion = 1
+)
+
+var (
+	// persistMetadata contains the header and version strings that identify
+	// the gateway persist file.
+	persistMetadata = persist.Metadata{
+		Header:  "Sia Node List",
+		Version: "1.1.0",
+	}
+
+	// persistMetadataV033 identifies gateway persist files which store the
+	// node list as a raw slice of addresses.
+	persistMetadataV033 = persist.Metadata{
+		Header:  "Sia Node List",
+		Version: "0.3.3",
+	}
+
+	errBadPersistVersion = errors.New("unrecognized gateway persist version")
+)
+
+type (
+	// persistedPeers is the on-disk representation of the gateway's node
+	// list.
+	persistedPeers struct {
+		Version uint8           `json:"version"`
+		Peers   []persistedPeer `json:"peers"`
+		Bans    []persistedBan  `json:"bans"`
+	}
+
+	// persistedBan is the on-disk representation of a banned address.
+	persistedBan struct {
+		Address modules.NetAddress `json:"address"`
+		Expiry  time.Time          `json:"expiry"`
+	}
+
+	// persistedPeer is the on-disk representation of a single node.
+	persistedPeer struct {
+		Address       modules.NetAddress `json:"address"`
+		LastConnected time.Time          `json:"lastconnected"`
+		FailCount     int                `json:"failcount"`
+		SuccessCount  int                `json:"successcount"`
+		RetryAfter    time.Time          `json:"retryafter"`
+	}
+)
 
 // persistData returns the data in the Gateway that will be saved to disk.
-func (g *Gateway) persistData() (nodes []modules.NetAddress) {
-	for node := range g.nodes {
-		nodes = append(nodes, node)
+func (g *Gateway) persistData() (data persistedPeers) {
+	data.Version = persistVersion
+	for addr, n := range g.nodes {
+		data.Peers = append(data.Peers, persistedPeer{
+			Address:       addr,
+			LastConnected: n.LastConnected,
+			FailCount:     n.FailCount,
+			SuccessCount:  n.SuccessCount,
+			RetryAfter:    n.RetryAfter,
+		})
+	}
+	for addr, expiry := range g.bans {
+		data.Bans = append(data.Bans, persistedBan{
+			Address: addr,
+			Expiry:  expiry,
+		})
 	}
 	return
 }
 
 // load loads the Gateway's persistent data from disk.
 func (g *Gateway) load() error {
+	var data persistedPeers
+	filename := filepath.Join(g.persistDir, nodesFile)
+	err := persist.LoadFile(persistMetadata, &data, filename)
+	if err == persist.ErrBadVersion {
+		err = g.loadV033(filename)
+		if err != nil {
+			return err
+		}
+		// Rewrite the file in the current format.
+		return g.saveSync()
+	} else if err != nil {
+		return err
+	}
+	if data.Version != persistVersion {
+		return errBadPersistVersion
+	}
+	for _, p := range data.Peers {
+		err := g.addNode(p.Address)
+		if err != nil {
+			g.log.Printf("WARN: error loading node '%v' from persist: %v", p.Address, err)
+			continue
+		}
+		g.nodes[p.Address].LastConnected = p.LastConnected
+		g.nodes[p.Address].FailCount = p.FailCount
+		g.nodes[p.Address].SuccessCount = p.SuccessCount
+		g.nodes[p.Address].RetryAfter = p.RetryAfter
+	}
+	now := time.Now()
+	for _, b := range data.Bans {
+		if b.Expiry.After(now) {
+			g.bans[b.Address] = b.Expiry
+		}
+	}
+	return nil
+}
+
+// loadV033 loads a node list that was saved as a raw slice of addresses.
+func (g *Gateway) loadV033(filename string) error {
 	var nodes []modules.NetAddress
-	err := persist.LoadFile(persistMetadata, &nodes, filepath.Join(g.persistDir, nodesFile))
+	err := persist.LoadFile(persistMetadataV033, &nodes, filename)
 	if err != nil {
 		return err
 	}
@@ -1,7 +1,12 @@
 package gateway
 
 import (
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
 )
 
 func TestLoad(t *testing.T) {
@@ -24,3 +29,107 @@ func TestLoad(t *testing.T) {
 		t.Fatal("gateway did not load old peer list:", g2.nodes)
 	}
 }
+
+// TestLoadNodeMetadata checks that node metadata survives a save and load.
+func TestLoadNodeMetadata(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	g := newTestingGateway("TestLoadNodeMetadata", t)
+	lastConnected := time.Now().Add(-time.Hour).Round(time.Second)
+	retryAfter := time.Now().Add(time.Hour).Round(time.Second)
+	g.mu.Lock()
+	g.addNode(dummyNode)
+	g.nodes[dummyNode].LastConnected = lastConnected
+	g.nodes[dummyNode].FailCount = 3
+	g.nodes[dummyNode].RetryAfter = retryAfter
+	g.save()
+	g.mu.Unlock()
+	g.Close()
+
+	g2, err := New("localhost:0", false, g.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g2.Close()
+	n, ok := g2.nodes[dummyNode]
+	if !ok {
+		t.Fatal("gateway did not load node:", g2.nodes)
+	}
+	if !n.LastConnected.Equal(lastConnected) {
+		t.Errorf("LastConnected mismatch: expected %v, got %v", lastConnected, n.LastConnected)
+	}
+	if n.FailCount != 3 {
+		t.Errorf("FailCount mismatch: expected 3, got %v", n.FailCount)
+	}
+	if !n.RetryAfter.Equal(retryAfter) {
+		t.Errorf("RetryAfter mismatch: expected %v, got %v", retryAfter, n.RetryAfter)
+	}
+}
+
+// TestLoadV033 checks that the gateway can load a node list saved in the
+// v0.3.3 format, and that the file is upgraded to the current format.
+func TestLoadV033(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	g := newTestingGateway("TestLoadV033", t)
+	g.Close()
+	filename := filepath.Join(g.persistDir, nodesFile)
+	err := persist.SaveFile(persistMetadataV033, []modules.NetAddress{dummyNode}, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g2, err := New("localhost:0", false, g.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g2.Close()
+	if _, ok := g2.nodes[dummyNode]; !ok {
+		t.Fatal("gateway did not load legacy node list:", g2.nodes)
+	}
+
+	var data persistedPeers
+	err = persist.LoadFile(persistMetadata, &data, filename)
+	if err != nil {
+		t.Fatal("legacy node list was not upgraded:", err)
+	}
+	if data.Version != persistVersion || len(data.Peers) == 0 {
+		t.Fatal("upgraded node list is malformed:", data)
+	}
+}
+
+// TestLoadBans checks that bans survive a restart, and that expired bans are
+// dropped.
+func TestLoadBans(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	g := newTestingGateway("TestLoadBans", t)
+	if err := g.Ban("foo.com:123", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	g.mu.Lock()
+	g.bans["bar.com:123"] = time.Now().Add(-time.Hour)
+	g.save()
+	g.mu.Unlock()
+	g.Close()
+
+	g2, err := New("localhost:0", false, g.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g2.Close()
+	g2.mu.Lock()
+	defer g2.mu.Unlock()
+	if !g2.isBanned("foo.com:123") {
+		t.Fatal("gateway did not load ban")
+	}
+	if _, exists := g2.bans["bar.com:123"]; exists {
+		t.Fatal("gateway loaded expired ban")
+	}
+}
@@ -0,0 +1,133 @@
+package gateway
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	errBadPingConfig = errors.New("ping interval and failure threshold must be positive")
+)
+
+// pingResponse is the value written by a peer in response to a Ping RPC.
+const pingResponse = "pong"
+
+// rpcPing is the receiving end of the Ping RPC. It writes a short response so
+// that the caller can confirm that the peer is still alive.
+func (g *Gateway) rpcPing(conn modules.PeerConn) error {
+	return encoding.WriteObject(conn, pingResponse)
+}
+
+// managedPingPeer calls the Ping RPC on a peer, returning the round-trip time
+// of the ping, or an error if the peer does not respond within pingTimeout.
+func (g *Gateway) managedPingPeer(addr modules.NetAddress) (time.Duration, error) {
+	start := time.Now()
+	err := g.managedRPC(addr, "Ping", func(conn modules.PeerConn) error {
+		conn.SetDeadline(time.Now().Add(pingTimeout))
+		var resp string
+		err := encoding.ReadObject(conn, &resp, uint64(len(pingResponse))+8)
+		if err == io.EOF {
+			// Peers that do not support the Ping RPC close the stream
+			// without responding, which still shows that they are alive.
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if resp != pingResponse {
+			return errors.New("peer sent an invalid ping response")
+		}
+		return nil
+	})
+	return time.Since(start), err
+}
+
+// managedRecordPing updates the ping failure count of a peer, disconnecting
+// the peer once it has failed too many consecutive pings. The latency of a
+// successful ping is recorded for PeersByLatency.
+func (g *Gateway) managedRecordPing(addr modules.NetAddress, latency time.Duration, success bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, exists := g.peers[addr]
+	if !exists {
+		return
+	}
+	if success {
+		p.latency = latency
+		p.pingFailures = 0
+		return
+	}
+	p.pingFailures++
+	g.recordNodeConnection(addr, false)
+	if p.pingFailures >= g.maxPingFailures {
+		p.sess.Close()
+		delete(g.peers, addr)
+		g.log.Printf("INFO: disconnected from %v after %v failed pings\n", addr, p.pingFailures)
+	}
+}
+
+// permanentPeerPinger periodically pings every peer, removing peers that stop
+// responding.
+func (g *Gateway) permanentPeerPinger(closeChan chan struct{}) {
+	defer close(closeChan)
+
+	for {
+		g.mu.RLock()
+		interval := g.pingInterval
+		g.mu.RUnlock()
+		if !g.managedSleep(interval) {
+			return
+		}
+
+		g.mu.RLock()
+		addrs := make([]modules.NetAddress, 0, len(g.peers))
+		for addr := range g.peers {
+			addrs = append(addrs, addr)
+		}
+		g.mu.RUnlock()
+
+		var wg sync.WaitGroup
+		for _, addr := range addrs {
+			wg.Add(1)
+			go func(addr modules.NetAddress) {
+				defer wg.Done()
+				latency, err := g.managedPingPeer(addr)
+				if err != nil {
+					g.log.Debugf("WARN: ping to peer %v failed: %v", addr, err)
+				}
+				g.managedRecordPing(addr, latency, err == nil)
+			}(addr)
+		}
+		wg.Wait()
+	}
+}
+
+// peersByLatency sorts peers by the latency of their most recent successful
+// ping. Peers with no recorded latency sort last.
+type peersByLatency []*peer
+
+func (ps peersByLatency) Len() int      { return len(ps) }
+func (ps peersByLatency) Swap(i, j int) { ps[i], ps[j] = ps[j], ps[i] }
+func (ps peersByLatency) Less(i, j int) bool {
+	if ps[i].latency == 0 || ps[j].latency == 0 {
+		return ps[j].latency == 0 && ps[i].latency != 0
+	}
+	return ps[i].latency < ps[j].latency
+}
+
+// SetPingConfig sets how often the Gateway pings its peers, and how many
+// consecutive pings a peer may fail before it is disconnected.
+func (g *Gateway) SetPingConfig(interval time.Duration, maxFailures int) error {
+	if interval <= 0 || maxFailures <= 0 {
+		return errBadPingConfig
+	}
+	g.mu.Lock()
+	g.pingInterval = interval
+	g.maxPingFailures = maxFailures
+	g.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,153 @@
+package gateway
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/muxado"
+)
+
+// TestPingPeer checks that the Ping RPC succeeds against a live gateway.
+func TestPingPeer(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	g1 := newTestingGateway("TestPingPeer1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestPingPeer2", t)
+	defer g2.Close()
+
+	if err := g1.Connect(g2.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g1.managedPingPeer(g2.Address()); err != nil {
+		t.Fatal("ping failed:", err)
+	}
+	if _, err := g1.managedPingPeer("foo.com:123"); err == nil {
+		t.Fatal("ping to unconnected peer should fail")
+	}
+}
+
+// TestSetPingConfig checks that invalid ping configurations are rejected.
+func TestSetPingConfig(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	g := newTestingGateway("TestSetPingConfig", t)
+	defer g.Close()
+
+	if err := g.SetPingConfig(0, 1); err != errBadPingConfig {
+		t.Fatal("expected errBadPingConfig, got", err)
+	}
+	if err := g.SetPingConfig(time.Second, 0); err != errBadPingConfig {
+		t.Fatal("expected errBadPingConfig, got", err)
+	}
+	if err := g.SetPingConfig(time.Second, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestPeerPinger checks that the pinger disconnects peers that stop
+// responding, while keeping responsive peers.
+func TestPeerPinger(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	g1 := newTestingGateway("TestPeerPinger1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestPeerPinger2", t)
+	defer g2.Close()
+
+	if err := g1.SetPingConfig(100*time.Millisecond, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := g1.Connect(g2.Address()); err != nil {
+		t.Fatal(err)
+	}
+
+	// add a peer which accepts streams but never responds to them
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	remote := muxado.Server(c2)
+	go func() {
+		for {
+			if _, err := remote.Accept(); err != nil {
+				return
+			}
+		}
+	}()
+	const dead = modules.NetAddress("dead.com:123")
+	g1.mu.Lock()
+	err := g1.addPeer(&peer{
+		Peer: modules.Peer{NetAddress: dead},
+		sess: muxado.Client(c1),
+	})
+	g1.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wait for the unresponsive peer to be pruned
+	for i := 0; i < 150; i++ {
+		g1.mu.RLock()
+		_, exists := g1.peers[dead]
+		g1.mu.RUnlock()
+		if !exists {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	g1.mu.RLock()
+	_, deadExists := g1.peers[dead]
+	_, g2Exists := g1.peers[g2.Address()]
+	g1.mu.RUnlock()
+	if deadExists {
+		t.Fatal("unresponsive peer was not disconnected")
+	}
+	if !g2Exists {
+		t.Fatal("responsive peer was disconnected")
+	}
+}
+
+// TestPeersByLatency checks that PeersByLatency orders peers by their
+// recorded ping latency, with peers that were never pinged listed last.
+func TestPeersByLatency(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	g := newTestingGateway("TestPeersByLatency", t)
+	defer g.Close()
+
+	addrs := []modules.NetAddress{"slow.com:123", "unpinged.com:123", "fast.com:123", "medium.com:123"}
+	g.mu.Lock()
+	for _, addr := range addrs {
+		g.addPeer(&peer{
+			Peer: modules.Peer{NetAddress: addr},
+			sess: muxado.Client(new(dummyConn)),
+		})
+	}
+	g.mu.Unlock()
+
+	g.managedRecordPing("slow.com:123", 300*time.Millisecond, true)
+	g.managedRecordPing("fast.com:123", 10*time.Millisecond, true)
+	g.managedRecordPing("medium.com:123", 50*time.Millisecond, true)
+	// a failed ping should not record a latency
+	g.managedRecordPing("unpinged.com:123", time.Millisecond, false)
+
+	peers := g.PeersByLatency()
+	expected := []modules.NetAddress{"fast.com:123", "medium.com:123", "slow.com:123", "unpinged.com:123"}
+	if len(peers) != len(expected) {
+		t.Fatalf("expected %v peers, got %v", len(expected), len(peers))
+	}
+	for i, p := range peers {
+		if p.NetAddress != expected[i] {
+			t.Fatalf("expected peer %v to be %v, got %v", i, expected[i], p.NetAddress)
+		}
+	}
+}
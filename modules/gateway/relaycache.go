@@ -0,0 +1,107 @@
+package gateway
+
+import (
+	"container/list"
+	"errors"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	errBadRelayCacheConfig = errors.New("relay cache size and TTL must be positive")
+)
+
+// A relayCache remembers which objects were recently relayed to which peers,
+// so that the gateway does not send a peer the same transaction set or block
+// repeatedly as it bounces between peers. Each entry is the hash of an object
+// and a peer address. The cache holds at most size hashes, evicting the least
+// recently seen hash when full, and forgets each hash ttl after it was first
+// relayed.
+type relayCache struct {
+	size int
+	ttl  time.Duration
+
+	// order holds the cached entries, most recently seen first. entries maps
+	// each hash to its element in order.
+	order   *list.List
+	entries map[crypto.Hash]*list.Element
+}
+
+// relayCacheEntry is a hash in the relay cache, along with the time at which
+// it was first relayed.
+type relayCacheEntry struct {
+	hash    crypto.Hash
+	relayed time.Time
+}
+
+// newRelayCache returns an empty relayCache.
+func newRelayCache(size int, ttl time.Duration) *relayCache {
+	return &relayCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[crypto.Hash]*list.Element),
+	}
+}
+
+// evict removes the least recently seen entries until the cache holds at most
+// rc.size entries.
+func (rc *relayCache) evict() {
+	for rc.order.Len() > rc.size {
+		e := rc.order.Back()
+		rc.order.Remove(e)
+		delete(rc.entries, e.Value.(*relayCacheEntry).hash)
+	}
+}
+
+// relayed records that the object with hash h is being relayed at time now. It
+// returns true if the object was already relayed within the last rc.ttl, in
+// which case it should not be relayed again.
+func (rc *relayCache) relayed(h crypto.Hash, now time.Time) bool {
+	if e, exists := rc.entries[h]; exists {
+		rc.order.MoveToFront(e)
+		entry := e.Value.(*relayCacheEntry)
+		if now.Sub(entry.relayed) < rc.ttl {
+			return true
+		}
+		entry.relayed = now
+		return false
+	}
+	rc.entries[h] = rc.order.PushFront(&relayCacheEntry{hash: h, relayed: now})
+	rc.evict()
+	return false
+}
+
+// managedUnrelayedPeers records that an object is being relayed over the
+// named RPC to peers, returning the peers that it was not already relayed to
+// recently.
+func (g *Gateway) managedUnrelayedPeers(name string, obj interface{}, peers []modules.Peer) []modules.Peer {
+	objHash := crypto.HashAll(name, obj)
+	now := time.Now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var unrelayed []modules.Peer
+	for _, p := range peers {
+		if !g.relayCache.relayed(crypto.HashAll(objHash, p.NetAddress), now) {
+			unrelayed = append(unrelayed, p)
+		}
+	}
+	return unrelayed
+}
+
+// SetRelayCacheConfig sets how many recently relayed objects the Gateway
+// remembers, counting each peer an object was relayed to separately, and how
+// long it refuses to relay an object to a peer again after relaying it.
+func (g *Gateway) SetRelayCacheConfig(size int, ttl time.Duration) error {
+	if size <= 0 || ttl <= 0 {
+		return errBadRelayCacheConfig
+	}
+	g.mu.Lock()
+	g.relayCache.size = size
+	g.relayCache.ttl = ttl
+	g.relayCache.evict()
+	g.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,167 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestRelayCache tests that the relay cache suppresses hashes that were
+// relayed within the TTL, and evicts the least recently seen hashes when full.
+func TestRelayCache(t *testing.T) {
+	rc := newRelayCache(2, time.Minute)
+	now := time.Now()
+	h1, h2, h3 := crypto.Hash{1}, crypto.Hash{2}, crypto.Hash{3}
+
+	if rc.relayed(h1, now) {
+		t.Fatal("new hash should not have been relayed")
+	}
+	if !rc.relayed(h1, now.Add(time.Second)) {
+		t.Fatal("hash should have been relayed")
+	}
+
+	// Once the TTL has passed, the hash should be relayed again.
+	if rc.relayed(h1, now.Add(time.Minute)) {
+		t.Fatal("hash should expire after the TTL")
+	}
+	if !rc.relayed(h1, now.Add(time.Minute+time.Second)) {
+		t.Fatal("expired hash should be recorded again")
+	}
+
+	// Adding a third hash should evict the least recently seen one. h1 was
+	// seen more recently than h2.
+	rc.relayed(h2, now)
+	rc.relayed(h1, now)
+	rc.relayed(h3, now)
+	if len(rc.entries) != 2 || rc.order.Len() != 2 {
+		t.Fatal("cache should hold 2 entries, holds", len(rc.entries))
+	}
+	if _, exists := rc.entries[h2]; exists {
+		t.Fatal("least recently seen hash was not evicted")
+	}
+	if rc.relayed(h2, now) {
+		t.Fatal("evicted hash should not have been relayed")
+	}
+}
+
+// TestSetRelayCacheConfig tests that SetRelayCacheConfig rejects invalid
+// values and shrinks the cache.
+func TestSetRelayCacheConfig(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	g := newTestingGateway("TestSetRelayCacheConfig", t)
+	defer g.Close()
+
+	if err := g.SetRelayCacheConfig(0, time.Second); err != errBadRelayCacheConfig {
+		t.Fatal("expected errBadRelayCacheConfig, got", err)
+	}
+	if err := g.SetRelayCacheConfig(1, 0); err != errBadRelayCacheConfig {
+		t.Fatal("expected errBadRelayCacheConfig, got", err)
+	}
+	peers := []modules.Peer{{NetAddress: "foo.com:123"}}
+	for i := 0; i < 3; i++ {
+		g.managedUnrelayedPeers("Recv", i, peers)
+	}
+	if err := g.SetRelayCacheConfig(1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	g.mu.RLock()
+	n := len(g.relayCache.entries)
+	g.mu.RUnlock()
+	if n != 1 {
+		t.Fatal("cache should have been shrunk to 1 entry, has", n)
+	}
+}
+
+// TestBroadcastSuppressesDuplicates tests that Broadcast does not relay an
+// object to a peer that it relayed the object to recently, while still
+// relaying it to other peers.
+func TestBroadcastSuppressesDuplicates(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	g1 := newTestingGateway("TestBroadcastSuppressesDuplicates1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestBroadcastSuppressesDuplicates2", t)
+	defer g2.Close()
+
+	if err := g1.Connect(g2.Address()); err != nil {
+		t.Fatal("failed to connect:", err)
+	}
+	received := make(chan string, 4)
+	g2.RegisterRPC("Recv", func(conn modules.PeerConn) error {
+		var payload string
+		encoding.ReadObject(conn, &payload, 100)
+		received <- payload
+		return nil
+	})
+
+	// The first relay should reach g2, and the second should be suppressed.
+	g1.Broadcast("Recv", "foo", g1.Peers())
+	select {
+	case <-received:
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("first broadcast was not received")
+	}
+	g1.Broadcast("Recv", "foo", g1.Peers())
+	select {
+	case <-received:
+		t.Fatal("duplicate broadcast was not suppressed")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// A peer that has not received the object yet should still receive it,
+	// while g2 should not receive it again.
+	g3 := newTestingGateway("TestBroadcastSuppressesDuplicates3", t)
+	defer g3.Close()
+	if err := g1.Connect(g3.Address()); err != nil {
+		t.Fatal("failed to connect:", err)
+	}
+	received3 := make(chan string, 4)
+	g3.RegisterRPC("Recv", func(conn modules.PeerConn) error {
+		var payload string
+		encoding.ReadObject(conn, &payload, 100)
+		received3 <- payload
+		return nil
+	})
+	g1.Broadcast("Recv", "foo", g1.Peers())
+	select {
+	case <-received3:
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("broadcast to a new peer was suppressed")
+	}
+	select {
+	case <-received:
+		t.Fatal("duplicate broadcast was not suppressed")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// A different object should still be relayed.
+	g1.Broadcast("Recv", "bar", g1.Peers())
+	select {
+	case payload := <-received:
+		if payload != "bar" {
+			t.Fatal("wrong payload received:", payload)
+		}
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("broadcast of a new object was not received")
+	}
+
+	// Once the TTL has passed, the object can be relayed again.
+	if err := g1.SetRelayCacheConfig(defaultRelayCacheSize, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	g1.Broadcast("Recv", "foo", g1.Peers())
+	select {
+	case <-received:
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("broadcast was suppressed after the TTL passed")
+	}
+}
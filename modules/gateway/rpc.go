@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 )
@@ -206,13 +207,14 @@ func (g *Gateway) threadedHandleConn(conn modules.PeerConn) {
 	}
 }
 
-// Broadcast calls an RPC on all of the specified peers. The calls are run in
-// parallel. Broadcasts are restricted to "one-way" RPCs, which simply write an
-// object and disconnect. This is why Broadcast takes an interface{} instead of
-// an RPCFunc.
-func (g *Gateway) Broadcast(name string, obj interface{}, peers []modules.Peer) {
+// broadcastWithErrors calls an RPC on all of the specified peers and returns
+// the error encountered for each peer that could not be reached. The calls are
+// run in parallel, with at most maxConcurrentBroadcasts in flight at once.
+// Peers that fail maxBroadcastFailures consecutive broadcasts are
+// disconnected.
+func (g *Gateway) broadcastWithErrors(name string, obj interface{}, peers []modules.Peer) map[modules.NetAddress]error {
 	if g.threads.Add() != nil {
-		return
+		return nil
 	}
 	defer g.threads.Done()
 
@@ -221,29 +223,106 @@ func (g *Gateway) Broadcast(name string, obj interface{}, peers []modules.Peer)
 	// only encode obj once, instead of using WriteObject
 	enc := encoding.Marshal(obj)
 	fn := func(conn modules.PeerConn) error {
+		conn.SetDeadline(time.Now().Add(broadcastTimeout))
 		return encoding.WritePrefix(conn, enc)
 	}
 
 	var wg sync.WaitGroup
+	var errsMu sync.Mutex
+	errs := make(map[modules.NetAddress]error)
+	sem := make(chan struct{}, maxConcurrentBroadcasts)
 	for _, p := range peers {
 		wg.Add(1)
 		go func(addr modules.NetAddress) {
 			defer wg.Done()
+			sem <- struct{}{}
 			err := g.managedRPC(addr, name, fn)
+			<-sem
 			if err != nil {
-				g.log.Debugf("WARN: broadcasting RPC %q to peer %q failed (attempting again in 10 seconds): %v", name, addr, err)
+				g.log.Debugf("WARN: broadcasting RPC %q to peer %q failed (attempting again in %v): %v", name, addr, broadcastRetryDelay, err)
 				// try one more time before giving up
 				select {
-				case <-time.After(10 * time.Second):
+				case <-time.After(broadcastRetryDelay):
 				case <-g.threads.StopChan():
 					return
 				}
-				err := g.managedRPC(addr, name, fn)
+				sem <- struct{}{}
+				err = g.managedRPC(addr, name, fn)
+				<-sem
 				if err != nil {
 					g.log.Debugf("WARN: broadcasting RPC %q to peer %q failed twice: %v", name, addr, err)
+					errsMu.Lock()
+					errs[addr] = err
+					errsMu.Unlock()
 				}
 			}
+			g.managedRecordBroadcast(addr, err == nil)
 		}(p.NetAddress)
 	}
 	wg.Wait()
+	return errs
+}
+
+// broadcastSubset calls an RPC on k distinct peers selected at random from
+// peers, relying on those peers to relay the object so that it eventually
+// reaches the rest of the network. If k exceeds the number of peers, every
+// peer is contacted. It returns the error encountered for each selected peer
+// that could not be reached.
+func (g *Gateway) broadcastSubset(name string, obj interface{}, peers []modules.Peer, k int) map[modules.NetAddress]error {
+	if k < 0 {
+		k = 0
+	} else if k > len(peers) {
+		k = len(peers)
+	}
+	if k < len(peers) {
+		subset := make([]modules.Peer, k)
+		perm, err := crypto.Perm(len(peers))
+		if err != nil {
+			g.log.Severe("Unable to get random permutation for broadcast:", err)
+			copy(subset, peers)
+		} else {
+			for i := range subset {
+				subset[i] = peers[perm[i]]
+			}
+		}
+		peers = subset
+	}
+	return g.broadcastWithErrors(name, obj, peers)
+}
+
+// managedRecordBroadcast updates the broadcast failure count of a peer,
+// disconnecting the peer if it has failed too many consecutive broadcasts.
+func (g *Gateway) managedRecordBroadcast(addr modules.NetAddress, success bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, exists := g.peers[addr]
+	if !exists {
+		return
+	}
+	if success {
+		p.broadcastFailures = 0
+		return
+	}
+	p.broadcastFailures++
+	if p.broadcastFailures >= maxBroadcastFailures {
+		p.sess.Close()
+		delete(g.peers, addr)
+		g.log.Printf("INFO: disconnected from %v after %v failed broadcasts\n", addr, p.broadcastFailures)
+	}
+}
+
+// Broadcast calls an RPC on all of the specified peers. The calls are run in
+// parallel. Broadcasts are restricted to "one-way" RPCs, which simply write an
+// object and disconnect. This is why Broadcast takes an interface{} instead of
+// an RPCFunc. Objects are not broadcast again to peers that they were
+// recently broadcast to.
+func (g *Gateway) Broadcast(name string, obj interface{}, peers []modules.Peer) {
+	unrelayed := g.managedUnrelayedPeers(name, obj, peers)
+	if len(unrelayed) < len(peers) {
+		g.log.Debugf("INFO: not broadcasting RPC %q to %v peers: object was broadcast to them recently", name, len(peers)-len(unrelayed))
+		if len(unrelayed) == 0 {
+			return
+		}
+	}
+	g.broadcastSubset(name, obj, unrelayed, len(unrelayed))
 }
@@ -2,11 +2,13 @@ package gateway
 
 import (
 	"io"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/muxado"
 )
 
 func TestRPCID(t *testing.T) {
@@ -534,3 +536,133 @@ func TestCallingRPCFromRPC(t *testing.T) {
 		t.Fatal("expected BAR RPC to be called")
 	}
 }
+
+// TestBroadcastWithErrors tests that broadcastWithErrors reports the peers
+// that could not be reached, and disconnects peers that repeatedly fail.
+func TestBroadcastWithErrors(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	g1 := newTestingGateway("TestBroadcastWithErrors1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestBroadcastWithErrors2", t)
+	defer g2.Close()
+
+	err := g1.Connect(g2.Address())
+	if err != nil {
+		t.Fatal("failed to connect:", err)
+	}
+	received := make(chan string, maxBroadcastFailures)
+	g2.RegisterRPC("Recv", func(conn modules.PeerConn) error {
+		var payload string
+		encoding.ReadObject(conn, &payload, 100)
+		received <- payload
+		return nil
+	})
+
+	// add a peer whose session has already been closed, so that every RPC
+	// to it fails
+	const dead = modules.NetAddress("dead.com:123")
+	sess := muxado.Client(new(dummyConn))
+	sess.Close()
+	g1.mu.Lock()
+	g1.peers[dead] = &peer{
+		Peer: modules.Peer{NetAddress: dead},
+		sess: sess,
+	}
+	g1.mu.Unlock()
+
+	peers := []modules.Peer{
+		{NetAddress: g2.Address()},
+		{NetAddress: dead},
+		{NetAddress: "unconnected.com:123"},
+	}
+	for i := 0; i < maxBroadcastFailures; i++ {
+		errs := g1.broadcastWithErrors("Recv", "foo", peers)
+		if len(errs) != 2 || errs[dead] == nil || errs["unconnected.com:123"] == nil {
+			t.Fatal("expected errors for the failing peers only, got", errs)
+		}
+		select {
+		case p := <-received:
+			if p != "foo" {
+				t.Fatal("wrong payload:", p)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("responsive peer did not receive the broadcast")
+		}
+	}
+
+	// the dead peer should have been disconnected, but not the responsive one
+	g1.mu.RLock()
+	_, deadExists := g1.peers[dead]
+	_, g2Exists := g1.peers[g2.Address()]
+	g1.mu.RUnlock()
+	if deadExists {
+		t.Fatal("peer that repeatedly failed broadcasts was not disconnected")
+	}
+	if !g2Exists {
+		t.Fatal("responsive peer was disconnected")
+	}
+}
+
+// TestBroadcastSubset tests that broadcastSubset contacts exactly k distinct
+// peers, and every peer when k exceeds the number of peers.
+func TestBroadcastSubset(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	g := newTestingGateway("TestBroadcastSubset", t)
+	defer g.Close()
+
+	received := make(chan modules.NetAddress, 20)
+	var addrs []modules.NetAddress
+	for i := 0; i < 4; i++ {
+		peer := newTestingGateway("TestBroadcastSubset"+strconv.Itoa(i), t)
+		defer peer.Close()
+		if err := g.Connect(peer.Address()); err != nil {
+			t.Fatal("failed to connect:", err)
+		}
+		addr := peer.Address()
+		addrs = append(addrs, addr)
+		peer.RegisterRPC("Recv", func(conn modules.PeerConn) error {
+			var payload string
+			encoding.ReadObject(conn, &payload, 100)
+			received <- addr
+			return nil
+		})
+	}
+
+	// collect returns the number of times each peer received a broadcast.
+	collect := func() map[modules.NetAddress]int {
+		counts := make(map[modules.NetAddress]int)
+		for {
+			select {
+			case addr := <-received:
+				counts[addr]++
+			case <-time.After(200 * time.Millisecond):
+				return counts
+			}
+		}
+	}
+
+	for _, k := range []int{0, 1, 2, 3, 4, 10} {
+		if errs := g.broadcastSubset("Recv", "foo", g.Peers(), k); len(errs) != 0 {
+			t.Fatal("broadcast failed:", errs)
+		}
+		counts := collect()
+		want := k
+		if want > len(addrs) {
+			want = len(addrs)
+		}
+		if len(counts) != want {
+			t.Fatalf("broadcastSubset with k = %v contacted %v peers, expected %v", k, len(counts), want)
+		}
+		for addr, n := range counts {
+			if n != 1 {
+				t.Fatalf("broadcastSubset with k = %v contacted %v %v times", k, addr, n)
+			}
+		}
+	}
+}
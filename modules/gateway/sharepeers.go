@@ -0,0 +1,152 @@
+package gateway
+
+import (
+	"net"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// rpcSharePeers is the receiving end of the SharePeers RPC. It writes up to
+// maxSharedPeers randomly selected addresses of connected peers to the
+// caller. Unlike the node list, every shared address belonged to a live peer
+// at the time of the request.
+func (g *Gateway) rpcSharePeers(conn modules.PeerConn) error {
+	conn.SetDeadline(time.Now().Add(connStdDeadline))
+
+	var addrs []modules.NetAddress
+	func() {
+		g.mu.RLock()
+		defer g.mu.RUnlock()
+
+		gpeers := make([]modules.NetAddress, 0, len(g.peers))
+		for addr := range g.peers {
+			gpeers = append(gpeers, addr)
+		}
+		perm, err := crypto.Perm(len(gpeers))
+		if err != nil {
+			g.log.Severe("Unable to get random permutation for sharing peers")
+		}
+
+		// Apply the same locality rules as the ShareNodes RPC, and don't tell
+		// the caller about itself.
+		remoteNA := modules.NetAddress(conn.RemoteAddr().String())
+		for _, i := range perm {
+			addr := gpeers[i]
+			if addr == conn.RPCAddr() {
+				continue
+			}
+			if addr.IsLoopback() && !remoteNA.IsLoopback() {
+				continue
+			}
+			if addr.IsLocal() && !remoteNA.IsLocal() {
+				continue
+			}
+
+			addrs = append(addrs, addr)
+			if uint64(len(addrs)) == maxSharedPeers {
+				break
+			}
+		}
+	}()
+	return encoding.WriteObject(conn, addrs)
+}
+
+// managedRequestPeers calls the SharePeers RPC on a peer and returns the
+// addresses that are worth connecting to. Our own address, banned addresses,
+// invalid addresses, and addresses that are already peers are discarded.
+func (g *Gateway) managedRequestPeers(addr modules.NetAddress) ([]modules.NetAddress, error) {
+	var shared []modules.NetAddress
+	err := g.managedRPC(addr, "SharePeers", func(conn modules.PeerConn) error {
+		conn.SetDeadline(time.Now().Add(connStdDeadline))
+		return encoding.ReadObject(conn, &shared, maxSharedPeers*modules.MaxEncodedNetAddressLength)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var addrs []modules.NetAddress
+	for _, sa := range shared {
+		if sa == g.myAddr || g.isBanned(sa) {
+			continue
+		} else if _, exists := g.peers[sa]; exists {
+			continue
+		} else if sa.IsStdValid() != nil || net.ParseIP(sa.Host()) == nil {
+			g.log.Printf("WARN: peer '%v' shared the invalid addr '%v'", addr, sa)
+			continue
+		}
+		addrs = append(addrs, sa)
+	}
+	return addrs, nil
+}
+
+// managedBootstrapPeers asks each connected peer for its peers, adds the
+// addresses to the node list, and connects to them until the gateway has
+// maxOutboundPeers outbound peers.
+func (g *Gateway) managedBootstrapPeers() {
+	g.mu.RLock()
+	peers := make([]modules.NetAddress, 0, len(g.peers))
+	for addr := range g.peers {
+		peers = append(peers, addr)
+	}
+	g.mu.RUnlock()
+
+	for _, peer := range peers {
+		g.mu.RLock()
+		full := g.peerCount(false) >= g.maxOutboundPeers
+		g.mu.RUnlock()
+		if full {
+			return
+		}
+
+		addrs, err := g.managedRequestPeers(peer)
+		if err != nil {
+			g.log.Debugf("WARN: RPC SharePeers failed on peer %q: %v", peer, err)
+			continue
+		}
+		if len(addrs) == 0 {
+			continue
+		}
+		g.mu.Lock()
+		for _, addr := range addrs {
+			if err := g.addNode(addr); err != nil && err != errNodeExists {
+				g.log.Printf("WARN: failed to add shared peer '%v' to the node list: %v", addr, err)
+			}
+		}
+		if err := g.save(); err != nil {
+			g.log.Println("WARN: failed to save nodelist after requesting peers:", err)
+		}
+		g.mu.Unlock()
+
+		for _, addr := range addrs {
+			err := g.managedConnect(addr)
+			if err == ErrPeerLimitReached {
+				return
+			} else if err != nil && err != errPeerExists {
+				g.log.Debugf("WARN: could not connect to shared peer %v: %v", addr, err)
+			}
+		}
+	}
+}
+
+// permanentPeerBootstrapper periodically discovers new peers through the
+// SharePeers RPC, so that a gateway whose saved node list has gone stale can
+// still find its way back onto the network. The first round runs shortly
+// after startup, once the peer manager has had a chance to connect to some
+// of the saved nodes.
+func (g *Gateway) permanentPeerBootstrapper(closeChan chan struct{}) {
+	defer close(closeChan)
+
+	delay := acquiringPeersDelay
+	for {
+		if !g.managedSleep(delay) {
+			return
+		}
+		delay = peerBootstrapInterval
+		g.managedBootstrapPeers()
+	}
+}
@@ -0,0 +1,123 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestSharePeers checks that a gateway learns about the peers of the gateways
+// it is connected to, and connects to them.
+func TestSharePeers(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	g1 := newTestingGateway("TestSharePeers1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestSharePeers2", t)
+	defer g2.Close()
+	g3 := newTestingGateway("TestSharePeers3", t)
+	defer g3.Close()
+
+	// g1 and g3 are both connected to g2, but not to each other.
+	if err := g1.Connect(g2.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g3.Connect(g2.Address()); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 50 && len(g2.Peers()) != 2; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(g2.Peers()) != 2 {
+		t.Fatal("g2 did not accept both peers:", g2.Peers())
+	}
+
+	// g2 should share g3, but not g1 itself.
+	addrs, err := g1.managedRequestPeers(g2.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0] != g3.Address() {
+		t.Fatal("expected g2 to share only g3, got", addrs)
+	}
+
+	// Bootstrapping should add g3 to the node list and connect to it.
+	g1.managedBootstrapPeers()
+	g1.mu.RLock()
+	_, isNode := g1.nodes[g3.Address()]
+	_, isPeer := g1.peers[g3.Address()]
+	g1.mu.RUnlock()
+	if !isNode {
+		t.Fatal("shared peer was not added to the node list")
+	}
+	if !isPeer {
+		t.Fatal("gateway did not connect to the shared peer")
+	}
+
+	// Peers that are already connected are not returned.
+	addrs, err = g1.managedRequestPeers(g2.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 0 {
+		t.Fatal("expected no new peers, got", addrs)
+	}
+
+	// Banned peers are not returned either.
+	if err := g1.Ban(g3.Address(), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	addrs, err = g1.managedRequestPeers(g2.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 0 {
+		t.Fatal("banned peer was returned:", addrs)
+	}
+}
+
+// TestSharePeersValidation checks that addresses shared by a misbehaving peer
+// are validated before they are used.
+func TestSharePeersValidation(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	g1 := newTestingGateway("TestSharePeersValidation1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestSharePeersValidation2", t)
+	defer g2.Close()
+
+	if err := g1.Connect(g2.Address()); err != nil {
+		t.Fatal(err)
+	}
+	banned := modules.NetAddress("111.111.111.111:1")
+	if err := g1.Ban(banned, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace g2's handler with one that shares garbage along with a single
+	// good address.
+	good := modules.NetAddress("111.111.111.111:2")
+	g2.UnregisterRPC("SharePeers")
+	g2.RegisterRPC("SharePeers", func(conn modules.PeerConn) error {
+		return encoding.WriteObject(conn, []modules.NetAddress{
+			g1.Address(),
+			g2.Address(),
+			banned,
+			"foo.com:123",
+			good,
+		})
+	})
+
+	addrs, err := g1.managedRequestPeers(g2.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0] != good {
+		t.Fatal("expected only the good address, got", addrs)
+	}
+}
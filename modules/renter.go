@@ -15,6 +15,13 @@ const (
 	RenterDir = "renter"
 )
 
+// The statuses that a download in the download queue can have.
+const (
+	DownloadStatusActive    = "active"
+	DownloadStatusCompleted = "completed"
+	DownloadStatusErrored   = "errored"
+)
+
 // An ErasureCoder is an error-correcting encoder and decoder.
 type ErasureCoder interface {
 	// NumPieces is the number of pieces returned by Encode.
@@ -43,9 +50,19 @@ type FileUploadParams struct {
 	Source      string
 	SiaPath     string
 	ErasureCode ErasureCoder
+
+	// IdempotencyKey optionally identifies the upload. If an upload with the
+	// same key was already processed, its original result is returned and
+	// the upload is not queued again.
+	IdempotencyKey string
+
+	// Hosts optionally restricts the file's pieces to the contracts with
+	// the specified hosts.
+	Hosts []types.SiaPublicKey
 }
 
-// FileInfo provides information about a file.
+// FileInfo provides information about a file. UploadError is empty unless
+// repeated attempts to repair the file to its target redundancy have failed.
 type FileInfo struct {
 	SiaPath        string            `json:"siapath"`
 	Filesize       uint64            `json:"filesize"`
@@ -53,17 +70,38 @@ type FileInfo struct {
 	Renewing       bool              `json:"renewing"`
 	Redundancy     float64           `json:"redundancy"`
 	UploadProgress float64           `json:"uploadprogress"`
+	UploadError    string            `json:"uploaderror"`
 	Expiration     types.BlockHeight `json:"expiration"`
+	DataPieces     int               `json:"datapieces"`
+	ParityPieces   int               `json:"paritypieces"`
+
+	// Contracts are the file contracts that store at least one piece of the
+	// file. Renewed contracts are listed by the ID of their renewal.
+	Contracts []types.FileContractID `json:"contracts"`
+}
+
+// FileRecoverability reports whether a file can currently be reconstructed
+// from the renter's live contracts. If it cannot, MissingHosts is the minimum
+// number of additional healthy hosts needed to recover it.
+type FileRecoverability struct {
+	SiaPath      string `json:"siapath"`
+	Recoverable  bool   `json:"recoverable"`
+	MissingHosts int    `json:"missinghosts"`
 }
 
 // DownloadInfo provides information about a file that has been requested for
-// download.
+// download. For downloads of a section of a file, Filesize is the length of
+// the section and Offset is where the section begins. Status is one of the
+// DownloadStatus constants, and Error is set when the download has errored.
 type DownloadInfo struct {
 	SiaPath     string    `json:"siapath"`
 	Destination string    `json:"destination"`
 	Filesize    uint64    `json:"filesize"`
+	Offset      uint64    `json:"offset"`
 	Received    uint64    `json:"received"`
 	StartTime   time.Time `json:"starttime"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error"`
 }
 
 // An Allowance dictates how much the Renter is allowed to spend in a given
@@ -73,11 +111,99 @@ type Allowance struct {
 	Hosts       uint64            `json:"hosts"`
 	Period      types.BlockHeight `json:"period"`
 	RenewWindow types.BlockHeight `json:"renewwindow"`
+
+	// MaxContractPrice is the highest storage price (per byte per block)
+	// that the renter will accept when forming contracts. If it is zero, the
+	// contractor's default is used.
+	MaxContractPrice types.Currency `json:"maxcontractprice"`
+}
+
+// RenterPriceEstimation summarizes the prices of the hosts that the renter
+// would form contracts with. StorageTerabyteCost is the estimated allowance
+// needed to form Hosts contracts that can each store 1 TB for Period blocks,
+// including contract and transaction fees.
+type RenterPriceEstimation struct {
+	AverageContractPrice types.Currency `json:"averagecontractprice"`
+	MedianContractPrice  types.Currency `json:"mediancontractprice"`
+	AverageStoragePrice  types.Currency `json:"averagestorageprice"`
+	MedianStoragePrice   types.Currency `json:"medianstorageprice"`
+
+	Hosts               uint64            `json:"hosts"`
+	Period              types.BlockHeight `json:"period"`
+	StorageTerabyteCost types.Currency    `json:"storageterabytecost"`
+}
+
+// A ContractEstimate is the estimated cost of forming a contract with a host,
+// including the transaction fee.
+type ContractEstimate struct {
+	NetAddress NetAddress     `json:"netaddress"`
+	Cost       types.Currency `json:"cost"`
+}
+
+// RenterContractEstimate describes the contracts that the renter would form
+// with an allowance, without forming them. Filesize is the amount of storage
+// allocated in each contract.
+type RenterContractEstimate struct {
+	AverageContractPrice types.Currency `json:"averagecontractprice"`
+	AverageStoragePrice  types.Currency `json:"averagestorageprice"`
+
+	Contracts []ContractEstimate `json:"contracts"`
+	EndHeight types.BlockHeight  `json:"endheight"`
+	Filesize  uint64             `json:"filesize"`
+	TotalCost types.Currency     `json:"totalcost"`
+}
+
+// NegotiationMetrics records how long each phase of forming a contract took.
+// FundAndSign covers the time spent funding and signing the contract
+// transaction, and Exchange covers the time spent exchanging the transaction
+// and signatures with the host. The durations are measured with the wall
+// clock, so they are distorted if the system clock is adjusted during a
+// negotiation.
+type NegotiationMetrics struct {
+	ContractID types.FileContractID `json:"id"`
+	NetAddress NetAddress           `json:"netaddress"`
+
+	Dial           time.Duration `json:"dial"`
+	VerifySettings time.Duration `json:"verifysettings"`
+	FundAndSign    time.Duration `json:"fundandsign"`
+	Exchange       time.Duration `json:"exchange"`
+	Submit         time.Duration `json:"submit"`
+}
+
+// A HostFailure describes the most recent failed attempt to form a contract
+// with a host.
+type HostFailure struct {
+	NetAddress NetAddress `json:"netaddress"`
+	Error      string     `json:"error"`
+	Time       time.Time  `json:"time"`
 }
 
 // RenterSettings control the behavior of the Renter.
 type RenterSettings struct {
 	Allowance Allowance `json:"allowance"`
+
+	// MaxHosts is the largest number of hosts that an allowance may request
+	// contracts with. It must be at least 1.
+	MaxHosts uint64 `json:"maxhosts"`
+
+	// FundingMargin is the fraction of the allowance that is held back when
+	// deciding how much data each contract can store, leaving headroom for
+	// transaction fees and price increases. It must be between 0 and 0.5.
+	FundingMargin float64 `json:"fundingmargin"`
+
+	// BandwidthReserve is the fraction of the allowance that is held back
+	// for upload and download costs when the hosts charge for bandwidth. It
+	// must be between 0 and 0.4.
+	BandwidthReserve float64 `json:"bandwidthreserve"`
+
+	// MaxConcurrentUploads is the maximum number of files that the renter
+	// uploads at once. Additional uploads are queued until a slot frees up.
+	// A value of 0 means there is no limit.
+	MaxConcurrentUploads int `json:"maxconcurrentuploads"`
+
+	// DebugLogging makes the renter log each host selection decision made
+	// while forming contracts, in addition to the contracts themselves.
+	DebugLogging bool `json:"debuglogging"`
 }
 
 // A HostDBEntry represents one host entry in the Renter's host DB. It
@@ -90,17 +216,37 @@ type HostDBEntry struct {
 	ScanHistory HostDBScans
 	// FirstSeen is the last block height at which this host was announced.
 	FirstSeen types.BlockHeight
+	// SettingsEpoch is incremented each time the host announces itself again.
+	// Settings read before the most recent announcement may be out of date.
+	SettingsEpoch uint64
 }
 
-// HostDBScan represents a single scan event.
+// HostDBScan represents a single scan event. Latency is the time it took for
+// the host to respond with its settings, and is zero for failed scans.
 type HostDBScan struct {
 	Timestamp time.Time
 	Success   bool
+	Latency   time.Duration
 }
 
 // HostDBScans represents a sortable slice of scans.
 type HostDBScans []HostDBScan
 
+// Uptime returns the percentage of the scans that succeeded. A host that has
+// not been scanned has an uptime of 0.
+func (s HostDBScans) Uptime() float64 {
+	if len(s) == 0 {
+		return 0
+	}
+	var successes int
+	for _, scan := range s {
+		if scan.Success {
+			successes++
+		}
+	}
+	return 100 * float64(successes) / float64(len(s))
+}
+
 func (s HostDBScans) Len() int           { return len(s) }
 func (s HostDBScans) Less(i, j int) bool { return s[i].Timestamp.Before(s[j].Timestamp) }
 func (s HostDBScans) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -109,6 +255,7 @@ func (s HostDBScans) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 // file contract.
 type RenterContract struct {
 	FileContract    types.FileContract         `json:"filecontract"`
+	HostPublicKey   types.SiaPublicKey         `json:"hostpublickey"`
 	ID              types.FileContractID       `json:"id"`
 	LastRevision    types.FileContractRevision `json:"lastrevision"`
 	LastRevisionTxn types.Transaction          `json:"lastrevisiontxn"`
@@ -117,6 +264,11 @@ type RenterContract struct {
 	SecretKey       crypto.SecretKey           `json:"secretkey"`
 	StartHeight     types.BlockHeight          `json:"startheight"`
 
+	// Capacity is the number of bytes of storage that the renter paid for
+	// when the contract was formed or renewed. It is zero for contracts
+	// formed before it was recorded.
+	Capacity uint64 `json:"capacity"`
+
 	DownloadSpending types.Currency `json:"downloadspending"`
 	StorageSpending  types.Currency `json:"storagespending"`
 	UploadSpending   types.Currency `json:"uploadspending"`
@@ -153,28 +305,96 @@ type Renter interface {
 	// AllHosts returns the full list of hosts known to the renter.
 	AllHosts() []HostDBEntry
 
+	// HostWeight returns the weight that the renter assigns to a host when
+	// selecting hosts, if the host has been weighted. Hosts with a higher
+	// weight are preferred.
+	HostWeight(types.SiaPublicKey) (types.Currency, bool)
+
+	// CancelContract removes the specified contract from the renter's
+	// current contract set. The contract will not be renewed.
+	CancelContract(types.FileContractID) error
+
+	// PriceEstimation estimates the cost of forming contracts with the
+	// current set of hosts, using the current allowance.
+	PriceEstimation() (RenterPriceEstimation, error)
+
+	// EstimateContracts estimates the contracts that would be formed if the
+	// allowance were set to a, without forming them.
+	EstimateContracts(a Allowance) (RenterContractEstimate, error)
+
+	// ValidateAllowance checks whether the allowance a could be set, without
+	// setting it or forming any contracts.
+	ValidateAllowance(a Allowance) error
+
+	// RecentFailures returns the most recent failed attempts to form a
+	// contract with each host, newest first.
+	RecentFailures() []HostFailure
+
+	// NegotiationMetrics returns the durations of the negotiation phases of
+	// each current contract that was formed since the renter started.
+	NegotiationMetrics() []NegotiationMetrics
+
+	// Backup writes an encrypted backup of the renter's files and contracts
+	// to w. The backup contains the contracts' secret keys.
+	Backup(w io.Writer, key crypto.TwofishKey) error
+
+	// CancelUpload stops the upload of a file and removes the partially
+	// uploaded file from the renter.
+	CancelUpload(path string) error
+
 	// Close closes the Renter.
 	Close() error
 
-	// Contracts returns the contracts formed by the renter.
+	// Contracts returns the contracts formed by the renter in the current
+	// period whose hosts are online.
 	Contracts() []RenterContract
 
 	// CurrentPeriod returns the height at which the current allowance period
 	// began.
 	CurrentPeriod() types.BlockHeight
 
+	// ExpiringContracts returns the contracts whose proof window starts
+	// within the specified number of blocks, soonest first.
+	ExpiringContracts(within types.BlockHeight) []RenterContract
+
 	// DeleteFile deletes a file entry from the renter.
 	DeleteFile(path string) error
 
+	// DeleteFolder deletes every file entry beneath the folder prefix from
+	// the renter, returning the number of entries deleted.
+	DeleteFolder(prefix string) (int, error)
+
 	// Download downloads a file to the given destination.
 	Download(path, destination string) error
 
+	// DownloadSection downloads length bytes of a file, starting at offset,
+	// to the given destination. A length of zero downloads the remainder of
+	// the file.
+	DownloadSection(path, destination string, offset, length uint64) error
+
+	// DownloadStream downloads length bytes of a file, starting at offset,
+	// and writes them to w in order. A length of zero downloads the remainder
+	// of the file.
+	DownloadStream(path string, w io.Writer, offset, length uint64) error
+
+	// ClearDownloads removes the downloads that have completed or errored
+	// from the download queue, returning the number of downloads removed.
+	ClearDownloads() int
+
 	// DownloadQueue lists all the files that have been scheduled for download.
 	DownloadQueue() []DownloadInfo
 
+	// File returns information on the file stored by the renter at the given
+	// path.
+	File(siaPath string) (FileInfo, error)
+
 	// FileList returns information on all of the files stored by the renter.
 	FileList() []FileInfo
 
+	// Recoverable reports, for each file, whether the renter has enough
+	// healthy contracts to reconstruct it.
+	Recoverable() []FileRecoverability
+
 	// LoadSharedFiles loads a '.sia' file into the renter. A .sia file may
 	// contain multiple files. The paths of the added files are returned.
 	LoadSharedFiles(source string) ([]string, error)
@@ -186,6 +406,26 @@ type Renter interface {
 	// RenameFile changes the path of a file.
 	RenameFile(path, newPath string) error
 
+	// ReservedFunds returns the amount of the allowance that is held back
+	// as a safety margin when deciding how much data each contract can
+	// store.
+	ReservedFunds() types.Currency
+
+	// BandwidthReserve returns the amount of the allowance that was held
+	// back for upload and download costs when deciding how much data the
+	// current contracts can store.
+	BandwidthReserve() types.Currency
+
+	// Restore reads an encrypted backup created by Backup, adding its
+	// contracts and files to the renter. The paths of the restored files
+	// are returned.
+	Restore(r io.Reader, key crypto.TwofishKey) ([]string, error)
+
+	// Repair queues the file at siaPath, or every file if siaPath is empty,
+	// for an immediate repair, and returns the number of files that needed
+	// repair.
+	Repair(siaPath string) (int, error)
+
 	// Settings returns the Renter's current settings.
 	Settings() RenterSettings
 
@@ -200,4 +440,13 @@ type Renter interface {
 
 	// Upload uploads a file using the input parameters.
 	Upload(FileUploadParams) error
+
+	// UploadQueueDepth returns the number of uploads that are waiting for a
+	// slot because the renter is already uploading MaxConcurrentUploads
+	// files.
+	UploadQueueDepth() int
+
+	// WillRenew reports whether the renter intends to renew the specified
+	// contract when it nears its end height.
+	WillRenew(types.FileContractID) bool
 }
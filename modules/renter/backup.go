@@ -0,0 +1,161 @@
+package renter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// A backup starts with an unencrypted header and a random nonce. The rest of
+// the backup is encrypted with a key derived from the nonce and the key
+// supplied by the caller, and contains the header again (so that a wrong key
+// is detected), the renter's contracts, the repair path of each file, and
+// the files themselves in the .sia format.
+
+var (
+	// ErrBadBackup is returned when restoring data that is not a renter
+	// backup, or whose contents are inconsistent.
+	ErrBadBackup = errors.New("not a renter backup")
+
+	// ErrBackupKey is returned when restoring a backup with a key other than
+	// the one it was encrypted with.
+	ErrBackupKey = errors.New("backup was encrypted with a different key")
+
+	backupHeader  = [17]byte{'S', 'i', 'a', ' ', 'R', 'e', 'n', 't', 'e', 'r', ' ', 'B', 'a', 'c', 'k', 'u', 'p'}
+	backupVersion = "1.0"
+)
+
+// backupKey returns the key that encrypts a backup with the given nonce.
+// Each backup uses a fresh nonce, so the key stream is never reused.
+func backupKey(key crypto.TwofishKey, nonce [crypto.EntropySize]byte) crypto.TwofishKey {
+	return crypto.TwofishKey(crypto.HashAll(key, nonce))
+}
+
+// Backup writes an encrypted backup of the renter's files, their erasure
+// coding parameters, and the contracts storing them to w. The backup is
+// encoded in memory first, so that no locks are held while writing to w.
+func (r *Renter) Backup(w io.Writer, key crypto.TwofishKey) error {
+	var contracts, files bytes.Buffer
+	if err := r.hostContractor.BackupContracts(&contracts); err != nil {
+		return err
+	}
+	if err := r.managedBackupFiles(&files); err != nil {
+		return err
+	}
+
+	var nonce [crypto.EntropySize]byte
+	entropy, err := crypto.RandBytes(len(nonce))
+	if err != nil {
+		return err
+	}
+	copy(nonce[:], entropy)
+	err = encoding.NewEncoder(w).EncodeAll(backupHeader, backupVersion, nonce)
+	if err != nil {
+		return err
+	}
+
+	cw := backupKey(key, nonce).NewWriter(w)
+	if err := encoding.NewEncoder(cw).Encode(backupHeader); err != nil {
+		return err
+	}
+	if _, err := contracts.WriteTo(cw); err != nil {
+		return err
+	}
+	_, err = files.WriteTo(cw)
+	return err
+}
+
+// managedBackupFiles writes the repair path of each file, followed by the
+// files themselves in the .sia format, to w.
+func (r *Renter) managedBackupFiles(w io.Writer) error {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	names := make([]string, 0, len(r.files))
+	for name := range r.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	files := make([]*file, len(names))
+	repairPaths := make([]string, len(names))
+	for i, name := range names {
+		files[i] = r.files[name]
+		repairPaths[i] = r.tracking[name].RepairPath
+		files[i].mu.RLock()
+		defer files[i].mu.RUnlock()
+	}
+	if err := encoding.NewEncoder(w).Encode(repairPaths); err != nil {
+		return err
+	}
+	return shareFiles(files, w)
+}
+
+// Restore reads a backup written by Backup from reader, adding its contracts
+// and files to the renter. Contracts that the renter already has are
+// skipped, and files whose names conflict with existing files are renamed.
+// It returns the paths of the restored files.
+func (r *Renter) Restore(reader io.Reader, key crypto.TwofishKey) ([]string, error) {
+	var header [17]byte
+	var version string
+	var nonce [crypto.EntropySize]byte
+	err := encoding.NewDecoder(reader).DecodeAll(&header, &version, &nonce)
+	if err != nil {
+		return nil, err
+	} else if header != backupHeader {
+		return nil, ErrBadBackup
+	} else if version != backupVersion {
+		return nil, ErrIncompatible
+	}
+
+	cr := backupKey(key, nonce).NewReader(reader)
+	dec := encoding.NewDecoder(cr)
+	if err := dec.Decode(&header); err != nil {
+		return nil, err
+	} else if header != backupHeader {
+		return nil, ErrBackupKey
+	}
+	// The contracts precede the files in the backup, but are only restored
+	// once the files have been decoded, so that a corrupt backup is not
+	// partially restored. Keep a copy of the encoded contracts until then.
+	var contracts []modules.RenterContract
+	var renewed [][2]types.FileContractID
+	var encodedContracts bytes.Buffer
+	err = encoding.NewDecoder(io.TeeReader(cr, &encodedContracts)).DecodeAll(&contracts, &renewed)
+	if err != nil {
+		return nil, err
+	}
+	var repairPaths []string
+	if err := dec.Decode(&repairPaths); err != nil {
+		return nil, err
+	}
+
+	lockID := r.mu.Lock()
+	names, err := r.loadSharedFiles(cr)
+	if err != nil {
+		r.mu.Unlock(lockID)
+		return nil, err
+	} else if len(names) != len(repairPaths) {
+		r.mu.Unlock(lockID)
+		return nil, ErrBadBackup
+	}
+	for i, name := range names {
+		if repairPaths[i] != "" {
+			r.tracking[name] = trackedFile{RepairPath: repairPaths[i]}
+		}
+	}
+	err = r.saveSync()
+	r.mu.Unlock(lockID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.hostContractor.RestoreContracts(&encodedContracts); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
@@ -0,0 +1,58 @@
+package contractor
+
+import (
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// managedNegotiationAddress returns the refund address to use when
+// negotiating a contract. If a previous negotiation failed, its address is
+// reused, so that repeated failures do not each consume a new address from
+// the wallet. The cached address is taken exclusively: it is cleared until the
+// negotiation using it gives it back with managedReturnAddress, so concurrent
+// negotiations never share a refund address.
+func (c *Contractor) managedNegotiationAddress() (types.UnlockHash, error) {
+	c.mu.Lock()
+	if c.cachedAddress != (types.UnlockHash{}) {
+		c.cachedReuses++
+		addr := c.cachedAddress
+		c.cachedAddress = types.UnlockHash{}
+		c.mu.Unlock()
+		return addr, nil
+	}
+	c.mu.Unlock()
+
+	uc, err := c.wallet.NextAddress()
+	if err != nil {
+		return types.UnlockHash{}, err
+	}
+	return uc.UnlockHash(), nil
+}
+
+// managedReturnAddress gives back the address of a failed negotiation, so that
+// the next negotiation reuses it. If another failed negotiation has already
+// given back its address, addr is dropped.
+func (c *Contractor) managedReturnAddress(addr types.UnlockHash) {
+	c.mu.Lock()
+	if c.cachedAddress == (types.UnlockHash{}) {
+		c.cachedAddress = addr
+	}
+	c.mu.Unlock()
+}
+
+// managedResetAddressReuses resets the reuse count of the negotiation address.
+// It is called after a negotiation succeeds, since its address now belongs to
+// a contract and will not be given back.
+func (c *Contractor) managedResetAddressReuses() {
+	c.mu.Lock()
+	c.cachedReuses = 0
+	c.mu.Unlock()
+}
+
+// CachedAddress reports whether the contractor is holding a negotiation
+// address left over from a failed negotiation, and how many negotiations have
+// reused it. It is intended for debugging.
+func (c *Contractor) CachedAddress() (held bool, reuses int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cachedAddress != (types.UnlockHash{}), c.cachedReuses
+}
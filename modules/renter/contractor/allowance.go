@@ -10,15 +10,27 @@ import (
 )
 
 var (
-	errAllowanceNoHosts    = errors.New("hosts must be non-zero")
 	errAllowanceZeroPeriod = errors.New("period must be non-zero")
 	errAllowanceWindowSize = errors.New("renew window must be less than period")
 	errAllowanceNotSynced  = errors.New("you must be synced to set an allowance")
+	errAllowanceMaxPrice   = errors.New("max contract price is below the minimum storage price")
 
 	// ErrAllowanceZeroWindow is returned when the caller requests a
 	// zero-length renewal window. This will happen if the caller sets the
 	// period to 1 block, since RenewWindow := period / 2.
 	ErrAllowanceZeroWindow = errors.New("renew window must be non-zero")
+
+	// ErrTooFewHosts is returned when an allowance requests contracts with
+	// no hosts.
+	ErrTooFewHosts = errors.New("hosts must be at least 1")
+
+	// ErrTooManyHosts is returned when an allowance requests contracts with
+	// more hosts than the contractor's maximum.
+	ErrTooManyHosts = errors.New("hosts exceeds the maximum number of hosts")
+
+	// ErrUnknownContract is returned when the caller refers to a contract
+	// that is not in the contractor's current contract set.
+	ErrUnknownContract = errors.New("no record of that contract")
 )
 
 // contractEndHeight returns the height at which the Contractor's contracts
@@ -32,6 +44,107 @@ func (c *Contractor) contractEndHeight() types.BlockHeight {
 	return endHeight
 }
 
+// checkAllowance checks that the allowance parameters are valid, and that it
+// requests at most maxHosts hosts. A maxHosts of zero does not limit the
+// number of hosts. It does not check that the allowance can afford any
+// contracts.
+func checkAllowance(a modules.Allowance, maxHosts uint64) error {
+	if a.Hosts == 0 {
+		return ErrTooFewHosts
+	} else if maxHosts != 0 && a.Hosts > maxHosts {
+		return ErrTooManyHosts
+	} else if a.Period == 0 {
+		return errAllowanceZeroPeriod
+	} else if a.RenewWindow == 0 {
+		return ErrAllowanceZeroWindow
+	} else if a.RenewWindow >= a.Period {
+		return errAllowanceWindowSize
+	} else if !a.MaxContractPrice.IsZero() && a.MaxContractPrice.Cmp(minStoragePrice) < 0 {
+		return errAllowanceMaxPrice
+	}
+	return nil
+}
+
+// allowanceSectors returns the number of sectors to allocate in each contract,
+// given the maximum number of sectors the allowance can support.
+func allowanceSectors(max uint64) (uint64, error) {
+	// Only allocate half as many sectors as the max. This leaves some leeway
+	// for replacing contracts, transaction fees, etc.
+	numSectors := max / 2
+	// check that this is sufficient to store at least one sector
+	if numSectors == 0 {
+		return 0, ErrInsufficientAllowance
+	}
+	return numSectors, nil
+}
+
+// isCancelAllowance reports whether a is the empty allowance, which cancels
+// the current allowance.
+func isCancelAllowance(a modules.Allowance) bool {
+	return a.Funds.IsZero() && a.Hosts == 0 && a.Period == 0 && a.RenewWindow == 0
+}
+
+// managedAllowanceSectors validates the allowance a and returns the number of
+// sectors to allocate in each of its contracts, along with the funds held back
+// for bandwidth.
+func (c *Contractor) managedAllowanceSectors(a modules.Allowance) (uint64, types.Currency, error) {
+	// sanity checks
+	c.mu.RLock()
+	maxHosts := c.maxHosts
+	c.mu.RUnlock()
+	if err := checkAllowance(a, maxHosts); err != nil {
+		return 0, types.Currency{}, err
+	} else if !c.cs.Synced() {
+		return 0, types.Currency{}, errAllowanceNotSynced
+	}
+
+	// calculate the maximum sectors this allowance can store
+	c.mu.RLock()
+	margin, bandwidth := c.fundingMargin, c.bandwidthShare
+	c.mu.RUnlock()
+	max, bandwidth, err := maxSectors(a, margin, bandwidth, c.hdb, c.tpool)
+	if err != nil {
+		return 0, types.Currency{}, err
+	}
+	numSectors, err := allowanceSectors(max)
+	if err != nil {
+		return 0, types.Currency{}, err
+	}
+	return numSectors, a.Funds.MulFloat(bandwidth), nil
+}
+
+// SetMaxHosts sets the maximum number of hosts that an allowance may request
+// contracts with. Allowances requesting more hosts are rejected with
+// ErrTooManyHosts. n must be at least 1. The maximum is persisted.
+func (c *Contractor) SetMaxHosts(n uint64) error {
+	if n == 0 {
+		return errBadMaxHosts
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxHosts = n
+	return c.saveSync()
+}
+
+// MaxHosts returns the maximum number of hosts that an allowance may request
+// contracts with.
+func (c *Contractor) MaxHosts() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.maxHosts
+}
+
+// ValidateAllowance performs the same checks as SetAllowance, returning the
+// error that SetAllowance would return if a cannot be used. Unlike
+// SetAllowance, it does not set the allowance or form any contracts.
+func (c *Contractor) ValidateAllowance(a modules.Allowance) error {
+	if isCancelAllowance(a) {
+		return nil
+	}
+	_, _, err := c.managedAllowanceSectors(a)
+	return err
+}
+
 // SetAllowance sets the amount of money the Contractor is allowed to spend on
 // contracts over a given time period, divided among the number of hosts
 // specified. Note that Contractor can start forming contracts as soon as
@@ -53,35 +166,14 @@ func (c *Contractor) contractEndHeight() types.BlockHeight {
 // NOTE: At this time, transaction fees are not counted towards the allowance.
 // This means the contractor may spend more than allowance.Funds.
 func (c *Contractor) SetAllowance(a modules.Allowance) error {
-	if a.Funds.IsZero() && a.Hosts == 0 && a.Period == 0 && a.RenewWindow == 0 {
+	if isCancelAllowance(a) {
 		return c.managedCancelAllowance(a)
 	}
 
-	// sanity checks
-	if a.Hosts == 0 {
-		return errAllowanceNoHosts
-	} else if a.Period == 0 {
-		return errAllowanceZeroPeriod
-	} else if a.RenewWindow == 0 {
-		return ErrAllowanceZeroWindow
-	} else if a.RenewWindow >= a.Period {
-		return errAllowanceWindowSize
-	} else if !c.cs.Synced() {
-		return errAllowanceNotSynced
-	}
-
-	// calculate the maximum sectors this allowance can store
-	max, err := maxSectors(a, c.hdb, c.tpool)
+	numSectors, reserved, err := c.managedAllowanceSectors(a)
 	if err != nil {
 		return err
 	}
-	// Only allocate half as many sectors as the max. This leaves some leeway
-	// for replacing contracts, transaction fees, etc.
-	numSectors := max / 2
-	// check that this is sufficient to store at least one sector
-	if numSectors == 0 {
-		return ErrInsufficientAllowance
-	}
 
 	c.mu.RLock()
 	shouldRenew := a.Period != c.allowance.Period || !a.Funds.Equals(c.allowance.Funds)
@@ -91,7 +183,7 @@ func (c *Contractor) SetAllowance(a modules.Allowance) error {
 
 	if !shouldRenew {
 		// If no contracts need renewing, just form new contracts.
-		return c.managedFormAllowanceContracts(remaining, numSectors, a)
+		return c.managedFormAllowanceContracts(remaining, numSectors, reserved, a)
 	} else if shouldWait {
 		// If the new period would result in an earlier endHeight, we can't
 		// renew; instead, set the allowance without modifying any contracts.
@@ -120,13 +212,17 @@ func (c *Contractor) SetAllowance(a modules.Allowance) error {
 	}
 	c.mu.RUnlock()
 
-	// renew existing contracts with new allowance parameters
+	// Renew existing contracts with new allowance parameters. The new
+	// contract set is built separately, and only replaces the current set
+	// once every negotiation has finished.
 	newContracts := make(map[types.FileContractID]modules.RenterContract)
+	var unrenewed []modules.RenterContract
 	for _, contract := range renewSet {
-		newContract, err := c.managedRenew(contract, numSectors, endHeight)
+		newContract, err := c.managedRenew(contract, numSectors, endHeight, a.MaxContractPrice)
 		if err != nil {
 			c.log.Printf("WARN: failed to renew contract with %v; a new contract will be formed in its place", contract.NetAddress)
 			remaining++
+			unrenewed = append(unrenewed, contract)
 			continue
 		}
 		newContracts[newContract.ID] = newContract
@@ -140,10 +236,11 @@ func (c *Contractor) SetAllowance(a modules.Allowance) error {
 	}
 
 	// if we did not renew enough contracts, form new ones
+	var formed []modules.RenterContract
 	if remaining > 0 {
-		formed, err := c.managedFormContracts(remaining, numSectors, endHeight)
+		formed, err = c.managedFormContracts(remaining, numSectors, endHeight, a.MaxContractPrice)
 		if err != nil {
-			return err
+			c.log.Println("WARN:", err)
 		}
 		for _, contract := range formed {
 			newContracts[contract.ID] = contract
@@ -155,12 +252,23 @@ func (c *Contractor) SetAllowance(a modules.Allowance) error {
 		return errors.New("unable to form or renew any contracts")
 	}
 
+	// Contracts that could not be renewed are kept until a new contract has
+	// been formed in their place.
+	for i := len(formed); i < remaining && len(unrenewed) > 0; i++ {
+		newContracts[unrenewed[0].ID] = unrenewed[0]
+		unrenewed = unrenewed[1:]
+	}
+
 	c.mu.Lock()
 	// update the allowance
 	c.allowance = a
-	// archive the current contract set
+	c.bandwidthHeld = reserved
+	// archive the contracts that are not part of the new set
 	for id, contract := range c.contracts {
-		c.oldContracts[id] = contract
+		if _, ok := newContracts[id]; !ok {
+			c.oldContracts[id] = contract
+			delete(c.metrics, id)
+		}
 	}
 	// replace the current contract set with new contracts
 	c.contracts = newContracts
@@ -168,6 +276,9 @@ func (c *Contractor) SetAllowance(a modules.Allowance) error {
 	if c.currentPeriod == 0 {
 		c.currentPeriod = periodStart
 	}
+	if err := c.validateSpending(); err != nil {
+		c.log.Println("WARN:", err)
+	}
 	err = c.saveSync()
 	c.mu.Unlock()
 
@@ -175,10 +286,17 @@ func (c *Contractor) SetAllowance(a modules.Allowance) error {
 }
 
 // managedFormAllowanceContracts handles the special case where no contracts
-// need to be renewed when setting the allowance.
-func (c *Contractor) managedFormAllowanceContracts(n int, numSectors uint64, a modules.Allowance) error {
+// need to be renewed when setting the allowance. reserved is the amount held
+// back for bandwidth when calculating numSectors.
+func (c *Contractor) managedFormAllowanceContracts(n int, numSectors uint64, reserved types.Currency, a modules.Allowance) error {
 	if n <= 0 {
-		return nil
+		// No contracts need to be formed, but the other allowance parameters
+		// (e.g. the renew window) may have changed.
+		c.mu.Lock()
+		c.allowance = a
+		err := c.saveSync()
+		c.mu.Unlock()
+		return err
 	}
 
 	// if we're forming contracts but not renewing, the new contracts should
@@ -192,17 +310,23 @@ func (c *Contractor) managedFormAllowanceContracts(n int, numSectors uint64, a m
 	c.mu.RUnlock()
 
 	// form the contracts
-	formed, err := c.managedFormContracts(n, numSectors, endHeight)
-	if err != nil {
+	formed, err := c.managedFormContracts(n, numSectors, endHeight, a.MaxContractPrice)
+	if len(formed) == 0 {
 		return err
+	} else if err != nil {
+		c.log.Println("WARN:", err)
 	}
 
 	// Set the allowance and replace the contract set
 	c.mu.Lock()
 	c.allowance = a
+	c.bandwidthHeld = reserved
 	for _, contract := range formed {
 		c.contracts[contract.ID] = contract
 	}
+	if err := c.validateSpending(); err != nil {
+		c.log.Println("WARN:", err)
+	}
 	err = c.saveSync()
 	c.mu.Unlock()
 
@@ -245,12 +369,55 @@ func (c *Contractor) managedCancelAllowance(a modules.Allowance) error {
 	// reset currentPeriod and archive all contracts
 	c.mu.Lock()
 	c.allowance = a
+	c.bandwidthHeld = types.ZeroCurrency
 	c.currentPeriod = 0
 	for id, contract := range c.contracts {
 		c.oldContracts[id] = contract
 	}
 	c.contracts = make(map[types.FileContractID]modules.RenterContract)
+	c.metrics = make(map[types.FileContractID]modules.NegotiationMetrics)
 	err := c.saveSync()
 	c.mu.Unlock()
 	return err
 }
+
+// CancelContract removes a single contract from the current contract set. The
+// contract is archived; it will not be renewed, and it can no longer be used
+// to create Editors or Downloaders.
+func (c *Contractor) CancelContract(id types.FileContractID) error {
+	// prevent new editors or downloaders from being created, then invalidate
+	// any active ones
+	c.mu.Lock()
+	if _, ok := c.contracts[id]; !ok {
+		c.mu.Unlock()
+		return ErrUnknownContract
+	}
+	c.renewing[id] = true
+	e, eok := c.editors[id]
+	d, dok := c.downloaders[id]
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.renewing, id)
+		c.mu.Unlock()
+	}()
+	if eok {
+		e.invalidate()
+	}
+	if dok {
+		d.invalidate()
+	}
+
+	// archive the contract
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	contract, ok := c.contracts[id]
+	if !ok {
+		// the contract was renewed or canceled while we were waiting
+		return ErrUnknownContract
+	}
+	c.oldContracts[id] = contract
+	delete(c.contracts, id)
+	delete(c.metrics, id)
+	return c.saveSync()
+}
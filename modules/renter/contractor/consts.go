@@ -1,6 +1,8 @@
 package contractor
 
 import (
+	"time"
+
 	"github.com/NebulousLabs/Sia/build"
 )
 
@@ -8,9 +10,72 @@ const (
 	// estimatedFileContractTransactionSize provides the estimated size of
 	// the average file contract in bytes.
 	estimatedFileContractTransactionSize = 1200
+
+	// maxFailureRecords is the maximum number of hosts whose contract
+	// formation failures are remembered. When the limit is reached, the
+	// oldest failure is forgotten.
+	maxFailureRecords = 100
+
+	// maxFormationAttempts is the multiple of the initial host sample size
+	// that limits how many hosts managedFormContracts will negotiate with
+	// before giving up.
+	maxFormationAttempts = 3
+
+	// defaultSampleMultiplier is the default multiple of the number of
+	// desired contracts that is sampled from the hostdb when forming
+	// contracts.
+	defaultSampleMultiplier = 2
+
+	// minFormationSampleSize is the minimum number of hosts that are sampled
+	// from the hostdb when forming contracts.
+	minFormationSampleSize = 10
+
+	// defaultEstimationPeriod is the contract duration used for price
+	// estimations when no allowance has been set. It is roughly one month.
+	defaultEstimationPeriod = 4320
+
+	// defaultFundingMargin is the default fraction of the allowance that is
+	// held back when sizing contracts, leaving headroom for transaction fees
+	// and price increases during the period.
+	defaultFundingMargin = 0.05
+
+	// maxFundingMargin is the largest fraction of the allowance that may be
+	// held back when sizing contracts.
+	maxFundingMargin = 0.5
+
+	// defaultBandwidthReserve is the default fraction of the allowance that
+	// is held back for upload and download costs when sizing contracts with
+	// hosts that charge for bandwidth.
+	defaultBandwidthReserve = 0.1
+
+	// defaultMaxHosts is the default maximum number of hosts that an
+	// allowance may request contracts with. Forming contracts with thousands
+	// of hosts would take a very long time.
+	defaultMaxHosts = 50
+
+	// maxBandwidthReserve is the largest fraction of the allowance that may
+	// be held back for bandwidth. Together with maxFundingMargin, it leaves
+	// some of the allowance for storage.
+	maxBandwidthReserve = 0.4
 )
 
 var (
+	// defaultFailureCooldown is how long a host that failed contract
+	// formation is excluded from host selection by default.
+	defaultFailureCooldown = build.Select(build.Var{
+		Standard: time.Hour,
+		Dev:      5 * time.Minute,
+		Testing:  10 * time.Second,
+	}).(time.Duration)
+
+	// failureRecordDuration is how long a contract formation failure is
+	// remembered, unless the failure cooldown is longer.
+	failureRecordDuration = build.Select(build.Var{
+		Standard: 24 * time.Hour,
+		Dev:      time.Hour,
+		Testing:  time.Minute,
+	}).(time.Duration)
+
 	// minHostsForEstimations describes the minimum number of hosts that
 	// are needed to make broad estimations such as the number of sectors
 	// that you can store on the network for a given allowance.
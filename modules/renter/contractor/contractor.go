@@ -2,12 +2,16 @@ package contractor
 
 import (
 	"errors"
+	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/renter/proto"
 	"github.com/NebulousLabs/Sia/persist"
 	siasync "github.com/NebulousLabs/Sia/sync"
 	"github.com/NebulousLabs/Sia/types"
@@ -18,12 +22,43 @@ var (
 	errNilWallet = errors.New("cannot create contractor with nil wallet")
 	errNilTpool  = errors.New("cannot create contractor with nil transaction pool")
 
+	errBadTimeouts = errors.New("negotiation timeouts must be positive")
+
+	errBadCooldown = errors.New("failure cooldown must not be negative")
+
+	errBadSampleMultiplier = errors.New("host sample multiplier must be at least 1")
+
+	errBadMissedProofPolicy = errors.New("unknown missed proof policy")
+
+	errBadLocalAddress = errors.New("local address must be an IP address")
+
+	errBadFundingMargin = errors.New("funding margin must be between 0 and 0.5")
+
+	errBadBandwidthReserve = errors.New("bandwidth reserve must be between 0 and 0.4")
+
+	errBadMaxHosts = errors.New("maximum number of hosts must be at least 1")
+
+	errBadVerbosity = errors.New("unknown log verbosity")
+
 	// COMPATv1.0.4-lts
 	// metricsContractID identifies a special contract that contains aggregate
 	// financial metrics from older contractors
 	metricsContractID = types.FileContractID{'m', 'e', 't', 'r', 'i', 'c', 's'}
 )
 
+// A Verbosity controls how much detail the contractor writes to its log.
+type Verbosity int
+
+const (
+	// VerbosityNormal logs contract formation, renewal, and failures. This
+	// is the default.
+	VerbosityNormal Verbosity = iota
+
+	// VerbosityDebug additionally logs each host selection decision: which
+	// hosts were sampled, which were skipped, and why.
+	VerbosityDebug
+)
+
 // A cachedRevision contains changes that would be applied to a RenterContract
 // if a contract revision succeeded. The contractor must cache these changes
 // as a safeguard against desynchronizing with the host.
@@ -45,17 +80,33 @@ type Contractor struct {
 	wallet  wallet
 
 	allowance       modules.Allowance
+	bandwidthHeld   types.Currency // funds held back for bandwidth when the current contracts were sized
+	bandwidthShare  float64        // fraction of the allowance held back for bandwidth
 	blockHeight     types.BlockHeight
+	cachedAddress   types.UnlockHash // refund address kept from a failed negotiation
+	cachedReuses    int              // number of negotiations that reused cachedAddress
 	cachedRevisions map[types.FileContractID]cachedRevision
 	contracts       map[types.FileContractID]modules.RenterContract
 	currentPeriod   types.BlockHeight
+	dialer          proto.Dialer
 	downloaders     map[types.FileContractID]*hostDownloader
 	editors         map[types.FileContractID]*hostEditor
+	failedHosts     map[modules.NetAddress]modules.HostFailure // hosts that recently failed contract formation
+	failureCooldown time.Duration
+	fundingMargin   float64 // fraction of the allowance held back when sizing contracts
 	lastChange      modules.ConsensusChangeID
+	localAddr       net.Addr                                            // source address for negotiation; nil means any
+	maxHosts        uint64                                              // most hosts an allowance may request
+	maxTxnSetSize   uint64                                              // limit on a host's contract txn additions; zero means the default
+	metrics         map[types.FileContractID]modules.NegotiationMetrics // not persisted; only current contracts
+	missedProofs    proto.MissedProofPolicy
 	oldContracts    map[types.FileContractID]modules.RenterContract
 	renewedIDs      map[types.FileContractID]types.FileContractID
 	renewing        map[types.FileContractID]bool // prevent revising during renewal
 	revising        map[types.FileContractID]bool // prevent overlapping revisions
+	oversampling    int                           // multiple of desired contracts sampled from the hostdb
+	timeouts        proto.NegotiationTimeouts
+	verbosity       Verbosity
 
 	mu sync.RWMutex
 
@@ -108,6 +159,45 @@ func (c *Contractor) AllContracts() (cs []modules.RenterContract) {
 	return
 }
 
+// contractsByEndHeight sorts contracts by the start of their proof window,
+// soonest first.
+type contractsByEndHeight []modules.RenterContract
+
+func (cs contractsByEndHeight) Len() int           { return len(cs) }
+func (cs contractsByEndHeight) Less(i, j int) bool { return cs[i].EndHeight() < cs[j].EndHeight() }
+func (cs contractsByEndHeight) Swap(i, j int)      { cs[i], cs[j] = cs[j], cs[i] }
+
+// ExpiringContracts returns the contracts whose proof window starts within
+// the next within blocks, soonest first. Contracts with offline hosts are
+// included.
+func (c *Contractor) ExpiringContracts(within types.BlockHeight) []modules.RenterContract {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	cs := []modules.RenterContract{}
+	for _, contract := range c.contracts {
+		end := contract.EndHeight()
+		if end <= c.blockHeight || end-c.blockHeight <= within {
+			cs = append(cs, contract)
+		}
+	}
+	sort.Sort(contractsByEndHeight(cs))
+	return cs
+}
+
+// NegotiationMetrics returns the durations of the negotiation phases of each
+// current contract that was formed since the contractor was created.
+func (c *Contractor) NegotiationMetrics() []modules.NegotiationMetrics {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var metrics []modules.NegotiationMetrics
+	for id := range c.contracts {
+		if m, ok := c.metrics[id]; ok {
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics
+}
+
 // CurrentPeriod returns the height at which the current allowance period
 // began.
 func (c *Contractor) CurrentPeriod() types.BlockHeight {
@@ -116,6 +206,13 @@ func (c *Contractor) CurrentPeriod() types.BlockHeight {
 	return c.currentPeriod
 }
 
+// ResolveID returns the ID of the most recent renewal of id.
+func (c *Contractor) ResolveID(id types.FileContractID) types.FileContractID {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.resolveID(id)
+}
+
 // resolveID returns the ID of the most recent renewal of id.
 func (c *Contractor) resolveID(id types.FileContractID) types.FileContractID {
 	if newID, ok := c.renewedIDs[id]; ok && newID != id {
@@ -124,6 +221,95 @@ func (c *Contractor) resolveID(id types.FileContractID) types.FileContractID {
 	return id
 }
 
+// SetNegotiationTimeouts sets the timeouts used when forming and renewing
+// contracts. The dial and contract timeouts must be positive. A zero
+// transaction set timeout selects the default.
+func (c *Contractor) SetNegotiationTimeouts(t proto.NegotiationTimeouts) error {
+	if t.Dial <= 0 || t.Contract <= 0 || t.TxnSet < 0 {
+		return errBadTimeouts
+	}
+	c.mu.Lock()
+	c.timeouts = t
+	c.mu.Unlock()
+	return nil
+}
+
+// SetMaxTxnSetSize sets the limit on the total encoded size of the
+// transactions, inputs, and outputs that a host may add to a contract
+// transaction when forming or renewing a contract. Zero selects the default.
+func (c *Contractor) SetMaxTxnSetSize(n uint64) {
+	c.mu.Lock()
+	c.maxTxnSetSize = n
+	c.mu.Unlock()
+}
+
+// SetMissedProofPolicy sets whether the renter's payments to a host are
+// burned or refunded to the renter if the host misses its storage proof. The
+// policy applies to revisions and renewals negotiated after it is set; the
+// default is proto.BurnPayments.
+func (c *Contractor) SetMissedProofPolicy(p proto.MissedProofPolicy) error {
+	if p != proto.BurnPayments && p != proto.RefundPayments {
+		return errBadMissedProofPolicy
+	}
+	c.mu.Lock()
+	c.missedProofs = p
+	c.mu.Unlock()
+	return nil
+}
+
+// SetLocalAddress sets the local IP address that connections to hosts
+// originate from, both for forming and renewing contracts and for the Editors
+// and Downloaders that revise them. An empty address restores the default,
+// letting the operating system choose.
+func (c *Contractor) SetLocalAddress(addr string) error {
+	var localAddr net.Addr
+	if addr != "" {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return errBadLocalAddress
+		}
+		localAddr = &net.TCPAddr{IP: ip}
+	}
+	c.mu.Lock()
+	c.localAddr = localAddr
+	c.mu.Unlock()
+	return nil
+}
+
+// SetLogVerbosity sets how much detail the contractor writes to its log.
+func (c *Contractor) SetLogVerbosity(v Verbosity) error {
+	if v != VerbosityNormal && v != VerbosityDebug {
+		return errBadVerbosity
+	}
+	c.mu.Lock()
+	c.verbosity = v
+	c.mu.Unlock()
+	return nil
+}
+
+// managedDebugf logs a message if the log verbosity is VerbosityDebug.
+func (c *Contractor) managedDebugf(format string, v ...interface{}) {
+	c.mu.RLock()
+	verbose := c.verbosity >= VerbosityDebug
+	c.mu.RUnlock()
+	if verbose {
+		c.log.Printf("DEBUG: "+format, v...)
+	}
+}
+
+// managedUpdateHostSettings notifies the hostdb if err was caused by a host
+// reporting settings that differ from the ones in the hostdb.
+func (c *Contractor) managedUpdateHostSettings(err error) {
+	host, ok := proto.SettingsDiscrepancy(err)
+	if !ok {
+		return
+	}
+	c.log.Printf("WARN: host %v reported different settings during negotiation: %v", host.NetAddress, err)
+	if err := c.hdb.UpdateEntry(host); err != nil {
+		c.log.Debugln("couldn't update host settings in the hostdb:", err)
+	}
+}
+
 // New returns a new Contractor.
 func New(cs consensusSet, wallet walletShim, tpool transactionPool, hdb hostDB, persistDir string) (*Contractor, error) {
 	// Check for nil inputs.
@@ -163,14 +349,22 @@ func newContractor(cs consensusSet, w wallet, tp transactionPool, hdb hostDB, p
 		tpool:   tp,
 		wallet:  w,
 
+		bandwidthShare:  defaultBandwidthReserve,
 		cachedRevisions: make(map[types.FileContractID]cachedRevision),
 		contracts:       make(map[types.FileContractID]modules.RenterContract),
+		dialer:          proto.StdDialer{},
 		downloaders:     make(map[types.FileContractID]*hostDownloader),
 		editors:         make(map[types.FileContractID]*hostEditor),
+		failedHosts:     make(map[modules.NetAddress]modules.HostFailure),
+		failureCooldown: defaultFailureCooldown,
+		fundingMargin:   defaultFundingMargin,
+		maxHosts:        defaultMaxHosts,
+		metrics:         make(map[types.FileContractID]modules.NegotiationMetrics),
 		oldContracts:    make(map[types.FileContractID]modules.RenterContract),
 		renewedIDs:      make(map[types.FileContractID]types.FileContractID),
 		renewing:        make(map[types.FileContractID]bool),
 		revising:        make(map[types.FileContractID]bool),
+		oversampling:    defaultSampleMultiplier,
 	}
 
 	// Load the prior persistence structures.
@@ -3,6 +3,7 @@ package contractor
 import (
 	"encoding/json"
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
 	"testing"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/renter/proto"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -26,14 +28,17 @@ func (newStub) Synced() bool { return true }
 // wallet stubs
 func (newStub) NextAddress() (uc types.UnlockConditions, err error) { return }
 func (newStub) StartTransaction() modules.TransactionBuilder        { return nil }
+func (newStub) Unlocked() bool                                      { return true }
 
 // transaction pool stubs
 func (newStub) AcceptTransactionSet([]types.Transaction) error      { return nil }
 func (newStub) FeeEstimation() (a types.Currency, b types.Currency) { return }
 
 // hdb stubs
-func (newStub) Host(modules.NetAddress) (settings modules.HostDBEntry, ok bool) { return }
-func (newStub) RandomHosts(int, []modules.NetAddress) []modules.HostDBEntry     { return nil }
+func (newStub) Host(modules.NetAddress) (settings modules.HostDBEntry, ok bool)        { return }
+func (newStub) RandomHosts(int, []modules.NetAddress) []modules.HostDBEntry            { return nil }
+func (newStub) RefreshHost(modules.NetAddress) (settings modules.HostDBEntry, ok bool) { return }
+func (newStub) UpdateEntry(modules.HostDBEntry) error                                  { return nil }
 
 // TestNew tests the New function.
 func TestNew(t *testing.T) {
@@ -139,6 +144,81 @@ func TestContracts(t *testing.T) {
 	}
 }
 
+// TestExpiringContracts tests the ExpiringContracts method.
+func TestExpiringContracts(t *testing.T) {
+	c := &Contractor{
+		blockHeight: 100,
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, LastRevision: types.FileContractRevision{NewWindowStart: 150}},
+			{2}: {ID: types.FileContractID{2}, LastRevision: types.FileContractRevision{NewWindowStart: 110}},
+			{3}: {ID: types.FileContractID{3}, LastRevision: types.FileContractRevision{NewWindowStart: 200}},
+			{4}: {ID: types.FileContractID{4}, LastRevision: types.FileContractRevision{NewWindowStart: 100}},
+			{5}: {ID: types.FileContractID{5}, LastRevision: types.FileContractRevision{NewWindowStart: 130}},
+		},
+	}
+	tests := []struct {
+		within types.BlockHeight
+		ids    []types.FileContractID
+	}{
+		{0, []types.FileContractID{{4}}},
+		{9, []types.FileContractID{{4}}},
+		{10, []types.FileContractID{{4}, {2}}},
+		{50, []types.FileContractID{{4}, {2}, {5}, {1}}},
+		{100, []types.FileContractID{{4}, {2}, {5}, {1}, {3}}},
+		{^types.BlockHeight(0), []types.FileContractID{{4}, {2}, {5}, {1}, {3}}},
+	}
+	for _, test := range tests {
+		cs := c.ExpiringContracts(test.within)
+		if len(cs) != len(test.ids) {
+			t.Errorf("within %v: expected %v contracts, got %v", test.within, len(test.ids), len(cs))
+			continue
+		}
+		for i := range cs {
+			if cs[i].ID != test.ids[i] {
+				t.Errorf("within %v: expected contract %v at position %v, got %v", test.within, test.ids[i], i, cs[i].ID)
+			}
+		}
+	}
+}
+
+// TestWillRenew tests the WillRenew method.
+func TestWillRenew(t *testing.T) {
+	now := time.Now()
+	badScans := []modules.HostDBScan{
+		{Timestamp: now.Add(-uptimeWindow * 2), Success: false},
+		{Timestamp: now.Add(-uptimeWindow / 2), Success: false},
+		{Timestamp: now, Success: false},
+	}
+	c := &Contractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, NetAddress: "foo"},
+			{2}: {ID: types.FileContractID{2}, NetAddress: "bar"},
+		},
+		hdb: mapHostDB{
+			hosts: map[modules.NetAddress]modules.HostDBEntry{
+				"foo": {},
+				"bar": {ScanHistory: badScans},
+			},
+		},
+	}
+
+	// Without an allowance, no contracts are renewed.
+	if c.WillRenew(types.FileContractID{1}) {
+		t.Error("contract should not be renewed without an allowance")
+	}
+
+	c.allowance = modules.Allowance{Period: 100, RenewWindow: 10}
+	if !c.WillRenew(types.FileContractID{1}) {
+		t.Error("contract with an online host should be renewed")
+	}
+	if c.WillRenew(types.FileContractID{2}) {
+		t.Error("contract with an offline host should not be renewed")
+	}
+	if c.WillRenew(types.FileContractID{3}) {
+		t.Error("unknown contract should not be renewed")
+	}
+}
+
 // TestResolveID tests the resolveID method.
 func TestResolveID(t *testing.T) {
 	c := &Contractor{
@@ -184,12 +264,141 @@ func TestAllowance(t *testing.T) {
 	}
 }
 
+// TestValidateAllowance tests that ValidateAllowance returns the errors that
+// SetAllowance would return, without setting the allowance.
+func TestValidateAllowance(t *testing.T) {
+	hosts := make([]modules.HostDBEntry, 4)
+	for i := range hosts {
+		hosts[i].StoragePrice = types.NewCurrency64(1)
+		hosts[i].ContractPrice = types.NewCurrency64(1000)
+	}
+	deps := &fakeDeps{hosts: hosts, fee: types.NewCurrency64(2)}
+	c := &Contractor{
+		cs:    newStub{},
+		hdb:   deps,
+		tpool: deps,
+	}
+
+	valid := modules.Allowance{
+		Funds:       types.NewCurrency64(1e12),
+		Hosts:       2,
+		Period:      10,
+		RenewWindow: 5,
+	}
+	tests := []struct {
+		modify func(*modules.Allowance)
+		err    error
+	}{
+		{func(a *modules.Allowance) {}, nil},
+		{func(a *modules.Allowance) { *a = modules.Allowance{} }, nil},
+		{func(a *modules.Allowance) { a.Hosts = 0 }, ErrTooFewHosts},
+		{func(a *modules.Allowance) { a.RenewWindow = 0 }, ErrAllowanceZeroWindow},
+		{func(a *modules.Allowance) { a.Funds = types.NewCurrency64(1000) }, ErrInsufficientAllowance},
+	}
+	for i, test := range tests {
+		a := valid
+		test.modify(&a)
+		if err := c.ValidateAllowance(a); err != test.err {
+			t.Errorf("%v: expected %v, got %v", i, test.err, err)
+		}
+	}
+	if !c.allowance.Funds.IsZero() || c.allowance.Hosts != 0 {
+		t.Fatal("ValidateAllowance should not set the allowance:", c.allowance)
+	}
+}
+
+// TestAllowanceHostLimits tests that allowances must request between 1 and
+// the contractor's maximum number of hosts.
+func TestAllowanceHostLimits(t *testing.T) {
+	a := modules.Allowance{
+		Funds:       types.NewCurrency64(1e12),
+		Period:      10,
+		RenewWindow: 5,
+	}
+	tests := []struct {
+		hosts uint64
+		err   error
+	}{
+		{0, ErrTooFewHosts},
+		{1, nil},
+		{defaultMaxHosts, nil},
+		{defaultMaxHosts + 1, ErrTooManyHosts},
+	}
+	for _, test := range tests {
+		a.Hosts = test.hosts
+		if err := checkAllowance(a, defaultMaxHosts); err != test.err {
+			t.Errorf("%v hosts: expected %v, got %v", test.hosts, test.err, err)
+		}
+	}
+
+	// The maximum should be configurable.
+	c := &Contractor{persist: new(memPersist)}
+	if err := c.SetMaxHosts(0); err != errBadMaxHosts {
+		t.Fatal("expected errBadMaxHosts, got", err)
+	}
+	if err := c.SetMaxHosts(5); err != nil {
+		t.Fatal(err)
+	}
+	a.Hosts = 6
+	if err := c.ValidateAllowance(a); err != ErrTooManyHosts {
+		t.Fatal("expected ErrTooManyHosts, got", err)
+	}
+}
+
 // stubHostDB mocks the hostDB dependency using zero-valued implementations of
 // its methods.
 type stubHostDB struct{}
 
 func (stubHostDB) Host(modules.NetAddress) (h modules.HostDBEntry, ok bool)         { return }
 func (stubHostDB) RandomHosts(int, []modules.NetAddress) (hs []modules.HostDBEntry) { return }
+func (stubHostDB) RefreshHost(modules.NetAddress) (h modules.HostDBEntry, ok bool)  { return }
+func (stubHostDB) UpdateEntry(modules.HostDBEntry) error                            { return nil }
+
+// fakeDeps is a configurable hostDB, transactionPool, and wallet.
+// RandomHosts returns up to n of hosts, skipping excluded addresses, and
+// records the arguments of each call. FeeEstimation reports fee as both the
+// minimum and the maximum fee. The wallet reports itself as locked if locked
+// is set, and walletCalls counts the calls that require an unlocked wallet.
+type fakeDeps struct {
+	stubHostDB
+	hosts     []modules.HostDBEntry
+	requested []int
+	excludes  [][]modules.NetAddress
+
+	fee types.Currency
+
+	locked      bool
+	walletCalls int
+}
+
+func (d *fakeDeps) RandomHosts(n int, exclude []modules.NetAddress) []modules.HostDBEntry {
+	d.requested = append(d.requested, n)
+	d.excludes = append(d.excludes, append([]modules.NetAddress(nil), exclude...))
+	excluded := make(map[modules.NetAddress]bool)
+	for _, addr := range exclude {
+		excluded[addr] = true
+	}
+	var hosts []modules.HostDBEntry
+	for _, h := range d.hosts {
+		if len(hosts) < n && !excluded[h.NetAddress] {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+func (d *fakeDeps) AcceptTransactionSet([]types.Transaction) error  { return nil }
+func (d *fakeDeps) FeeEstimation() (types.Currency, types.Currency) { return d.fee, d.fee }
+
+func (d *fakeDeps) NextAddress() (types.UnlockConditions, error) {
+	d.walletCalls++
+	return types.UnlockConditions{}, nil
+}
+func (d *fakeDeps) StartTransaction() transactionBuilder {
+	d.walletCalls++
+	return nil
+}
+func (d *fakeDeps) Unlocked() bool { return !d.locked }
 
 // TestIntegrationSetAllowance tests the SetAllowance method.
 func TestIntegrationSetAllowance(t *testing.T) {
@@ -245,6 +454,13 @@ func TestIntegrationSetAllowance(t *testing.T) {
 	if err != errAllowanceWindowSize {
 		t.Errorf("expected %q, got %q", errAllowanceWindowSize, err)
 	}
+	a.RenewWindow = 10
+	a.MaxContractPrice = minStoragePrice.Sub(types.NewCurrency64(1))
+	err = c.SetAllowance(a)
+	if err != errAllowanceMaxPrice {
+		t.Errorf("expected %q, got %q", errAllowanceMaxPrice, err)
+	}
+	a.MaxContractPrice = types.ZeroCurrency
 
 	// reasonable values; should succeed
 	a.Funds = types.SiacoinPrecision.Mul64(100)
@@ -326,6 +542,110 @@ func TestIntegrationSetAllowance(t *testing.T) {
 	}
 }
 
+// recordingPersister wraps a persister, recording the IDs of the contracts in
+// each save.
+type recordingPersister struct {
+	persister
+	saves *[]map[types.FileContractID]bool
+}
+
+func (p recordingPersister) record(data contractorPersist) {
+	ids := make(map[types.FileContractID]bool)
+	for _, contract := range data.Contracts {
+		ids[contract.ID] = true
+	}
+	*p.saves = append(*p.saves, ids)
+}
+
+func (p recordingPersister) save(data contractorPersist) error {
+	p.record(data)
+	return p.persister.save(data)
+}
+
+func (p recordingPersister) saveSync(data contractorPersist) error {
+	p.record(data)
+	return p.persister.saveSync(data)
+}
+
+// TestIntegrationSetAllowanceRenewFailure tests that SetAllowance replaces the
+// contract set in a single step, and keeps contracts that could not be
+// renewed if no replacement could be formed.
+func TestIntegrationSetAllowanceRenewFailure(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	h, c, _, err := newTestingTrio("TestIntegrationSetAllowanceRenewFailure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// form a contract with the host
+	a := modules.Allowance{
+		Funds:       types.SiacoinPrecision.Mul64(100),
+		Hosts:       1,
+		Period:      20,
+		RenewWindow: 10,
+	}
+	if err = c.SetAllowance(a); err != nil {
+		t.Fatal(err)
+	}
+	contracts := c.Contracts()
+	if len(contracts) != 1 {
+		t.Fatal("expected 1 contract, got", len(contracts))
+	}
+	good := contracts[0]
+
+	// add a contract with a host that the hostdb returns but has no record
+	// of, so that renewing the contract fails partway through SetAllowance
+	bad := good
+	bad.ID = types.FileContractID{1}
+	bad.NetAddress = "foo.com:1234"
+	hostEntry, _ := c.hdb.Host(good.NetAddress)
+	hostEntry.NetAddress = bad.NetAddress
+	c.hdb = unreachableHostDB{hostDB: c.hdb, bad: []modules.HostDBEntry{hostEntry}}
+	c.mu.Lock()
+	c.contracts[bad.ID] = bad
+	c.mu.Unlock()
+
+	var saves []map[types.FileContractID]bool
+	c.persist = recordingPersister{c.persist, &saves}
+
+	// renew both contracts. Only the good contract can be renewed, and no
+	// other host can replace the bad one.
+	a.Hosts = 2
+	a.Funds = a.Funds.Mul64(2)
+	if err = c.SetAllowance(a); err != nil {
+		t.Fatal(err)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.contracts) != 2 {
+		t.Fatal("expected 2 contracts, got", len(c.contracts))
+	}
+	if _, ok := c.contracts[good.ID]; ok {
+		t.Error("renewed contract was not replaced")
+	} else if _, ok := c.oldContracts[good.ID]; !ok {
+		t.Error("renewed contract was not archived")
+	}
+	if _, ok := c.contracts[bad.ID]; !ok {
+		t.Error("contract that could not be renewed was dropped")
+	} else if _, ok := c.oldContracts[bad.ID]; ok {
+		t.Error("contract that could not be renewed was archived")
+	}
+
+	// the new contract set should have been saved exactly once
+	if len(saves) != 1 {
+		t.Fatal("expected contract set to be saved once, got", len(saves))
+	}
+	for id := range c.contracts {
+		if !saves[0][id] {
+			t.Error("saved contract set does not match the current set")
+		}
+	}
+}
+
 // testWalletShim is used to test the walletBridge type.
 type testWalletShim struct {
 	nextAddressCalled bool
@@ -342,6 +662,7 @@ func (ws *testWalletShim) StartTransaction() modules.TransactionBuilder {
 	ws.startTxnCalled = true
 	return nil
 }
+func (ws *testWalletShim) Unlocked() bool { return true }
 
 // TestWalletBridge tests the walletBridge type.
 func TestWalletBridge(t *testing.T) {
@@ -356,3 +677,108 @@ func TestWalletBridge(t *testing.T) {
 		t.Error("StartTransaction was not called on the shim")
 	}
 }
+
+// TestSetNegotiationTimeouts tests the SetNegotiationTimeouts method.
+func TestSetNegotiationTimeouts(t *testing.T) {
+	c := &Contractor{}
+	bad := []proto.NegotiationTimeouts{
+		{},
+		{Dial: time.Second},
+		{Contract: time.Second},
+		{Dial: -time.Second, Contract: time.Second},
+		{Dial: time.Second, Contract: time.Second, TxnSet: -time.Second},
+	}
+	for _, timeouts := range bad {
+		if err := c.SetNegotiationTimeouts(timeouts); err != errBadTimeouts {
+			t.Errorf("expected %q for %v, got %v", errBadTimeouts, timeouts, err)
+		}
+	}
+	good := proto.NegotiationTimeouts{Dial: time.Second, Contract: time.Minute}
+	if err := c.SetNegotiationTimeouts(good); err != nil {
+		t.Fatal(err)
+	}
+	if c.timeouts != good {
+		t.Error("timeouts were not set")
+	}
+}
+
+// TestSetMaxTxnSetSize tests the SetMaxTxnSetSize method.
+func TestSetMaxTxnSetSize(t *testing.T) {
+	c := &Contractor{}
+	c.SetMaxTxnSetSize(1000)
+	if c.maxTxnSetSize != 1000 {
+		t.Error("limit was not set")
+	}
+}
+
+// TestSetMissedProofPolicy tests the SetMissedProofPolicy method.
+func TestSetMissedProofPolicy(t *testing.T) {
+	c := &Contractor{}
+	if c.missedProofs != proto.BurnPayments {
+		t.Fatal("default policy should burn payments")
+	}
+	if err := c.SetMissedProofPolicy(proto.MissedProofPolicy(2)); err != errBadMissedProofPolicy {
+		t.Errorf("expected %q, got %v", errBadMissedProofPolicy, err)
+	}
+	if err := c.SetMissedProofPolicy(proto.RefundPayments); err != nil {
+		t.Fatal(err)
+	}
+	if c.missedProofs != proto.RefundPayments {
+		t.Error("policy was not set")
+	}
+}
+
+// TestSetLocalAddress tests the SetLocalAddress method.
+func TestSetLocalAddress(t *testing.T) {
+	c := &Contractor{}
+	for _, addr := range []string{"foo", "127.0.0.1:9982", "256.0.0.1"} {
+		if err := c.SetLocalAddress(addr); err != errBadLocalAddress {
+			t.Errorf("expected %q for %q, got %v", errBadLocalAddress, addr, err)
+		}
+	}
+	if err := c.SetLocalAddress("::1"); err != nil {
+		t.Fatal(err)
+	}
+	if tcpAddr, ok := c.localAddr.(*net.TCPAddr); !ok || !tcpAddr.IP.Equal(net.IPv6loopback) {
+		t.Error("local address was not set:", c.localAddr)
+	}
+	if err := c.SetLocalAddress(""); err != nil {
+		t.Fatal(err)
+	}
+	if c.localAddr != nil {
+		t.Error("local address was not cleared:", c.localAddr)
+	}
+}
+
+// TestNegotiationAddressExclusive tests that the cached negotiation address is
+// handed to only one negotiation at a time.
+func TestNegotiationAddressExclusive(t *testing.T) {
+	deps := &fakeDeps{}
+	cached := types.UnlockHash{1}
+	c := &Contractor{
+		wallet:        deps,
+		cachedAddress: cached,
+	}
+
+	// the first negotiation takes the cached address; the second gets a new
+	// address from the wallet
+	first, err := c.managedNegotiationAddress()
+	if err != nil {
+		t.Fatal(err)
+	} else if first != cached {
+		t.Fatal("cached address was not reused")
+	}
+	second, err := c.managedNegotiationAddress()
+	if err != nil {
+		t.Fatal(err)
+	} else if second == cached || deps.walletCalls != 1 {
+		t.Fatal("cached address was handed out twice")
+	}
+
+	// when both fail, only the first address given back is cached
+	c.managedReturnAddress(first)
+	c.managedReturnAddress(second)
+	if held, reuses := c.CachedAddress(); !held || reuses != 1 || c.cachedAddress != cached {
+		t.Fatalf("expected %v to be cached with 1 reuse, got %v (%v, %v)", cached, c.cachedAddress, held, reuses)
+	}
+}
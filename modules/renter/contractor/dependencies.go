@@ -21,10 +21,12 @@ type (
 	walletShim interface {
 		NextAddress() (types.UnlockConditions, error)
 		StartTransaction() modules.TransactionBuilder
+		Unlocked() bool
 	}
 	wallet interface {
 		NextAddress() (types.UnlockConditions, error)
 		StartTransaction() transactionBuilder
+		Unlocked() bool
 	}
 	transactionBuilder interface {
 		AddArbitraryData([]byte) uint64
@@ -48,6 +50,8 @@ type (
 	hostDB interface {
 		Host(modules.NetAddress) (modules.HostDBEntry, bool)
 		RandomHosts(n int, exclude []modules.NetAddress) []modules.HostDBEntry
+		RefreshHost(modules.NetAddress) (modules.HostDBEntry, bool)
+		UpdateEntry(modules.HostDBEntry) error
 	}
 
 	persister interface {
@@ -65,6 +69,7 @@ type walletBridge struct {
 
 func (ws *walletBridge) NextAddress() (types.UnlockConditions, error) { return ws.w.NextAddress() }
 func (ws *walletBridge) StartTransaction() transactionBuilder         { return ws.w.StartTransaction() }
+func (ws *walletBridge) Unlocked() bool                               { return ws.w.Unlocked() }
 
 // stdPersist implements the persister interface via persist.SaveFile and
 // persist.LoadFile. The metadata and filename required by these functions is
@@ -57,6 +57,13 @@ Editor maintains a network connection to a host, over which is sends
 modification requests, such as "delete sector 12." After each modification,
 the Editor revises the underlying file contract and saves it to disk.
 
+Revisions can only move funds between the outputs of a contract; consensus
+rejects any revision that changes the contract's total payout. It follows that
+a contract cannot be topped up in place: once the renter's funds in a contract
+are spent, more funds can only be added by forming a new contract with the
+host, as renewal does. A contract that runs low mid-period is therefore
+replaced rather than revised.
+
 The primary challenge of the contractor is that it must be smart enough for
 the user to feel comfortable allowing it to spend their money. Because
 contract renewal is a background task, it is difficult to report errors to the
@@ -112,6 +112,8 @@ func (c *Contractor) Downloader(id types.FileContractID) (_ Downloader, err erro
 	height := c.blockHeight
 	contract, haveContract := c.contracts[id]
 	renewing := c.renewing[id]
+	missedProofs := c.missedProofs
+	dialer, localAddr := c.dialer, c.localAddr
 	c.mu.RUnlock()
 
 	if renewing {
@@ -126,7 +128,7 @@ func (c *Contractor) Downloader(id types.FileContractID) (_ Downloader, err erro
 		return cachedDownloader, nil
 	}
 
-	host, haveHost := c.hdb.Host(contract.NetAddress)
+	host, haveHost := c.hdb.RefreshHost(contract.NetAddress)
 	if !haveContract {
 		return nil, errors.New("no record of that contract")
 	} else if height > contract.EndHeight() {
@@ -168,7 +170,7 @@ func (c *Contractor) Downloader(id types.FileContractID) (_ Downloader, err erro
 	}
 
 	// create downloader
-	d, err := proto.NewDownloader(host, contract)
+	d, err := proto.NewDownloader(host, contract, dialer, localAddr)
 	if proto.IsRevisionMismatch(err) {
 		// try again with the cached revision
 		c.mu.RLock()
@@ -181,14 +183,16 @@ func (c *Contractor) Downloader(id types.FileContractID) (_ Downloader, err erro
 		}
 		c.log.Printf("host %v has different revision for %v; retrying with cached revision", contract.NetAddress, contract.ID)
 		contract.LastRevision = cached.Revision
-		d, err = proto.NewDownloader(host, contract)
+		d, err = proto.NewDownloader(host, contract, dialer, localAddr)
 	}
 	if err != nil {
+		c.managedUpdateHostSettings(err)
 		return nil, err
 	}
 	// supply a SaveFn that saves the revision to the contractor's persist
 	// (the existing revision will be overwritten when SaveFn is called)
 	d.SaveFn = c.saveRevision(contract.ID)
+	d.MissedProofPolicy = missedProofs
 
 	// cache downloader
 	hd := &hostDownloader{
@@ -171,6 +171,8 @@ func (c *Contractor) Editor(id types.FileContractID) (_ Editor, err error) {
 	height := c.blockHeight
 	contract, haveContract := c.contracts[id]
 	renewing := c.renewing[id]
+	missedProofs := c.missedProofs
+	dialer, localAddr := c.dialer, c.localAddr
 	c.mu.RUnlock()
 
 	if renewing {
@@ -178,14 +180,21 @@ func (c *Contractor) Editor(id types.FileContractID) (_ Editor, err error) {
 	}
 
 	if haveEditor {
-		// increment number of clients and return
+		// increment number of clients and return, unless the last client
+		// closed the editor after it was looked up, in which case a new
+		// editor is created below
 		cachedEditor.mu.Lock()
-		cachedEditor.clients++
+		closed := cachedEditor.clients == 0 && !cachedEditor.invalid
+		if !closed {
+			cachedEditor.clients++
+		}
 		cachedEditor.mu.Unlock()
-		return cachedEditor, nil
+		if !closed {
+			return cachedEditor, nil
+		}
 	}
 
-	host, haveHost := c.hdb.Host(contract.NetAddress)
+	host, haveHost := c.hdb.RefreshHost(contract.NetAddress)
 	if !haveContract {
 		return nil, errors.New("no record of that contract")
 	} else if height > contract.EndHeight() {
@@ -232,7 +241,7 @@ func (c *Contractor) Editor(id types.FileContractID) (_ Editor, err error) {
 	}
 
 	// create editor
-	e, err := proto.NewEditor(host, contract, height)
+	e, err := proto.NewEditor(host, contract, height, dialer, localAddr)
 	if proto.IsRevisionMismatch(err) {
 		// try again with the cached revision
 		c.mu.RLock()
@@ -246,14 +255,16 @@ func (c *Contractor) Editor(id types.FileContractID) (_ Editor, err error) {
 		c.log.Printf("host %v has different revision for %v; retrying with cached revision", contract.NetAddress, contract.ID)
 		contract.LastRevision = cached.Revision
 		contract.MerkleRoots = cached.MerkleRoots
-		e, err = proto.NewEditor(host, contract, height)
+		e, err = proto.NewEditor(host, contract, height, dialer, localAddr)
 	}
 	if err != nil {
+		c.managedUpdateHostSettings(err)
 		return nil, err
 	}
 	// supply a SaveFn that saves the revision to the contractor's persist
 	// (the existing revision will be overwritten when SaveFn is called)
 	e.SaveFn = c.saveRevision(contract.ID)
+	e.MissedProofPolicy = missedProofs
 
 	// cache editor
 	he := &hostEditor{
@@ -0,0 +1,88 @@
+package contractor
+
+import (
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/renter/proto"
+)
+
+// EstimateContracts estimates the contracts that SetAllowance would form with
+// the allowance a, without contacting any hosts or spending any money. The
+// hosts are selected and the contract sizes are calculated in the same way as
+// when contracts are formed. Hosts that the contractor already has contracts
+// with are not included, as forming additional contracts never replaces them.
+func (c *Contractor) EstimateContracts(a modules.Allowance) (modules.RenterContractEstimate, error) {
+	c.mu.RLock()
+	maxHosts := c.maxHosts
+	c.mu.RUnlock()
+	if err := checkAllowance(a, maxHosts); err != nil {
+		return modules.RenterContractEstimate{}, err
+	}
+
+	// calculate the number of sectors per contract, as in SetAllowance
+	sample, err := sampleHosts(c.hdb, a.Hosts)
+	if err != nil {
+		return modules.RenterContractEstimate{}, err
+	}
+	averageStoragePrice, averageContractPrice := averagePrices(sample)
+	c.mu.RLock()
+	margin := c.fundingMargin + bandwidthMargin(sample, c.bandwidthShare)
+	c.mu.RUnlock()
+	max, err := maxSectorsAtPrices(a, margin, averageStoragePrice, averageContractPrice, c.tpool)
+	if err != nil {
+		return modules.RenterContractEstimate{}, err
+	}
+	numSectors, err := allowanceSectors(max)
+	if err != nil {
+		return modules.RenterContractEstimate{}, err
+	}
+
+	// new contracts end with the existing ones, as in
+	// managedFormAllowanceContracts
+	c.mu.RLock()
+	n := int(a.Hosts) - len(c.contracts)
+	startHeight := c.blockHeight
+	endHeight := c.blockHeight + a.Period
+	if len(c.contracts) > 0 {
+		endHeight = c.contractEndHeight()
+	}
+	c.mu.RUnlock()
+
+	estimate := modules.RenterContractEstimate{
+		AverageContractPrice: averageContractPrice,
+		AverageStoragePrice:  averageStoragePrice,
+		EndHeight:            endHeight,
+		Filesize:             numSectors * modules.SectorSize,
+	}
+	if n <= 0 {
+		return estimate, nil
+	}
+	hosts, _, err := c.managedCandidateHosts(n)
+	if err != nil {
+		return modules.RenterContractEstimate{}, err
+	}
+	for _, h := range hosts {
+		if len(estimate.Contracts) >= n {
+			break
+		}
+		// skip the hosts that managedNewContract would reject
+		h, err := checkHostPrice(h, a.MaxContractPrice)
+		if err != nil {
+			continue
+		}
+		cost, err := proto.ContractCost(proto.ContractParams{
+			Host:        h,
+			Filesize:    estimate.Filesize,
+			StartHeight: startHeight,
+			EndHeight:   endHeight,
+		}, c.tpool)
+		if err != nil {
+			continue
+		}
+		estimate.Contracts = append(estimate.Contracts, modules.ContractEstimate{
+			NetAddress: h.NetAddress,
+			Cost:       cost,
+		})
+		estimate.TotalCost = estimate.TotalCost.Add(cost)
+	}
+	return estimate, nil
+}
@@ -0,0 +1,90 @@
+package contractor
+
+import (
+	"sort"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// failuresByTime sorts host failures from newest to oldest.
+type failuresByTime []modules.HostFailure
+
+func (fs failuresByTime) Len() int           { return len(fs) }
+func (fs failuresByTime) Less(i, j int) bool { return fs[i].Time.After(fs[j].Time) }
+func (fs failuresByTime) Swap(i, j int)      { fs[i], fs[j] = fs[j], fs[i] }
+
+// SetFailureCooldown sets how long a host that failed contract formation is
+// excluded from host selection. A cooldown of zero disables the exclusion.
+func (c *Contractor) SetFailureCooldown(d time.Duration) error {
+	if d < 0 {
+		return errBadCooldown
+	}
+	c.mu.Lock()
+	c.failureCooldown = d
+	c.mu.Unlock()
+	return nil
+}
+
+// RecentFailures returns the most recent contract formation failure of each
+// host, newest first. Failures are forgotten after failureRecordDuration, or
+// after the failure cooldown if it is longer.
+func (c *Contractor) RecentFailures() []modules.HostFailure {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneFailures()
+	failures := make([]modules.HostFailure, 0, len(c.failedHosts))
+	for _, f := range c.failedHosts {
+		failures = append(failures, f)
+	}
+	sort.Sort(failuresByTime(failures))
+	return failures
+}
+
+// recordFailure records that contract formation with a host failed. If
+// maxFailureRecords failures are already recorded, the oldest is forgotten.
+// The caller must hold c.mu.
+func (c *Contractor) recordFailure(addr modules.NetAddress, err error) {
+	c.pruneFailures()
+	if _, exists := c.failedHosts[addr]; !exists && len(c.failedHosts) >= maxFailureRecords {
+		var oldest modules.HostFailure
+		for _, f := range c.failedHosts {
+			if oldest.Time.IsZero() || f.Time.Before(oldest.Time) {
+				oldest = f
+			}
+		}
+		delete(c.failedHosts, oldest.NetAddress)
+	}
+	c.failedHosts[addr] = modules.HostFailure{
+		NetAddress: addr,
+		Error:      err.Error(),
+		Time:       time.Now(),
+	}
+}
+
+// pruneFailures forgets the failures that have expired. The caller must hold
+// c.mu.
+func (c *Contractor) pruneFailures() {
+	expiry := failureRecordDuration
+	if c.failureCooldown > expiry {
+		expiry = c.failureCooldown
+	}
+	for addr, f := range c.failedHosts {
+		if time.Since(f.Time) >= expiry {
+			delete(c.failedHosts, addr)
+		}
+	}
+}
+
+// recentlyFailedHosts returns the hosts that failed contract formation within
+// the failure cooldown. The caller must hold c.mu.
+func (c *Contractor) recentlyFailedHosts() []modules.NetAddress {
+	c.pruneFailures()
+	var failed []modules.NetAddress
+	for addr, f := range c.failedHosts {
+		if time.Since(f.Time) < c.failureCooldown {
+			failed = append(failed, addr)
+		}
+	}
+	return failed
+}
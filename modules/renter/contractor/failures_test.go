@@ -0,0 +1,128 @@
+package contractor
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestFormContractsExcludesFailedHosts tests that hosts which failed to form
+// a contract are excluded from host selection until their cooldown expires.
+func TestFormContractsExcludesFailedHosts(t *testing.T) {
+	// every host is more expensive than the maximum price, so negotiation
+	// with them fails
+	var bad, other modules.HostDBEntry
+	bad.NetAddress = "bad:1234"
+	bad.StoragePrice = types.NewCurrency64(100)
+	other.NetAddress = "other:1234"
+	other.StoragePrice = types.NewCurrency64(100)
+	hdb := &fakeDeps{hosts: []modules.HostDBEntry{bad}}
+	c := &Contractor{
+		hdb:             hdb,
+		wallet:          &fakeDeps{},
+		failedHosts:     make(map[modules.NetAddress]modules.HostFailure),
+		failureCooldown: time.Minute,
+	}
+	if _, err := c.managedFormContracts(1, 0, 0, types.NewCurrency64(1)); err == nil {
+		t.Fatal("expected contract formation to fail")
+	}
+	if f, ok := c.failedHosts[bad.NetAddress]; !ok {
+		t.Fatal("failed host was not recorded")
+	} else if f.Error != errTooExpensive.Error() {
+		t.Fatalf("expected recorded error to be %q, got %q", errTooExpensive, f.Error)
+	}
+
+	// the failed host should be excluded from the next selection
+	hdb.hosts = []modules.HostDBEntry{bad, other}
+	hdb.excludes = nil
+	c.managedFormContracts(1, 0, 0, types.NewCurrency64(1))
+	if len(hdb.excludes) == 0 || len(hdb.excludes[0]) != 1 || hdb.excludes[0][0] != bad.NetAddress {
+		t.Fatal("failed host was not excluded:", hdb.excludes)
+	}
+
+	// once the cooldown expires, the host should no longer be excluded, but
+	// the failure should still be reported
+	for addr, f := range c.failedHosts {
+		f.Time = f.Time.Add(-2 * time.Minute)
+		c.failedHosts[addr] = f
+	}
+	hdb.excludes = nil
+	c.managedFormContracts(1, 0, 0, types.NewCurrency64(1))
+	if len(hdb.excludes) == 0 || len(hdb.excludes[0]) != 0 {
+		t.Fatal("expired hosts were excluded:", hdb.excludes)
+	}
+	if len(c.RecentFailures()) != 2 {
+		t.Fatal("expected both failures to be reported, got", c.RecentFailures())
+	}
+
+	// if excluding the failed hosts leaves too few hosts, they are selected
+	// anyway
+	hdb.hosts = []modules.HostDBEntry{bad}
+	hdb.excludes = nil
+	c.failedHosts = map[modules.NetAddress]modules.HostFailure{bad.NetAddress: {NetAddress: bad.NetAddress, Time: time.Now()}}
+	c.managedFormContracts(1, 0, 0, types.NewCurrency64(1))
+	if len(hdb.excludes) < 2 || len(hdb.excludes[1]) != 0 {
+		t.Fatal("failed hosts were not selected when there were too few hosts:", hdb.excludes)
+	}
+}
+
+// TestSetFailureCooldown tests the SetFailureCooldown method.
+func TestSetFailureCooldown(t *testing.T) {
+	c := &Contractor{}
+	if err := c.SetFailureCooldown(-time.Second); err != errBadCooldown {
+		t.Errorf("expected %q, got %v", errBadCooldown, err)
+	}
+	if err := c.SetFailureCooldown(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if c.failureCooldown != time.Minute {
+		t.Error("cooldown was not set")
+	}
+}
+
+// TestRecentFailures tests that RecentFailures reports the latest failure of
+// each host, and that failures are capped and expire.
+func TestRecentFailures(t *testing.T) {
+	c := &Contractor{
+		failedHosts:     make(map[modules.NetAddress]modules.HostFailure),
+		failureCooldown: time.Minute,
+	}
+	errDial := errors.New("dial tcp: connection refused")
+	c.recordFailure("foo:1234", errors.New("old error"))
+	c.recordFailure("bar:1234", errTooExpensive)
+	c.recordFailure("foo:1234", errDial)
+
+	failures := c.RecentFailures()
+	if len(failures) != 2 {
+		t.Fatal("expected 2 failures, got", len(failures))
+	}
+	if failures[0].NetAddress != "foo:1234" || failures[0].Error != errDial.Error() {
+		t.Error("expected the newest failure first, got", failures[0])
+	}
+	if failures[1].NetAddress != "bar:1234" || failures[1].Error != errTooExpensive.Error() {
+		t.Error("wrong second failure:", failures[1])
+	}
+
+	// expired failures are forgotten
+	f := c.failedHosts["bar:1234"]
+	f.Time = time.Now().Add(-failureRecordDuration)
+	c.failedHosts["bar:1234"] = f
+	if failures = c.RecentFailures(); len(failures) != 1 || failures[0].NetAddress != "foo:1234" {
+		t.Error("expired failure was reported:", failures)
+	}
+
+	// the number of failures is capped, forgetting the oldest first
+	for i := 0; i < maxFailureRecords; i++ {
+		c.recordFailure(modules.NetAddress(fmt.Sprintf("host%v:1234", i)), errDial)
+	}
+	if failures = c.RecentFailures(); len(failures) != maxFailureRecords {
+		t.Fatalf("expected %v failures, got %v", maxFailureRecords, len(failures))
+	}
+	if _, ok := c.failedHosts["foo:1234"]; ok {
+		t.Error("oldest failure was not forgotten")
+	}
+}
@@ -13,8 +13,12 @@ import (
 )
 
 var (
-	// the contractor will not form contracts above this price
+	// the contractor will not form contracts above this price, unless the
+	// allowance specifies a different maximum
 	maxStoragePrice = types.SiacoinPrecision.Mul64(500e3).Div(modules.BlockBytesPerMonthTerabyte) // 500k SC / TB / Month
+	// the allowance's maximum price may not be set below this price, as
+	// practically no host would be able to satisfy it
+	minStoragePrice = types.SiacoinPrecision.Div(modules.BlockBytesPerMonthTerabyte) // 1 SC / TB / Month
 	// the contractor will not download data above this price (3x the maximum monthly storage price)
 	maxDownloadPrice = maxStoragePrice.Mul64(3 * 4320)
 	// the contractor will cap host's MaxCollateral setting to this value
@@ -24,92 +28,207 @@ var (
 	// than the amount necessary to store at least one sector
 	ErrInsufficientAllowance = errors.New("allowance is not large enough to cover fees of contract creation")
 	errTooExpensive          = errors.New("host price was too high")
+	errAllowanceTooLarge     = errors.New("allowance parameters too large")
+
+	// ErrWalletLocked is returned if contracts cannot be formed because the
+	// wallet is locked.
+	ErrWalletLocked = errors.New("wallet must be unlocked to form contracts")
 )
 
+// errCostOverflow returns the error reported when the named step of the
+// allowance cost calculation overflows.
+func errCostOverflow(step string) error {
+	return fmt.Errorf("%v: %v overflows", errAllowanceTooLarge, step)
+}
+
 // maxSectors is the estimated maximum number of sectors that the allowance
-// can support.
-func maxSectors(a modules.Allowance, hdb hostDB, tp transactionPool) (uint64, error) {
+// can support, after holding back the fraction margin of its funds, and the
+// fraction bandwidth of its funds if the hosts charge for bandwidth. It also
+// returns the fraction that was held back for bandwidth.
+func maxSectors(a modules.Allowance, margin, bandwidth float64, hdb hostDB, tp transactionPool) (uint64, float64, error) {
 	if a.Hosts <= 0 || a.Period <= 0 {
-		return 0, errors.New("invalid allowance")
+		return 0, 0, errors.New("invalid allowance")
 	}
 
-	// Sample at least 10 hosts.
-	nRandomHosts := int(a.Hosts)
-	if nRandomHosts < minHostsForEstimations {
-		nRandomHosts = minHostsForEstimations
+	hosts, err := sampleHosts(hdb, a.Hosts)
+	if err != nil {
+		return 0, 0, err
 	}
-	hosts := hdb.RandomHosts(nRandomHosts, nil)
-	if len(hosts) < int(a.Hosts) {
-		return 0, fmt.Errorf("not enough hosts in hostdb for sector calculation, got %v but needed %v", len(hosts), int(a.Hosts))
+	averageSectorPrice, averageContractPrice := averagePrices(hosts)
+	bandwidth = bandwidthMargin(hosts, bandwidth)
+	numSectors, err := maxSectorsAtPrices(a, margin+bandwidth, averageSectorPrice, averageContractPrice, tp)
+	if err != nil {
+		return 0, 0, err
 	}
+	return numSectors, bandwidth, nil
+}
 
-	// Calculate cost of creating contracts with each host, and the cost of
-	// storing sectors on each host.
-	var sectorSum types.Currency
-	var contractCostSum types.Currency
+// bandwidthMargin returns the fraction of the allowance to hold back for
+// uploading and downloading data: bandwidth if any of the hosts charge for
+// bandwidth, and 0 otherwise.
+func bandwidthMargin(hosts []modules.HostDBEntry, bandwidth float64) float64 {
 	for _, h := range hosts {
-		sectorSum = sectorSum.Add(h.StoragePrice)
-		contractCostSum = contractCostSum.Add(h.ContractPrice)
+		if !h.UploadBandwidthPrice.IsZero() || !h.DownloadBandwidthPrice.IsZero() {
+			return bandwidth
+		}
+	}
+	return 0
+}
+
+// maxSectorsAtPrices is the estimated maximum number of sectors that the
+// allowance can support, given the average prices of the hosts, after holding
+// back the fraction margin of its funds.
+func maxSectorsAtPrices(a modules.Allowance, margin float64, averageSectorPrice, averageContractPrice types.Currency, tp transactionPool) (uint64, error) {
+	// Calculate cost of creating contracts with each host, and the cost of
+	// storing sectors on each host. Each multiplication is checked, so that
+	// an allowance too large to price is reported instead of producing a
+	// nonsensical number of sectors.
+	costPerSector, err := averageSectorPrice.Mul64Checked(a.Hosts)
+	if err != nil {
+		return 0, errCostOverflow("storage price for all hosts")
+	}
+	costPerSector, err = costPerSector.Mul64Checked(modules.SectorSize)
+	if err != nil {
+		return 0, errCostOverflow("storage price per sector")
+	}
+	costPerSector, err = costPerSector.Mul64Checked(uint64(a.Period))
+	if err != nil {
+		return 0, errCostOverflow("storage price for the period")
+	}
+	costForContracts, err := averageContractPrice.Mul64Checked(a.Hosts)
+	if err != nil {
+		return 0, errCostOverflow("contract price for all hosts")
 	}
-	averageSectorPrice := sectorSum.Div64(uint64(len(hosts)))
-	averageContractPrice := contractCostSum.Div64(uint64(len(hosts)))
-	costPerSector := averageSectorPrice.Mul64(a.Hosts).Mul64(modules.SectorSize).Mul64(uint64(a.Period))
-	costForContracts := averageContractPrice.Mul64(a.Hosts)
 
 	// Subtract fees for creating the file contracts from the allowance.
 	_, feeEstimation := tp.FeeEstimation()
-	costForTxnFees := types.NewCurrency64(estimatedFileContractTransactionSize).Mul(feeEstimation).Mul64(a.Hosts)
+	costForTxnFees, err := feeEstimation.Mul64Checked(estimatedFileContractTransactionSize)
+	if err == nil {
+		costForTxnFees, err = costForTxnFees.Mul64Checked(a.Hosts)
+	}
+	if err != nil {
+		return 0, errCostOverflow("transaction fees for all hosts")
+	}
+	// Hold back the safety margin.
+	reserved := a.Funds.MulFloat(margin)
 	// Check for potential divide by zero
-	if a.Funds.Cmp(costForTxnFees.Add(costForContracts)) <= 0 {
+	if a.Funds.Cmp(costForTxnFees.Add(costForContracts).Add(reserved)) <= 0 {
 		return 0, ErrInsufficientAllowance
 	}
-	sectorFunds := a.Funds.Sub(costForTxnFees).Sub(costForContracts)
+	sectorFunds := a.Funds.Sub(costForTxnFees).Sub(costForContracts).Sub(reserved)
 
 	// Divide total funds by cost per sector.
 	numSectors, err := sectorFunds.Div(costPerSector).Uint64()
 	if err != nil {
-		return 0, errors.New("error when totaling number of sectors that can be bought with an allowance: " + err.Error())
+		return 0, errCostOverflow("number of sectors")
 	}
 	return numSectors, nil
 }
 
-// managedNewContract negotiates an initial file contract with the specified
-// host, saves it, and returns it.
-func (c *Contractor) managedNewContract(host modules.HostDBEntry, numSectors uint64, endHeight types.BlockHeight) (modules.RenterContract, error) {
-	// reject hosts that are too expensive
-	if host.StoragePrice.Cmp(maxStoragePrice) > 0 {
-		return modules.RenterContract{}, errTooExpensive
+// sampleHosts returns a random sample of hosts from the hostdb to use for
+// price estimations. At least minHostsForEstimations hosts are sampled, and an
+// error is returned if the hostdb has fewer than numHosts hosts.
+func sampleHosts(hdb hostDB, numHosts uint64) ([]modules.HostDBEntry, error) {
+	nRandomHosts := int(numHosts)
+	if nRandomHosts < minHostsForEstimations {
+		nRandomHosts = minHostsForEstimations
+	}
+	hosts := hdb.RandomHosts(nRandomHosts, nil)
+	if len(hosts) < int(numHosts) {
+		return nil, fmt.Errorf("not enough hosts in hostdb for sector calculation, got %v but needed %v", len(hosts), int(numHosts))
+	}
+	return hosts, nil
+}
+
+// averagePrices returns the average storage price and contract price of the
+// provided hosts.
+func averagePrices(hosts []modules.HostDBEntry) (storagePrice, contractPrice types.Currency) {
+	if len(hosts) == 0 {
+		return types.ZeroCurrency, types.ZeroCurrency
+	}
+	var storageSum, contractSum types.Currency
+	for _, h := range hosts {
+		storageSum = storageSum.Add(h.StoragePrice)
+		contractSum = contractSum.Add(h.ContractPrice)
+	}
+	return storageSum.Div64(uint64(len(hosts))), contractSum.Div64(uint64(len(hosts)))
+}
+
+// checkHostPrice rejects hosts whose storage price exceeds maxPrice, or
+// maxStoragePrice if maxPrice is zero. The returned host has its
+// MaxCollateral capped to maxCollateral.
+func checkHostPrice(host modules.HostDBEntry, maxPrice types.Currency) (modules.HostDBEntry, error) {
+	if maxPrice.IsZero() {
+		maxPrice = maxStoragePrice
+	}
+	if host.StoragePrice.Cmp(maxPrice) > 0 {
+		return modules.HostDBEntry{}, errTooExpensive
 	}
-	// cap host.MaxCollateral
 	if host.MaxCollateral.Cmp(maxCollateral) > 0 {
 		host.MaxCollateral = maxCollateral
 	}
+	return host, nil
+}
+
+// managedNewContract negotiates an initial file contract with the specified
+// host, saves it, and returns it. Hosts whose storage price exceeds maxPrice
+// are rejected; if maxPrice is zero, maxStoragePrice is used instead.
+func (c *Contractor) managedNewContract(host modules.HostDBEntry, numSectors uint64, endHeight types.BlockHeight, maxPrice types.Currency) (modules.RenterContract, error) {
+	// if the host has announced itself since its settings were read, the
+	// price may have changed
+	if refreshed, ok := c.hdb.RefreshHost(host.NetAddress); ok && refreshed.SettingsEpoch != host.SettingsEpoch {
+		host = refreshed
+	}
+	host, err := checkHostPrice(host, maxPrice)
+	if err != nil {
+		return modules.RenterContract{}, err
+	}
 
 	// get an address to use for negotiation
-	uc, err := c.wallet.NextAddress()
+	refundAddress, err := c.managedNegotiationAddress()
 	if err != nil {
 		return modules.RenterContract{}, err
 	}
 
 	// create contract params
+	var metrics modules.NegotiationMetrics
 	c.mu.RLock()
 	params := proto.ContractParams{
 		Host:          host,
 		Filesize:      numSectors * modules.SectorSize,
 		StartHeight:   c.blockHeight,
 		EndHeight:     endHeight,
-		RefundAddress: uc.UnlockHash(),
+		RefundAddress: refundAddress,
+		Timeouts:      c.timeouts,
+		MaxTxnSetSize: c.maxTxnSetSize,
+		Metrics:       &metrics,
+		Dialer:        c.dialer,
+		LocalAddr:     c.localAddr,
 	}
 	c.mu.RUnlock()
 
-	// create transaction builder
+	// create transaction builder. Unless the contract is formed, the builder
+	// is dropped, returning any inputs it funded to the wallet.
 	txnBuilder := c.wallet.StartTransaction()
+	formed := false
+	defer func() {
+		if !formed {
+			txnBuilder.Drop()
+		}
+	}()
 
 	contract, err := proto.FormContract(params, txnBuilder, c.tpool)
 	if err != nil {
-		txnBuilder.Drop()
+		c.managedReturnAddress(refundAddress)
+		c.managedUpdateHostSettings(err)
 		return modules.RenterContract{}, err
 	}
+	formed = true
+	c.managedResetAddressReuses()
+
+	c.mu.Lock()
+	c.metrics[contract.ID] = metrics
+	c.mu.Unlock()
 
 	contractValue := contract.RenterFunds()
 	c.log.Printf("Formed contract with %v for %v SC", host.NetAddress, contractValue.Div(types.SiacoinPrecision))
@@ -118,56 +237,205 @@ func (c *Contractor) managedNewContract(host modules.HostDBEntry, numSectors uin
 }
 
 // managedFormContracts forms contracts with n hosts using the allowance
-// parameters.
-func (c *Contractor) managedFormContracts(n int, numSectors uint64, endHeight types.BlockHeight) ([]modules.RenterContract, error) {
+// parameters. If negotiation fails with some of the sampled hosts, additional
+// hosts are requested from the hostdb until n contracts have been formed or
+// the attempt limit is reached. If fewer than n contracts could be formed,
+// the formed contracts are returned along with an error.
+func (c *Contractor) managedFormContracts(n int, numSectors uint64, endHeight types.BlockHeight, maxPrice types.Currency) ([]modules.RenterContract, error) {
 	if n <= 0 {
 		return nil, nil
 	}
-
-	// Sample at least 10 hosts.
-	nRandomHosts := 2 * n
-	if nRandomHosts < 10 {
-		nRandomHosts = 10
+	// Every negotiation needs an address and funds from the wallet, so fail
+	// once up front rather than once per host.
+	if !c.wallet.Unlocked() {
+		return nil, ErrWalletLocked
 	}
-	// Don't select from hosts we've already formed contracts with
-	c.mu.RLock()
-	var exclude []modules.NetAddress
-	for _, contract := range c.contracts {
-		exclude = append(exclude, contract.NetAddress)
+	hosts, exclude, err := c.managedCandidateHosts(n)
+	if err != nil {
+		return nil, err
 	}
+
+	// Cap the total number of negotiation attempts so that a hostdb full of
+	// bad hosts cannot keep us looping forever. The cap follows the sample
+	// size rather than n, so that a single contract can still be formed when
+	// the whole initial sample is unreachable.
+	c.mu.RLock()
+	maxAttempts := maxFormationAttempts * c.formationSampleSize(n)
 	c.mu.RUnlock()
-	hosts := c.hdb.RandomHosts(nRandomHosts, exclude)
-	if len(hosts) < n {
-		return nil, fmt.Errorf("not enough hosts in hostdb for contract formation, got %v but needed %v", len(hosts), n)
-	}
 
 	var contracts []modules.RenterContract
 	var errs []string
-	for _, h := range hosts {
-		contract, err := c.managedNewContract(h, numSectors, endHeight)
-		if err != nil {
-			errs = append(errs, fmt.Sprintf("\t%v: %v", h.NetAddress, err))
-			continue
-		}
-		contracts = append(contracts, contract)
-		if len(contracts) >= n {
-			break
+	attempts := 0
+	for len(contracts) < n && attempts < maxAttempts && len(hosts) > 0 {
+		for _, h := range hosts {
+			if len(contracts) >= n || attempts >= maxAttempts {
+				break
+			}
+			attempts++
+			// don't try this host again if we need more candidates
+			exclude = append(exclude, h.NetAddress)
+			contract, err := c.managedNewContract(h, numSectors, endHeight, maxPrice)
+			if err != nil {
+				if err == errTooExpensive {
+					c.managedDebugf("skipped host %v: storage price %v exceeds the maximum", h.NetAddress, h.StoragePrice)
+				} else {
+					c.managedDebugf("negotiation with host %v failed: %v", h.NetAddress, err)
+				}
+				errs = append(errs, fmt.Sprintf("\t%v: %v", h.NetAddress, err))
+				c.mu.Lock()
+				c.recordFailure(h.NetAddress, err)
+				c.mu.Unlock()
+				continue
+			}
+			contracts = append(contracts, contract)
+			if len(contracts) < n && build.Release != "testing" {
+				// sleep for 1 minute to alleviate potential block propagation issues
+				time.Sleep(60 * time.Second)
+			}
 		}
-		if build.Release != "testing" {
-			// sleep for 1 minute to alleviate potential block propagation issues
-			time.Sleep(60 * time.Second)
+		if len(contracts) < n {
+			// request fresh candidates, excluding every host tried so far
+			c.mu.RLock()
+			used := c.usedSubnets()
+			c.mu.RUnlock()
+			for _, contract := range contracts {
+				used[hostSubnet(contract.NetAddress)] = struct{}{}
+			}
+			hosts = diversifyHosts(c.hdb.RandomHosts(n-len(contracts), exclude), used)
+			c.managedDebugf("resampled %v candidate hosts for %v remaining contracts: %v", len(hosts), n-len(contracts), hostAddresses(hosts))
 		}
 	}
-	// If we couldn't form any contracts, return an error. Otherwise, just log
-	// the failures.
-	// TODO: is there a better way to handle failure here? Should we prefer an
-	// all-or-nothing approach? We can't pick new hosts to negotiate with
-	// because they'll probably be more expensive than we can afford.
-	if len(contracts) == 0 {
-		return nil, errors.New("could not form any contracts:\n" + strings.Join(errs, "\n"))
-	} else if len(contracts) < n {
-		c.log.Printf("WARN: failed to form desired number of contracts (wanted %v, got %v):\n%v", n, len(contracts), strings.Join(errs, "\n"))
+	if len(contracts) < n {
+		return contracts, fmt.Errorf("failed to form desired number of contracts (wanted %v, got %v):\n%v", n, len(contracts), strings.Join(errs, "\n"))
 	}
 
 	return contracts, nil
 }
+
+// SetHostSampleMultiplier sets the multiple of the number of desired
+// contracts that is sampled from the hostdb when forming contracts. Sampling
+// more hosts makes it more likely that enough affordable hosts are found when
+// many hosts are overpriced. The multiplier must be at least 1.
+func (c *Contractor) SetHostSampleMultiplier(m int) error {
+	if m < 1 {
+		return errBadSampleMultiplier
+	}
+	c.mu.Lock()
+	c.oversampling = m
+	c.mu.Unlock()
+	return nil
+}
+
+// SetFundingMargin sets the fraction of the allowance that is held back when
+// calculating how much data each contract can store. The margin leaves
+// headroom for transaction fees and for hosts raising their prices during the
+// period. It must be between 0 and maxFundingMargin. The margin is persisted.
+func (c *Contractor) SetFundingMargin(m float64) error {
+	if m < 0 || m > maxFundingMargin {
+		return errBadFundingMargin
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fundingMargin = m
+	return c.saveSync()
+}
+
+// FundingMargin returns the fraction of the allowance that is held back when
+// sizing contracts.
+func (c *Contractor) FundingMargin() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.fundingMargin
+}
+
+// ReservedFunds returns the amount of the current allowance that is held back
+// by the funding margin.
+func (c *Contractor) ReservedFunds() types.Currency {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.allowance.Funds.MulFloat(c.fundingMargin)
+}
+
+// SetBandwidthReserve sets the fraction of the allowance that is held back for
+// upload and download costs when calculating how much data each contract can
+// store. Without the reserve, contracts with hosts that charge for bandwidth
+// may use up the allowance on storage, leaving nothing to transfer the data
+// with. The reserve is only held back if the hosts charge for bandwidth. It
+// must be between 0 and maxBandwidthReserve. The reserve is persisted.
+func (c *Contractor) SetBandwidthReserve(r float64) error {
+	if r < 0 || r > maxBandwidthReserve {
+		return errBadBandwidthReserve
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bandwidthShare = r
+	return c.saveSync()
+}
+
+// BandwidthShare returns the fraction of the allowance that is held back for
+// upload and download costs, as set by SetBandwidthReserve.
+func (c *Contractor) BandwidthShare() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.bandwidthShare
+}
+
+// BandwidthReserve returns the amount of the allowance that was held back for
+// upload and download costs when the current contracts were sized. It is zero
+// if none of the sampled hosts charged for bandwidth.
+func (c *Contractor) BandwidthReserve() types.Currency {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.bandwidthHeld
+}
+
+// formationSampleSize returns the number of hosts sampled from the hostdb
+// when forming n contracts. The caller must hold c.mu.
+func (c *Contractor) formationSampleSize(n int) int {
+	nRandomHosts := c.oversampling * n
+	if nRandomHosts < minFormationSampleSize {
+		nRandomHosts = minFormationSampleSize
+	}
+	return nRandomHosts
+}
+
+// managedCandidateHosts returns the hosts that managedFormContracts will try
+// to form n contracts with, along with the hosts that were excluded from the
+// selection. Hosts in subnets that no existing contract is in are ordered
+// first.
+func (c *Contractor) managedCandidateHosts(n int) (hosts []modules.HostDBEntry, exclude []modules.NetAddress, err error) {
+	// Don't select from hosts we've already formed contracts with, or from
+	// hosts that recently failed to form a contract. The recently failed
+	// hosts are only excluded if there are enough other hosts.
+	c.mu.Lock()
+	nRandomHosts := c.formationSampleSize(n)
+	for _, contract := range c.contracts {
+		exclude = append(exclude, contract.NetAddress)
+	}
+	failed := c.recentlyFailedHosts()
+	used := c.usedSubnets()
+	c.mu.Unlock()
+	hosts = c.hdb.RandomHosts(nRandomHosts, append(exclude, failed...))
+	if len(hosts) < n && len(failed) > 0 {
+		c.managedDebugf("only %v hosts available without the %v recently failed hosts; including them", len(hosts), len(failed))
+		hosts = c.hdb.RandomHosts(nRandomHosts, exclude)
+	}
+	if len(hosts) < n {
+		return nil, nil, fmt.Errorf("not enough hosts in hostdb for contract formation, got %v but needed %v", len(hosts), n)
+	}
+
+	// Prefer hosts in subnets that we don't have a contract in yet, so that
+	// the contracts don't all depend on the same infrastructure.
+	hosts = diversifyHosts(hosts, used)
+	c.managedDebugf("sampled %v candidate hosts for %v contracts: %v", len(hosts), n, hostAddresses(hosts))
+	return hosts, exclude, nil
+}
+
+// hostAddresses returns the addresses of hosts.
+func hostAddresses(hosts []modules.HostDBEntry) []modules.NetAddress {
+	addrs := make([]modules.NetAddress, len(hosts))
+	for i, h := range hosts {
+		addrs[i] = h.NetAddress
+	}
+	return addrs
+}
@@ -0,0 +1,341 @@
+package contractor
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestFormContractsWalletLocked tests that managedFormContracts fails with
+// ErrWalletLocked before contacting any host if the wallet is locked.
+func TestFormContractsWalletLocked(t *testing.T) {
+	hosts := make([]modules.HostDBEntry, 4)
+	for i := range hosts {
+		hosts[i].NetAddress = modules.NetAddress(fmt.Sprintf("host%v:1234", i))
+	}
+	hdb := &fakeDeps{hosts: hosts}
+	w := &fakeDeps{locked: true}
+	c := &Contractor{
+		hdb:          hdb,
+		wallet:       w,
+		oversampling: defaultSampleMultiplier,
+		failedHosts:  make(map[modules.NetAddress]modules.HostFailure),
+	}
+
+	contracts, err := c.managedFormContracts(2, 1, 100, types.ZeroCurrency)
+	if err != ErrWalletLocked {
+		t.Fatal("expected ErrWalletLocked, got", err)
+	}
+	if len(contracts) != 0 {
+		t.Fatal("expected no contracts to be formed, got", len(contracts))
+	}
+	if len(hdb.requested) != 0 {
+		t.Fatal("hosts were sampled from the hostdb:", hdb.requested)
+	}
+	if w.walletCalls != 0 {
+		t.Fatal("the wallet was used", w.walletCalls, "times")
+	}
+	if len(c.failedHosts) != 0 {
+		t.Fatal("hosts were blamed for the locked wallet:", c.failedHosts)
+	}
+}
+
+// TestFormContractsDebugLog tests that host selection decisions are only
+// logged when the log verbosity is VerbosityDebug.
+func TestFormContractsDebugLog(t *testing.T) {
+	var a, b modules.HostDBEntry
+	a.NetAddress = "a:1234"
+	a.StoragePrice = types.NewCurrency64(100)
+	b.NetAddress = "b:1234"
+	b.StoragePrice = types.NewCurrency64(100)
+	var buf bytes.Buffer
+	c := &Contractor{
+		hdb:          &fakeDeps{hosts: []modules.HostDBEntry{a, b}},
+		log:          persist.NewLogger(&buf),
+		wallet:       &fakeDeps{},
+		oversampling: defaultSampleMultiplier,
+		failedHosts:  make(map[modules.NetAddress]modules.HostFailure),
+	}
+	if err := c.SetLogVerbosity(VerbosityDebug + 1); err != errBadVerbosity {
+		t.Fatal("expected errBadVerbosity, got", err)
+	}
+
+	// By default, no selection decisions are logged.
+	c.managedFormContracts(1, 0, 0, types.NewCurrency64(1))
+	if strings.Contains(buf.String(), "DEBUG") {
+		t.Fatal("debug messages were logged at the default verbosity:\n", buf.String())
+	}
+
+	if err := c.SetLogVerbosity(VerbosityDebug); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	c.failedHosts = make(map[modules.NetAddress]modules.HostFailure)
+	c.managedFormContracts(1, 0, 0, types.NewCurrency64(1))
+	for _, msg := range []string{
+		"DEBUG: sampled 2 candidate hosts for 1 contracts",
+		"DEBUG: skipped host a:1234: storage price 100 exceeds the maximum",
+		"DEBUG: skipped host b:1234: storage price 100 exceeds the maximum",
+	} {
+		if !strings.Contains(buf.String(), msg) {
+			t.Errorf("log does not contain %q:\n%v", msg, buf.String())
+		}
+	}
+}
+
+// TestFormContractsAttemptLimit tests that managedFormContracts stops after
+// negotiating with maxFormationAttempts times the host sample size.
+func TestFormContractsAttemptLimit(t *testing.T) {
+	hosts := make([]modules.HostDBEntry, 200)
+	for i := range hosts {
+		hosts[i].NetAddress = modules.NetAddress(fmt.Sprintf("host%v:1234", i))
+		hosts[i].StoragePrice = types.NewCurrency64(100)
+	}
+	c := &Contractor{
+		hdb:          &fakeDeps{hosts: hosts},
+		wallet:       &fakeDeps{},
+		oversampling: 10,
+		failedHosts:  make(map[modules.NetAddress]modules.HostFailure),
+	}
+
+	const n = 2
+	contracts, err := c.managedFormContracts(n, 0, 0, types.NewCurrency64(1))
+	if err == nil || len(contracts) != 0 {
+		t.Fatal("expected no contracts to be formed, got", len(contracts), err)
+	}
+	if attempts := maxFormationAttempts * c.formationSampleSize(n); len(c.failedHosts) != attempts {
+		t.Fatalf("expected %v negotiation attempts, got %v", attempts, len(c.failedHosts))
+	}
+}
+
+// TestSetHostSampleMultiplier tests that the host sample multiplier controls
+// how many candidate hosts are requested from the hostdb.
+func TestSetHostSampleMultiplier(t *testing.T) {
+	hdb := &fakeDeps{hosts: make([]modules.HostDBEntry, 100)}
+	c := &Contractor{
+		hdb:          hdb,
+		oversampling: defaultSampleMultiplier,
+	}
+
+	if err := c.SetHostSampleMultiplier(0); err != errBadSampleMultiplier {
+		t.Fatal("expected errBadSampleMultiplier, got", err)
+	}
+
+	// By default, twice the number of desired hosts is sampled.
+	if _, _, err := c.managedCandidateHosts(8); err != nil {
+		t.Fatal(err)
+	}
+	if len(hdb.requested) != 1 || hdb.requested[0] != 16 {
+		t.Fatal("expected 16 hosts to be requested, got", hdb.requested)
+	}
+
+	// A higher multiplier should request more hosts.
+	if err := c.SetHostSampleMultiplier(5); err != nil {
+		t.Fatal(err)
+	}
+	hdb.requested = nil
+	if _, _, err := c.managedCandidateHosts(8); err != nil {
+		t.Fatal(err)
+	}
+	if len(hdb.requested) != 1 || hdb.requested[0] != 40 {
+		t.Fatal("expected 40 hosts to be requested, got", hdb.requested)
+	}
+
+	// The sample size never drops below minFormationSampleSize.
+	if err := c.SetHostSampleMultiplier(1); err != nil {
+		t.Fatal(err)
+	}
+	hdb.requested = nil
+	if _, _, err := c.managedCandidateHosts(2); err != nil {
+		t.Fatal(err)
+	}
+	if len(hdb.requested) != 1 || hdb.requested[0] != minFormationSampleSize {
+		t.Fatalf("expected %v hosts to be requested, got %v", minFormationSampleSize, hdb.requested)
+	}
+}
+
+// TestFundingMargin tests that increasing the funding margin reduces the
+// number of sectors that an allowance can support.
+func TestFundingMargin(t *testing.T) {
+	c := &Contractor{
+		allowance: modules.Allowance{
+			Funds:  types.NewCurrency64(1e12),
+			Hosts:  2,
+			Period: 10,
+		},
+		fundingMargin: defaultFundingMargin,
+		persist:       new(memPersist),
+	}
+	for _, m := range []float64{-0.1, maxFundingMargin + 0.1} {
+		if err := c.SetFundingMargin(m); err != errBadFundingMargin {
+			t.Errorf("expected %q for %v, got %v", errBadFundingMargin, m, err)
+		}
+	}
+
+	sectorPrice, contractPrice := types.NewCurrency64(1), types.NewCurrency64(1000)
+	var prev uint64
+	for i, m := range []float64{0, defaultFundingMargin, 0.2, maxFundingMargin} {
+		if err := c.SetFundingMargin(m); err != nil {
+			t.Fatal(err)
+		}
+		numSectors, err := maxSectorsAtPrices(c.allowance, c.fundingMargin, sectorPrice, contractPrice, &fakeDeps{fee: types.NewCurrency64(2)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && numSectors >= prev {
+			t.Errorf("margin %v should support fewer than %v sectors, got %v", m, prev, numSectors)
+		}
+		prev = numSectors
+
+		if reserved := c.ReservedFunds(); !reserved.Equals(c.allowance.Funds.MulFloat(m)) {
+			t.Errorf("margin %v reserved %v of %v", m, reserved, c.allowance.Funds)
+		}
+	}
+
+	// A margin that leaves nothing for storage should be rejected.
+	a := c.allowance
+	a.Funds = types.NewCurrency64(10000)
+	if _, err := maxSectorsAtPrices(a, 0, sectorPrice, contractPrice, &fakeDeps{fee: types.NewCurrency64(2)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := maxSectorsAtPrices(a, maxFundingMargin, sectorPrice, contractPrice, &fakeDeps{fee: types.NewCurrency64(2)}); err != ErrInsufficientAllowance {
+		t.Fatal("expected ErrInsufficientAllowance, got", err)
+	}
+}
+
+// TestBandwidthReserve tests that holding back part of the allowance for
+// bandwidth reduces the number of sectors that an allowance can support, but
+// only if the hosts charge for bandwidth, and that BandwidthReserve reports the
+// amount that was actually held back.
+func TestBandwidthReserve(t *testing.T) {
+	hosts := []modules.HostDBEntry{{}, {}}
+	for i := range hosts {
+		hosts[i].StoragePrice = types.NewCurrency64(1)
+		hosts[i].ContractPrice = types.NewCurrency64(1000)
+	}
+	hdb := &fakeDeps{hosts: hosts, fee: types.NewCurrency64(2)}
+	c := &Contractor{
+		cs:      newStub{},
+		hdb:     hdb,
+		persist: new(memPersist),
+		tpool:   hdb,
+	}
+	a := modules.Allowance{
+		Funds:       types.NewCurrency64(1e12),
+		Hosts:       2,
+		Period:      10,
+		RenewWindow: 5,
+	}
+	for _, r := range []float64{-0.1, maxBandwidthReserve + 0.1} {
+		if err := c.SetBandwidthReserve(r); err != errBadBandwidthReserve {
+			t.Errorf("expected %q for %v, got %v", errBadBandwidthReserve, r, err)
+		}
+	}
+	if err := c.SetBandwidthReserve(defaultBandwidthReserve); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hosts that don't charge for bandwidth should not be affected by the
+	// reserve.
+	without, _, err := maxSectors(a, 0, 0, hdb, hdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	with, held, err := maxSectors(a, 0, defaultBandwidthReserve, hdb, hdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if with != without || held != 0 {
+		t.Errorf("reserve should not apply to free bandwidth: %v sectors with reserve, %v without, %v held", with, without, held)
+	}
+	if _, reserved, err := c.managedAllowanceSectors(a); err != nil {
+		t.Fatal(err)
+	} else if !reserved.IsZero() {
+		t.Error("nothing should be reserved for free bandwidth, got", reserved)
+	}
+
+	// Once the hosts charge for bandwidth, the reserve should reduce the
+	// number of sectors.
+	hosts[0].UploadBandwidthPrice = types.NewCurrency64(1)
+	hosts[1].DownloadBandwidthPrice = types.NewCurrency64(1)
+	with, held, err = maxSectors(a, 0, defaultBandwidthReserve, hdb, hdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if with >= without || held != defaultBandwidthReserve {
+		t.Errorf("expected fewer than %v sectors with a bandwidth reserve, got %v with %v held", without, with, held)
+	}
+	if _, reserved, err := c.managedAllowanceSectors(a); err != nil {
+		t.Fatal(err)
+	} else if !reserved.Equals(a.Funds.MulFloat(defaultBandwidthReserve)) {
+		t.Errorf("reserve %v held back %v of %v", defaultBandwidthReserve, reserved, a.Funds)
+	}
+
+	// BandwidthReserve should report the amount held back when the current
+	// contracts were sized, not the configured fraction.
+	if reserved := c.BandwidthReserve(); !reserved.IsZero() {
+		t.Error("expected no reserve before any contracts were sized, got", reserved)
+	}
+	c.bandwidthHeld = types.NewCurrency64(5)
+	if reserved := c.BandwidthReserve(); !reserved.Equals(types.NewCurrency64(5)) {
+		t.Error("expected a reserve of 5, got", reserved)
+	}
+}
+
+// TestMaxSectorsOverflow tests that maxSectorsAtPrices reports the step of
+// the cost calculation that overflows for extreme allowances.
+func TestMaxSectorsOverflow(t *testing.T) {
+	// Currency values are limited to 256 bytes, i.e. 2048 bits. pow2(n) is
+	// 2^n.
+	pow2 := func(n uint) types.Currency {
+		return types.NewCurrency(new(big.Int).Lsh(big.NewInt(1), n))
+	}
+	one := types.NewCurrency64(1)
+	a := modules.Allowance{
+		Funds:  pow2(2047),
+		Hosts:  2,
+		Period: 10,
+	}
+	tests := []struct {
+		hosts         uint64
+		period        uint64
+		storagePrice  types.Currency
+		contractPrice types.Currency
+		fee           types.Currency
+		step          string
+	}{
+		// 2^2040 * 2^10 hosts exceeds 2048 bits.
+		{1 << 10, 10, pow2(2040), one, one, "storage price for all hosts"},
+		// 2^2046 * 2 hosts fits exactly; any sector size overflows.
+		{2, 10, pow2(2046), one, one, "storage price per sector"},
+		// The price for all hosts per sector fits exactly, and any period
+		// longer than one block overflows.
+		{2, 2, pow2(2046).Div64(modules.SectorSize), one, one, "storage price for the period"},
+		{1 << 10, 10, one, pow2(2040), one, "contract price for all hosts"},
+		{1 << 10, 10, one, one, pow2(2040), "transaction fees for all hosts"},
+		// All costs fit, but the allowance buys too many sectors to count.
+		{2, 10, one, one, one, "number of sectors"},
+	}
+	for _, test := range tests {
+		a.Hosts = test.hosts
+		a.Period = types.BlockHeight(test.period)
+		_, err := maxSectorsAtPrices(a, 0, test.storagePrice, test.contractPrice, &fakeDeps{fee: test.fee})
+		if expected := errCostOverflow(test.step); err == nil || err.Error() != expected.Error() {
+			t.Errorf("expected %q, got %v", expected, err)
+		}
+	}
+
+	// A large but reasonable allowance should not overflow.
+	a.Funds = types.SiacoinPrecision.Mul64(1e6)
+	a.Hosts = 1e3
+	a.Period = 1e6
+	if _, err := maxSectorsAtPrices(a, 0, one, one, &fakeDeps{fee: one}); err != nil {
+		t.Fatal(err)
+	}
+}
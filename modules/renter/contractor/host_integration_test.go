@@ -3,8 +3,10 @@ package contractor
 import (
 	"bytes"
 	"errors"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -195,7 +197,7 @@ func TestIntegrationFormContract(t *testing.T) {
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, types.ZeroCurrency)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -205,6 +207,470 @@ func TestIntegrationFormContract(t *testing.T) {
 	}
 }
 
+// TestIntegrationFormContractReannounced tests that the contractor re-reads
+// the settings of a host that re-announced itself before forming a contract,
+// instead of negotiating with the stale settings in the hostdb.
+func TestIntegrationFormContractReannounced(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	h, c, m, err := newTestingTrio("TestIntegrationFormContractReannounced")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// get the host's entry from the db
+	addr := h.ExternalSettings().NetAddress
+	staleEntry, ok := c.hdb.Host(addr)
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// raise the host's price well beyond the price tolerance and announce
+	// the host again
+	settings := h.InternalSettings()
+	settings.MinStoragePrice = staleEntry.StoragePrice.Mul64(2)
+	if err := h.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Announce(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.AddBlock(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if entry, _ := c.hdb.Host(addr); entry.SettingsEpoch > staleEntry.SettingsEpoch {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if entry, _ := c.hdb.Host(addr); entry.SettingsEpoch == staleEntry.SettingsEpoch {
+		t.Fatal("hostdb did not register the new announcement")
+	}
+
+	// forming a contract with the stale entry should succeed, using the new
+	// price
+	if _, err = c.managedNewContract(staleEntry, 10, c.blockHeight+100, types.ZeroCurrency); err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := c.hdb.Host(addr); !entry.StoragePrice.Equals(settings.MinStoragePrice) {
+		t.Fatal("hostdb was not updated with the host's new price:", entry.StoragePrice)
+	}
+}
+
+// dropCountingWallet wraps a wallet, counting the number of times that the
+// transaction builders it creates are dropped.
+type dropCountingWallet struct {
+	wallet
+	drops *int
+}
+
+func (w dropCountingWallet) StartTransaction() transactionBuilder {
+	return dropCountingBuilder{w.wallet.StartTransaction(), w.drops}
+}
+
+// dropCountingBuilder is a transactionBuilder that counts calls to Drop.
+type dropCountingBuilder struct {
+	transactionBuilder
+	drops *int
+}
+
+func (b dropCountingBuilder) Drop() {
+	*b.drops++
+	b.transactionBuilder.Drop()
+}
+
+// TestIntegrationFormContractDrop tests that managedNewContract drops the
+// transaction builder if and only if the contract could not be formed.
+func TestIntegrationFormContractDrop(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	h, c, _, err := newTestingTrio("TestIntegrationFormContractDrop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	var drops int
+	c.wallet = dropCountingWallet{c.wallet, &drops}
+
+	hostEntry, ok := c.hdb.Host(h.ExternalSettings().NetAddress)
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// forming a contract should not drop the builder
+	if _, err = c.managedNewContract(hostEntry, 10, c.blockHeight+100, types.ZeroCurrency); err != nil {
+		t.Fatal(err)
+	} else if drops != 0 {
+		t.Fatal("builder was dropped after forming a contract:", drops)
+	}
+
+	// an unreachable host fails after the builder has been funded, and the
+	// builder should be dropped exactly once
+	hostEntry.NetAddress = "localhost:0"
+	if _, err = c.managedNewContract(hostEntry, 10, c.blockHeight+100, types.ZeroCurrency); err == nil {
+		t.Fatal("expected an error when forming a contract with an unreachable host")
+	} else if drops != 1 {
+		t.Fatal("expected builder to be dropped once, got", drops)
+	}
+}
+
+// slowWallet wraps a wallet, creating transaction builders that take at
+// least delay to fund and to sign transactions.
+type slowWallet struct {
+	wallet
+	delay time.Duration
+}
+
+func (w slowWallet) StartTransaction() transactionBuilder {
+	return slowBuilder{w.wallet.StartTransaction(), w.delay}
+}
+
+// slowBuilder is a transactionBuilder that sleeps before funding and signing.
+type slowBuilder struct {
+	transactionBuilder
+	delay time.Duration
+}
+
+func (b slowBuilder) FundSiacoins(amount types.Currency) error {
+	time.Sleep(b.delay)
+	return b.transactionBuilder.FundSiacoins(amount)
+}
+
+func (b slowBuilder) Sign(wholeTransaction bool) ([]types.Transaction, error) {
+	time.Sleep(b.delay)
+	return b.transactionBuilder.Sign(wholeTransaction)
+}
+
+// slowTpool is a transactionPool that sleeps before accepting transactions.
+type slowTpool struct {
+	transactionPool
+	delay time.Duration
+}
+
+func (tp slowTpool) AcceptTransactionSet(txns []types.Transaction) error {
+	time.Sleep(tp.delay)
+	return tp.transactionPool.AcceptTransactionSet(txns)
+}
+
+// recordingDialer is a proto.Dialer that records the local address of each
+// connection before dialing it with proto.StdDialer.
+type recordingDialer struct {
+	localAddrs []net.Addr
+}
+
+func (d *recordingDialer) DialTimeout(addr modules.NetAddress, localAddr net.Addr, timeout time.Duration) (net.Conn, error) {
+	d.localAddrs = append(d.localAddrs, localAddr)
+	return proto.StdDialer{}.DialTimeout(addr, localAddr, timeout)
+}
+
+// TestIntegrationFormContractLocalAddress tests that managedNewContract, the
+// Editor, and the Downloader connect to the host from the address passed to
+// SetLocalAddress.
+func TestIntegrationFormContractLocalAddress(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	h, c, _, err := newTestingTrio("TestIntegrationFormContractLocalAddress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	dialer := new(recordingDialer)
+	c.dialer = dialer
+
+	hostEntry, ok := c.hdb.Host(h.ExternalSettings().NetAddress)
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// without a local address, the operating system chooses one
+	if _, err = c.managedNewContract(hostEntry, 10, c.blockHeight+100, types.ZeroCurrency); err != nil {
+		t.Fatal(err)
+	}
+	if len(dialer.localAddrs) != 1 || dialer.localAddrs[0] != nil {
+		t.Fatal("expected a single dial with no local address, got", dialer.localAddrs)
+	}
+
+	// with a local address set, the connection should originate from it
+	if err = c.SetLocalAddress("127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.managedNewContract(hostEntry, 10, c.blockHeight+100, types.ZeroCurrency); err != nil {
+		t.Fatal(err)
+	}
+	if len(dialer.localAddrs) != 2 {
+		t.Fatal("expected 2 dials, got", len(dialer.localAddrs))
+	}
+	tcpAddr, ok := dialer.localAddrs[1].(*net.TCPAddr)
+	if !ok || !tcpAddr.IP.Equal(net.ParseIP("127.0.0.1")) {
+		t.Fatal("dial did not originate from the local address:", dialer.localAddrs[1])
+	}
+
+	// the same should hold for the editor and the downloader
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.mu.Lock()
+	c.contracts[contract.ID] = contract
+	c.mu.Unlock()
+	editor, err := c.Editor(contract.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	editor.Close()
+	downloader, err := c.Downloader(contract.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloader.Close()
+	if len(dialer.localAddrs) != 5 {
+		t.Fatal("expected 5 dials, got", len(dialer.localAddrs))
+	}
+	for _, addr := range dialer.localAddrs[2:] {
+		tcpAddr, ok := addr.(*net.TCPAddr)
+		if !ok || !tcpAddr.IP.Equal(net.ParseIP("127.0.0.1")) {
+			t.Fatal("dial did not originate from the local address:", addr)
+		}
+	}
+}
+
+// TestIntegrationFormContractMetrics tests that managedNewContract records
+// the duration of each negotiation phase.
+func TestIntegrationFormContractMetrics(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	h, c, _, err := newTestingTrio("TestIntegrationFormContractMetrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// slow down funding, signing, and submitting, so that we can check that
+	// the time is attributed to the correct phases
+	const delay = 50 * time.Millisecond
+	c.wallet = slowWallet{c.wallet, delay}
+	c.tpool = slowTpool{c.tpool, delay}
+
+	hostEntry, ok := c.hdb.Host(h.ExternalSettings().NetAddress)
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+	start := time.Now()
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.mu.Lock()
+	c.contracts[contract.ID] = contract
+	c.mu.Unlock()
+	elapsed := time.Since(start)
+
+	metrics := c.NegotiationMetrics()
+	if len(metrics) != 1 {
+		t.Fatal("expected metrics for 1 contract, got", len(metrics))
+	}
+	m := metrics[0]
+	if m.ContractID != contract.ID || m.NetAddress != contract.NetAddress {
+		t.Fatal("metrics recorded for the wrong contract:", m.ContractID, m.NetAddress)
+	}
+	phases := []struct {
+		name string
+		d    time.Duration
+		min  time.Duration
+	}{
+		{"dial", m.Dial, 0},
+		{"verifysettings", m.VerifySettings, 0},
+		{"fundandsign", m.FundAndSign, 2 * delay},
+		{"exchange", m.Exchange, 0},
+		{"submit", m.Submit, delay},
+	}
+	var total time.Duration
+	for _, p := range phases {
+		if p.d <= 0 || p.d < p.min {
+			t.Errorf("implausible %v duration %v, expected at least %v", p.name, p.d, p.min)
+		}
+		total += p.d
+	}
+	if total > elapsed {
+		t.Errorf("phases took %v in total, but forming the contract took %v", total, elapsed)
+	}
+}
+
+// TestIntegrationEstimateContracts tests that EstimateContracts predicts the
+// contracts formed by SetAllowance.
+func TestIntegrationEstimateContracts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	h, c, _, err := newTestingTrio("TestIntegrationEstimateContracts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	a := modules.Allowance{
+		Funds:       types.SiacoinPrecision.Mul64(100),
+		Hosts:       1,
+		Period:      20,
+		RenewWindow: 10,
+	}
+	estimate, err := c.EstimateContracts(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Contracts()) != 0 {
+		t.Fatal("EstimateContracts formed contracts")
+	}
+	if len(estimate.Contracts) != 1 || estimate.Contracts[0].NetAddress != h.ExternalSettings().NetAddress {
+		t.Fatal("expected an estimate for the host, got", estimate.Contracts)
+	}
+
+	// form the contracts for real
+	if err = c.SetAllowance(a); err != nil {
+		t.Fatal(err)
+	}
+	contracts := c.Contracts()
+	if len(contracts) != 1 {
+		t.Fatal("expected 1 contract, got", len(contracts))
+	}
+	contract := contracts[0]
+	if contract.EndHeight() != estimate.EndHeight {
+		t.Errorf("expected end height %v, got %v", estimate.EndHeight, contract.EndHeight())
+	}
+	// the contract's cost is determined by its filesize, so the estimated
+	// filesize was used if the costs match
+	if cost := contract.TotalCost.Add(contract.TxnFee); cost.Cmp(estimate.Contracts[0].Cost) != 0 {
+		t.Errorf("expected contract to cost %v, got %v", estimate.Contracts[0].Cost, cost)
+	}
+	// a different filesize would not have produced the same cost
+	host, _ := c.hdb.Host(contract.NetAddress)
+	host, _ = checkHostPrice(host, types.ZeroCurrency)
+	cost, err := proto.ContractCost(proto.ContractParams{
+		Host:        host,
+		Filesize:    estimate.Filesize + modules.SectorSize,
+		StartHeight: contract.StartHeight,
+		EndHeight:   contract.EndHeight(),
+	}, c.tpool)
+	if err != nil {
+		t.Fatal(err)
+	} else if cost.Cmp(estimate.Contracts[0].Cost) == 0 {
+		t.Error("contract cost does not depend on the filesize")
+	}
+}
+
+// TestIntegrationFormContractMaxPrice tests that the contractor skips hosts
+// whose storage price exceeds the allowance's maximum price.
+func TestIntegrationFormContractMaxPrice(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	h, c, _, err := newTestingTrio("TestIntegrationFormContractMaxPrice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// set a cap below the host's storage price
+	hostPrice := h.ExternalSettings().StoragePrice
+	_, err = c.managedFormContracts(1, 10, c.blockHeight+100, hostPrice.Div64(2))
+	if err == nil || !strings.Contains(err.Error(), errTooExpensive.Error()) {
+		t.Fatalf("expected %q, got %v", errTooExpensive, err)
+	}
+
+	// raise the cap above the host's storage price
+	contracts, err := c.managedFormContracts(1, 10, c.blockHeight+100, hostPrice.Mul64(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contracts) != 1 || contracts[0].NetAddress != h.ExternalSettings().NetAddress {
+		t.Fatal("bad contract")
+	}
+}
+
+// unreachableHostDB wraps a hostDB, returning a set of unreachable hosts from
+// RandomHosts before any of the real hosts.
+type unreachableHostDB struct {
+	hostDB
+	bad []modules.HostDBEntry
+}
+
+func (hdb unreachableHostDB) RandomHosts(n int, exclude []modules.NetAddress) []modules.HostDBEntry {
+	excluded := make(map[modules.NetAddress]bool)
+	for _, addr := range exclude {
+		excluded[addr] = true
+	}
+	var hosts []modules.HostDBEntry
+	for _, h := range hdb.bad {
+		if len(hosts) < n && !excluded[h.NetAddress] {
+			hosts = append(hosts, h)
+		}
+	}
+	if len(hosts) < n {
+		hosts = append(hosts, hdb.hostDB.RandomHosts(n-len(hosts), exclude)...)
+	}
+	return hosts
+}
+
+// TestIntegrationFormContractsRetry tests that managedFormContracts requests
+// fresh hosts from the hostdb when negotiation with the initial sample fails.
+func TestIntegrationFormContractsRetry(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	h, c, _, err := newTestingTrio("TestIntegrationFormContractsRetry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	hostEntry, ok := c.hdb.Host(h.ExternalSettings().NetAddress)
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// fill the hostdb's initial sample with hosts that refuse connections
+	var bad []modules.HostDBEntry
+	for i := 0; i < 10; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.Close()
+		entry := hostEntry
+		entry.NetAddress = modules.NetAddress(l.Addr().String())
+		bad = append(bad, entry)
+	}
+	c.hdb = unreachableHostDB{hostDB: c.hdb, bad: bad}
+
+	contracts, err := c.managedFormContracts(1, 10, c.blockHeight+100, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contracts) != 1 || contracts[0].NetAddress != h.ExternalSettings().NetAddress {
+		t.Fatal("bad contract")
+	}
+
+	// if every host fails, an error should be returned
+	c.hdb = unreachableHostDB{hostDB: stubHostDB{}, bad: bad}
+	contracts, err = c.managedFormContracts(1, 10, c.blockHeight+100, types.ZeroCurrency)
+	if err == nil || len(contracts) != 0 {
+		t.Fatal("expected error when no contracts could be formed")
+	}
+}
+
 // TestIntegrationReviseContract tests that the contractor can revise a
 // contract previously formed with a host.
 func TestIntegrationReviseContract(t *testing.T) {
@@ -226,7 +692,7 @@ func TestIntegrationReviseContract(t *testing.T) {
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, types.ZeroCurrency)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -274,7 +740,7 @@ func TestIntegrationUploadDownload(t *testing.T) {
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, types.ZeroCurrency)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -318,6 +784,67 @@ func TestIntegrationUploadDownload(t *testing.T) {
 	}
 }
 
+// TestIntegrationUploadRefundPayments tests that a host accepts an upload
+// revision that refunds the renter's payment on a missed proof.
+func TestIntegrationUploadRefundPayments(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	// create testing trio
+	h, c, _, err := newTestingTrio("TestIntegrationUploadRefundPayments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if err := c.SetMissedProofPolicy(proto.RefundPayments); err != nil {
+		t.Fatal(err)
+	}
+
+	// get the host's entry from the db
+	hostEntry, ok := c.hdb.Host(h.ExternalSettings().NetAddress)
+	if !ok {
+		t.Fatal("no entry for host in db")
+	}
+
+	// form a contract with the host
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.mu.Lock()
+	c.contracts[contract.ID] = contract
+	c.mu.Unlock()
+
+	// revise the contract
+	editor, err := c.Editor(contract.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := crypto.RandBytes(int(modules.SectorSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = editor.Upload(data); err != nil {
+		t.Fatal(err)
+	}
+	if err = editor.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the renter paid the host, but keeps its full missed proof output
+	c.mu.RLock()
+	revised := c.contracts[contract.ID]
+	c.mu.RUnlock()
+	oldRev, newRev := contract.LastRevision, revised.LastRevision
+	if newRev.NewValidProofOutputs[0].Value.Cmp(oldRev.NewValidProofOutputs[0].Value) >= 0 {
+		t.Fatal("renter did not pay for the upload")
+	}
+	if !newRev.NewMissedProofOutputs[0].Value.Equals(oldRev.NewMissedProofOutputs[0].Value) {
+		t.Fatal("renter's missed proof output changed:", oldRev.NewMissedProofOutputs[0].Value, newRev.NewMissedProofOutputs[0].Value)
+	}
+}
+
 // TestIntegrationDelete tests that the contractor can delete a sector from a
 // contract previously formed with a host.
 func TestIntegrationDelete(t *testing.T) {
@@ -339,7 +866,7 @@ func TestIntegrationDelete(t *testing.T) {
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, types.ZeroCurrency)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -404,7 +931,7 @@ func TestIntegrationInsertDelete(t *testing.T) {
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, types.ZeroCurrency)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -464,7 +991,7 @@ func TestIntegrationModify(t *testing.T) {
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, types.ZeroCurrency)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -531,7 +1058,7 @@ func TestIntegrationRenew(t *testing.T) {
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, types.ZeroCurrency)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -557,10 +1084,23 @@ func TestIntegrationRenew(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	// the upload should be accounted for
+	c.mu.RLock()
+	err = c.validateSpending()
+	c.mu.RUnlock()
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	// renew the contract
+	// renewing should fail if the host is more expensive than the cap
 	oldContract := c.contracts[contract.ID]
-	contract, err = c.managedRenew(oldContract, modules.SectorSize*10, c.blockHeight+200)
+	_, err = c.managedRenew(oldContract, modules.SectorSize*10, c.blockHeight+200, hostEntry.StoragePrice.Div64(2))
+	if err != errTooExpensive {
+		t.Fatalf("expected %q, got %v", errTooExpensive, err)
+	}
+
+	// renew the contract
+	contract, err = c.managedRenew(oldContract, modules.SectorSize*10, c.blockHeight+200, types.ZeroCurrency)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -599,10 +1139,17 @@ func TestIntegrationRenew(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	// the renewal and download should be accounted for
+	c.mu.RLock()
+	err = c.validateSpending()
+	c.mu.RUnlock()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// renew to a lower height
 	oldContract = c.contracts[contract.ID]
-	contract, err = c.managedRenew(oldContract, modules.SectorSize*10, c.blockHeight+100)
+	contract, err = c.managedRenew(oldContract, modules.SectorSize*10, c.blockHeight+100, types.ZeroCurrency)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -658,7 +1205,7 @@ func TestIntegrationResync(t *testing.T) {
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, types.ZeroCurrency)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -796,7 +1343,7 @@ func TestIntegrationDownloaderCaching(t *testing.T) {
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, types.ZeroCurrency)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -889,7 +1436,7 @@ func TestIntegrationEditorCaching(t *testing.T) {
 	}
 
 	// form a contract with the host
-	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100)
+	contract, err := c.managedNewContract(hostEntry, 10, c.blockHeight+100, types.ZeroCurrency)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -959,3 +1506,62 @@ func TestIntegrationEditorCaching(t *testing.T) {
 	}
 	d4.Close()
 }
+
+// TestIntegrationCachedAddress tests that the address obtained for a failed
+// negotiation is reused by the next negotiation, and forgotten once a
+// negotiation succeeds.
+func TestIntegrationCachedAddress(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	h, c, _, err := newTestingTrio("TestIntegrationCachedAddress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	host, ok := c.hdb.Host(h.ExternalSettings().NetAddress)
+	if !ok {
+		t.Fatal("host is not in the hostdb")
+	}
+	unreachable := host
+	unreachable.NetAddress = "127.0.0.1:1"
+
+	if held, _ := c.CachedAddress(); held {
+		t.Fatal("no address should be cached before any negotiation")
+	}
+
+	// a failed negotiation should leave its address cached
+	if _, err := c.managedNewContract(unreachable, 10, c.blockHeight+100, types.ZeroCurrency); err == nil {
+		t.Fatal("expected negotiation with an unreachable host to fail")
+	}
+	if held, reuses := c.CachedAddress(); !held || reuses != 0 {
+		t.Fatalf("expected a cached address with 0 reuses, got %v, %v", held, reuses)
+	}
+	c.mu.RLock()
+	addr := c.cachedAddress
+	c.mu.RUnlock()
+
+	// the next negotiation should reuse it
+	if _, err := c.managedNewContract(unreachable, 10, c.blockHeight+100, types.ZeroCurrency); err == nil {
+		t.Fatal("expected negotiation with an unreachable host to fail")
+	}
+	if held, reuses := c.CachedAddress(); !held || reuses != 1 {
+		t.Fatalf("expected a cached address with 1 reuse, got %v, %v", held, reuses)
+	}
+	c.mu.RLock()
+	reused := c.cachedAddress
+	c.mu.RUnlock()
+	if reused != addr {
+		t.Fatal("cached address was not reused")
+	}
+
+	// a successful negotiation should clear the cached address
+	if _, err := c.managedNewContract(host, 10, c.blockHeight+100, types.ZeroCurrency); err != nil {
+		t.Fatal(err)
+	}
+	if held, reuses := c.CachedAddress(); held || reuses != 0 {
+		t.Fatalf("expected the cached address to be cleared, got %v, %v", held, reuses)
+	}
+}
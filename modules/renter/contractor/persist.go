@@ -1,7 +1,10 @@
 package contractor
 
 import (
+	"io"
+
 	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
@@ -9,11 +12,15 @@ import (
 // contractorPersist defines what Contractor data persists across sessions.
 type contractorPersist struct {
 	Allowance       modules.Allowance
+	BandwidthHeld   types.Currency
+	BandwidthShare  float64
 	BlockHeight     types.BlockHeight
 	CachedRevisions []cachedRevision
 	Contracts       []modules.RenterContract
 	CurrentPeriod   types.BlockHeight
+	FundingMargin   float64
 	LastChange      modules.ConsensusChangeID
+	MaxHosts        uint64
 	OldContracts    []modules.RenterContract
 	RenewedIDs      map[string]string
 
@@ -29,11 +36,15 @@ type contractorPersist struct {
 // persistData returns the data in the Contractor that will be saved to disk.
 func (c *Contractor) persistData() contractorPersist {
 	data := contractorPersist{
-		Allowance:     c.allowance,
-		BlockHeight:   c.blockHeight,
-		CurrentPeriod: c.currentPeriod,
-		LastChange:    c.lastChange,
-		RenewedIDs:    make(map[string]string),
+		Allowance:      c.allowance,
+		BandwidthHeld:  c.bandwidthHeld,
+		BandwidthShare: c.bandwidthShare,
+		BlockHeight:    c.blockHeight,
+		CurrentPeriod:  c.currentPeriod,
+		FundingMargin:  c.fundingMargin,
+		LastChange:     c.lastChange,
+		MaxHosts:       c.maxHosts,
+		RenewedIDs:     make(map[string]string),
 	}
 	for _, rev := range c.cachedRevisions {
 		data.CachedRevisions = append(data.CachedRevisions, rev)
@@ -52,12 +63,21 @@ func (c *Contractor) persistData() contractorPersist {
 
 // load loads the Contractor persistence data from disk.
 func (c *Contractor) load() error {
-	var data contractorPersist
+	// COMPATv1.1.0
+	// Persist files written before the limits were stored do not contain
+	// them, so start from the current values to keep the defaults.
+	data := contractorPersist{
+		BandwidthShare: c.bandwidthShare,
+		FundingMargin:  c.fundingMargin,
+		MaxHosts:       c.maxHosts,
+	}
 	err := c.persist.load(&data)
 	if err != nil {
 		return err
 	}
 	c.allowance = data.Allowance
+	c.bandwidthHeld = data.BandwidthHeld
+	c.bandwidthShare = data.BandwidthShare
 	c.blockHeight = data.BlockHeight
 	for _, rev := range data.CachedRevisions {
 		c.cachedRevisions[rev.Revision.ParentID] = rev
@@ -75,6 +95,7 @@ func (c *Contractor) load() error {
 		}
 		c.currentPeriod = highestEnd - c.allowance.Period
 	}
+	c.fundingMargin = data.FundingMargin
 	for _, contract := range data.Contracts {
 		// COMPATv1.0.4-lts
 		// If loading old persist, start height of contract is unknown. Give
@@ -83,9 +104,17 @@ func (c *Contractor) load() error {
 		if contract.StartHeight == 0 {
 			contract.StartHeight = c.currentPeriod + 1
 		}
+		// If loading old persist, the host's public key was not stored. It
+		// is the second key in the contract's unlock conditions.
+		if len(contract.HostPublicKey.Key) == 0 && len(contract.LastRevision.UnlockConditions.PublicKeys) > 1 {
+			contract.HostPublicKey = contract.LastRevision.UnlockConditions.PublicKeys[1]
+		}
 		c.contracts[contract.ID] = contract
 	}
 	c.lastChange = data.LastChange
+	if data.MaxHosts != 0 {
+		c.maxHosts = data.MaxHosts
+	}
 	for _, contract := range data.OldContracts {
 		c.oldContracts[contract.ID] = contract
 	}
@@ -143,3 +172,54 @@ func (c *Contractor) saveRevision(id types.FileContractID) func(types.FileContra
 		return c.saveSync()
 	}
 }
+
+// BackupContracts writes the contracts in the current contract set to w,
+// along with the renewal history that maps the IDs of renewed contracts to
+// their replacements. The contracts include their secret keys, so the output
+// must be protected.
+func (c *Contractor) BackupContracts(w io.Writer) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	contracts := make([]modules.RenterContract, 0, len(c.contracts))
+	for _, contract := range c.contracts {
+		contracts = append(contracts, contract)
+	}
+	renewed := make([][2]types.FileContractID, 0, len(c.renewedIDs))
+	for oldID, newID := range c.renewedIDs {
+		renewed = append(renewed, [2]types.FileContractID{oldID, newID})
+	}
+	return encoding.NewEncoder(w).EncodeAll(contracts, renewed)
+}
+
+// RestoreContracts reads contracts written by BackupContracts from r and adds
+// them to the current contract set. Contracts that are already known or that
+// have already ended are ignored. It returns the number of contracts added.
+func (c *Contractor) RestoreContracts(r io.Reader) (int, error) {
+	var contracts []modules.RenterContract
+	var renewed [][2]types.FileContractID
+	if err := encoding.NewDecoder(r).DecodeAll(&contracts, &renewed); err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var added int
+	for _, contract := range contracts {
+		_, known := c.contracts[contract.ID]
+		_, old := c.oldContracts[contract.ID]
+		if known || old || contract.EndHeight() <= c.blockHeight {
+			continue
+		}
+		c.contracts[contract.ID] = contract
+		// The Editor and Downloader expect a cached revision for every
+		// contract that has been revised.
+		c.cachedRevisions[contract.ID] = cachedRevision{contract.LastRevision, contract.MerkleRoots}
+		added++
+	}
+	for _, ids := range renewed {
+		if _, exists := c.renewedIDs[ids[0]]; !exists {
+			c.renewedIDs[ids[0]] = ids[1]
+		}
+	}
+	return added, c.saveSync()
+}
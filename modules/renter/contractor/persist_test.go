@@ -1,6 +1,7 @@
 package contractor
 
 import (
+	"bytes"
 	"os"
 	"testing"
 
@@ -127,3 +128,95 @@ func TestSaveLoad(t *testing.T) {
 		t.Fatal("oldContracts were not restored properly:", c.oldContracts)
 	}
 }
+
+// TestSaveLoadLimits tests that the host limit, funding margin, and bandwidth
+// reserve are persisted by their setters.
+func TestSaveLoadLimits(t *testing.T) {
+	c := &Contractor{
+		persist: new(memPersist),
+
+		bandwidthShare:  defaultBandwidthReserve,
+		cachedRevisions: make(map[types.FileContractID]cachedRevision),
+		contracts:       make(map[types.FileContractID]modules.RenterContract),
+		fundingMargin:   defaultFundingMargin,
+		maxHosts:        defaultMaxHosts,
+		oldContracts:    make(map[types.FileContractID]modules.RenterContract),
+		renewedIDs:      make(map[types.FileContractID]types.FileContractID),
+	}
+	if err := c.SetMaxHosts(10); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetFundingMargin(0.2); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetBandwidthReserve(0.3); err != nil {
+		t.Fatal(err)
+	}
+
+	// reset to the defaults and reload
+	c.bandwidthShare = defaultBandwidthReserve
+	c.fundingMargin = defaultFundingMargin
+	c.maxHosts = defaultMaxHosts
+	if err := c.load(); err != nil {
+		t.Fatal(err)
+	}
+	if c.MaxHosts() != 10 || c.FundingMargin() != 0.2 || c.BandwidthShare() != 0.3 {
+		t.Fatal("limits were not restored properly:", c.MaxHosts(), c.FundingMargin(), c.BandwidthShare())
+	}
+}
+
+// TestBackupRestoreContracts tests that contracts written by BackupContracts
+// are restored by RestoreContracts, skipping known and expired contracts.
+func TestBackupRestoreContracts(t *testing.T) {
+	c := &Contractor{
+		persist: new(memPersist),
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, NetAddress: "foo", LastRevision: types.FileContractRevision{NewWindowStart: 100}},
+			{2}: {ID: types.FileContractID{2}, NetAddress: "bar", LastRevision: types.FileContractRevision{NewWindowStart: 5}},
+		},
+		renewedIDs: map[types.FileContractID]types.FileContractID{
+			{0}: {1},
+		},
+	}
+	buf := new(bytes.Buffer)
+	if err := c.BackupContracts(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restore into a contractor that already knows one of the contracts, and
+	// for which the other has expired.
+	c = &Contractor{
+		blockHeight: 10,
+		persist:     new(memPersist),
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, NetAddress: "baz"},
+		},
+		cachedRevisions: make(map[types.FileContractID]cachedRevision),
+		oldContracts:    make(map[types.FileContractID]modules.RenterContract),
+		renewedIDs:      make(map[types.FileContractID]types.FileContractID),
+	}
+	backup := buf.Bytes()
+	added, err := c.RestoreContracts(bytes.NewReader(backup))
+	if err != nil {
+		t.Fatal(err)
+	} else if added != 0 {
+		t.Fatal("expected no contracts to be added, got", added)
+	} else if c.contracts[types.FileContractID{1}].NetAddress != "baz" {
+		t.Fatal("known contract was overwritten")
+	} else if c.resolveID(types.FileContractID{0}) != (types.FileContractID{1}) {
+		t.Fatal("renewal history was not restored")
+	}
+
+	// Restore into an empty contractor.
+	c.contracts = make(map[types.FileContractID]modules.RenterContract)
+	added, err = c.RestoreContracts(bytes.NewReader(backup))
+	if err != nil {
+		t.Fatal(err)
+	} else if added != 1 {
+		t.Fatal("expected 1 contract to be added, got", added)
+	} else if c.contracts[types.FileContractID{1}].NetAddress != "foo" {
+		t.Fatal("contract was not restored")
+	} else if _, ok := c.cachedRevisions[types.FileContractID{1}]; !ok {
+		t.Fatal("restored contract has no cached revision")
+	}
+}
@@ -0,0 +1,79 @@
+package contractor
+
+import (
+	"sort"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// sortedCurrencies is a list of currencies that can be sorted using the sort
+// package.
+type sortedCurrencies []types.Currency
+
+func (sc sortedCurrencies) Len() int           { return len(sc) }
+func (sc sortedCurrencies) Less(i, j int) bool { return sc[i].Cmp(sc[j]) < 0 }
+func (sc sortedCurrencies) Swap(i, j int)      { sc[i], sc[j] = sc[j], sc[i] }
+
+// medianPrice returns the median of the provided prices. If there are an even
+// number of prices, the average of the two middle prices is returned.
+func medianPrice(prices []types.Currency) types.Currency {
+	if len(prices) == 0 {
+		return types.ZeroCurrency
+	}
+	sorted := append(sortedCurrencies(nil), prices...)
+	sort.Sort(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return sorted[mid-1].Add(sorted[mid]).Div64(2)
+	}
+	return sorted[mid]
+}
+
+// PriceEstimation estimates the prices of the hosts that the contractor would
+// form contracts with. The hosts are sampled in the same way as when
+// contracts are formed, and the cost of storing a terabyte is calculated from
+// the same averages. If no allowance has been set, the estimate uses
+// minHostsForEstimations hosts and a period of defaultEstimationPeriod.
+func (c *Contractor) PriceEstimation() (modules.RenterPriceEstimation, error) {
+	c.mu.RLock()
+	numHosts, period := c.allowance.Hosts, c.allowance.Period
+	c.mu.RUnlock()
+	if numHosts == 0 {
+		numHosts = uint64(minHostsForEstimations)
+	}
+	if period == 0 {
+		period = defaultEstimationPeriod
+	}
+
+	hosts, err := sampleHosts(c.hdb, numHosts)
+	if err != nil {
+		return modules.RenterPriceEstimation{}, err
+	}
+	storagePrices := make([]types.Currency, 0, len(hosts))
+	contractPrices := make([]types.Currency, 0, len(hosts))
+	for _, h := range hosts {
+		storagePrices = append(storagePrices, h.StoragePrice)
+		contractPrices = append(contractPrices, h.ContractPrice)
+	}
+	averageStoragePrice, averageContractPrice := averagePrices(hosts)
+
+	// Mirror the calculation in maxSectors: each contract holds the data for
+	// the full period, and every contract pays a contract price and a
+	// transaction fee.
+	_, feeEstimation := c.tpool.FeeEstimation()
+	costForStorage := averageStoragePrice.Mul(modules.BytesPerTerabyte).Mul64(numHosts).Mul64(uint64(period))
+	costForContracts := averageContractPrice.Mul64(numHosts)
+	costForTxnFees := types.NewCurrency64(estimatedFileContractTransactionSize).Mul(feeEstimation).Mul64(numHosts)
+
+	return modules.RenterPriceEstimation{
+		AverageContractPrice: averageContractPrice,
+		MedianContractPrice:  medianPrice(contractPrices),
+		AverageStoragePrice:  averageStoragePrice,
+		MedianStoragePrice:   medianPrice(storagePrices),
+
+		Hosts:               numHosts,
+		Period:              period,
+		StorageTerabyteCost: costForStorage.Add(costForContracts).Add(costForTxnFees),
+	}, nil
+}
@@ -0,0 +1,92 @@
+package contractor
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestMedianPrice tests the medianPrice function.
+func TestMedianPrice(t *testing.T) {
+	tests := []struct {
+		prices []uint64
+		median uint64
+	}{
+		{nil, 0},
+		{[]uint64{5}, 5},
+		{[]uint64{9, 1, 5}, 5},
+		{[]uint64{4, 1, 10, 2}, 3},
+	}
+	for _, test := range tests {
+		var prices []types.Currency
+		for _, p := range test.prices {
+			prices = append(prices, types.NewCurrency64(p))
+		}
+		if median := medianPrice(prices); median.Cmp(types.NewCurrency64(test.median)) != 0 {
+			t.Errorf("median of %v: expected %v, got %v", test.prices, test.median, median)
+		}
+	}
+}
+
+// TestPriceEstimation tests the PriceEstimation method.
+func TestPriceEstimation(t *testing.T) {
+	var hosts []modules.HostDBEntry
+	for _, prices := range [][2]uint64{{10, 100}, {20, 200}, {30, 300}, {100, 1000}} {
+		var h modules.HostDBEntry
+		h.StoragePrice = types.NewCurrency64(prices[0])
+		h.ContractPrice = types.NewCurrency64(prices[1])
+		hosts = append(hosts, h)
+	}
+	deps := &fakeDeps{hosts: hosts, fee: types.NewCurrency64(2)}
+	c := &Contractor{
+		hdb:   deps,
+		tpool: deps,
+		allowance: modules.Allowance{
+			Hosts:  2,
+			Period: 10,
+		},
+	}
+
+	pe, err := c.PriceEstimation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pe.AverageStoragePrice.Cmp(types.NewCurrency64(40)) != 0 {
+		t.Error("wrong average storage price:", pe.AverageStoragePrice)
+	}
+	if pe.MedianStoragePrice.Cmp(types.NewCurrency64(25)) != 0 {
+		t.Error("wrong median storage price:", pe.MedianStoragePrice)
+	}
+	if pe.AverageContractPrice.Cmp(types.NewCurrency64(400)) != 0 {
+		t.Error("wrong average contract price:", pe.AverageContractPrice)
+	}
+	if pe.MedianContractPrice.Cmp(types.NewCurrency64(250)) != 0 {
+		t.Error("wrong median contract price:", pe.MedianContractPrice)
+	}
+	if pe.Hosts != 2 || pe.Period != 10 {
+		t.Error("estimate did not use the allowance:", pe.Hosts, pe.Period)
+	}
+	// 1 TB for 10 blocks on 2 hosts at 40 hastings / byte / block, plus 2
+	// contracts at 400 hastings and 2 transactions at 2 hastings / byte.
+	expected := modules.BytesPerTerabyte.Mul64(40 * 2 * 10).Add(types.NewCurrency64(2*400 + 2*2*estimatedFileContractTransactionSize))
+	if pe.StorageTerabyteCost.Cmp(expected) != 0 {
+		t.Errorf("expected storage cost to be %v, got %v", expected, pe.StorageTerabyteCost)
+	}
+
+	// Without an allowance, the defaults should be used.
+	c.allowance = modules.Allowance{}
+	pe, err = c.PriceEstimation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pe.Hosts != uint64(minHostsForEstimations) || pe.Period != defaultEstimationPeriod {
+		t.Error("estimate did not use the defaults:", pe.Hosts, pe.Period)
+	}
+
+	// An error should be returned if there are not enough hosts.
+	c.allowance.Hosts = uint64(len(hosts) + 1)
+	if _, err = c.PriceEstimation(); err == nil {
+		t.Error("expected an error when there are not enough hosts")
+	}
+}
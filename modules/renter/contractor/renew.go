@@ -12,12 +12,16 @@ import (
 
 // managedRenew negotiates a new contract for data already stored with a host.
 // It returns the new contract. This is a blocking call that performs network
-// I/O.
-func (c *Contractor) managedRenew(contract modules.RenterContract, numSectors uint64, newEndHeight types.BlockHeight) (modules.RenterContract, error) {
-	host, ok := c.hdb.Host(contract.NetAddress)
+// I/O. As with managedNewContract, hosts whose storage price exceeds maxPrice
+// are rejected, and a zero maxPrice means maxStoragePrice.
+func (c *Contractor) managedRenew(contract modules.RenterContract, numSectors uint64, newEndHeight types.BlockHeight, maxPrice types.Currency) (modules.RenterContract, error) {
+	if maxPrice.IsZero() {
+		maxPrice = maxStoragePrice
+	}
+	host, ok := c.hdb.RefreshHost(contract.NetAddress)
 	if !ok {
 		return modules.RenterContract{}, errors.New("no record of that host")
-	} else if host.StoragePrice.Cmp(maxStoragePrice) > 0 {
+	} else if host.StoragePrice.Cmp(maxPrice) > 0 {
 		return modules.RenterContract{}, errTooExpensive
 	}
 	// cap host.MaxCollateral
@@ -26,7 +30,7 @@ func (c *Contractor) managedRenew(contract modules.RenterContract, numSectors ui
 	}
 
 	// get an address to use for negotiation
-	uc, err := c.wallet.NextAddress()
+	refundAddress, err := c.managedNegotiationAddress()
 	if err != nil {
 		return modules.RenterContract{}, err
 	}
@@ -38,22 +42,48 @@ func (c *Contractor) managedRenew(contract modules.RenterContract, numSectors ui
 		Filesize:      numSectors * modules.SectorSize,
 		StartHeight:   c.blockHeight,
 		EndHeight:     newEndHeight,
-		RefundAddress: uc.UnlockHash(),
+		RefundAddress: refundAddress,
+		Timeouts:      c.timeouts,
+		MaxTxnSetSize: c.maxTxnSetSize,
+
+		MissedProofPolicy: c.missedProofs,
+		Dialer:            c.dialer,
+		LocalAddr:         c.localAddr,
 	}
 	c.mu.RUnlock()
 
+	// unless the contract is renewed, return unused outputs to wallet
 	txnBuilder := c.wallet.StartTransaction()
+	renewed := false
+	defer func() {
+		if !renewed {
+			txnBuilder.Drop()
+		}
+	}()
 
 	// execute negotiation protocol
 	newContract, err := proto.Renew(contract, params, txnBuilder, c.tpool)
 	if err != nil {
-		txnBuilder.Drop() // return unused outputs to wallet
+		c.managedReturnAddress(refundAddress)
+		c.managedUpdateHostSettings(err)
 		return modules.RenterContract{}, err
 	}
+	renewed = true
+	c.managedResetAddressReuses()
 
 	return newContract, nil
 }
 
+// WillRenew reports whether the contractor intends to renew the specified
+// contract when it enters the renew window. Contracts are only renewed while
+// an allowance is set and the contract's host is online.
+func (c *Contractor) WillRenew(id types.FileContractID) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, exists := c.contracts[id]
+	return exists && c.allowance.Period != 0 && !c.isOffline(id)
+}
+
 // managedRenewContracts renews any contracts that are up for renewal, using
 // the current allowance.
 func (c *Contractor) managedRenewContracts() error {
@@ -78,7 +108,9 @@ func (c *Contractor) managedRenewContracts() error {
 
 	c.mu.RLock()
 	endHeight := c.blockHeight + c.allowance.Period
-	max, err := maxSectors(c.allowance, c.hdb, c.tpool)
+	maxPrice := c.allowance.MaxContractPrice
+	max, bandwidth, err := maxSectors(c.allowance, c.fundingMargin, c.bandwidthShare, c.hdb, c.tpool)
+	reserved := c.allowance.Funds.MulFloat(bandwidth)
 	c.mu.RUnlock()
 	if err != nil {
 		return err
@@ -136,7 +168,7 @@ func (c *Contractor) managedRenewContracts() error {
 	// map old ID to new contract, for easy replacement later
 	newContracts := make(map[types.FileContractID]modules.RenterContract)
 	for _, contract := range oldContracts {
-		newContract, err := c.managedRenew(contract, numSectors, endHeight)
+		newContract, err := c.managedRenew(contract, numSectors, endHeight, maxPrice)
 		if err != nil {
 			c.log.Printf("WARN: failed to renew contract with %v: %v", contract.NetAddress, err)
 		} else {
@@ -155,12 +187,19 @@ func (c *Contractor) managedRenewContracts() error {
 		if oldContract, ok := c.contracts[oldID]; ok {
 			c.oldContracts[oldID] = oldContract
 			delete(c.contracts, oldID)
+			delete(c.metrics, oldID)
 		}
 		// insert the new contract
 		c.contracts[contract.ID] = contract
 		// add a mapping from old->new contract
 		c.renewedIDs[oldID] = contract.ID
 	}
+	if len(newContracts) > 0 {
+		c.bandwidthHeld = reserved
+	}
+	if err := c.validateSpending(); err != nil {
+		c.log.Println("WARN:", err)
+	}
 	err = c.saveSync()
 	c.mu.Unlock()
 	return err
@@ -0,0 +1,33 @@
+package contractor
+
+import (
+	"fmt"
+)
+
+// validateSpending checks that the spending of every contract in the current
+// set adds up. The renter pays TotalCost to form or renew a contract, and
+// each revision moves funds out of the renter's payout and into one of the
+// spending metrics, so the remaining RenterFunds plus the contract fee, the
+// siafund fee, and the download, storage, and upload spending must always
+// equal TotalCost. A mismatch means that a metric was not updated alongside
+// a revision. The caller must hold c.mu.
+//
+// NOTE: Transaction fees are paid outside of the contract, and are not part
+// of TotalCost.
+func (c *Contractor) validateSpending() error {
+	for _, contract := range c.contracts {
+		if len(contract.LastRevision.NewValidProofOutputs) < 2 {
+			return fmt.Errorf("contract %v has a malformed revision", contract.ID)
+		}
+		accounted := contract.RenterFunds().
+			Add(contract.ContractFee).
+			Add(contract.SiafundFee).
+			Add(contract.DownloadSpending).
+			Add(contract.StorageSpending).
+			Add(contract.UploadSpending)
+		if !accounted.Equals(contract.TotalCost) {
+			return fmt.Errorf("spending of contract %v does not add up: total cost is %v, but funds, fees, and spending sum to %v", contract.ID, contract.TotalCost, accounted)
+		}
+	}
+	return nil
+}
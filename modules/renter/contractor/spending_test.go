@@ -0,0 +1,52 @@
+package contractor
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestValidateSpending tests that validateSpending detects contracts whose
+// spending does not add up to their total cost.
+func TestValidateSpending(t *testing.T) {
+	// A contract that cost 100, of which 10 was spent on fees and 30 on
+	// revisions.
+	contract := modules.RenterContract{
+		ID: types.FileContractID{1},
+		LastRevision: types.FileContractRevision{
+			NewValidProofOutputs: []types.SiacoinOutput{
+				{Value: types.NewCurrency64(60)},
+				{Value: types.NewCurrency64(0)},
+			},
+		},
+		TotalCost:        types.NewCurrency64(100),
+		ContractFee:      types.NewCurrency64(6),
+		SiafundFee:       types.NewCurrency64(4),
+		DownloadSpending: types.NewCurrency64(5),
+		StorageSpending:  types.NewCurrency64(15),
+		UploadSpending:   types.NewCurrency64(10),
+	}
+	c := &Contractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			contract.ID: contract,
+		},
+	}
+	if err := c.validateSpending(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Moving funds out of the contract without recording the spending
+	// should be detected.
+	contract.LastRevision.NewValidProofOutputs[0].Value = types.NewCurrency64(50)
+	c.contracts[contract.ID] = contract
+	if err := c.validateSpending(); err == nil {
+		t.Fatal("expected corrupted funds to be detected")
+	}
+
+	// Malformed contracts should be reported rather than causing a panic.
+	c.contracts[contract.ID] = modules.RenterContract{ID: contract.ID}
+	if err := c.validateSpending(); err == nil {
+		t.Fatal("expected malformed contract to be detected")
+	}
+}
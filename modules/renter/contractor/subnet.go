@@ -0,0 +1,56 @@
+package contractor
+
+import (
+	"net"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// hostSubnet returns the subnet that addr belongs to, for the purpose of
+// spreading contracts across independent infrastructure. IPv4 addresses are
+// grouped by /16 and IPv6 addresses by /32. Hostnames are not resolved, so
+// each hostname is treated as its own subnet.
+func hostSubnet(addr modules.NetAddress) string {
+	host := addr.Host()
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(16, 32)).String() + "/16"
+	}
+	return ip.Mask(net.CIDRMask(32, 128)).String() + "/32"
+}
+
+// diversifyHosts reorders hosts so that the first host of each subnet not
+// already in used comes first. The remaining hosts follow, so that hosts
+// sharing a subnet are only chosen when there are not enough distinct
+// subnets. The relative order of the hosts is otherwise preserved.
+func diversifyHosts(hosts []modules.HostDBEntry, used map[string]struct{}) []modules.HostDBEntry {
+	seen := make(map[string]struct{}, len(used))
+	for s := range used {
+		seen[s] = struct{}{}
+	}
+	diverse := make([]modules.HostDBEntry, 0, len(hosts))
+	var rest []modules.HostDBEntry
+	for _, h := range hosts {
+		s := hostSubnet(h.NetAddress)
+		if _, exists := seen[s]; exists {
+			rest = append(rest, h)
+			continue
+		}
+		seen[s] = struct{}{}
+		diverse = append(diverse, h)
+	}
+	return append(diverse, rest...)
+}
+
+// usedSubnets returns the subnets of the hosts the contractor currently has
+// contracts with. The caller must hold c.mu.
+func (c *Contractor) usedSubnets() map[string]struct{} {
+	used := make(map[string]struct{}, len(c.contracts))
+	for _, contract := range c.contracts {
+		used[hostSubnet(contract.NetAddress)] = struct{}{}
+	}
+	return used
+}
@@ -0,0 +1,91 @@
+package contractor
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestHostSubnet tests the hostSubnet function.
+func TestHostSubnet(t *testing.T) {
+	tests := []struct {
+		addr   modules.NetAddress
+		subnet string
+	}{
+		{"1.2.3.4:9982", "1.2.0.0/16"},
+		{"1.2.200.100:9982", "1.2.0.0/16"},
+		{"1.3.3.4:9982", "1.3.0.0/16"},
+		{"[2001:db8:1::1]:9982", "2001:db8::/32"},
+		{"[2001:db8:2::1]:9982", "2001:db8::/32"},
+		{"example.com:9982", "example.com"},
+		{"foo.example.com:9982", "foo.example.com"},
+	}
+	for _, test := range tests {
+		if s := hostSubnet(test.addr); s != test.subnet {
+			t.Errorf("hostSubnet(%v): expected %v, got %v", test.addr, test.subnet, s)
+		}
+	}
+}
+
+// TestCandidateHostsSubnets tests that managedCandidateHosts orders hosts in
+// distinct subnets before hosts that share a subnet, and falls back to hosts
+// sharing a subnet when there are not enough distinct subnets.
+func TestCandidateHostsSubnets(t *testing.T) {
+	hdb := &fakeDeps{}
+	for _, addr := range []modules.NetAddress{
+		"1.2.3.4:1", "1.2.3.5:1", "1.2.4.4:1", // 1.2.0.0/16
+		"5.6.7.8:1", "5.6.8.8:1", // 5.6.0.0/16
+		"9.9.9.9:1",
+		"10.10.10.10:1",
+	} {
+		hdb.hosts = append(hdb.hosts, modules.HostDBEntry{HostExternalSettings: modules.HostExternalSettings{NetAddress: addr}})
+	}
+	c := &Contractor{
+		hdb:          hdb,
+		oversampling: defaultSampleMultiplier,
+		contracts:    make(map[types.FileContractID]modules.RenterContract),
+	}
+
+	subnets := func(hosts []modules.HostDBEntry) map[string]int {
+		m := make(map[string]int)
+		for _, h := range hosts {
+			m[hostSubnet(h.NetAddress)]++
+		}
+		return m
+	}
+
+	// The first four candidates should all be in distinct subnets.
+	hosts, _, err := c.managedCandidateHosts(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != len(hdb.hosts) {
+		t.Fatalf("expected %v candidates, got %v", len(hdb.hosts), len(hosts))
+	}
+	if s := subnets(hosts[:4]); len(s) != 4 {
+		t.Fatal("first 4 candidates should be in distinct subnets:", hosts[:4])
+	}
+
+	// Hosts in subnets that we already have a contract in should come last.
+	c.contracts[types.FileContractID{1}] = modules.RenterContract{NetAddress: "9.9.1.1:1"}
+	hosts, _, err = c.managedCandidateHosts(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := subnets(hosts[:3]); len(s) != 3 || s["9.9.0.0/16"] != 0 {
+		t.Fatal("first 3 candidates should be in distinct, unused subnets:", hosts[:3])
+	}
+
+	// When there are not enough distinct subnets, hosts sharing a subnet
+	// should still be returned.
+	c.contracts = make(map[types.FileContractID]modules.RenterContract)
+	hdb.hosts = hdb.hosts[:3]
+	hosts, _, err = c.managedCandidateHosts(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 3 {
+		t.Fatal("expected 3 candidates sharing a subnet, got", len(hosts))
+	}
+}
@@ -35,6 +35,7 @@ func (c *Contractor) ProcessConsensusChange(cc modules.ConsensusChange) {
 	// delete expired contracts (can't delete while iterating)
 	for _, id := range expired {
 		delete(c.contracts, id)
+		delete(c.metrics, id)
 		c.log.Println("INFO: archived expired contract", id)
 	}
 
@@ -78,12 +79,13 @@ func (c *Contractor) ProcessConsensusChange(cc modules.ConsensusChange) {
 			// if we don't have enough (online) contracts, form new ones
 			c.mu.RLock()
 			a := c.allowance
+			margin, bandwidth := c.fundingMargin, c.bandwidthShare
 			remaining := int(a.Hosts) - len(c.onlineContracts())
 			c.mu.RUnlock()
 			if remaining <= 0 {
 				return
 			}
-			max, err := maxSectors(a, c.hdb, c.tpool)
+			max, bandwidth, err := maxSectors(a, margin, bandwidth, c.hdb, c.tpool)
 			if err != nil {
 				c.log.Debugln("ERROR: couldn't calculate maxSectors after processing a consensus change:", err)
 				return
@@ -91,7 +93,7 @@ func (c *Contractor) ProcessConsensusChange(cc modules.ConsensusChange) {
 			// Only allocate half as many sectors as the max. This leaves some leeway
 			// for replacing contracts, transaction fees, etc.
 			numSectors := max / 2
-			err = c.managedFormAllowanceContracts(remaining, numSectors, a)
+			err = c.managedFormAllowanceContracts(remaining, numSectors, a.Funds.MulFloat(bandwidth), a)
 			if err != nil {
 				c.log.Debugln("WARN: failed to form contracts after processing a consensus change:", err)
 			}
@@ -26,8 +26,11 @@ func TestProcessConsensusUpdate(t *testing.T) {
 			rc.ID: rc,
 		},
 		oldContracts: make(map[types.FileContractID]modules.RenterContract),
-		persist:      new(memPersist),
-		log:          persist.NewLogger(ioutil.Discard),
+		metrics: map[types.FileContractID]modules.NegotiationMetrics{
+			rc.ID: {ContractID: rc.ID},
+		},
+		persist: new(memPersist),
+		log:     persist.NewLogger(ioutil.Discard),
 	}
 
 	// process 20 blocks; contract should remain
@@ -42,11 +45,15 @@ func TestProcessConsensusUpdate(t *testing.T) {
 		t.Error("expected 1 contract, got", len(c.contracts))
 	}
 
-	// process one more block; contract should be removed
+	// process one more block; contract should be removed, along with its
+	// negotiation metrics
 	c.ProcessConsensusChange(cc)
 	if len(c.contracts) != 0 {
 		t.Error("expected 0 contracts, got", len(c.contracts))
 	}
+	if len(c.metrics) != 0 {
+		t.Error("expected the metrics of the expired contract to be deleted, got", c.metrics)
+	}
 }
 
 // TestIntegrationAutoRenew tests that contracts are automatically renwed at
@@ -19,6 +19,10 @@ func (hdb editorHostDB) Host(addr modules.NetAddress) (modules.HostDBEntry, bool
 	return h, ok
 }
 
+func (hdb editorHostDB) RefreshHost(addr modules.NetAddress) (modules.HostDBEntry, bool) {
+	return hdb.Host(addr)
+}
+
 // TestEditor tests the failure conditions of the Editor method. The method is
 // more fully tested in the host integration test.
 func TestEditor(t *testing.T) {
@@ -160,3 +160,32 @@ func TestIsOffline(t *testing.T) {
 		}
 	}
 }
+
+// TestContractsOffline tests that Contracts omits contracts whose hosts are
+// offline, while AllContracts includes them.
+func TestContractsOffline(t *testing.T) {
+	now := time.Now()
+	badScans := []modules.HostDBScan{
+		{Timestamp: now.Add(-uptimeWindow * 2), Success: false},
+		{Timestamp: now.Add(-uptimeWindow / 2), Success: false},
+		{Timestamp: now, Success: false},
+	}
+	c := &Contractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			types.FileContractID{1}: {ID: types.FileContractID{1}, NetAddress: "online"},
+			types.FileContractID{2}: {ID: types.FileContractID{2}, NetAddress: "offline"},
+		},
+		hdb: mapHostDB{
+			hosts: map[modules.NetAddress]modules.HostDBEntry{
+				"online":  {},
+				"offline": {ScanHistory: badScans},
+			},
+		},
+	}
+	if cs := c.Contracts(); len(cs) != 1 || cs[0].NetAddress != "online" {
+		t.Fatal("expected only the online contract, got", cs)
+	}
+	if cs := c.AllContracts(); len(cs) != 2 {
+		t.Fatal("expected both contracts, got", cs)
+	}
+}
@@ -7,7 +7,6 @@ package renter
 import (
 	"bytes"
 	"errors"
-	"os"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -71,7 +70,8 @@ type (
 
 		// Static information about the file - can be read without a lock.
 		chunkSize         uint64
-		destination       string
+		destination       downloadDestination
+		destinationString string
 		erasureCode       modules.ErasureCoder
 		fileSize          uint64
 		masterKey         crypto.TwofishKey
@@ -80,6 +80,12 @@ type (
 		reportedPieceSize uint64
 		siapath           string
 
+		// offset and length specify the range of the file that is being
+		// downloaded. Only the chunks that overlap the range are fetched, and
+		// the range is written to the start of the destination.
+		offset uint64
+		length uint64
+
 		// Syncrhonization tools.
 		downloadFinished chan error
 		mu               sync.Mutex
@@ -116,29 +122,50 @@ type (
 	}
 )
 
-// newDownload initializes and returns a download object.
-func newDownload(f *file, destination string) *download {
+// newDownload initializes and returns a download object for the length bytes
+// of the file starting at offset. destinationString describes the destination
+// in the download queue.
+func newDownload(f *file, destination downloadDestination, destinationString string, offset, length uint64) *download {
 	d := &download{
 		finishedChunks: make([]bool, f.numChunks()),
 
 		startTime: time.Now(),
 
-		chunkSize:   f.chunkSize(),
-		destination: destination,
-		erasureCode: f.erasureCode,
-		fileSize:    f.size,
-		masterKey:   f.masterKey,
-		numChunks:   f.numChunks(),
-		siapath:     f.name,
+		chunkSize:         f.chunkSize(),
+		destination:       destination,
+		destinationString: destinationString,
+		erasureCode:       f.erasureCode,
+		fileSize:          f.size,
+		masterKey:         f.masterKey,
+		numChunks:         f.numChunks(),
+		siapath:           f.name,
+
+		offset: offset,
+		length: length,
 
 		downloadFinished: make(chan error),
 	}
+
+	// Mark the chunks outside of the requested range as finished, so that
+	// they are never fetched.
+	firstChunk := offset / d.chunkSize
+	lastChunk := firstChunk
+	if length > 0 {
+		lastChunk = (offset + length - 1) / d.chunkSize
+	}
+	for i := range d.finishedChunks {
+		if uint64(i) < firstChunk || uint64(i) > lastChunk {
+			d.finishedChunks[i] = true
+		}
+	}
+	rangeChunks := lastChunk - firstChunk + 1
+
 	// Allocate the piece size and progress bar so that the download will
 	// finish at exactly 100%. Due to rounding error and padding, there is not
 	// a strict mapping between 'progress' and 'bytes downloaded' - it is
 	// actually necessary to download more bytes than the size of the file.
-	d.reportedPieceSize = d.fileSize / (d.numChunks * uint64(d.erasureCode.MinPieces()))
-	d.atomicDataReceived = d.fileSize - (d.reportedPieceSize * d.numChunks * uint64(d.erasureCode.MinPieces()))
+	d.reportedPieceSize = d.length / (rangeChunks * uint64(d.erasureCode.MinPieces()))
+	d.atomicDataReceived = d.length - (d.reportedPieceSize * rangeChunks * uint64(d.erasureCode.MinPieces()))
 
 	// Assemble the piece set for the download.
 	d.pieceSet = make([]map[types.FileContractID]pieceData, f.numChunks())
@@ -168,6 +195,37 @@ func (d *download) fail(err error) {
 	d.downloadFinished <- err
 }
 
+// status returns the status of the download, along with the error that it
+// failed with if it has errored.
+func (d *download) status() (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.downloadComplete {
+		return modules.DownloadStatusActive, nil
+	} else if d.downloadErr != nil {
+		return modules.DownloadStatusErrored, d.downloadErr
+	}
+	return modules.DownloadStatusCompleted, nil
+}
+
+// sliceChunk returns the portion of a recovered chunk that falls within the
+// range of the download.
+func (d *download) sliceChunk(index uint64, data []byte) []byte {
+	chunkStart := index * d.chunkSize
+	chunkEnd := chunkStart + uint64(len(data))
+	start, end := chunkStart, chunkEnd
+	if d.offset > start {
+		start = d.offset
+	}
+	if rangeEnd := d.offset + d.length; rangeEnd < end {
+		end = rangeEnd
+	}
+	if start >= end {
+		return nil
+	}
+	return data[start-chunkStart : end-chunkStart]
+}
+
 // recoverChunk takes a chunk that has had a sufficient number of pieces
 // downloaded and verified and decryptps + decodes them into the file.
 func (cd *chunkDownload) recoverChunk() error {
@@ -213,31 +271,24 @@ func (cd *chunkDownload) recoverChunk() error {
 		return build.ExtendErr("unable to recover chunk", err)
 	}
 
-	// Open a file handle for the download.
-	fileDest, err := os.OpenFile(cd.download.destination, os.O_CREATE|os.O_WRONLY, defaultFilePerm)
-	if err != nil {
-		return build.ExtendErr("unable to open download destination", err)
+	// Write the portion of the chunk that falls within the requested range to
+	// the download destination.
+	result := cd.download.sliceChunk(cd.index, recoverWriter.Bytes())
+	chunkStart := cd.index * cd.download.chunkSize
+	writeOffset := uint64(0)
+	if chunkStart > cd.download.offset {
+		writeOffset = chunkStart - cd.download.offset
 	}
-	defer fileDest.Close()
-
-	// Write the bytes to the download file.
-	result := recoverWriter.Bytes()
-	_, err = fileDest.WriteAt(result, int64(cd.index*cd.download.chunkSize))
+	_, err = cd.download.destination.WriteAt(result, int64(writeOffset))
 	if err != nil {
 		return build.ExtendErr("unable to write to download destination", err)
 	}
 
-	// Sync the write to provide proper durability.
-	err = fileDest.Sync()
-	if err != nil {
-		return build.ExtendErr("unable to sync downlaod destination", err)
-	}
-
 	cd.download.mu.Lock()
 	defer cd.download.mu.Unlock()
 
 	// Update the download to signal that this chunk has completed. Only update
-	// after the sync, so that durability is maintained.
+	// after the write, so that durability is maintained.
 	if cd.download.finishedChunks[cd.index] {
 		build.Critical("recovering chunk when the chunk has already finished downloading")
 	}
@@ -518,7 +569,9 @@ func (r *Renter) managedWaitOnDownloadWork(ds *downloadState) {
 	// Check for an error.
 	cd := finishedDownload.chunkDownload
 	if finishedDownload.err != nil {
-		r.log.Debugln("Error when downloading a piece:", finishedDownload.err)
+		// Log the failure so that hosts sending corrupt data can be
+		// identified; the piece is fetched from another host instead.
+		r.log.Println("WARN: unable to download a piece from contract", workerID, "::", finishedDownload.err)
 		worker.recentDownloadFailure = time.Now()
 		ds.incompleteChunks = append(ds.incompleteChunks, cd)
 		return
@@ -0,0 +1,213 @@
+package renter
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/NebulousLabs/Sia/build"
+)
+
+// partExtension is appended to the destination of a download to disk while
+// the download is in progress.
+const partExtension = ".part"
+
+var (
+	errDownloadBufferFull = errors.New("download aborted because the client is not reading it fast enough")
+	errDownloadCanceled   = errors.New("download aborted because the client disconnected")
+
+	// maxDownloadWriterBuffer is the maximum number of bytes that a
+	// downloadDestinationWriter holds before aborting the download.
+	maxDownloadWriterBuffer = build.Select(build.Var{
+		Standard: 256 << 20, // 256 MiB
+		Dev:      64 << 20,  // 64 MiB
+		Testing:  1 << 20,   // 1 MiB
+	}).(int)
+)
+
+type (
+	// downloadDestination is the target of a download. Recovered chunks are
+	// written to the destination at their offset within the downloaded range,
+	// though not necessarily in order.
+	downloadDestination interface {
+		WriteAt(data []byte, offset int64) (int, error)
+	}
+
+	// downloadDestinationFile writes a download to a file on disk. Each write
+	// is synced before returning so that a finished chunk is durable.
+	downloadDestinationFile string
+
+	// downloadDestinationWriter writes a download to an io.Writer, such as an
+	// http response. Because the writer can only be written to sequentially,
+	// chunks that are recovered out of order are held in memory until all of
+	// the preceding data has been recovered. The download loop only queues
+	// data; it is written to the writer by the goroutine calling writeTo, so
+	// a slow writer cannot stall other downloads. If more than
+	// maxDownloadWriterBuffer bytes are held, the download is aborted.
+	downloadDestinationWriter struct {
+		// offset is the position of the next byte that will be queued.
+		// pending holds the chunks beyond offset that have been recovered,
+		// keyed by their position. queue holds the data that is ready to be
+		// written, in order. buffered is the total size of pending and queue.
+		offset   int64
+		pending  map[int64][]byte
+		queue    [][]byte
+		buffered int
+
+		// closed is set once no more data will be queued. err is the error
+		// that ends the download early, if any.
+		closed bool
+		err    error
+
+		cond *sync.Cond
+		mu   sync.Mutex
+	}
+
+	// closeNotifier is implemented by writers that can report when their
+	// client has gone away, such as an http.ResponseWriter.
+	closeNotifier interface {
+		CloseNotify() <-chan bool
+	}
+)
+
+// WriteAt writes data to the destination file at the provided offset.
+func (dest downloadDestinationFile) WriteAt(data []byte, offset int64) (int, error) {
+	f, err := os.OpenFile(string(dest), os.O_CREATE|os.O_WRONLY, defaultFilePerm)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n, err := f.WriteAt(data, offset)
+	if err != nil {
+		return n, err
+	}
+	return n, f.Sync()
+}
+
+// downloadToFile runs download against a temporary file next to destination,
+// and renames the temporary file to destination once the download has
+// completed. If the download fails, the temporary file is removed, so that
+// destination never holds a partial download.
+func downloadToFile(destination string, download func(downloadDestination) error) error {
+	// Create the temporary file up front, truncating any leftovers of an
+	// earlier interrupted download.
+	part := destination + partExtension
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, defaultFilePerm)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	if err := download(downloadDestinationFile(part)); err != nil {
+		os.Remove(part)
+		return err
+	}
+	if err := os.Rename(part, destination); err != nil {
+		os.Remove(part)
+		return err
+	}
+	return nil
+}
+
+// newDownloadDestinationWriter returns a downloadDestination whose data is
+// written in order by writeTo.
+func newDownloadDestinationWriter() *downloadDestinationWriter {
+	dest := &downloadDestinationWriter{
+		pending: make(map[int64][]byte),
+	}
+	dest.cond = sync.NewCond(&dest.mu)
+	return dest
+}
+
+// WriteAt queues data to be written if it is the next data in the download.
+// Otherwise, it is held until the preceding data has been queued. WriteAt
+// never waits for the writer.
+func (dest *downloadDestinationWriter) WriteAt(data []byte, offset int64) (int, error) {
+	dest.mu.Lock()
+	defer dest.mu.Unlock()
+
+	if dest.err != nil {
+		return 0, dest.err
+	}
+	if dest.buffered+len(data) > maxDownloadWriterBuffer {
+		dest.err = errDownloadBufferFull
+		dest.cond.Broadcast()
+		return 0, dest.err
+	}
+	dest.buffered += len(data)
+	data = append([]byte(nil), data...)
+	if offset != dest.offset {
+		dest.pending[offset] = data
+		return len(data), nil
+	}
+
+	// Queue the data, followed by any pending data that it was blocking.
+	written := len(data)
+	for {
+		dest.queue = append(dest.queue, data)
+		dest.offset += int64(len(data))
+		next, exists := dest.pending[dest.offset]
+		if !exists {
+			break
+		}
+		delete(dest.pending, dest.offset)
+		data = next
+	}
+	dest.cond.Broadcast()
+	return written, nil
+}
+
+// close marks the end of the download. err is the error that the download
+// failed with, if any.
+func (dest *downloadDestinationWriter) close(err error) {
+	dest.mu.Lock()
+	defer dest.mu.Unlock()
+	dest.closed = true
+	if dest.err == nil {
+		dest.err = err
+	}
+	dest.cond.Broadcast()
+}
+
+// writeTo writes the queued data to w until the download is closed, returning
+// the error that ended the download, if any. If w implements closeNotifier,
+// the download is aborted when its client goes away.
+func (dest *downloadDestinationWriter) writeTo(w io.Writer) error {
+	if cn, ok := w.(closeNotifier); ok {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-cn.CloseNotify():
+				dest.close(errDownloadCanceled)
+			case <-done:
+			}
+		}()
+	}
+
+	for {
+		dest.mu.Lock()
+		for len(dest.queue) == 0 && !dest.closed && dest.err == nil {
+			dest.cond.Wait()
+		}
+		if dest.err != nil || len(dest.queue) == 0 {
+			err := dest.err
+			dest.mu.Unlock()
+			return err
+		}
+		data := dest.queue[0]
+		dest.queue = dest.queue[1:]
+		dest.mu.Unlock()
+
+		_, err := w.Write(data)
+
+		dest.mu.Lock()
+		dest.buffered -= len(data)
+		if err != nil && dest.err == nil {
+			dest.err = err
+		}
+		dest.mu.Unlock()
+	}
+}
@@ -0,0 +1,156 @@
+package renter
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/build"
+)
+
+// TestDownloadDestinationWriter tests that the downloadDestinationWriter
+// writes chunks to the underlying writer in order, regardless of the order in
+// which they arrive.
+func TestDownloadDestinationWriter(t *testing.T) {
+	dest := newDownloadDestinationWriter()
+
+	// Write the chunks out of order. Nothing should be queued until the first
+	// chunk arrives.
+	writes := []struct {
+		data   string
+		offset int64
+	}{
+		{"ef", 4},
+		{"cd", 2},
+		{"gh", 6},
+	}
+	for _, w := range writes {
+		if n, err := dest.WriteAt([]byte(w.data), w.offset); err != nil || n != len(w.data) {
+			t.Fatal(n, err)
+		}
+	}
+	if len(dest.queue) != 0 {
+		t.Fatal("data was queued before the start of the download:", dest.queue)
+	}
+
+	// Writing the first chunk should queue every pending chunk.
+	if _, err := dest.WriteAt([]byte("ab"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(dest.pending) != 0 {
+		t.Fatal("pending chunks were not cleared:", len(dest.pending))
+	}
+	if _, err := dest.WriteAt([]byte("ij"), 8); err != nil {
+		t.Fatal(err)
+	}
+	dest.close(nil)
+
+	var buf bytes.Buffer
+	if err := dest.writeTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "abcdefghij" {
+		t.Fatal("expected abcdefghij, got", buf.String())
+	}
+	if dest.buffered != 0 {
+		t.Fatal("expected no buffered data, got", dest.buffered)
+	}
+}
+
+// failingWriter is an io.Writer that always fails.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("write failed") }
+
+// TestDownloadDestinationWriterAbort tests that the downloadDestinationWriter
+// aborts the download when its buffer fills or its writer fails, rather than
+// waiting for the writer.
+func TestDownloadDestinationWriterAbort(t *testing.T) {
+	// Data that is never written should fill the buffer.
+	dest := newDownloadDestinationWriter()
+	chunk := make([]byte, maxDownloadWriterBuffer/2)
+	for i := 0; i < 2; i++ {
+		if _, err := dest.WriteAt(chunk, int64(i*len(chunk))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := dest.WriteAt(chunk, int64(2*len(chunk))); err != errDownloadBufferFull {
+		t.Fatal("expected errDownloadBufferFull, got", err)
+	}
+	if err := dest.writeTo(new(bytes.Buffer)); err != errDownloadBufferFull {
+		t.Fatal("expected errDownloadBufferFull, got", err)
+	}
+
+	// A failed write should fail every later WriteAt.
+	dest = newDownloadDestinationWriter()
+	if _, err := dest.WriteAt([]byte("ab"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := dest.writeTo(failingWriter{}); err == nil {
+		t.Fatal("expected the write error to be returned")
+	}
+	if _, err := dest.WriteAt([]byte("cd"), 2); err == nil {
+		t.Fatal("expected WriteAt to fail after the writer failed")
+	}
+
+	// A download error should be returned by writeTo.
+	dest = newDownloadDestinationWriter()
+	dest.close(errInsufficientHosts)
+	if err := dest.writeTo(new(bytes.Buffer)); err != errInsufficientHosts {
+		t.Fatal("expected errInsufficientHosts, got", err)
+	}
+}
+
+// TestDownloadToFile tests that downloadToFile only creates the destination
+// once a download completes, and cleans up after a failed download.
+func TestDownloadToFile(t *testing.T) {
+	dir := build.TempDir("renter", "TestDownloadToFile")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	destination := filepath.Join(dir, "file")
+	part := destination + partExtension
+
+	// Simulate a download that fails partway through. Neither the
+	// destination nor the temporary file should remain.
+	errFailed := errors.New("download failed")
+	err := downloadToFile(destination, func(dest downloadDestination) error {
+		if _, err := dest.WriteAt([]byte("abcd"), 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(destination); !os.IsNotExist(err) {
+			t.Fatal("destination exists before the download completed:", err)
+		}
+		return errFailed
+	})
+	if err != errFailed {
+		t.Fatal("expected errFailed, got", err)
+	}
+	if _, err := os.Stat(destination); !os.IsNotExist(err) {
+		t.Fatal("failed download left a file at the destination:", err)
+	}
+	if _, err := os.Stat(part); !os.IsNotExist(err) {
+		t.Fatal("failed download did not remove the temporary file:", err)
+	}
+
+	// A successful download should be moved to the destination.
+	err = downloadToFile(destination, func(dest downloadDestination) error {
+		_, err := dest.WriteAt([]byte("efgh"), 0)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(destination)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(data) != "efgh" {
+		t.Fatal("expected efgh, got", string(data))
+	}
+	if _, err := os.Stat(part); !os.IsNotExist(err) {
+		t.Fatal("temporary file was not removed:", err)
+	}
+}
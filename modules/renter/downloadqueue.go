@@ -2,25 +2,92 @@ package renter
 
 import (
 	"errors"
+	"io"
 	"sync/atomic"
 
 	"github.com/NebulousLabs/Sia/modules"
 )
 
+var (
+	// ErrDownloadLength is returned when a requested download range extends
+	// past the end of the file.
+	ErrDownloadLength = errors.New("requested download range extends beyond the end of the file")
+
+	// ErrDownloadOffset is returned when a requested download offset is not
+	// within the file.
+	ErrDownloadOffset = errors.New("download offset is beyond the end of the file")
+
+	// ErrDownloadUnknownPath is returned when the requested file does not
+	// exist.
+	ErrDownloadUnknownPath = errors.New("no file with that path")
+)
+
 // Download downloads a file, identified by its path, to the destination
-// specified.
+// specified. The file is only moved to the destination once the download has
+// completed.
 func (r *Renter) Download(path, destination string) error {
 	// Lookup the file associated with the nickname.
 	lockID := r.mu.RLock()
 	file, exists := r.files[path]
 	r.mu.RUnlock(lockID)
 	if !exists {
-		return errors.New("no file with that path")
+		return ErrDownloadUnknownPath
 	}
+	return downloadToFile(destination, func(dest downloadDestination) error {
+		return r.managedDownload(file, dest, destination, 0, file.size)
+	})
+}
+
+// DownloadSection downloads length bytes of a file, identified by its path,
+// starting at offset. The bytes are written to the start of the destination.
+// A length of zero downloads the remainder of the file.
+func (r *Renter) DownloadSection(path, destination string, offset, length uint64) error {
+	return downloadToFile(destination, func(dest downloadDestination) error {
+		return r.managedDownloadSection(path, dest, destination, offset, length)
+	})
+}
 
+// DownloadStream downloads length bytes of a file, identified by its path,
+// starting at offset, and writes them to w in order. A length of zero
+// downloads the remainder of the file. The download runs in the background,
+// and is aborted if w falls too far behind it or its client disconnects.
+func (r *Renter) DownloadStream(path string, w io.Writer, offset, length uint64) error {
+	dest := newDownloadDestinationWriter()
+	go func() {
+		dest.close(r.managedDownloadSection(path, dest, "http response", offset, length))
+	}()
+	return dest.writeTo(w)
+}
+
+// managedDownloadSection validates the requested range of a file and then
+// downloads it to the destination.
+func (r *Renter) managedDownloadSection(path string, destination downloadDestination, destinationString string, offset, length uint64) error {
+	// Lookup the file associated with the nickname.
+	lockID := r.mu.RLock()
+	file, exists := r.files[path]
+	r.mu.RUnlock(lockID)
+	if !exists {
+		return ErrDownloadUnknownPath
+	}
+
+	// Validate the requested range.
+	if offset >= file.size {
+		return ErrDownloadOffset
+	}
+	if length == 0 {
+		length = file.size - offset
+	} else if length > file.size-offset {
+		return ErrDownloadLength
+	}
+	return r.managedDownload(file, destination, destinationString, offset, length)
+}
+
+// managedDownload queues a download of the given range of a file and blocks
+// until the download has completed.
+func (r *Renter) managedDownload(file *file, destination downloadDestination, destinationString string, offset, length uint64) error {
 	// Create the download object and add it to the queue.
-	d := newDownload(file, destination)
-	lockID = r.mu.Lock()
+	d := newDownload(file, destination, destinationString, offset, length)
+	lockID := r.mu.Lock()
 	r.downloadQueue = append(r.downloadQueue, d)
 	r.mu.Unlock(lockID)
 	r.newDownloads <- d
@@ -48,11 +115,39 @@ func (r *Renter) DownloadQueue() []modules.DownloadInfo {
 		d := r.downloadQueue[len(r.downloadQueue)-i-1]
 		downloads[i] = modules.DownloadInfo{
 			SiaPath:     d.siapath,
-			Destination: d.destination,
-			Filesize:    d.fileSize,
+			Destination: d.destinationString,
+			Filesize:    d.length,
+			Offset:      d.offset,
 			StartTime:   d.startTime,
 		}
 		downloads[i].Received = atomic.LoadUint64(&d.atomicDataReceived)
+		status, err := d.status()
+		downloads[i].Status = status
+		if err != nil {
+			downloads[i].Error = err.Error()
+		}
 	}
 	return downloads
 }
+
+// ClearDownloads removes the downloads that have completed or errored from
+// the download queue, returning the number of downloads removed. Active
+// downloads are kept.
+func (r *Renter) ClearDownloads() int {
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	active := r.downloadQueue[:0]
+	for _, d := range r.downloadQueue {
+		if status, _ := d.status(); status == modules.DownloadStatusActive {
+			active = append(active, d)
+		}
+	}
+	cleared := len(r.downloadQueue) - len(active)
+	// Zero the tail so that the cleared downloads can be garbage collected.
+	for i := len(active); i < len(r.downloadQueue); i++ {
+		r.downloadQueue[i] = nil
+	}
+	r.downloadQueue = active
+	return cleared
+}
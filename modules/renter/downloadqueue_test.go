@@ -0,0 +1,60 @@
+package renter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/sync"
+)
+
+// TestDownloadQueueStatus checks that the download queue reports the status
+// of each download, and that ClearDownloads only removes finished downloads.
+func TestDownloadQueueStatus(t *testing.T) {
+	active := &download{siapath: "active"}
+	completed := &download{siapath: "completed", downloadComplete: true}
+	errored := &download{siapath: "errored", downloadComplete: true, downloadErr: errors.New("no hosts")}
+	r := &Renter{
+		downloadQueue: []*download{active, completed, errored},
+		mu:            sync.New(modules.SafeMutexDelay, 1),
+	}
+
+	// The queue is ordered from most recent to least recent.
+	queue := r.DownloadQueue()
+	expected := []struct {
+		siapath, status, err string
+	}{
+		{"errored", modules.DownloadStatusErrored, "no hosts"},
+		{"completed", modules.DownloadStatusCompleted, ""},
+		{"active", modules.DownloadStatusActive, ""},
+	}
+	if len(queue) != len(expected) {
+		t.Fatalf("expected %v downloads, got %v", len(expected), len(queue))
+	}
+	for i, e := range expected {
+		if queue[i].SiaPath != e.siapath || queue[i].Status != e.status || queue[i].Error != e.err {
+			t.Errorf("download %v: expected %v/%v/%q, got %v/%v/%q", i, e.siapath, e.status, e.err, queue[i].SiaPath, queue[i].Status, queue[i].Error)
+		}
+	}
+
+	// Clearing should remove the completed and errored downloads.
+	if cleared := r.ClearDownloads(); cleared != 2 {
+		t.Fatal("expected 2 downloads to be cleared, got", cleared)
+	}
+	queue = r.DownloadQueue()
+	if len(queue) != 1 || queue[0].SiaPath != "active" {
+		t.Fatal("active download was not kept:", queue)
+	}
+
+	// Once the active download completes, it can be cleared as well.
+	active.downloadComplete = true
+	if queue = r.DownloadQueue(); queue[0].Status != modules.DownloadStatusCompleted {
+		t.Fatal("expected download to be completed, got", queue[0].Status)
+	}
+	if cleared := r.ClearDownloads(); cleared != 1 {
+		t.Fatal("expected 1 download to be cleared, got", cleared)
+	}
+	if queue = r.DownloadQueue(); len(queue) != 0 {
+		t.Fatal("expected an empty download queue, got", queue)
+	}
+}
@@ -1,6 +1,7 @@
 package renter
 
 import (
+	"errors"
 	"io"
 
 	"github.com/klauspost/reedsolomon"
@@ -8,6 +9,16 @@ import (
 	"github.com/NebulousLabs/Sia/modules"
 )
 
+var (
+	// errReplicationMissingPieces is returned when every piece of a
+	// replicated chunk is missing.
+	errReplicationMissingPieces = errors.New("no pieces available to recover replicated data")
+
+	// errReplicationNoData is returned when encoding empty data with a
+	// replication code.
+	errReplicationNoData = errors.New("cannot replicate empty data")
+)
+
 // rsCode is a Reed-Solomon encoder/decoder. It implements the
 // modules.ErasureCoder interface.
 type rsCode struct {
@@ -65,3 +76,55 @@ func NewRSCode(nData, nParity int) (modules.ErasureCoder, error) {
 		dataPieces: nData,
 	}, nil
 }
+
+// replicationCode stores a full copy of the data in each piece. It implements
+// the modules.ErasureCoder interface without any coding overhead, which makes
+// it useful for testing the upload and download pipeline.
+type replicationCode struct {
+	numPieces int
+}
+
+// NumPieces returns the number of pieces returned by Encode.
+func (rc *replicationCode) NumPieces() int { return rc.numPieces }
+
+// MinPieces return the minimum number of pieces that must be present to
+// recover the original data. Any single piece is sufficient.
+func (rc *replicationCode) MinPieces() int { return 1 }
+
+// Encode returns numPieces copies of data.
+func (rc *replicationCode) Encode(data []byte) ([][]byte, error) {
+	if len(data) == 0 {
+		return nil, errReplicationNoData
+	}
+	pieces := make([][]byte, rc.numPieces)
+	for i := range pieces {
+		pieces[i] = append([]byte(nil), data...)
+	}
+	return pieces, nil
+}
+
+// Recover writes the first n bytes of the first available piece to w.
+func (rc *replicationCode) Recover(pieces [][]byte, n uint64, w io.Writer) error {
+	for _, piece := range pieces {
+		if piece == nil {
+			continue
+		}
+		if uint64(len(piece)) < n {
+			return io.ErrUnexpectedEOF
+		}
+		_, err := w.Write(piece[:n])
+		return err
+	}
+	return errReplicationMissingPieces
+}
+
+// NewReplicationCode creates a new replication encoder/decoder that stores
+// the data in numPieces pieces.
+func NewReplicationCode(numPieces int) (modules.ErasureCoder, error) {
+	if numPieces < 1 {
+		return nil, errors.New("replication code must have at least one piece")
+	}
+	return &replicationCode{
+		numPieces: numPieces,
+	}, nil
+}
@@ -57,6 +57,58 @@ func TestRSEncode(t *testing.T) {
 	}
 }
 
+// TestReplicationCode tests the replicationCode type.
+func TestReplicationCode(t *testing.T) {
+	if _, err := NewReplicationCode(0); err == nil {
+		t.Error("expected bad parameter error, got nil")
+	}
+
+	rc, err := NewReplicationCode(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.NumPieces() != 3 || rc.MinPieces() != 1 {
+		t.Fatal("wrong number of pieces:", rc.NumPieces(), rc.MinPieces())
+	}
+
+	data := make([]byte, 777)
+	rand.Read(data)
+	pieces, err := rc.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rc.Encode(nil); err == nil {
+		t.Fatal("expected nil data error, got nil")
+	}
+
+	// Any single piece should be enough to recover the data.
+	pieces[0], pieces[2] = nil, nil
+	buf := new(bytes.Buffer)
+	if err = rc.Recover(pieces, 700, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data[:700], buf.Bytes()) {
+		t.Fatal("recovered data does not match original")
+	}
+	if err = rc.Recover(make([][]byte, 3), 700, buf); err != errReplicationMissingPieces {
+		t.Fatal("expected errReplicationMissingPieces, got", err)
+	}
+
+	// A file using the replication code should keep it when persisted.
+	f := newFile("foo", rc, 100, 1000)
+	saved := new(bytes.Buffer)
+	if err = f.MarshalSia(saved); err != nil {
+		t.Fatal(err)
+	}
+	var loaded file
+	if err = loaded.UnmarshalSia(saved); err != nil {
+		t.Fatal(err)
+	}
+	if lrc, ok := loaded.erasureCode.(*replicationCode); !ok || lrc.numPieces != 3 {
+		t.Fatal("replication code was not persisted:", loaded.erasureCode)
+	}
+}
+
 func BenchmarkRSEncode(b *testing.B) {
 	rsc, err := NewRSCode(80, 20)
 	if err != nil {
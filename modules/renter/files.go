@@ -1,9 +1,12 @@
 package renter
 
 import (
+	"bytes"
 	"errors"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/NebulousLabs/Sia/build"
@@ -16,6 +19,10 @@ var (
 	ErrEmptyFilename = errors.New("filename must be a nonempty string")
 	ErrUnknownPath   = errors.New("no file known with that path")
 	ErrPathOverload  = errors.New("a file already exists at that location")
+
+	// ErrZeroDataPieces is returned when a file is uploaded with an erasure
+	// code that has no data pieces.
+	ErrZeroDataPieces = errors.New("erasure code must have at least one data piece")
 )
 
 // A file is a single file that has been uploaded to the network. Files are
@@ -32,6 +39,15 @@ type file struct {
 	pieceSize   uint64               // Static - can be accessed without lock.
 	mode        uint32               // actually an os.FileMode
 
+	// repairFailures is the number of consecutive failed repairs of the
+	// file, and uploadError is the error of the latest failure once
+	// maxRepairFailures has been reached. Neither is persisted.
+	repairFailures int
+	uploadError    string
+
+	// cancel is closed when the upload of the file is canceled.
+	cancel chan struct{}
+
 	mu sync.RWMutex
 }
 
@@ -96,6 +112,49 @@ func (f *file) available() bool {
 	return true
 }
 
+// missingHosts returns the minimum number of additional hosts needed to make
+// the file recoverable, counting only the pieces stored on the contracts in
+// healthy. Each host stores at most one piece of a given chunk, so the result
+// is the largest shortfall of any chunk. A recoverable file returns 0.
+func (f *file) missingHosts(healthy map[types.FileContractID]struct{}) int {
+	var missing int
+	for _, pieces := range f.healthyPieces(healthy) {
+		if n := f.erasureCode.MinPieces() - len(pieces); n > missing {
+			missing = n
+		}
+	}
+	return missing
+}
+
+// needsRepair reports whether any chunk of the file is missing pieces on the
+// contracts in healthy.
+func (f *file) needsRepair(healthy map[types.FileContractID]struct{}) bool {
+	for _, pieces := range f.healthyPieces(healthy) {
+		if len(pieces) < f.erasureCode.NumPieces() {
+			return true
+		}
+	}
+	return false
+}
+
+// healthyPieces returns, for each chunk of the file, the set of pieces that
+// are stored on the contracts in healthy.
+func (f *file) healthyPieces(healthy map[types.FileContractID]struct{}) []map[uint64]struct{} {
+	chunkPieces := make([]map[uint64]struct{}, f.numChunks())
+	for i := range chunkPieces {
+		chunkPieces[i] = make(map[uint64]struct{})
+	}
+	for id, fc := range f.contracts {
+		if _, ok := healthy[id]; !ok {
+			continue
+		}
+		for _, p := range fc.Pieces {
+			chunkPieces[p.Chunk][p.Piece] = struct{}{}
+		}
+	}
+	return chunkPieces
+}
+
 // uploadProgress indicates what percentage of the file (plus redundancy) has
 // been uploaded. Note that a file may be Available long before UploadProgress
 // reaches 100%, and UploadProgress may report a value greater than 100%.
@@ -109,6 +168,17 @@ func (f *file) uploadProgress() float64 {
 	return 100 * (float64(uploaded) / float64(desired))
 }
 
+// uploadCanceled reports whether the upload of the file has been canceled.
+// The file's lock must be held.
+func (f *file) uploadCanceled() bool {
+	select {
+	case <-f.cancel:
+		return true
+	default:
+		return false
+	}
+}
+
 // redundancy returns the redundancy of the least redundant chunk. A file
 // becomes available when this redundancy is >= 1. Assumes that every piece is
 // unique within a file contract. -1 is returned if the file has size 0.
@@ -163,6 +233,50 @@ func newFile(name string, code modules.ErasureCoder, pieceSize, fileSize uint64)
 		masterKey:   key,
 		erasureCode: code,
 		pieceSize:   pieceSize,
+		cancel:      make(chan struct{}),
+	}
+}
+
+// contractIDs sorts file contract IDs in byte order.
+type contractIDs []types.FileContractID
+
+func (ids contractIDs) Len() int           { return len(ids) }
+func (ids contractIDs) Less(i, j int) bool { return bytes.Compare(ids[i][:], ids[j][:]) < 0 }
+func (ids contractIDs) Swap(i, j int)      { ids[i], ids[j] = ids[j], ids[i] }
+
+// info returns the status of the file. The file keeps the IDs of the
+// contracts its pieces were uploaded to, so the contracts are reported by the
+// IDs that resolveID maps them to. The file's lock must be held.
+func (f *file) info(resolveID func(types.FileContractID) types.FileContractID) modules.FileInfo {
+	renewing := true
+	seen := make(map[types.FileContractID]struct{})
+	contracts := make([]types.FileContractID, 0, len(f.contracts))
+	for id, fc := range f.contracts {
+		if len(fc.Pieces) == 0 {
+			continue
+		}
+		// A file can have pieces on both a contract and its renewal.
+		id = resolveID(id)
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			contracts = append(contracts, id)
+		}
+	}
+	// Sort the contracts so that the info of an unchanged file is identical
+	// across calls.
+	sort.Sort(contractIDs(contracts))
+	return modules.FileInfo{
+		SiaPath:        f.name,
+		Filesize:       f.size,
+		Available:      f.available(),
+		Redundancy:     f.redundancy(),
+		Renewing:       renewing,
+		UploadProgress: f.uploadProgress(),
+		UploadError:    f.uploadError,
+		Expiration:     f.expiration(),
+		DataPieces:     f.erasureCode.MinPieces(),
+		ParityPieces:   f.erasureCode.NumPieces() - f.erasureCode.MinPieces(),
+		Contracts:      contracts,
 	}
 }
 
@@ -180,18 +294,47 @@ func (r *Renter) DeleteFile(nickname string) error {
 	}
 	delete(r.files, nickname)
 	os.RemoveAll(filepath.Join(r.persistDir, f.name+ShareExtension))
-	r.saveSync()
-	r.mu.Unlock(lockID)
 
 	// delete the file's associated contract data.
 	f.mu.Lock()
-	defer f.mu.Unlock()
+	r.sectors.removeRefs(f)
+	f.mu.Unlock()
+	r.saveSync()
+	r.mu.Unlock(lockID)
 
 	// TODO: delete the sectors of the file as well.
 
 	return nil
 }
 
+// DeleteFolder removes every file entry whose path lies beneath the folder
+// prefix from the renter, returning the number of entries removed.
+func (r *Renter) DeleteFolder(prefix string) (int, error) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return 0, ErrEmptyFilename
+	}
+
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	var deleted int
+	for nickname, f := range r.files {
+		if !strings.HasPrefix(nickname, prefix+"/") {
+			continue
+		}
+		delete(r.files, nickname)
+		os.RemoveAll(filepath.Join(r.persistDir, f.name+ShareExtension))
+		f.mu.Lock()
+		r.sectors.removeRefs(f)
+		f.mu.Unlock()
+		deleted++
+	}
+	if deleted == 0 {
+		return 0, ErrUnknownPath
+	}
+	return deleted, r.saveSync()
+}
+
 // FileList returns all of the files that the renter has.
 func (r *Renter) FileList() []modules.FileInfo {
 	lockID := r.mu.RLock()
@@ -200,24 +343,74 @@ func (r *Renter) FileList() []modules.FileInfo {
 	files := make([]modules.FileInfo, 0, len(r.files))
 	for _, f := range r.files {
 		f.mu.RLock()
-		renewing := true
-		files = append(files, modules.FileInfo{
-			SiaPath:        f.name,
-			Filesize:       f.size,
-			Available:      f.available(),
-			Redundancy:     f.redundancy(),
-			Renewing:       renewing,
-			UploadProgress: f.uploadProgress(),
-			Expiration:     f.expiration(),
+		files = append(files, f.info(r.hostContractor.ResolveID))
+		f.mu.RUnlock()
+	}
+	return files
+}
+
+// liveContracts returns the IDs of the contractor's live contracts.
+func (r *Renter) liveContracts() map[types.FileContractID]struct{} {
+	live := make(map[types.FileContractID]struct{})
+	for _, c := range r.hostContractor.Contracts() {
+		live[c.ID] = struct{}{}
+	}
+	return live
+}
+
+// healthyContracts returns the IDs in f.contracts whose most recent renewal
+// is one of the contracts in live. The caller must hold f.mu.
+func (r *Renter) healthyContracts(f *file, live map[types.FileContractID]struct{}) map[types.FileContractID]struct{} {
+	healthy := make(map[types.FileContractID]struct{})
+	for id := range f.contracts {
+		if _, ok := live[r.hostContractor.ResolveID(id)]; ok {
+			healthy[id] = struct{}{}
+		}
+	}
+	return healthy
+}
+
+// Recoverable reports, for each file, whether it can be reconstructed from
+// the contractor's live contracts, and if not, how many additional healthy
+// hosts are needed.
+func (r *Renter) Recoverable() []modules.FileRecoverability {
+	live := r.liveContracts()
+
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	files := make([]modules.FileRecoverability, 0, len(r.files))
+	for _, f := range r.files {
+		f.mu.RLock()
+		missing := f.missingHosts(r.healthyContracts(f, live))
+		files = append(files, modules.FileRecoverability{
+			SiaPath:      f.name,
+			Recoverable:  missing == 0,
+			MissingHosts: missing,
 		})
 		f.mu.RUnlock()
 	}
 	return files
 }
 
+// File returns information on the file at the given path.
+func (r *Renter) File(siaPath string) (modules.FileInfo, error) {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+
+	f, exists := r.files[siaPath]
+	if !exists {
+		return modules.FileInfo{}, ErrUnknownPath
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.info(r.hostContractor.ResolveID), nil
+}
+
 // RenameFile takes an existing file and changes the nickname. The original
 // file must exist, and there must not be any file that already has the
-// replacement nickname.
+// replacement nickname. If no file has the original nickname, it is treated as
+// a folder, and every file beneath it is moved beneath the replacement
+// nickname. Either every file in the folder is renamed or none are.
 func (r *Renter) RenameFile(currentName, newName string) error {
 	lockID := r.mu.Lock()
 	defer r.mu.Unlock(lockID)
@@ -227,38 +420,75 @@ func (r *Renter) RenameFile(currentName, newName string) error {
 		return ErrEmptyFilename
 	}
 
-	// Check that currentName exists and newName doesn't.
-	file, exists := r.files[currentName]
-	if !exists {
+	// Determine the set of files being renamed.
+	renames := make(map[string]string)
+	if _, exists := r.files[currentName]; exists {
+		renames[currentName] = newName
+	} else {
+		folder := strings.TrimSuffix(currentName, "/") + "/"
+		newFolder := strings.TrimSuffix(newName, "/") + "/"
+		for nickname := range r.files {
+			if strings.HasPrefix(nickname, folder) {
+				renames[nickname] = newFolder + strings.TrimPrefix(nickname, folder)
+			}
+		}
+	}
+	if len(renames) == 0 {
 		return ErrUnknownPath
 	}
-	_, exists = r.files[newName]
-	if exists {
-		return ErrPathOverload
+
+	// Check that none of the new names are taken.
+	for _, name := range renames {
+		if _, exists := r.files[name]; exists {
+			return ErrPathOverload
+		}
 	}
 
-	// Modify the file and save it to disk.
-	file.mu.Lock()
-	file.name = newName
-	err := r.saveFile(file)
-	file.mu.Unlock()
-	if err != nil {
-		return err
+	// Modify the files and save them to disk. If any file fails to save,
+	// restore the original names of the files that were already saved.
+	var saved []string
+	for oldName, name := range renames {
+		file := r.files[oldName]
+		file.mu.Lock()
+		file.name = name
+		err := r.saveFile(file)
+		file.mu.Unlock()
+		if err != nil {
+			file.mu.Lock()
+			file.name = oldName
+			file.mu.Unlock()
+			for _, savedName := range saved {
+				savedFile := r.files[savedName]
+				savedFile.mu.Lock()
+				os.RemoveAll(filepath.Join(r.persistDir, savedFile.name+ShareExtension))
+				savedFile.name = savedName
+				savedFile.mu.Unlock()
+			}
+			return err
+		}
+		saved = append(saved, oldName)
 	}
 
 	// Update the entries in the renter.
-	delete(r.files, currentName)
-	r.files[newName] = file
-	if t, ok := r.tracking[currentName]; ok {
-		delete(r.tracking, currentName)
-		r.tracking[newName] = t
+	for oldName, name := range renames {
+		r.files[name] = r.files[oldName]
+		delete(r.files, oldName)
+		if t, ok := r.tracking[oldName]; ok {
+			delete(r.tracking, oldName)
+			r.tracking[name] = t
+		}
 	}
-	err = r.saveSync()
+	err := r.saveSync()
 	if err != nil {
 		return err
 	}
 
-	// Delete the old .sia file.
-	oldPath := filepath.Join(r.persistDir, currentName+ShareExtension)
-	return os.RemoveAll(oldPath)
+	// Delete the old .sia files.
+	for oldName := range renames {
+		oldPath := filepath.Join(r.persistDir, oldName+ShareExtension)
+		if err := os.RemoveAll(oldPath); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -3,8 +3,11 @@ package renter
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/sync"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -180,6 +183,161 @@ func TestFileExpiration(t *testing.T) {
 	}
 }
 
+// TestFileMissingHosts probes the missingHosts method of the file type.
+func TestFileMissingHosts(t *testing.T) {
+	rsc, _ := NewRSCode(2, 2)
+	f := &file{
+		size:        1000,
+		erasureCode: rsc,
+		pieceSize:   100,
+		contracts:   make(map[types.FileContractID]fileContract),
+	}
+
+	// Store one piece of every chunk on each of four contracts.
+	healthy := make(map[types.FileContractID]struct{})
+	for i := uint64(0); i < 4; i++ {
+		var fc fileContract
+		for j := uint64(0); j < f.numChunks(); j++ {
+			fc.Pieces = append(fc.Pieces, pieceData{Chunk: j, Piece: i})
+		}
+		id := types.FileContractID{byte(i)}
+		f.contracts[id] = fc
+		healthy[id] = struct{}{}
+	}
+	if n := f.missingHosts(healthy); n != 0 {
+		t.Fatal("expected file to be recoverable, missing", n)
+	}
+
+	// Drop contracts until the file is no longer recoverable.
+	delete(healthy, types.FileContractID{0})
+	delete(healthy, types.FileContractID{1})
+	if n := f.missingHosts(healthy); n != 0 {
+		t.Fatal("expected file to be recoverable with the minimum pieces, missing", n)
+	}
+	delete(healthy, types.FileContractID{2})
+	if n := f.missingHosts(healthy); n != 1 {
+		t.Fatal("expected 1 missing host, got", n)
+	}
+	delete(healthy, types.FileContractID{3})
+	if n := f.missingHosts(healthy); n != 2 {
+		t.Fatal("expected 2 missing hosts, got", n)
+	}
+
+	// A chunk that is short a piece should be counted even if the other
+	// chunks are complete.
+	healthy = map[types.FileContractID]struct{}{{0}: {}, {1}: {}}
+	fc := f.contracts[types.FileContractID{1}]
+	fc.Pieces = fc.Pieces[1:]
+	f.contracts[types.FileContractID{1}] = fc
+	if n := f.missingHosts(healthy); n != 1 {
+		t.Fatal("expected 1 missing host, got", n)
+	}
+}
+
+// recoverableContractor is a hostContractor whose set of live contracts can
+// be changed during a test.
+type recoverableContractor struct {
+	hostContractor
+	contracts []modules.RenterContract
+	renewed   map[types.FileContractID]types.FileContractID
+}
+
+func (rc *recoverableContractor) Contracts() []modules.RenterContract { return rc.contracts }
+func (rc *recoverableContractor) ResolveID(id types.FileContractID) types.FileContractID {
+	if newID, ok := rc.renewed[id]; ok {
+		return newID
+	}
+	return id
+}
+
+// TestFileInfoContracts checks that the info of a file reports the current
+// IDs of the contracts storing it, even if they have been renewed.
+func TestFileInfoContracts(t *testing.T) {
+	rsc, _ := NewRSCode(1, 2)
+	f := newFile("foo", rsc, 100, 100)
+	for i := uint64(0); i < 3; i++ {
+		id := types.FileContractID{byte(i)}
+		f.contracts[id] = fileContract{ID: id, Pieces: []pieceData{{Chunk: 0, Piece: i}}}
+	}
+	// Contract 1 was renewed as contract 2, which also stores a piece, and
+	// contract 0 was renewed as contract 3.
+	hc := &recoverableContractor{renewed: map[types.FileContractID]types.FileContractID{
+		{0}: {3},
+		{1}: {2},
+	}}
+
+	contracts := f.info(hc.ResolveID).Contracts
+	expected := []types.FileContractID{{2}, {3}}
+	if len(contracts) != len(expected) {
+		t.Fatal("expected contracts", expected, "got", contracts)
+	}
+	for i := range expected {
+		if contracts[i] != expected[i] {
+			t.Fatal("expected contracts", expected, "got", contracts)
+		}
+	}
+}
+
+// TestRenterRecoverable probes the Recoverable method of the renter type.
+func TestRenterRecoverable(t *testing.T) {
+	// Create a file with 2 data pieces and 1 parity piece, each stored on a
+	// different contract.
+	rsc, _ := NewRSCode(2, 1)
+	f := &file{
+		name:        "foo",
+		size:        100,
+		erasureCode: rsc,
+		pieceSize:   100,
+		contracts:   make(map[types.FileContractID]fileContract),
+	}
+	hc := new(recoverableContractor)
+	for i := uint64(0); i < 3; i++ {
+		id := types.FileContractID{byte(i)}
+		f.contracts[id] = fileContract{ID: id, Pieces: []pieceData{{Chunk: 0, Piece: i}}}
+		hc.contracts = append(hc.contracts, modules.RenterContract{ID: id})
+	}
+	r := &Renter{
+		files:          map[string]*file{f.name: f},
+		hostContractor: hc,
+		mu:             sync.New(modules.SafeMutexDelay, 1),
+	}
+
+	recoverable := func() modules.FileRecoverability {
+		files := r.Recoverable()
+		if len(files) != 1 || files[0].SiaPath != "foo" {
+			t.Fatal("Recoverable returned the wrong files:", files)
+		}
+		return files[0]
+	}
+
+	// Losing the parity piece should leave the file recoverable.
+	if fr := recoverable(); !fr.Recoverable || fr.MissingHosts != 0 {
+		t.Fatal("file should be recoverable:", fr)
+	}
+
+	// Renewing the contracts should not affect the file, even though it
+	// still refers to them by their original IDs.
+	hc.renewed = make(map[types.FileContractID]types.FileContractID)
+	for i := range hc.contracts {
+		renewedID := types.FileContractID{byte(i), 1}
+		hc.renewed[hc.contracts[i].ID] = renewedID
+		hc.contracts[i].ID = renewedID
+	}
+	if fr := recoverable(); !fr.Recoverable || fr.MissingHosts != 0 {
+		t.Fatal("file should be recoverable after its contracts were renewed:", fr)
+	}
+	hc.contracts = hc.contracts[:2]
+	if fr := recoverable(); !fr.Recoverable || fr.MissingHosts != 0 {
+		t.Fatal("file should be recoverable with only its data pieces:", fr)
+	}
+
+	// Dropping below the recovery threshold should make it unrecoverable.
+	hc.contracts = hc.contracts[:1]
+	if fr := recoverable(); fr.Recoverable || fr.MissingHosts != 1 {
+		t.Fatal("file should not be recoverable:", fr)
+	}
+}
+
 // TestRenterDeleteFile probes the DeleteFile method of the renter type.
 func TestRenterDeleteFile(t *testing.T) {
 	if testing.Short() {
@@ -247,6 +405,91 @@ func TestRenterDeleteFile(t *testing.T) {
 	}
 }
 
+// TestRenterDeleteFolder probes the DeleteFolder method of the renter type.
+func TestRenterDeleteFolder(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRenterDeleteFolder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Delete a folder from an empty renter.
+	if _, err = rt.renter.DeleteFolder("foo"); err != ErrUnknownPath {
+		t.Error("Expected ErrUnknownPath:", err)
+	}
+	if _, err = rt.renter.DeleteFolder(""); err != ErrEmptyFilename {
+		t.Error("Expected ErrEmptyFilename:", err)
+	}
+
+	// Put several files in the renter, some of them in the folder.
+	for _, name := range []string{"foo/1", "foo/2", "foo/bar/3", "foobar", "foo", "baz/foo/4"} {
+		f := newTestingFile()
+		f.name = name
+		rt.renter.files[f.name] = f
+	}
+
+	// Delete the folder. Only the files beneath it should be removed.
+	deleted, err := rt.renter.DeleteFolder("foo/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 3 {
+		t.Error("expected 3 files to be deleted, got", deleted)
+	}
+	var remaining []string
+	for _, fi := range rt.renter.FileList() {
+		remaining = append(remaining, fi.SiaPath)
+	}
+	if len(remaining) != 3 {
+		t.Fatal("expected 3 files to remain, got", remaining)
+	}
+	for _, name := range remaining {
+		if strings.HasPrefix(name, "foo/") {
+			t.Error("file in deleted folder still reported in FileList:", name)
+		}
+	}
+
+	// Deleting the folder again should fail.
+	if _, err = rt.renter.DeleteFolder("foo"); err != ErrUnknownPath {
+		t.Error("Expected ErrUnknownPath:", err)
+	}
+}
+
+// TestRenterFile probes the File method of the renter type.
+func TestRenterFile(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRenterFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Put a file in the renter.
+	f := newTestingFile()
+	f.name = "foo/bar"
+	rt.renter.files[f.name] = f
+
+	fi, err := rt.renter.File("foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.SiaPath != "foo/bar" || fi.Filesize != f.size {
+		t.Error("File returned the wrong file info:", fi)
+	}
+
+	// Nonexistent files and folders should not be found.
+	for _, siaPath := range []string{"dne", "foo", "foo/", "foo/bar/"} {
+		if _, err := rt.renter.File(siaPath); err != ErrUnknownPath {
+			t.Errorf("%q: expected ErrUnknownPath, got %v", siaPath, err)
+		}
+	}
+}
+
 // TestRenterFileList probes the FileList method of the renter type.
 func TestRenterFileList(t *testing.T) {
 	if testing.Short() {
@@ -340,7 +583,7 @@ func TestRenterRenameFile(t *testing.T) {
 	}
 
 	// Renaming should also update the tracking set
-	rt.renter.tracking["1"] = trackedFile{"foo"}
+	rt.renter.tracking["1"] = trackedFile{RepairPath: "foo"}
 	err = rt.renter.RenameFile("1", "1b")
 	if err != nil {
 		t.Fatal(err)
@@ -351,3 +594,63 @@ func TestRenterRenameFile(t *testing.T) {
 		t.Error("renaming should have updated the entry in the tracking set")
 	}
 }
+
+// TestRenterRenameFolder probes renaming a folder with the rename method of
+// the renter.
+func TestRenterRenameFolder(t *testing.T) {
+	rt, err := newRenterTester("TestRenterRenameFolder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Put several files in the renter, some of them in the folder.
+	for _, name := range []string{"foo/bar/1", "foo/bar/2", "foo/bar/baz/3", "foo/barn", "taken/2"} {
+		f := newTestingFile()
+		f.name = name
+		rt.renter.files[f.name] = f
+		if err := rt.renter.saveFile(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A rename that collides with an existing file should leave every file
+	// untouched.
+	err = rt.renter.RenameFile("foo/bar", "taken")
+	if err != ErrPathOverload {
+		t.Fatal("Expecting ErrPathOverload, got", err)
+	}
+	for _, name := range []string{"foo/bar/1", "foo/bar/2", "foo/bar/baz/3", "taken/2"} {
+		if f, exists := rt.renter.files[name]; !exists || f.name != name {
+			t.Error("file was modified by a failed rename:", name)
+		}
+	}
+
+	// Rename the folder.
+	err = rt.renter.RenameFile("foo/bar", "baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]bool{"baz/1": true, "baz/2": true, "baz/baz/3": true, "foo/barn": true, "taken/2": true}
+	files := rt.renter.FileList()
+	if len(files) != len(expected) {
+		t.Fatal("FileList has unexpected number of files:", len(files))
+	}
+	for _, fi := range files {
+		if !expected[fi.SiaPath] {
+			t.Error("unexpected file after rename:", fi.SiaPath)
+		}
+		if _, err := os.Stat(filepath.Join(rt.renter.persistDir, fi.SiaPath+ShareExtension)); err != nil {
+			t.Error("renamed file was not saved:", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(rt.renter.persistDir, "foo", "bar", "1"+ShareExtension)); !os.IsNotExist(err) {
+		t.Error("old .sia file was not deleted:", err)
+	}
+
+	// Renaming the old folder again should fail.
+	err = rt.renter.RenameFile("foo/bar", "baz2")
+	if err != ErrUnknownPath {
+		t.Error("Expecting ErrUnknownPath, got", err)
+	}
+}
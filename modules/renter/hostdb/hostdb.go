@@ -35,7 +35,8 @@ const (
 )
 
 var (
-	errNilCS = errors.New("cannot create hostdb with nil consensus set")
+	errNilCS       = errors.New("cannot create hostdb with nil consensus set")
+	errUnknownHost = errors.New("host is not in the hostdb")
 )
 
 // The HostDB is a database of potential hosts. It assigns a weight to each
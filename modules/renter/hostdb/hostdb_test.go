@@ -4,11 +4,13 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/renter/hostdb/hosttree"
 	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 // bareHostDB returns a HostDB with its fields initialized, but without any
@@ -109,3 +111,55 @@ func TestRandomHosts(t *testing.T) {
 		}
 	}
 }
+
+// TestRandomHostsWeighted checks that RandomHosts prefers hosts with a higher
+// weight, i.e. cheap hosts with a good uptime over expensive, flaky hosts.
+func TestRandomHostsWeighted(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hdb := bareHostDB()
+
+	good, bad := makeHostDBEntry(), makeHostDBEntry()
+	good.NetAddress, bad.NetAddress = fakeAddr(1), fakeAddr(2)
+	good.RemainingStorage, bad.RemainingStorage = 250e3, 250e3
+	good.StoragePrice, bad.StoragePrice = types.NewCurrency64(10), types.NewCurrency64(40)
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		scanTime := now.Add(time.Duration(i-10) * time.Hour)
+		good.ScanHistory = append(good.ScanHistory, modules.HostDBScan{Timestamp: scanTime, Success: true})
+		bad.ScanHistory = append(bad.ScanHistory, modules.HostDBScan{Timestamp: scanTime, Success: i%2 == 0})
+	}
+	for _, entry := range []modules.HostDBEntry{good, bad} {
+		hdb.activeHosts[entry.NetAddress] = &hostEntry{HostDBEntry: entry}
+		hdb.hostTree.Insert(entry)
+	}
+	if hdb.calculateHostWeight(good).Cmp(hdb.calculateHostWeight(bad)) <= 0 {
+		t.Fatal("cheap, reliable host should outweigh an expensive, flaky host")
+	}
+
+	// The good host should be selected far more often. Its weight is several
+	// thousand times higher, so a 95% threshold will practically never fail.
+	const samples = 1000
+	var goodSelections int
+	for i := 0; i < samples; i++ {
+		hosts := hdb.RandomHosts(1, nil)
+		if len(hosts) != 1 {
+			t.Fatal("expected 1 host, got", len(hosts))
+		}
+		if hosts[0].NetAddress == good.NetAddress {
+			goodSelections++
+		}
+	}
+	if goodSelections < samples*95/100 {
+		t.Fatalf("good host was selected only %v times out of %v", goodSelections, samples)
+	}
+
+	// Excluded hosts are never selected, regardless of weight.
+	for i := 0; i < 20; i++ {
+		hosts := hdb.RandomHosts(1, []modules.NetAddress{good.NetAddress})
+		if len(hosts) != 1 || hosts[0].NetAddress != bad.NetAddress {
+			t.Fatal("RandomHosts returned an excluded host:", hosts)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package hostdb
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
@@ -13,8 +14,21 @@ type hostEntry struct {
 
 	Weight      types.Currency
 	Reliability types.Currency
+
+	// ScannedEpoch is the SettingsEpoch at which the host's settings were
+	// last read.
+	ScannedEpoch uint64
+
+	// refreshAttempt is when RefreshHost last scanned the host, successful or
+	// not. It is not persisted.
+	refreshAttempt time.Time
 }
 
+// refreshHostInterval is the minimum time between the scans RefreshHost makes
+// of a host whose settings are stale. Without it, every call for an
+// unreachable host would block on a scan.
+const refreshHostInterval = 10 * time.Minute
+
 // insertHost adds a host entry to the state. The host will be inserted into
 // the set of all hosts, and if it is online and responding to requests it will
 // be put into the list of active hosts.
@@ -26,9 +40,12 @@ func (hdb *HostDB) insertHost(host modules.HostDBEntry) {
 		hdb.log.Debugf("WARN: host '%v' has an invalid NetAddress: %v", host.NetAddress, err)
 		return
 	}
-	// Don't do anything if we've already seen this host and the public key is
-	// the same.
+	// If we've already seen this host and the public key is the same, the
+	// host may have re-announced itself because its settings changed. Bump
+	// its settings epoch so that the settings are re-read before they are
+	// used to negotiate with the host.
 	if knownHost, exists := hdb.allHosts[host.NetAddress]; exists && bytes.Equal(host.PublicKey.Key, knownHost.PublicKey.Key) {
+		knownHost.SettingsEpoch++
 		return
 	}
 
@@ -73,6 +90,49 @@ func (hdb *HostDB) Host(addr modules.NetAddress) (modules.HostDBEntry, bool) {
 	return entry.HostDBEntry, true
 }
 
+// UpdateEntry updates the settings of a known host using settings that were
+// received outside of a scan, e.g. during contract negotiation. The host must
+// already be in the hostdb with the same public key.
+func (hdb *HostDB) UpdateEntry(host modules.HostDBEntry) error {
+	hdb.mu.RLock()
+	entry, exists := hdb.allHosts[host.NetAddress]
+	hdb.mu.RUnlock()
+	if !exists || entry == nil || !bytes.Equal(entry.PublicKey.Key, host.PublicKey.Key) {
+		return errUnknownHost
+	}
+	hdb.mu.RLock()
+	epoch := entry.SettingsEpoch
+	hdb.mu.RUnlock()
+	hdb.managedUpdateEntry(entry, host.HostExternalSettings, 0, nil)
+	// The settings were read from the host during negotiation, so they are
+	// as fresh as a scan.
+	hdb.mu.Lock()
+	entry.ScannedEpoch = epoch
+	hdb.mu.Unlock()
+	return nil
+}
+
+// RefreshHost returns the entry of the host at the given address, first
+// re-reading the host's settings if the host has announced itself since they
+// were last read. If the host cannot be reached, the settings are left as
+// they were, and the host is not scanned again for refreshHostInterval.
+func (hdb *HostDB) RefreshHost(addr modules.NetAddress) (modules.HostDBEntry, bool) {
+	hdb.mu.Lock()
+	entry, exists := hdb.allHosts[addr]
+	stale := exists && entry != nil && entry.ScannedEpoch != entry.SettingsEpoch &&
+		time.Since(entry.refreshAttempt) >= refreshHostInterval
+	if stale {
+		// Record the attempt before scanning, so that concurrent callers do
+		// not scan the host as well.
+		entry.refreshAttempt = time.Now()
+	}
+	hdb.mu.Unlock()
+	if stale {
+		hdb.managedScanHost(entry)
+	}
+	return hdb.Host(addr)
+}
+
 // ActiveHosts returns the hosts that can be randomly selected out of the
 // hostdb, sorted by preference.
 func (hdb *HostDB) ActiveHosts() (activeHosts []modules.HostDBEntry) {
@@ -88,6 +148,13 @@ func (hdb *HostDB) ActiveHosts() (activeHosts []modules.HostDBEntry) {
 	return sortedHosts
 }
 
+// HostWeight returns the weight that the hostdb assigns to the host with the
+// given public key when selecting hosts. false is returned if the host has not
+// been weighted, which happens when the host is not active.
+func (hdb *HostDB) HostWeight(pk types.SiaPublicKey) (types.Currency, bool) {
+	return hdb.hostTree.Weight(pk)
+}
+
 // AllHosts returns all of the hosts known to the hostdb, including the
 // inactive ones.
 func (hdb *HostDB) AllHosts() (allHosts []modules.HostDBEntry) {
@@ -103,6 +103,125 @@ func TestActiveHosts(t *testing.T) {
 	}
 }
 
+// TestUpdateEntry tests the UpdateEntry method.
+func TestUpdateEntry(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+
+	// unknown host should be rejected
+	h := makeHostDBEntry()
+	h.NetAddress = fakeAddr(1)
+	if err := hdb.UpdateEntry(h); err != errUnknownHost {
+		t.Fatal("expected errUnknownHost, got", err)
+	}
+
+	// known host should have its settings updated and become active
+	hdb.allHosts[h.NetAddress] = &hostEntry{HostDBEntry: h}
+	h.ContractPrice = types.NewCurrency64(100)
+	if err := hdb.UpdateEntry(h); err != nil {
+		t.Fatal(err)
+	}
+	if entry, ok := hdb.Host(h.NetAddress); !ok || entry.ContractPrice.Cmp(h.ContractPrice) != 0 {
+		t.Error("host settings were not updated")
+	}
+	if len(hdb.ActiveHosts()) != 1 {
+		t.Error("updated host was not added to the set of active hosts")
+	}
+
+	// host with a different public key should be rejected
+	h2 := makeHostDBEntry()
+	h2.NetAddress = h.NetAddress
+	if err := hdb.UpdateEntry(h2); err != errUnknownHost {
+		t.Fatal("expected errUnknownHost, got", err)
+	}
+}
+
+// TestSettingsEpoch checks that a known host announcing itself again bumps
+// its settings epoch, and that settings read by UpdateEntry are current.
+func TestSettingsEpoch(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+
+	h := makeHostDBEntry()
+	h.NetAddress = fakeAddr(1)
+	hdb.insertHost(h)
+	if entry, _ := hdb.Host(h.NetAddress); entry.SettingsEpoch != 0 {
+		t.Fatal("new host should start at epoch 0, got", entry.SettingsEpoch)
+	}
+
+	// Announcing again with the same key bumps the epoch, which marks the
+	// settings as stale.
+	hdb.insertHost(h)
+	if entry, _ := hdb.Host(h.NetAddress); entry.SettingsEpoch != 1 {
+		t.Fatal("re-announcement should bump the epoch, got", entry.SettingsEpoch)
+	}
+	if e := hdb.allHosts[h.NetAddress]; e.ScannedEpoch == e.SettingsEpoch {
+		t.Fatal("settings should be stale after a re-announcement")
+	}
+
+	// A different key at the same address is not a re-announcement.
+	h2 := makeHostDBEntry()
+	h2.NetAddress = h.NetAddress
+	hdb.insertHost(h2)
+	if entry, _ := hdb.Host(h.NetAddress); entry.SettingsEpoch != 0 || entry.PublicKey.String() != h2.PublicKey.String() {
+		t.Fatal("host with a new key should replace the old entry")
+	}
+	hdb.insertHost(h2)
+
+	// Settings read during negotiation are current, so RefreshHost does not
+	// need to rescan the host.
+	h2.StoragePrice = types.NewCurrency64(5)
+	if err := hdb.UpdateEntry(h2); err != nil {
+		t.Fatal(err)
+	}
+	if e := hdb.allHosts[h.NetAddress]; e.ScannedEpoch != e.SettingsEpoch {
+		t.Fatal("settings from UpdateEntry should be current")
+	}
+	entry, ok := hdb.RefreshHost(h.NetAddress)
+	if !ok || !entry.StoragePrice.Equals(h2.StoragePrice) || entry.SettingsEpoch != 1 {
+		t.Fatal("RefreshHost returned the wrong entry:", entry, ok)
+	}
+}
+
+// TestRefreshHostRateLimit checks that RefreshHost does not rescan a host with
+// stale settings more than once per refreshHostInterval, even if the scan
+// fails.
+func TestRefreshHostRateLimit(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+
+	// The host is unreachable, and its settings are stale.
+	h := makeHostDBEntry()
+	h.NetAddress = fakeAddr(1)
+	hdb.insertHost(h)
+	hdb.insertHost(h)
+	entry := hdb.allHosts[h.NetAddress]
+	scans := len(entry.ScanHistory)
+
+	if _, ok := hdb.RefreshHost(h.NetAddress); !ok {
+		t.Fatal("host was not found")
+	}
+	if len(entry.ScanHistory) != scans+1 {
+		t.Fatal("expected RefreshHost to scan the host")
+	}
+	if entry.ScannedEpoch == entry.SettingsEpoch {
+		t.Fatal("a failed scan should leave the settings stale")
+	}
+
+	// A second call should return the cached entry without scanning.
+	hdb.RefreshHost(h.NetAddress)
+	if len(entry.ScanHistory) != scans+1 {
+		t.Fatal("RefreshHost rescanned the host within refreshHostInterval")
+	}
+
+	// Once the interval has passed, the host is scanned again.
+	entry.refreshAttempt = time.Now().Add(-refreshHostInterval)
+	hdb.RefreshHost(h.NetAddress)
+	if len(entry.ScanHistory) != scans+2 {
+		t.Fatal("expected RefreshHost to scan the host again")
+	}
+}
+
 // TestAverageContractPrice tests the AverageContractPrice method, which also depends on the
 // randomHosts method.
 func TestAverageContractPrice(t *testing.T) {
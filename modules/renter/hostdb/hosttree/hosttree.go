@@ -241,6 +241,19 @@ func (ht *HostTree) Modify(hdbe modules.HostDBEntry) error {
 	return nil
 }
 
+// Weight returns the weight of the host with the public key provided by
+// `pk`. false is returned if the host is not in the tree.
+func (ht *HostTree) Weight(pk types.SiaPublicKey) (types.Currency, bool) {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+
+	node, exists := ht.hosts[string(pk.Key)]
+	if !exists {
+		return types.Currency{}, false
+	}
+	return node.entry.weight, true
+}
+
 // SelectRandom grabs a random n hosts from the tree. There will be no repeats, but
 // the length of the slice returned may be less than n, and may even be zero.
 // The hosts that are returned first have the higher priority. Hosts passed to
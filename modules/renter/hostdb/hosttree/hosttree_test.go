@@ -562,3 +562,34 @@ func TestRandomHosts(t *testing.T) {
 		t.Error("doubled up")
 	}
 }
+
+// TestHostTreeWeight checks that Weight returns the weight of hosts in the
+// tree, and reports hosts that are not in the tree.
+func TestHostTreeWeight(t *testing.T) {
+	tree := New(func(dbe modules.HostDBEntry) types.Currency {
+		return types.NewCurrency64(uint64(len(dbe.NetAddress)))
+	})
+
+	entry := makeHostDBEntry()
+	entry.NetAddress = "foo.com:9982"
+	if err := tree.Insert(entry); err != nil {
+		t.Fatal(err)
+	}
+	weight, exists := tree.Weight(entry.PublicKey)
+	if !exists {
+		t.Fatal("host in the tree was not found")
+	}
+	if weight.Cmp(types.NewCurrency64(uint64(len(entry.NetAddress)))) != 0 {
+		t.Error("wrong weight returned:", weight)
+	}
+
+	if _, exists = tree.Weight(makeHostDBEntry().PublicKey); exists {
+		t.Error("host not in the tree was found")
+	}
+	if err := tree.Remove(entry.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists = tree.Weight(entry.PublicKey); exists {
+		t.Error("removed host was found")
+	}
+}
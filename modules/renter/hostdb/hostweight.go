@@ -119,6 +119,17 @@ func (hdb *HostDB) calculateHostWeight(entry modules.HostDBEntry) types.Currency
 		weight = weight.Div64(1000) // Because something weird is happening, don't trust this host very much.
 	}
 
+	// Enact penalties for hosts that have failed recent scans, in proportion
+	// to the share of scans that failed. Hosts that have not been scanned yet
+	// are not penalized.
+	var successes uint64
+	for _, scan := range entry.ScanHistory {
+		if scan.Success {
+			successes++
+		}
+	}
+	weight = weight.Mul64(successes + 1).Div64(uint64(len(entry.ScanHistory)) + 1)
+
 	// Account for collateral. Collateral has a somewhat complicated
 	// relationship with price, because raising the collateral inherently
 	// raises the price for renters. If the host's score increases linearly to
@@ -29,6 +29,12 @@ const (
 
 	maxSettingsLen = 2e3
 
+	// maxScanHistory is the number of recent scans that are kept for each
+	// host. Older scans are discarded. Given the scanning defaults, this
+	// covers roughly two weeks, which is longer than the window the
+	// contractor uses to judge whether a host is offline.
+	maxScanHistory = 250
+
 	hostRequestTimeout = 60 * time.Second
 	hostScanDeadline   = 60 * time.Second
 
@@ -122,21 +128,34 @@ func (hdb *HostDB) decrementReliability(addr modules.NetAddress, penalty types.C
 	}
 }
 
+// addScan records the result of a scan in the host's scan history, discarding
+// the oldest scans once the history holds maxScanHistory scans.
+func (entry *hostEntry) addScan(scan modules.HostDBScan) {
+	entry.ScanHistory = append(entry.ScanHistory, scan)
+	// Ensure the scans are sorted.
+	if !sort.IsSorted(entry.ScanHistory) {
+		sort.Sort(entry.ScanHistory)
+	}
+	if len(entry.ScanHistory) > maxScanHistory {
+		entry.ScanHistory = append(modules.HostDBScans(nil), entry.ScanHistory[len(entry.ScanHistory)-maxScanHistory:]...)
+	}
+}
+
 // managedUpdateEntry updates an entry in the hostdb after a scan has taken
-// place.
-func (hdb *HostDB) managedUpdateEntry(entry *hostEntry, newSettings modules.HostExternalSettings, netErr error) {
+// place. latency is the time the host took to respond to the scan.
+func (hdb *HostDB) managedUpdateEntry(entry *hostEntry, newSettings modules.HostExternalSettings, latency time.Duration, netErr error) {
 	hdb.mu.Lock()
 	defer hdb.mu.Unlock()
 
 	// Add a data point for the scan.
-	entry.ScanHistory = append(entry.ScanHistory, modules.HostDBScan{
+	scan := modules.HostDBScan{
 		Timestamp: time.Now(),
 		Success:   netErr == nil,
-	})
-	// Ensure the scans are sorted.
-	if !sort.IsSorted(entry.ScanHistory) {
-		sort.Sort(entry.ScanHistory)
 	}
+	if scan.Success {
+		scan.Latency = latency
+	}
+	entry.addScan(scan)
 
 	// Add the host to allHosts.
 	priorHost, exists := hdb.allHosts[entry.NetAddress]
@@ -198,9 +217,11 @@ func (hdb *HostDB) managedScanHost(hostEntry *hostEntry) {
 	hdb.mu.RLock()
 	netAddr := hostEntry.NetAddress
 	pubKey := hostEntry.PublicKey
+	epoch := hostEntry.SettingsEpoch
 	hdb.mu.RUnlock()
 	hdb.log.Debugln("Scanning", netAddr, pubKey)
 	var settings modules.HostExternalSettings
+	start := time.Now()
 	err := func() error {
 		dialer := &net.Dialer{
 			Cancel:  hdb.tg.StopChan(),
@@ -229,6 +250,7 @@ func (hdb *HostDB) managedScanHost(hostEntry *hostEntry) {
 		copy(pubkey[:], pubKey.Key)
 		return crypto.ReadSignedObject(conn, &settings, maxSettingsLen, pubkey)
 	}()
+	latency := time.Since(start)
 	if err != nil {
 		hdb.log.Debugln("Scanning", netAddr, pubKey, "failed:", err)
 	} else {
@@ -236,7 +258,14 @@ func (hdb *HostDB) managedScanHost(hostEntry *hostEntry) {
 	}
 
 	// Update the host tree to have a new entry.
-	hdb.managedUpdateEntry(hostEntry, settings, err)
+	hdb.managedUpdateEntry(hostEntry, settings, latency, err)
+	if err == nil {
+		// Record that the settings are current as of the epoch at which the
+		// scan started; an announcement during the scan leaves them stale.
+		hdb.mu.Lock()
+		hostEntry.ScannedEpoch = epoch
+		hdb.mu.Unlock()
+	}
 }
 
 // threadedProbeHosts tries to fetch the settings of a host. If successful, the
@@ -1,6 +1,7 @@
 package hostdb
 
 import (
+	"errors"
 	"net"
 	"testing"
 	"time"
@@ -44,6 +45,64 @@ func TestDecrementReliability(t *testing.T) {
 	}
 }
 
+// TestScanHistory checks that scans are recorded in a host's scan history,
+// that the history is bounded, and that failed scans lower the host's uptime
+// and weight.
+func TestScanHistory(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+
+	h := new(hostEntry)
+	h.NetAddress = "foo"
+	h.AcceptingContracts = true
+	h.PublicKey = types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: []byte{1, 2, 3}}
+	h.RemainingStorage = 250e3
+	h.Reliability = MaxReliability
+	initialWeight := hdb.calculateHostWeight(h.HostDBEntry)
+
+	// Record four scans, one of which failed.
+	scanErr := errors.New("host is offline")
+	hdb.managedUpdateEntry(h, h.HostExternalSettings, 10*time.Millisecond, nil)
+	hdb.managedUpdateEntry(h, h.HostExternalSettings, 50*time.Millisecond, scanErr)
+	hdb.managedUpdateEntry(h, h.HostExternalSettings, 20*time.Millisecond, nil)
+	hdb.managedUpdateEntry(h, h.HostExternalSettings, 30*time.Millisecond, nil)
+
+	host, ok := hdb.Host(h.NetAddress)
+	if !ok {
+		t.Fatal("host was not added to the hostdb")
+	}
+	if len(host.ScanHistory) != 4 {
+		t.Fatal("expected 4 scans, got", len(host.ScanHistory))
+	}
+	expected := []struct {
+		success bool
+		latency time.Duration
+	}{{true, 10 * time.Millisecond}, {false, 0}, {true, 20 * time.Millisecond}, {true, 30 * time.Millisecond}}
+	for i, scan := range host.ScanHistory {
+		if scan.Success != expected[i].success || scan.Latency != expected[i].latency {
+			t.Errorf("scan %v: expected %v/%v, got %v/%v", i, expected[i].success, expected[i].latency, scan.Success, scan.Latency)
+		}
+	}
+	if uptime := host.ScanHistory.Uptime(); uptime != 75 {
+		t.Error("expected an uptime of 75%, got", uptime)
+	}
+	if weight, ok := hdb.HostWeight(host.PublicKey); !ok || weight.Cmp(initialWeight) >= 0 {
+		t.Error("a failed scan should lower the host's weight:", weight, initialWeight)
+	}
+
+	// Once the history is full, the oldest scans are discarded.
+	for i := 0; i < maxScanHistory; i++ {
+		hdb.managedUpdateEntry(h, h.HostExternalSettings, 0, scanErr)
+	}
+	host, _ = hdb.Host(h.NetAddress)
+	if len(host.ScanHistory) != maxScanHistory {
+		t.Fatalf("expected %v scans, got %v", maxScanHistory, len(host.ScanHistory))
+	}
+	if uptime := host.ScanHistory.Uptime(); uptime != 0 {
+		t.Error("expected an uptime of 0% after the successful scans were discarded, got", uptime)
+	}
+}
+
 // probeDialer is used to test the threadedProbeHosts method. A simple type
 // alias is used so that it can easily be redefined during testing, allowing
 // multiple behaviors to be tested.
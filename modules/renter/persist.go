@@ -11,6 +11,7 @@ import (
 	"strconv"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/persist"
@@ -72,6 +73,14 @@ func (f *file) MarshalSia(w io.Writer) error {
 		if err != nil {
 			return err
 		}
+	case *replicationCode:
+		err = enc.EncodeAll(
+			"Replication",
+			uint64(code.numPieces),
+		)
+		if err != nil {
+			return err
+		}
 	default:
 		if build.DEBUG {
 			panic("unknown erasure code")
@@ -132,6 +141,16 @@ func (f *file) UnmarshalSia(r io.Reader) error {
 			return err
 		}
 		f.erasureCode = rsc
+	case "Replication":
+		var nPieces uint64
+		if err := dec.Decode(&nPieces); err != nil {
+			return err
+		}
+		rc, err := NewReplicationCode(int(nPieces))
+		if err != nil {
+			return err
+		}
+		f.erasureCode = rc
 	default:
 		return errors.New("unrecognized erasure code type: " + codeType)
 	}
@@ -181,16 +200,24 @@ func (r *Renter) saveFile(f *file) error {
 // save stores the current renter data to disk.
 func (r *Renter) save() error {
 	data := struct {
-		Tracking map[string]trackedFile
-	}{r.tracking}
+		Tracking             map[string]trackedFile
+		Sectors              []indexedSector
+		DedupSecret          crypto.Hash
+		MaxConcurrentUploads int
+		DebugLogging         bool
+	}{r.tracking, r.sectors.sectors(), r.dedupSecret, r.maxConcurrentUploads, r.debugLogging}
 	return persist.SaveFile(saveMetadata, data, filepath.Join(r.persistDir, PersistFilename))
 }
 
 // saveSync stores the current renter data to disk and then syncs to disk.
 func (r *Renter) saveSync() error {
 	data := struct {
-		Tracking map[string]trackedFile
-	}{r.tracking}
+		Tracking             map[string]trackedFile
+		Sectors              []indexedSector
+		DedupSecret          crypto.Hash
+		MaxConcurrentUploads int
+		DebugLogging         bool
+	}{r.tracking, r.sectors.sectors(), r.dedupSecret, r.maxConcurrentUploads, r.debugLogging}
 	return persist.SaveFileSync(saveMetadata, data, filepath.Join(r.persistDir, PersistFilename))
 }
 
@@ -233,8 +260,12 @@ func (r *Renter) load() error {
 
 	// Load contracts, repair set, and entropy.
 	data := struct {
-		Tracking  map[string]trackedFile
-		Repairing map[string]string // COMPATv0.4.8
+		Tracking             map[string]trackedFile
+		Repairing            map[string]string // COMPATv0.4.8
+		Sectors              []indexedSector
+		DedupSecret          crypto.Hash
+		MaxConcurrentUploads int
+		DebugLogging         bool
 	}{}
 	err = persist.LoadFile(saveMetadata, &data, filepath.Join(r.persistDir, PersistFilename))
 	if err != nil {
@@ -243,6 +274,22 @@ func (r *Renter) load() error {
 	if data.Tracking != nil {
 		r.tracking = data.Tracking
 	}
+	r.dedupSecret = data.DedupSecret
+	r.maxConcurrentUploads = data.MaxConcurrentUploads
+	r.debugLogging = data.DebugLogging
+	if err := r.hostContractor.SetLogVerbosity(logVerbosity(r.debugLogging)); err != nil {
+		return err
+	}
+
+	// Rebuild the sector index, counting the references held by the loaded
+	// files.
+	r.sectors = newSectorIndex(data.Sectors)
+	for _, f := range r.files {
+		f.mu.RLock()
+		r.sectors.addRefs(f)
+		f.mu.RUnlock()
+	}
+	r.sectors.prune()
 
 	return nil
 }
@@ -387,6 +434,7 @@ func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
 	names := make([]string, numFiles)
 	for i, f := range files {
 		r.files[f.name] = f
+		r.sectors.addRefs(f)
 		names[i] = f.name
 	}
 	// Save the files.
@@ -417,6 +465,16 @@ func (r *Renter) initPersist() error {
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
+
+	// Generate the deduplication secret if the renter does not have one yet.
+	if r.dedupSecret == (crypto.Hash{}) {
+		secret, err := crypto.RandBytes(crypto.HashSize)
+		if err != nil {
+			return err
+		}
+		copy(r.dedupSecret[:], secret)
+		return r.saveSync()
+	}
 	return nil
 }
 
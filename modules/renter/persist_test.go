@@ -229,6 +229,34 @@ func TestRenterSaveLoad(t *testing.T) {
 	}
 }
 
+// TestRenterSaveLoadDebugLogging checks that the DebugLogging setting
+// survives a save and load.
+func TestRenterSaveLoadDebugLogging(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRenterSaveLoadDebugLogging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	id := rt.renter.mu.Lock()
+	rt.renter.debugLogging = true
+	err = rt.renter.save()
+	rt.renter.debugLogging = false
+	if err == nil {
+		err = rt.renter.load()
+	}
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rt.renter.Settings().DebugLogging {
+		t.Fatal("DebugLogging was not persisted")
+	}
+}
+
 // TestRenterPaths checks that the renter properly handles nicknames
 // containing the path separator ("/").
 func TestRenterPaths(t *testing.T) {
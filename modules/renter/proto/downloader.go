@@ -5,11 +5,65 @@ import (
 	"net"
 	"time"
 
+	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 )
 
+var (
+	// errCorruptSector is returned when the data sent by the host does not
+	// match the sector that was requested, or cannot be proven to belong to
+	// the contract's file Merkle root.
+	errCorruptSector = errors.New("host sent corrupt sector data")
+)
+
+// verifySector checks that sector is the data whose Merkle root is root, and
+// that root is a member of the file Merkle root of contract. The membership
+// check is performed by building a storage proof for the first segment of
+// the sector against the contract's sector roots, and verifying it against
+// the file Merkle root of the latest revision. The root comparison shows that
+// the host sent the requested data; the membership check shows that the data
+// is covered by the revision the host signed, and not just by the renter's
+// record of sector roots. If either check fails, an error identifying the bad
+// sector is returned.
+func verifySector(sector []byte, root crypto.Hash, contract modules.RenterContract) error {
+	corrupt := func() error {
+		return build.ExtendErr("sector "+root.String(), errCorruptSector)
+	}
+	if crypto.MerkleRoot(sector) != root {
+		return corrupt()
+	}
+
+	// locate the sector within the contract
+	index := -1
+	for i, r := range contract.MerkleRoots {
+		if r == root {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return corrupt()
+	}
+
+	// prove the first segment of the sector against the file Merkle root
+	segmentsPerSector := modules.SectorSize / crypto.SegmentSize
+	segmentIndex := uint64(index) * segmentsPerSector
+	base, cachedHashSet := crypto.MerkleProof(sector, 0)
+	tree := crypto.NewCachedTree(sectorHeight)
+	tree.SetIndex(segmentIndex)
+	for _, r := range contract.MerkleRoots {
+		tree.Push(r)
+	}
+	hashSet := tree.Prove(base, cachedHashSet)
+	numSegments := uint64(len(contract.MerkleRoots)) * segmentsPerSector
+	if !crypto.VerifySegment(base, hashSet, numSegments, segmentIndex, contract.LastRevision.NewFileMerkleRoot) {
+		return corrupt()
+	}
+	return nil
+}
+
 // A Downloader retrieves sectors by calling the download RPC on a host.
 // Downloaders are NOT thread- safe; calls to Sector must be serialized.
 type Downloader struct {
@@ -17,7 +71,8 @@ type Downloader struct {
 	contract modules.RenterContract // updated after each revision
 	conn     net.Conn
 
-	SaveFn revisionSaver
+	SaveFn            revisionSaver
+	MissedProofPolicy MissedProofPolicy
 }
 
 // Sector retrieves the sector with the specified Merkle root, and revises
@@ -34,7 +89,7 @@ func (hd *Downloader) Sector(root crypto.Hash) (modules.RenterContract, []byte,
 	}
 
 	// create the download revision
-	rev := newDownloadRevision(hd.contract.LastRevision, sectorPrice)
+	rev := newDownloadRevision(hd.contract.LastRevision, sectorPrice, hd.MissedProofPolicy)
 
 	// initiate download by confirming host settings
 	if err := startDownload(hd.conn, hd.host); err != nil {
@@ -83,8 +138,8 @@ func (hd *Downloader) Sector(root crypto.Hash) (modules.RenterContract, []byte,
 	sector := sectors[0]
 	if uint64(len(sector)) != modules.SectorSize {
 		return modules.RenterContract{}, nil, errors.New("host did not send enough sector data")
-	} else if crypto.MerkleRoot(sector) != root {
-		return modules.RenterContract{}, nil, errors.New("host sent bad sector data")
+	} else if err := verifySector(sector, root, hd.contract); err != nil {
+		return modules.RenterContract{}, nil, err
 	}
 
 	// update contract and metrics
@@ -106,8 +161,9 @@ func (hd *Downloader) Close() error {
 }
 
 // NewDownloader initiates the download request loop with a host, and returns a
-// Downloader.
-func NewDownloader(host modules.HostDBEntry, contract modules.RenterContract) (*Downloader, error) {
+// Downloader. The connection is made with dialer from localAddr; a nil dialer
+// means StdDialer, and a nil localAddr lets the operating system choose.
+func NewDownloader(host modules.HostDBEntry, contract modules.RenterContract, dialer Dialer, localAddr net.Addr) (*Downloader, error) {
 	// check that contract has enough value to support a download
 	if len(contract.LastRevision.NewValidProofOutputs) != 2 {
 		return nil, errors.New("invalid contract")
@@ -118,7 +174,7 @@ func NewDownloader(host modules.HostDBEntry, contract modules.RenterContract) (*
 	}
 
 	// initiate download loop
-	conn, err := net.DialTimeout("tcp", string(contract.NetAddress), 15*time.Second)
+	conn, err := dialAddress(dialer, contract.NetAddress, localAddr, defaultDialTimeout)
 	if err != nil {
 		return nil, err
 	}
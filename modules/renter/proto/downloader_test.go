@@ -0,0 +1,61 @@
+package proto
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestVerifySector tests that verifySector accepts sectors that belong to the
+// contract's file Merkle root and rejects corrupt sectors, identifying the
+// bad sector in the error.
+func TestVerifySector(t *testing.T) {
+	// create a contract containing several sectors
+	var sectors [][]byte
+	var contract modules.RenterContract
+	for i := 0; i < 5; i++ {
+		sector, err := crypto.RandBytes(int(modules.SectorSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sectors = append(sectors, sector)
+		contract.MerkleRoots = append(contract.MerkleRoots, crypto.MerkleRoot(sector))
+	}
+	contract.LastRevision.NewFileMerkleRoot = cachedMerkleRoot(contract.MerkleRoots)
+
+	// every sector should verify
+	for i, sector := range sectors {
+		if err := verifySector(sector, contract.MerkleRoots[i], contract); err != nil {
+			t.Fatalf("sector %v failed to verify: %v", i, err)
+		}
+	}
+
+	// corrupt one sector; it should be rejected and identified
+	root := contract.MerkleRoots[2]
+	corrupted := append([]byte(nil), sectors[2]...)
+	corrupted[len(corrupted)-1]++
+	err := verifySector(corrupted, root, contract)
+	if err == nil || !strings.Contains(err.Error(), errCorruptSector.Error()) {
+		t.Fatal("expected errCorruptSector, got", err)
+	} else if !strings.Contains(err.Error(), root.String()) {
+		t.Fatal("error does not identify the bad sector:", err)
+	}
+
+	// a sector that is not part of the contract should be rejected
+	other, err := crypto.RandBytes(int(modules.SectorSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifySector(other, crypto.MerkleRoot(other), contract); err == nil {
+		t.Fatal("expected sector outside of the contract to be rejected")
+	}
+
+	// a sector should be rejected if the contract's file Merkle root does
+	// not commit to it
+	contract.LastRevision.NewFileMerkleRoot = cachedMerkleRoot(contract.MerkleRoots[:4])
+	if err := verifySector(sectors[2], contract.MerkleRoots[2], contract); err == nil {
+		t.Fatal("expected sector to be rejected when the file Merkle root does not match")
+	}
+}
@@ -42,7 +42,8 @@ type Editor struct {
 	height   types.BlockHeight
 	contract modules.RenterContract // updated after each revision
 
-	SaveFn revisionSaver
+	SaveFn            revisionSaver
+	MissedProofPolicy MissedProofPolicy
 }
 
 // Close cleanly terminates the revision loop with the host and closes the
@@ -139,7 +140,7 @@ func (he *Editor) Upload(data []byte) (modules.RenterContract, crypto.Hash, erro
 		SectorIndex: uint64(len(he.contract.MerkleRoots)),
 		Data:        data,
 	}}
-	rev := newUploadRevision(he.contract.LastRevision, merkleRoot, sectorPrice, sectorCollateral)
+	rev := newUploadRevision(he.contract.LastRevision, merkleRoot, sectorPrice, sectorCollateral, he.MissedProofPolicy)
 
 	// run the revision iteration
 	if err := he.runRevisionIteration(actions, rev, newRoots); err != nil {
@@ -223,7 +224,7 @@ func (he *Editor) Modify(oldRoot, newRoot crypto.Hash, offset uint64, newData []
 		Offset:      offset,
 		Data:        newData,
 	}}
-	rev := newModifyRevision(he.contract.LastRevision, merkleRoot, sectorBandwidthPrice)
+	rev := newModifyRevision(he.contract.LastRevision, merkleRoot, sectorBandwidthPrice, he.MissedProofPolicy)
 
 	// run the revision iteration
 	if err := he.runRevisionIteration(actions, rev, newRoots); err != nil {
@@ -237,15 +238,16 @@ func (he *Editor) Modify(oldRoot, newRoot crypto.Hash, offset uint64, newData []
 }
 
 // NewEditor initiates the contract revision process with a host, and returns
-// an Editor.
-func NewEditor(host modules.HostDBEntry, contract modules.RenterContract, currentHeight types.BlockHeight) (*Editor, error) {
+// an Editor. The connection is made with dialer from localAddr; a nil dialer
+// means StdDialer, and a nil localAddr lets the operating system choose.
+func NewEditor(host modules.HostDBEntry, contract modules.RenterContract, currentHeight types.BlockHeight, dialer Dialer, localAddr net.Addr) (*Editor, error) {
 	// check that contract has enough value to support an upload
 	if len(contract.LastRevision.NewValidProofOutputs) != 2 {
 		return nil, errors.New("invalid contract")
 	}
 
 	// initiate revision loop
-	conn, err := net.DialTimeout("tcp", string(contract.NetAddress), 15*time.Second)
+	conn, err := dialAddress(dialer, contract.NetAddress, localAddr, defaultDialTimeout)
 	if err != nil {
 		return nil, err
 	}
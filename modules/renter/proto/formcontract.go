@@ -1,8 +1,9 @@
 package proto
 
 import (
+	"bytes"
 	"errors"
-	"net"
+	"fmt"
 	"time"
 
 	"github.com/NebulousLabs/Sia/crypto"
@@ -15,6 +16,45 @@ const (
 	// estTxnSize is the estimated size of an encoded file contract
 	// transaction set.
 	estTxnSize = 2048
+
+	// defaultDialTimeout is the default timeout for connecting to a host.
+	defaultDialTimeout = 15 * time.Second
+
+	// defaultTxnSetTimeout is the default time allotted for reading the
+	// host's additions to the contract transaction.
+	defaultTxnSetTimeout = 120 * time.Second
+
+	// defaultMaxTxnSetSize is the default limit on the total encoded size of
+	// the host's additions to the contract transaction. A contract
+	// transaction set only needs to fit in the transaction pool, so it is
+	// much smaller than a block.
+	defaultMaxTxnSetSize = modules.NegotiateMaxFileContractSetLen
+
+	// maxCollateralMultiple is the largest multiple of a host's storage price
+	// that the renter will accept as the host's collateral. The host's
+	// collateral is part of the contract payout, and the renter pays the
+	// siafund fee on the entire payout, so an excessive collateral is paid for
+	// by the renter.
+	maxCollateralMultiple = 10
+)
+
+var (
+	// errHostTamperedContract is returned if the host's additions to the
+	// contract transaction alter the file contract or spend the renter's
+	// outputs.
+	errHostTamperedContract = errors.New("host tampered with the contract transaction")
+
+	// errCollateralTooHigh is returned if the host's collateral is more than
+	// maxCollateralMultiple times its storage price.
+	errCollateralTooHigh = errors.New("host collateral is too high relative to its storage price")
+
+	// errBadContractDuration is returned if the requested contract does not
+	// end after it starts.
+	errBadContractDuration = errors.New("contract end height must be greater than its start height")
+
+	// errTxnSetTooLarge is returned if the host's additions to the contract
+	// transaction exceed the maximum transaction set size.
+	errTxnSetTooLarge = errors.New("host's transaction set is too large")
 )
 
 // FormContract forms a contract with a host and submits the contract
@@ -23,6 +63,14 @@ func FormContract(params ContractParams, txnBuilder transactionBuilder, tpool tr
 	// extract vars from params, for convenience
 	host, filesize, startHeight, endHeight, refundAddress := params.Host, params.Filesize, params.StartHeight, params.EndHeight, params.RefundAddress
 
+	// reject unacceptable contract terms before funding anything
+	if err := checkDuration(host.HostExternalSettings, startHeight, endHeight); err != nil {
+		return modules.RenterContract{}, err
+	}
+	if err := checkWindowSize(host.HostExternalSettings); err != nil {
+		return modules.RenterContract{}, err
+	}
+
 	// create our key
 	ourSK, ourPK, err := crypto.GenerateKeyPair()
 	if err != nil {
@@ -38,48 +86,18 @@ func FormContract(params ContractParams, txnBuilder transactionBuilder, tpool tr
 		SignaturesRequired: 2,
 	}
 
-	// calculate cost to renter and cost to host
-	// TODO: clarify/abstract this math
-	storageAllocation := host.StoragePrice.Mul64(filesize).Mul64(uint64(endHeight - startHeight))
-	hostCollateral := host.Collateral.Mul64(filesize).Mul64(uint64(endHeight - startHeight))
-	if hostCollateral.Cmp(host.MaxCollateral) > 0 {
-		// TODO: if we have to cap the collateral, it probably means we shouldn't be using this host
-		// (ok within a factor of 2)
-		hostCollateral = host.MaxCollateral
+	// create file contract
+	fc, renterCost, err := newFileContract(host, filesize, startHeight, endHeight, refundAddress, uc.UnlockHash())
+	if err != nil {
+		return modules.RenterContract{}, err
 	}
-	hostPayout := hostCollateral.Add(host.ContractPrice)
-	payout := storageAllocation.Add(hostPayout).Mul64(10406).Div64(10000) // renter pays for siafund fee
-	renterCost := payout.Sub(hostCollateral)
 
-	// check for negative currency
-	if types.PostTax(startHeight, payout).Cmp(hostPayout) < 0 {
-		return modules.RenterContract{}, errors.New("payout smaller than host payout")
-	}
-
-	// create file contract
-	fc := types.FileContract{
-		FileSize:       0,
-		FileMerkleRoot: crypto.Hash{}, // no proof possible without data
-		WindowStart:    endHeight,
-		WindowEnd:      endHeight + host.WindowSize,
-		Payout:         payout,
-		UnlockHash:     uc.UnlockHash(),
-		RevisionNumber: 0,
-		ValidProofOutputs: []types.SiacoinOutput{
-			// outputs need to account for tax
-			{Value: types.PostTax(startHeight, payout).Sub(hostPayout), UnlockHash: refundAddress},
-			// collateral is returned to host
-			{Value: hostPayout, UnlockHash: host.UnlockHash},
-		},
-		MissedProofOutputs: []types.SiacoinOutput{
-			// same as above
-			{Value: types.PostTax(startHeight, payout).Sub(hostPayout), UnlockHash: refundAddress},
-			// same as above
-			{Value: hostPayout, UnlockHash: host.UnlockHash},
-			// once we start doing revisions, we'll move some coins to the host and some to the void
-			{Value: types.ZeroCurrency, UnlockHash: types.UnlockHash{}},
-		},
+	// record the duration of each phase of the negotiation
+	metrics := params.Metrics
+	if metrics == nil {
+		metrics = new(modules.NegotiationMetrics)
 	}
+	timer := newNegotiationTimer()
 
 	// calculate transaction fee
 	_, maxFee := tpool.FeeEstimation()
@@ -98,13 +116,15 @@ func FormContract(params ContractParams, txnBuilder transactionBuilder, tpool tr
 	// create initial transaction set
 	txn, parentTxns := txnBuilder.View()
 	txnSet := append(parentTxns, txn)
+	metrics.FundAndSign += timer.lap()
 
 	// initiate connection
-	conn, err := net.DialTimeout("tcp", string(host.NetAddress), 15*time.Second)
+	conn, err := dialHost(params)
 	if err != nil {
 		return modules.RenterContract{}, err
 	}
 	defer func() { _ = conn.Close() }()
+	metrics.Dial += timer.lap()
 
 	// allot time for sending RPC ID + verifySettings
 	extendDeadline(conn, modules.NegotiateSettingsTime)
@@ -120,9 +140,17 @@ func FormContract(params ContractParams, txnBuilder transactionBuilder, tpool tr
 	if !host.AcceptingContracts {
 		return modules.RenterContract{}, errors.New("host is not accepting contracts")
 	}
+	if err = checkDuration(host.HostExternalSettings, startHeight, endHeight); err != nil {
+		return modules.RenterContract{}, err
+	}
+	if err = checkWindowSize(host.HostExternalSettings); err != nil {
+		return modules.RenterContract{}, err
+	}
+	metrics.VerifySettings += timer.lap()
 
 	// allot time for negotiation
-	extendDeadline(conn, modules.NegotiateFileContractTime)
+	deadline := time.Now().Add(timeoutOrDefault(params.Timeouts.Contract, modules.NegotiateFileContractTime))
+	_ = conn.SetDeadline(deadline)
 
 	// send acceptance, txn signed by us, and pubkey
 	if err = modules.WriteNegotiationAcceptance(conn); err != nil {
@@ -141,19 +169,19 @@ func FormContract(params ContractParams, txnBuilder transactionBuilder, tpool tr
 	}
 	// host now sends any new parent transactions, inputs and outputs that
 	// were added to the transaction
-	var newParents []types.Transaction
-	var newInputs []types.SiacoinInput
-	var newOutputs []types.SiacoinOutput
-	if err = encoding.ReadObject(conn, &newParents, types.BlockSizeLimit); err != nil {
-		return modules.RenterContract{}, errors.New("couldn't read the host's added parents: " + err.Error())
-	}
-	if err = encoding.ReadObject(conn, &newInputs, types.BlockSizeLimit); err != nil {
-		return modules.RenterContract{}, errors.New("couldn't read the host's added inputs: " + err.Error())
+	newParents, newInputs, newOutputs, err := readHostAdditions(conn, params, deadline)
+	if err != nil {
+		return modules.RenterContract{}, err
 	}
-	if err = encoding.ReadObject(conn, &newOutputs, types.BlockSizeLimit); err != nil {
-		return modules.RenterContract{}, errors.New("couldn't read the host's added outputs: " + err.Error())
+
+	// the host must not spend any of our inputs or the outputs of our parent
+	// transactions
+	if err = checkHostInputs(txnSet, newInputs); err != nil {
+		return modules.RenterContract{}, modules.WriteNegotiationRejection(conn, err)
 	}
 
+	metrics.Exchange += timer.lap()
+
 	// merge txnAdditions with txnSet
 	txnBuilder.AddParents(newParents)
 	for _, input := range newInputs {
@@ -206,6 +234,7 @@ func FormContract(params ContractParams, txnBuilder transactionBuilder, tpool tr
 		return modules.RenterContract{}, modules.WriteNegotiationRejection(conn, errors.New("failed to sign revision transaction: "+err.Error()))
 	}
 	revisionTxn.TransactionSignatures[0].Signature = encodedSig[:]
+	metrics.FundAndSign += timer.lap()
 
 	// Send acceptance and signatures
 	if err = modules.WriteNegotiationAcceptance(conn); err != nil {
@@ -239,6 +268,10 @@ func FormContract(params ContractParams, txnBuilder transactionBuilder, tpool tr
 	// Construct the final transaction.
 	txn, parentTxns = txnBuilder.View()
 	txnSet = append(parentTxns, txn)
+	if err = checkContractTxn(txn, fc, startHeight); err != nil {
+		return modules.RenterContract{}, err
+	}
+	metrics.Exchange += timer.lap()
 
 	// Submit to blockchain.
 	err = tpool.AcceptTransactionSet(txnSet)
@@ -249,12 +282,16 @@ func FormContract(params ContractParams, txnBuilder transactionBuilder, tpool tr
 	if err != nil {
 		return modules.RenterContract{}, err
 	}
+	metrics.Submit += timer.lap()
 
 	// calculate contract ID
 	fcid := txn.FileContractID(0)
+	metrics.ContractID = fcid
+	metrics.NetAddress = host.NetAddress
 
 	return modules.RenterContract{
 		FileContract:    fc,
+		HostPublicKey:   host.PublicKey,
 		ID:              fcid,
 		LastRevision:    initRevision,
 		LastRevisionTxn: revisionTxn,
@@ -262,9 +299,133 @@ func FormContract(params ContractParams, txnBuilder transactionBuilder, tpool tr
 		SecretKey:       ourSK,
 		StartHeight:     startHeight,
 
+		Capacity: filesize,
+
 		TotalCost:   renterCost,
 		ContractFee: host.ContractPrice,
 		TxnFee:      txnFee,
 		SiafundFee:  types.Tax(startHeight, fc.Payout),
 	}, nil
 }
+
+// ContractCost returns the amount that FormContract would spend, including
+// the transaction fee, to form a contract with the specified parameters. The
+// host is not contacted.
+func ContractCost(params ContractParams, tpool transactionPool) (types.Currency, error) {
+	_, renterCost, err := newFileContract(params.Host, params.Filesize, params.StartHeight, params.EndHeight, params.RefundAddress, types.UnlockHash{})
+	if err != nil {
+		return types.Currency{}, err
+	}
+	_, maxFee := tpool.FeeEstimation()
+	return renterCost.Add(maxFee.Mul64(estTxnSize)), nil
+}
+
+// checkDuration checks that a contract starting at startHeight and ending at
+// endHeight is within the host's maximum contract duration.
+func checkDuration(settings modules.HostExternalSettings, startHeight, endHeight types.BlockHeight) error {
+	if endHeight <= startHeight {
+		return errBadContractDuration
+	}
+	if duration := endHeight - startHeight; duration > settings.MaxDuration {
+		return fmt.Errorf("contract duration of %v blocks exceeds the host's maximum duration of %v blocks", duration, settings.MaxDuration)
+	}
+	return nil
+}
+
+// newFileContract creates the file contract proposed to host when forming a
+// contract, along with the cost of the contract to the renter. The host's
+// collateral is included in the host's valid and missed proof outputs, so
+// that the host stakes it for the duration of the contract.
+func newFileContract(host modules.HostDBEntry, filesize uint64, startHeight, endHeight types.BlockHeight, refundAddress, unlockHash types.UnlockHash) (types.FileContract, types.Currency, error) {
+	if err := checkCollateral(host.HostExternalSettings); err != nil {
+		return types.FileContract{}, types.Currency{}, err
+	}
+
+	// calculate cost to renter and cost to host
+	// TODO: clarify/abstract this math
+	storageAllocation := host.StoragePrice.Mul64(filesize).Mul64(uint64(endHeight - startHeight))
+	hostCollateral := host.Collateral.Mul64(filesize).Mul64(uint64(endHeight - startHeight))
+	if hostCollateral.Cmp(host.MaxCollateral) > 0 {
+		// TODO: if we have to cap the collateral, it probably means we shouldn't be using this host
+		// (ok within a factor of 2)
+		hostCollateral = host.MaxCollateral
+	}
+	hostPayout := hostCollateral.Add(host.ContractPrice)
+	payout := storageAllocation.Add(hostPayout).Mul64(10406).Div64(10000) // renter pays for siafund fee
+	renterCost := payout.Sub(hostCollateral)
+
+	// check for negative currency
+	if types.PostTax(startHeight, payout).Cmp(hostPayout) < 0 {
+		return types.FileContract{}, types.Currency{}, errors.New("payout smaller than host payout")
+	}
+
+	fc := types.FileContract{
+		FileSize:       0,
+		FileMerkleRoot: crypto.Hash{}, // no proof possible without data
+		WindowStart:    endHeight,
+		WindowEnd:      endHeight + host.WindowSize,
+		Payout:         payout,
+		UnlockHash:     unlockHash,
+		RevisionNumber: 0,
+		ValidProofOutputs: []types.SiacoinOutput{
+			// outputs need to account for tax
+			{Value: types.PostTax(startHeight, payout).Sub(hostPayout), UnlockHash: refundAddress},
+			// collateral is returned to host
+			{Value: hostPayout, UnlockHash: host.UnlockHash},
+		},
+		MissedProofOutputs: []types.SiacoinOutput{
+			// same as above
+			{Value: types.PostTax(startHeight, payout).Sub(hostPayout), UnlockHash: refundAddress},
+			// same as above
+			{Value: hostPayout, UnlockHash: host.UnlockHash},
+			// once we start doing revisions, we'll move some coins to the host and some to the void
+			{Value: types.ZeroCurrency, UnlockHash: types.UnlockHash{}},
+		},
+	}
+	return fc, renterCost, nil
+}
+
+// checkCollateral returns errCollateralTooHigh if the host's collateral is
+// more than maxCollateralMultiple times its storage price. Currencies cannot
+// be negative, so no lower bound is needed.
+func checkCollateral(settings modules.HostExternalSettings) error {
+	if settings.Collateral.Cmp(settings.StoragePrice.Mul64(maxCollateralMultiple)) > 0 {
+		return errCollateralTooHigh
+	}
+	return nil
+}
+
+// checkHostInputs returns errHostTamperedContract if any of the inputs added
+// by the host spend an output that belongs to the renter, i.e. an output that
+// is already spent by the renter's half of the transaction set or that was
+// created by one of the renter's parent transactions.
+func checkHostInputs(renterTxnSet []types.Transaction, hostInputs []types.SiacoinInput) error {
+	renterOutputs := make(map[types.SiacoinOutputID]struct{})
+	for _, txn := range renterTxnSet {
+		for _, sci := range txn.SiacoinInputs {
+			renterOutputs[sci.ParentID] = struct{}{}
+		}
+		for i := range txn.SiacoinOutputs {
+			renterOutputs[txn.SiacoinOutputID(uint64(i))] = struct{}{}
+		}
+	}
+	for _, sci := range hostInputs {
+		if _, ok := renterOutputs[sci.ParentID]; ok {
+			return errHostTamperedContract
+		}
+	}
+	return nil
+}
+
+// checkContractTxn verifies that the final contract transaction contains
+// exactly the file contract proposed by the renter and that the signatures
+// added by the host are valid.
+func checkContractTxn(txn types.Transaction, fc types.FileContract, height types.BlockHeight) error {
+	if len(txn.FileContracts) != 1 || !bytes.Equal(encoding.Marshal(txn.FileContracts[0]), encoding.Marshal(fc)) {
+		return errHostTamperedContract
+	}
+	if err := txn.StandaloneValid(height); err != nil {
+		return errors.New("host's contract transaction is invalid: " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,578 @@
+package proto
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// stubTxnBuilder is a minimal transactionBuilder that funds transactions
+// using a single parent transaction.
+type stubTxnBuilder struct {
+	txn     types.Transaction
+	parents []types.Transaction
+}
+
+func (tb *stubTxnBuilder) AddFileContract(fc types.FileContract) uint64 {
+	tb.txn.FileContracts = append(tb.txn.FileContracts, fc)
+	return uint64(len(tb.txn.FileContracts) - 1)
+}
+func (tb *stubTxnBuilder) AddMinerFee(fee types.Currency) uint64 {
+	tb.txn.MinerFees = append(tb.txn.MinerFees, fee)
+	return uint64(len(tb.txn.MinerFees) - 1)
+}
+func (tb *stubTxnBuilder) AddParents(parents []types.Transaction) {
+	tb.parents = append(tb.parents, parents...)
+}
+func (tb *stubTxnBuilder) AddSiacoinInput(sci types.SiacoinInput) uint64 {
+	tb.txn.SiacoinInputs = append(tb.txn.SiacoinInputs, sci)
+	return uint64(len(tb.txn.SiacoinInputs) - 1)
+}
+func (tb *stubTxnBuilder) AddSiacoinOutput(sco types.SiacoinOutput) uint64 {
+	tb.txn.SiacoinOutputs = append(tb.txn.SiacoinOutputs, sco)
+	return uint64(len(tb.txn.SiacoinOutputs) - 1)
+}
+func (tb *stubTxnBuilder) AddTransactionSignature(sig types.TransactionSignature) uint64 {
+	tb.txn.TransactionSignatures = append(tb.txn.TransactionSignatures, sig)
+	return uint64(len(tb.txn.TransactionSignatures) - 1)
+}
+func (tb *stubTxnBuilder) FundSiacoins(amount types.Currency) error {
+	parent := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: amount}},
+	}
+	tb.parents = append(tb.parents, parent)
+	tb.AddSiacoinInput(types.SiacoinInput{ParentID: parent.SiacoinOutputID(0)})
+	return nil
+}
+func (tb *stubTxnBuilder) Sign(bool) ([]types.Transaction, error) {
+	return append(tb.parents, tb.txn), nil
+}
+func (tb *stubTxnBuilder) View() (types.Transaction, []types.Transaction) {
+	return tb.txn, tb.parents
+}
+func (tb *stubTxnBuilder) ViewAdded() (parents, coins, funds, signatures []int) { return }
+
+// stubTpool is a transactionPool that records whether a transaction set was
+// submitted.
+type stubTpool struct {
+	accepted bool
+}
+
+func (tp *stubTpool) AcceptTransactionSet([]types.Transaction) error {
+	tp.accepted = true
+	return nil
+}
+func (tp *stubTpool) FeeEstimation() (min, max types.Currency) {
+	return types.NewCurrency64(1), types.NewCurrency64(1)
+}
+
+// TestFormContractHostSpendsRenterOutputs tests that FormContract refuses to
+// submit a transaction set in which the host spends the renter's outputs.
+func TestFormContractHostSpendsRenterOutputs(t *testing.T) {
+	sk, pk, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	settings := modules.HostExternalSettings{
+		AcceptingContracts: true,
+		NetAddress:         modules.NetAddress(l.Addr().String()),
+		MaxDuration:        1000,
+		WindowSize:         10,
+		Version:            "1.0.0",
+	}
+	host := modules.HostDBEntry{
+		HostExternalSettings: settings,
+		PublicKey: types.SiaPublicKey{
+			Algorithm: types.SignatureEd25519,
+			Key:       pk[:],
+		},
+	}
+
+	// run a host that attempts to spend the renter's funding output
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var id types.Specifier
+		encoding.ReadObject(conn, &id, types.SpecifierLen)
+		crypto.WriteSignedObject(conn, settings, sk)
+		modules.ReadNegotiationAcceptance(conn)
+		var txnSet []types.Transaction
+		encoding.ReadObject(conn, &txnSet, types.BlockSizeLimit)
+		encoding.ReadObject(conn, new(crypto.PublicKey), 32)
+		modules.WriteNegotiationAcceptance(conn)
+
+		stolen := types.SiacoinInput{ParentID: txnSet[0].SiacoinOutputID(0)}
+		encoding.WriteObject(conn, []types.Transaction{})
+		encoding.WriteObject(conn, []types.SiacoinInput{stolen})
+		encoding.WriteObject(conn, []types.SiacoinOutput{{Value: txnSet[0].SiacoinOutputs[0].Value}})
+		modules.ReadNegotiationAcceptance(conn)
+	}()
+
+	params := ContractParams{
+		Host:        host,
+		Filesize:    1,
+		StartHeight: 0,
+		EndHeight:   100,
+	}
+	tpool := new(stubTpool)
+	_, err = FormContract(params, new(stubTxnBuilder), tpool)
+	if err != errHostTamperedContract {
+		t.Fatalf("expected %q, got %v", errHostTamperedContract, err)
+	}
+	if tpool.accepted {
+		t.Fatal("tampered transaction set was submitted to the transaction pool")
+	}
+}
+
+// TestFormContractTxnSetTooLarge tests that FormContract rejects hosts whose
+// additions to the contract transaction exceed MaxTxnSetSize, and hosts that
+// take too long to send them.
+func TestFormContractTxnSetTooLarge(t *testing.T) {
+	sk, pk, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bigTxn := types.Transaction{ArbitraryData: [][]byte{make([]byte, 600)}}
+	tests := []struct {
+		name string
+		// send writes the host's additions to the contract transaction.
+		send func(conn net.Conn)
+	}{
+		{"parents", func(conn net.Conn) {
+			encoding.WriteObject(conn, []types.Transaction{bigTxn, bigTxn})
+		}},
+		{"combined", func(conn net.Conn) {
+			encoding.WriteObject(conn, []types.Transaction{bigTxn})
+			encoding.WriteObject(conn, []types.SiacoinInput{})
+			encoding.WriteObject(conn, []types.SiacoinOutput{{}, {}, {}, {}, {}, {}, {}, {}, {}, {}})
+		}},
+		{"stalled", func(conn net.Conn) {
+			time.Sleep(time.Second)
+		}},
+	}
+	for _, test := range tests {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		settings := modules.HostExternalSettings{
+			AcceptingContracts: true,
+			NetAddress:         modules.NetAddress(l.Addr().String()),
+			MaxDuration:        1000,
+			WindowSize:         10,
+			Version:            "1.0.0",
+		}
+		go func(send func(net.Conn)) {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			var id types.Specifier
+			encoding.ReadObject(conn, &id, types.SpecifierLen)
+			crypto.WriteSignedObject(conn, settings, sk)
+			modules.ReadNegotiationAcceptance(conn)
+			encoding.ReadObject(conn, new([]types.Transaction), types.BlockSizeLimit)
+			encoding.ReadObject(conn, new(crypto.PublicKey), 32)
+			modules.WriteNegotiationAcceptance(conn)
+			send(conn)
+		}(test.send)
+
+		params := ContractParams{
+			Host: modules.HostDBEntry{
+				HostExternalSettings: settings,
+				PublicKey: types.SiaPublicKey{
+					Algorithm: types.SignatureEd25519,
+					Key:       pk[:],
+				},
+			},
+			Filesize:      1,
+			StartHeight:   0,
+			EndHeight:     100,
+			MaxTxnSetSize: 1000,
+			Timeouts:      NegotiationTimeouts{TxnSet: 100 * time.Millisecond},
+		}
+		tpool := new(stubTpool)
+		start := time.Now()
+		_, err = FormContract(params, new(stubTxnBuilder), tpool)
+		if test.name == "stalled" {
+			if err == nil || time.Since(start) > 900*time.Millisecond {
+				t.Errorf("%v: expected the read to time out quickly, got %v after %v", test.name, err, time.Since(start))
+			}
+		} else if err != errTxnSetTooLarge {
+			t.Errorf("%v: expected %q, got %v", test.name, errTxnSetTooLarge, err)
+		}
+		if tpool.accepted {
+			t.Errorf("%v: transaction set was submitted to the transaction pool", test.name)
+		}
+		l.Close()
+	}
+}
+
+// TestCheckDuration tests the checkDuration function.
+func TestCheckDuration(t *testing.T) {
+	settings := modules.HostExternalSettings{MaxDuration: 100}
+	tests := []struct {
+		start, end types.BlockHeight
+		valid      bool
+	}{
+		{10, 110, true},  // exactly the maximum duration
+		{10, 50, true},   // shorter than the maximum
+		{10, 111, false}, // one block too long
+		{10, 10, false},  // zero duration
+		{10, 5, false},   // negative duration
+	}
+	for _, test := range tests {
+		err := checkDuration(settings, test.start, test.end)
+		if test.valid && err != nil {
+			t.Errorf("contract from %v to %v should be valid: %v", test.start, test.end, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("contract from %v to %v should be invalid", test.start, test.end)
+		}
+	}
+	if err := checkDuration(settings, 10, 10); err != errBadContractDuration {
+		t.Errorf("expected %q, got %v", errBadContractDuration, err)
+	}
+}
+
+// TestFormContractMaxDuration tests that FormContract rejects hosts whose
+// maximum duration is too short without funding the contract or contacting
+// the host.
+func TestFormContractMaxDuration(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	dialed := make(chan struct{}, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conn.Close()
+		dialed <- struct{}{}
+	}()
+
+	host := modules.HostDBEntry{
+		HostExternalSettings: modules.HostExternalSettings{
+			AcceptingContracts: true,
+			NetAddress:         modules.NetAddress(l.Addr().String()),
+			MaxDuration:        50,
+			WindowSize:         10,
+			Version:            "1.0.0",
+		},
+	}
+	params := ContractParams{
+		Host:        host,
+		Filesize:    1,
+		StartHeight: 0,
+		EndHeight:   100,
+	}
+	txnBuilder := new(stubTxnBuilder)
+	_, err = FormContract(params, txnBuilder, new(stubTpool))
+	if err == nil || !strings.Contains(err.Error(), "maximum duration") {
+		t.Fatal("expected max duration error, got", err)
+	}
+	if len(txnBuilder.parents) != 0 {
+		t.Fatal("contract was funded before the duration was checked")
+	}
+	select {
+	case <-dialed:
+		t.Fatal("host was contacted before the duration was checked")
+	default:
+	}
+}
+
+// TestCheckWindowSize tests that hosts with a window size outside of the
+// acceptable range are rejected.
+func TestCheckWindowSize(t *testing.T) {
+	tests := []struct {
+		windowSize types.BlockHeight
+		err        string
+	}{
+		{minWindowSize - 1, "below the minimum"},
+		{maxWindowSize + 1, "above the maximum"},
+		{minWindowSize, ""},
+		{maxWindowSize, ""},
+	}
+	for _, test := range tests {
+		err := checkWindowSize(modules.HostExternalSettings{WindowSize: test.windowSize})
+		if test.err == "" && err != nil {
+			t.Errorf("window size %v should be acceptable: %v", test.windowSize, err)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("window size %v: expected error containing %q, got %v", test.windowSize, test.err, err)
+		}
+	}
+
+	// FormContract should reject the host before funding the contract
+	host := modules.HostDBEntry{
+		HostExternalSettings: modules.HostExternalSettings{
+			AcceptingContracts: true,
+			NetAddress:         "foo.com:1234",
+			MaxDuration:        1000,
+			WindowSize:         maxWindowSize + 1,
+		},
+	}
+	txnBuilder := new(stubTxnBuilder)
+	_, err := FormContract(ContractParams{Host: host, Filesize: 1, EndHeight: 100}, txnBuilder, new(stubTpool))
+	if err == nil || !strings.Contains(err.Error(), "above the maximum") {
+		t.Fatal("expected window size error, got", err)
+	} else if len(txnBuilder.parents) != 0 {
+		t.Fatal("contract was funded before the window size was checked")
+	}
+}
+
+// TestSetWindowSizeRange tests the SetWindowSizeRange function.
+func TestSetWindowSizeRange(t *testing.T) {
+	oldMin, oldMax := minWindowSize, maxWindowSize
+	defer SetWindowSizeRange(oldMin, oldMax)
+
+	if err := SetWindowSizeRange(0, 10); err != errBadWindowSizeRange {
+		t.Errorf("expected %q, got %v", errBadWindowSizeRange, err)
+	}
+	if err := SetWindowSizeRange(20, 10); err != errBadWindowSizeRange {
+		t.Errorf("expected %q, got %v", errBadWindowSizeRange, err)
+	}
+	if err := SetWindowSizeRange(10, 20); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkWindowSize(modules.HostExternalSettings{WindowSize: 5}); err == nil {
+		t.Error("window size below the new minimum was accepted")
+	}
+	if err := checkWindowSize(modules.HostExternalSettings{WindowSize: 15}); err != nil {
+		t.Error("window size within the new range was rejected:", err)
+	}
+}
+
+// TestCheckContractTxn tests that checkContractTxn rejects transactions whose
+// file contract differs from the one proposed by the renter.
+func TestCheckContractTxn(t *testing.T) {
+	fc := types.FileContract{
+		WindowStart: 10,
+		WindowEnd:   20,
+		Payout:      types.NewCurrency64(100),
+		ValidProofOutputs: []types.SiacoinOutput{
+			{Value: types.NewCurrency64(50)},
+			{Value: types.NewCurrency64(46)},
+		},
+		MissedProofOutputs: []types.SiacoinOutput{
+			{Value: types.NewCurrency64(50)},
+			{Value: types.NewCurrency64(46)},
+		},
+	}
+
+	// altered terms
+	tampered := fc
+	tampered.ValidProofOutputs = []types.SiacoinOutput{
+		{Value: types.NewCurrency64(0)},
+		{Value: types.NewCurrency64(96)},
+	}
+	txn := types.Transaction{FileContracts: []types.FileContract{tampered}}
+	if err := checkContractTxn(txn, fc, 0); err != errHostTamperedContract {
+		t.Fatalf("expected %q, got %v", errHostTamperedContract, err)
+	}
+
+	// reduced host collateral
+	tampered = fc
+	tampered.MissedProofOutputs = []types.SiacoinOutput{
+		{Value: types.NewCurrency64(50)},
+		{Value: types.NewCurrency64(6)},
+	}
+	txn = types.Transaction{FileContracts: []types.FileContract{tampered}}
+	if err := checkContractTxn(txn, fc, 0); err != errHostTamperedContract {
+		t.Fatalf("expected %q, got %v", errHostTamperedContract, err)
+	}
+
+	// extra file contract
+	txn = types.Transaction{FileContracts: []types.FileContract{fc, tampered}}
+	if err := checkContractTxn(txn, fc, 0); err != errHostTamperedContract {
+		t.Fatalf("expected %q, got %v", errHostTamperedContract, err)
+	}
+
+	// missing file contract
+	if err := checkContractTxn(types.Transaction{}, fc, 0); err != errHostTamperedContract {
+		t.Fatalf("expected %q, got %v", errHostTamperedContract, err)
+	}
+}
+
+// TestNewFileContract tests that newFileContract stakes the host's collateral
+// in the host's proof outputs.
+func TestNewFileContract(t *testing.T) {
+	host := modules.HostDBEntry{
+		HostExternalSettings: modules.HostExternalSettings{
+			Collateral:    types.NewCurrency64(2),
+			ContractPrice: types.NewCurrency64(1000),
+			MaxCollateral: types.NewCurrency64(1e6),
+			StoragePrice:  types.NewCurrency64(1),
+			WindowSize:    10,
+			UnlockHash:    types.UnlockHash{1},
+		},
+	}
+	refund, unlockHash := types.UnlockHash{2}, types.UnlockHash{3}
+	fc, renterCost, err := newFileContract(host, 1000, 0, 100, refund, unlockHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the host stakes 2 hastings per byte per block
+	hostCollateral := types.NewCurrency64(2 * 1000 * 100)
+	hostPayout := hostCollateral.Add(host.ContractPrice)
+	if renterCost.Cmp(fc.Payout.Sub(hostCollateral)) != 0 {
+		t.Error("renter should not pay for the host's collateral:", renterCost, fc.Payout)
+	}
+	for _, outputs := range [][]types.SiacoinOutput{fc.ValidProofOutputs, fc.MissedProofOutputs} {
+		if outputs[1].Value.Cmp(hostPayout) != 0 || outputs[1].UnlockHash != host.UnlockHash {
+			t.Errorf("expected host output of %v, got %v", hostPayout, outputs[1].Value)
+		}
+		if outputs[0].Value.Add(outputs[1].Value).Cmp(types.PostTax(0, fc.Payout)) != 0 || outputs[0].UnlockHash != refund {
+			t.Error("proof outputs do not add up to the post-tax payout")
+		}
+	}
+	if fc.UnlockHash != unlockHash || fc.WindowStart != 100 || fc.WindowEnd != 110 {
+		t.Error("file contract has the wrong terms:", fc)
+	}
+
+	// collateral is capped by MaxCollateral
+	host.MaxCollateral = types.NewCurrency64(500)
+	fc, _, err = newFileContract(host, 1000, 0, 100, refund, unlockHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fc.ValidProofOutputs[1].Value.Cmp(host.MaxCollateral.Add(host.ContractPrice)) != 0 {
+		t.Error("collateral was not capped:", fc.ValidProofOutputs[1].Value)
+	}
+
+	// collateral above maxCollateralMultiple times the storage price is
+	// rejected
+	host.Collateral = host.StoragePrice.Mul64(maxCollateralMultiple + 1)
+	if _, _, err = newFileContract(host, 1000, 0, 100, refund, unlockHash); err != errCollateralTooHigh {
+		t.Fatalf("expected %q, got %v", errCollateralTooHigh, err)
+	}
+}
+
+// unfundedTxnBuilder is a stubTxnBuilder that does not add any inputs, so
+// that the resulting transaction requires no signatures.
+type unfundedTxnBuilder struct {
+	stubTxnBuilder
+}
+
+func (*unfundedTxnBuilder) FundSiacoins(types.Currency) error { return nil }
+
+// TestFormContractTimeouts tests that FormContract respects the negotiation
+// timeouts supplied in its ContractParams.
+func TestFormContractTimeouts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	sk, pk, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	settings := modules.HostExternalSettings{
+		AcceptingContracts: true,
+		NetAddress:         modules.NetAddress(l.Addr().String()),
+		ContractPrice:      types.SiacoinPrecision,
+		MaxDuration:        1000,
+		WindowSize:         10,
+		Version:            "1.0.0",
+	}
+	host := modules.HostDBEntry{
+		HostExternalSettings: settings,
+		PublicKey: types.SiaPublicKey{
+			Algorithm: types.SignatureEd25519,
+			Key:       pk[:],
+		},
+	}
+
+	// run a host that waits before accepting each proposed contract
+	const delay = 200 * time.Millisecond
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var id types.Specifier
+			encoding.ReadObject(conn, &id, types.SpecifierLen)
+			crypto.WriteSignedObject(conn, settings, sk)
+			modules.ReadNegotiationAcceptance(conn)
+			encoding.ReadObject(conn, new([]types.Transaction), types.BlockSizeLimit)
+			encoding.ReadObject(conn, new(crypto.PublicKey), 32)
+			time.Sleep(delay)
+			modules.WriteNegotiationAcceptance(conn)
+			encoding.WriteObject(conn, []types.Transaction{})
+			encoding.WriteObject(conn, []types.SiacoinInput{})
+			encoding.WriteObject(conn, []types.SiacoinOutput{})
+			modules.ReadNegotiationAcceptance(conn)
+			encoding.ReadObject(conn, new([]types.TransactionSignature), 2e3)
+			encoding.ReadObject(conn, new(types.TransactionSignature), 2e3)
+			modules.WriteNegotiationAcceptance(conn)
+			encoding.WriteObject(conn, []types.TransactionSignature{})
+			encoding.WriteObject(conn, types.TransactionSignature{})
+			conn.Close()
+		}
+	}()
+
+	params := ContractParams{
+		Host:        host,
+		Filesize:    1,
+		StartHeight: 0,
+		EndHeight:   100,
+		Timeouts: NegotiationTimeouts{
+			Dial:     time.Second,
+			Contract: delay / 4,
+		},
+	}
+
+	// a timeout shorter than the host's delay should fail
+	tpool := new(stubTpool)
+	_, err = FormContract(params, new(unfundedTxnBuilder), tpool)
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Fatal("expected timeout error, got", err)
+	}
+
+	// a longer timeout should succeed
+	params.Timeouts.Contract = 10 * delay
+	_, err = FormContract(params, new(unfundedTxnBuilder), tpool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tpool.accepted {
+		t.Fatal("contract transaction was not submitted to the transaction pool")
+	}
+}
+
+// TestNegotiationTimerNegativeLap tests that a phase during which the wall
+// clock was set back is reported as taking no time.
+func TestNegotiationTimerNegativeLap(t *testing.T) {
+	timer := newNegotiationTimer()
+	timer.last = time.Now().Add(time.Hour)
+	if d := timer.lap(); d != 0 {
+		t.Fatal("expected a lap of 0, got", d)
+	}
+	if d := timer.lap(); d < 0 {
+		t.Fatal("expected a nonnegative lap, got", d)
+	}
+}
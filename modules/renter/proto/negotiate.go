@@ -2,10 +2,10 @@ package proto
 
 import (
 	"errors"
+	"io"
 	"net"
 	"time"
 
-	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
@@ -15,6 +15,60 @@ import (
 // extendDeadline is a helper function for extending the connection timeout.
 func extendDeadline(conn net.Conn, d time.Duration) { _ = conn.SetDeadline(time.Now().Add(d)) }
 
+// readLimitedObject reads a length-prefixed object from r, returning
+// errTxnSetTooLarge if it is larger than the remaining byte budget. The size
+// of the object is deducted from the budget.
+func readLimitedObject(r io.Reader, obj interface{}, remaining *uint64) error {
+	prefix := make([]byte, 8)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return err
+	}
+	n := encoding.DecUint64(prefix)
+	if n > *remaining {
+		return errTxnSetTooLarge
+	}
+	*remaining -= n
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	return encoding.Unmarshal(data, obj)
+}
+
+// readHostAdditions reads the parent transactions, inputs, and outputs that
+// the host added to the contract transaction. Together they may not exceed
+// params.MaxTxnSetSize bytes, and they must arrive within
+// params.Timeouts.TxnSet and before deadline. The connection's read deadline
+// is restored to deadline afterwards.
+func readHostAdditions(conn net.Conn, params ContractParams, deadline time.Time) (parents []types.Transaction, inputs []types.SiacoinInput, outputs []types.SiacoinOutput, err error) {
+	readDeadline := time.Now().Add(timeoutOrDefault(params.Timeouts.TxnSet, defaultTxnSetTimeout))
+	if deadline.Before(readDeadline) {
+		readDeadline = deadline
+	}
+	_ = conn.SetReadDeadline(readDeadline)
+	defer func() { _ = conn.SetReadDeadline(deadline) }()
+
+	remaining := params.MaxTxnSetSize
+	if remaining == 0 {
+		remaining = defaultMaxTxnSetSize
+	}
+	for _, o := range []struct {
+		name string
+		obj  interface{}
+	}{
+		{"parents", &parents},
+		{"inputs", &inputs},
+		{"outputs", &outputs},
+	} {
+		if err = readLimitedObject(conn, o.obj, &remaining); err == errTxnSetTooLarge {
+			return nil, nil, nil, err
+		} else if err != nil {
+			return nil, nil, nil, errors.New("couldn't read the host's added " + o.name + ": " + err.Error())
+		}
+	}
+	return parents, inputs, outputs, nil
+}
+
 // startRevision is run at the beginning of each revision iteration. It reads
 // the host's settings confirms that the values are acceptable, and writes an acceptance.
 func startRevision(conn net.Conn, host modules.HostDBEntry) error {
@@ -42,30 +96,67 @@ func startDownload(conn net.Conn, host modules.HostDBEntry) error {
 // received settings. If there is a discrepancy, the hostDB is notified. The
 // received settings are returned.
 func verifySettings(conn net.Conn, host modules.HostDBEntry) (modules.HostDBEntry, error) {
-	// convert host key (types.SiaPublicKey) to a crypto.PublicKey
-	if host.PublicKey.Algorithm != types.SignatureEd25519 || len(host.PublicKey.Key) != crypto.PublicKeySize {
-		build.Critical("hostdb did not filter out host with wrong signature algorithm:", host.PublicKey.Algorithm)
-		return modules.HostDBEntry{}, errors.New("host used unsupported signature algorithm")
-	}
-	var pk crypto.PublicKey
-	copy(pk[:], host.PublicKey.Key)
-
-	// read signed host settings
+	// read signed host settings, verifying the signature with the host's
+	// signature algorithm
 	var recvSettings modules.HostExternalSettings
-	if err := crypto.ReadSignedObject(conn, &recvSettings, modules.NegotiateMaxHostExternalSettingsLen, pk); err != nil {
+	if err := readSignedObject(conn, &recvSettings, modules.NegotiateMaxHostExternalSettingsLen, host.PublicKey); err == errUnknownSignatureAlgorithm {
+		return modules.HostDBEntry{}, err
+	} else if err != nil {
 		return modules.HostDBEntry{}, errors.New("couldn't read host's settings: " + err.Error())
 	}
-	// TODO: check recvSettings against host.HostExternalSettings. If there is
-	// a discrepancy, write the error to conn.
 	if recvSettings.NetAddress != host.NetAddress {
 		// for now, just overwrite the NetAddress, since we know that
 		// host.NetAddress works (it was the one we dialed to get conn)
 		recvSettings.NetAddress = host.NetAddress
 	}
+	known := host.HostExternalSettings
 	host.HostExternalSettings = recvSettings
+	// check recvSettings against the known settings. If there is a
+	// discrepancy, write the error to conn.
+	if err := checkSettings(known, recvSettings); err != nil {
+		err.host = host
+		modules.WriteNegotiationRejection(conn, err) // we return err regardless
+		return modules.HostDBEntry{}, err
+	}
+	// the renter pays the siafund fee on the host's collateral, so the
+	// collateral must be within a sane multiple of the storage price.
+	if err := checkCollateral(recvSettings); err != nil {
+		return modules.HostDBEntry{}, modules.WriteNegotiationRejection(conn, err)
+	}
 	return host, nil
 }
 
+// checkSettings compares the settings received from a host to the settings
+// recorded in the hostdb, returning an error if they differ materially. Only
+// changes that are unfavorable to the renter are considered; prices are
+// allowed to fluctuate within priceTolerance.
+func checkSettings(known, recv modules.HostExternalSettings) *settingsDiscrepancyError {
+	// a host that has never been scanned has no settings to compare against
+	if known.Version == "" {
+		return nil
+	}
+	priceToleranceMu.RLock()
+	tol := priceTolerance
+	priceToleranceMu.RUnlock()
+
+	discrepancy := func(field string, known, recv interface{}) *settingsDiscrepancyError {
+		return &settingsDiscrepancyError{field: field, known: known, recv: recv}
+	}
+	switch {
+	case recv.ContractPrice.Cmp(known.ContractPrice.MulFloat(1+tol)) > 0:
+		return discrepancy("ContractPrice", known.ContractPrice, recv.ContractPrice)
+	case recv.StoragePrice.Cmp(known.StoragePrice.MulFloat(1+tol)) > 0:
+		return discrepancy("StoragePrice", known.StoragePrice, recv.StoragePrice)
+	case recv.Collateral.Cmp(known.Collateral.MulFloat(1-tol)) < 0:
+		return discrepancy("Collateral", known.Collateral, recv.Collateral)
+	case recv.WindowSize != known.WindowSize:
+		return discrepancy("WindowSize", known.WindowSize, recv.WindowSize)
+	case recv.MaxDuration < known.MaxDuration:
+		return discrepancy("MaxDuration", known.MaxDuration, recv.MaxDuration)
+	}
+	return nil
+}
+
 // verifyRecentRevision confirms that the host and contractor agree upon the current
 // state of the contract being revised.
 func verifyRecentRevision(conn net.Conn, contract modules.RenterContract) error {
@@ -167,8 +258,9 @@ func negotiateRevision(conn net.Conn, rev types.FileContractRevision, secretKey
 }
 
 // newRevision creates a copy of current with its revision number incremented,
-// and with cost transferred from the renter to the host.
-func newRevision(current types.FileContractRevision, cost types.Currency) types.FileContractRevision {
+// and with cost transferred from the renter to the host. Unless policy is
+// RefundPayments, the renter's missed payout is moved to the void.
+func newRevision(current types.FileContractRevision, cost types.Currency, policy MissedProofPolicy) types.FileContractRevision {
 	rev := current
 
 	// need to manually copy slice memory
@@ -182,8 +274,10 @@ func newRevision(current types.FileContractRevision, cost types.Currency) types.
 	rev.NewValidProofOutputs[1].Value = current.NewValidProofOutputs[1].Value.Add(cost)
 
 	// move missed payout from renter to void
-	rev.NewMissedProofOutputs[0].Value = current.NewMissedProofOutputs[0].Value.Sub(cost)
-	rev.NewMissedProofOutputs[2].Value = current.NewMissedProofOutputs[2].Value.Add(cost)
+	if policy != RefundPayments {
+		rev.NewMissedProofOutputs[0].Value = current.NewMissedProofOutputs[0].Value.Sub(cost)
+		rev.NewMissedProofOutputs[2].Value = current.NewMissedProofOutputs[2].Value.Add(cost)
+	}
 
 	// increment revision number
 	rev.NewRevisionNumber++
@@ -193,14 +287,14 @@ func newRevision(current types.FileContractRevision, cost types.Currency) types.
 
 // newDownloadRevision revises the current revision to cover the cost of
 // downloading data.
-func newDownloadRevision(current types.FileContractRevision, downloadCost types.Currency) types.FileContractRevision {
-	return newRevision(current, downloadCost)
+func newDownloadRevision(current types.FileContractRevision, downloadCost types.Currency, policy MissedProofPolicy) types.FileContractRevision {
+	return newRevision(current, downloadCost, policy)
 }
 
 // newUploadRevision revises the current revision to cover the cost of
 // uploading a sector.
-func newUploadRevision(current types.FileContractRevision, merkleRoot crypto.Hash, price, collateral types.Currency) types.FileContractRevision {
-	rev := newRevision(current, price)
+func newUploadRevision(current types.FileContractRevision, merkleRoot crypto.Hash, price, collateral types.Currency, policy MissedProofPolicy) types.FileContractRevision {
+	rev := newRevision(current, price, policy)
 
 	// move collateral from host to void
 	rev.NewMissedProofOutputs[1].Value = rev.NewMissedProofOutputs[1].Value.Sub(collateral)
@@ -215,7 +309,7 @@ func newUploadRevision(current types.FileContractRevision, merkleRoot crypto.Has
 // newDeleteRevision revises the current revision to cover the cost of
 // deleting a sector.
 func newDeleteRevision(current types.FileContractRevision, merkleRoot crypto.Hash) types.FileContractRevision {
-	rev := newRevision(current, types.ZeroCurrency)
+	rev := newRevision(current, types.ZeroCurrency, BurnPayments)
 	rev.NewFileSize -= modules.SectorSize
 	rev.NewFileMerkleRoot = merkleRoot
 	return rev
@@ -223,8 +317,8 @@ func newDeleteRevision(current types.FileContractRevision, merkleRoot crypto.Has
 
 // newModifyRevision revises the current revision to cover the cost of
 // modifying a sector.
-func newModifyRevision(current types.FileContractRevision, merkleRoot crypto.Hash, uploadCost types.Currency) types.FileContractRevision {
-	rev := newRevision(current, uploadCost)
+func newModifyRevision(current types.FileContractRevision, merkleRoot crypto.Hash, uploadCost types.Currency, policy MissedProofPolicy) types.FileContractRevision {
+	rev := newRevision(current, uploadCost, policy)
 	rev.NewFileMerkleRoot = merkleRoot
 	return rev
 }
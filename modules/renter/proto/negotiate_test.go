@@ -62,3 +62,234 @@ func TestNegotiateRevisionStopResponse(t *testing.T) {
 	}
 	rConn.Close()
 }
+
+// TestVerifySettings tests that verifySettings detects material discrepancies
+// between the host's reported settings and the settings in the hostdb.
+func TestVerifySettings(t *testing.T) {
+	sk, pk, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	known := modules.HostDBEntry{
+		HostExternalSettings: modules.HostExternalSettings{
+			NetAddress:    "foo.com:1234",
+			Collateral:    types.NewCurrency64(1000),
+			ContractPrice: types.NewCurrency64(1000),
+			StoragePrice:  types.NewCurrency64(1000),
+			MaxDuration:   1000,
+			WindowSize:    100,
+			Version:       "1.0.0",
+		},
+		PublicKey: types.SiaPublicKey{
+			Algorithm: types.SignatureEd25519,
+			Key:       pk[:],
+		},
+	}
+
+	// verify runs verifySettings against a host that reports recv, returning
+	// the result along with whatever the host read back afterwards.
+	verify := func(recv modules.HostExternalSettings) (modules.HostDBEntry, string, error) {
+		rConn, hConn := net.Pipe()
+		defer rConn.Close()
+		resp := make(chan string)
+		go func() {
+			defer hConn.Close()
+			crypto.WriteSignedObject(hConn, recv, sk)
+			var s string
+			encoding.ReadObject(hConn, &s, 1<<10)
+			resp <- s
+		}()
+		host, err := verifySettings(rConn, known)
+		rConn.Close()
+		return host, <-resp, err
+	}
+
+	// matching settings, with a price change inside the tolerance
+	recv := known.HostExternalSettings
+	recv.ContractPrice = types.NewCurrency64(1040)
+	host, resp, err := verify(recv)
+	if err != nil {
+		t.Fatal(err)
+	} else if host.ContractPrice.Cmp(recv.ContractPrice) != 0 {
+		t.Fatal("verifySettings did not return the received settings")
+	} else if resp != "" {
+		t.Fatal("verifySettings wrote to conn on success:", resp)
+	}
+
+	// price bump beyond the tolerance
+	recv = known.HostExternalSettings
+	recv.StoragePrice = types.NewCurrency64(1100)
+	_, resp, err = verify(recv)
+	updated, ok := SettingsDiscrepancy(err)
+	if !ok {
+		t.Fatal("expected settings discrepancy, got", err)
+	} else if updated.StoragePrice.Cmp(recv.StoragePrice) != 0 {
+		t.Fatal("discrepancy error did not contain the received settings")
+	} else if resp != err.Error() {
+		t.Fatalf("host did not receive the error: expected %q, got %q", err.Error(), resp)
+	}
+
+	// changed WindowSize
+	recv = known.HostExternalSettings
+	recv.WindowSize = 50
+	if _, _, err = verify(recv); err == nil {
+		t.Fatal("expected settings discrepancy")
+	} else if _, ok := SettingsDiscrepancy(err); !ok {
+		t.Fatal("expected settings discrepancy, got", err)
+	}
+
+	// collateral too high relative to the storage price
+	recv = known.HostExternalSettings
+	recv.Collateral = recv.StoragePrice.Mul64(maxCollateralMultiple + 1)
+	if _, resp, err = verify(recv); err != errCollateralTooHigh {
+		t.Fatalf("expected %q, got %v", errCollateralTooHigh, err)
+	} else if resp != err.Error() {
+		t.Fatalf("host did not receive the error: expected %q, got %q", err.Error(), resp)
+	}
+}
+
+// TestVerifySettingsSignatureAlgorithms tests that verifySettings verifies the
+// host's signature using the verifier registered for the host's algorithm.
+func TestVerifySettingsSignatureAlgorithms(t *testing.T) {
+	// register a dummy algorithm whose "signature" is the hash of the signed
+	// object, prefixed by the public key
+	dummyAlgorithm := types.Specifier{'d', 'u', 'm', 'm', 'y'}
+	registerSignatureVerifier(dummyAlgorithm, func(pk []byte, hash crypto.Hash, sig crypto.Signature) error {
+		if string(sig[:len(pk)]) != string(pk) || string(sig[len(pk):len(pk)+crypto.HashSize]) != string(hash[:]) {
+			return errors.New("bad dummy signature")
+		}
+		return nil
+	})
+	defer func() {
+		signatureVerifiersMu.Lock()
+		delete(signatureVerifiers, dummyAlgorithm)
+		signatureVerifiersMu.Unlock()
+	}()
+
+	dummyKey := []byte("dummykey")
+	known := modules.HostDBEntry{
+		HostExternalSettings: modules.HostExternalSettings{
+			NetAddress:   "foo.com:1234",
+			StoragePrice: types.NewCurrency64(1000),
+			Version:      "1.0.0",
+		},
+		PublicKey: types.SiaPublicKey{
+			Algorithm: dummyAlgorithm,
+			Key:       dummyKey,
+		},
+	}
+
+	// verify runs verifySettings against a host that signs its settings with
+	// the provided function.
+	verify := func(sign func(crypto.Hash) crypto.Signature) (modules.HostDBEntry, error) {
+		rConn, hConn := net.Pipe()
+		defer rConn.Close()
+		go func() {
+			defer hConn.Close()
+			objBytes := encoding.Marshal(known.HostExternalSettings)
+			encoding.NewEncoder(hConn).EncodeAll(sign(crypto.HashBytes(objBytes)), objBytes)
+		}()
+		return verifySettings(rConn, known)
+	}
+
+	// valid dummy signature
+	host, err := verify(func(h crypto.Hash) (sig crypto.Signature) {
+		copy(sig[:], dummyKey)
+		copy(sig[len(dummyKey):], h[:])
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if host.NetAddress != known.NetAddress {
+		t.Fatal("verifySettings did not return the received settings")
+	}
+
+	// invalid dummy signature
+	_, err = verify(func(h crypto.Hash) (sig crypto.Signature) {
+		copy(sig[:], h[:])
+		return
+	})
+	if err == nil {
+		t.Fatal("expected invalid dummy signature to be rejected")
+	}
+}
+
+// TestVerifySettingsUnknownAlgorithm tests that verifySettings returns an
+// error when the host uses an unregistered signature algorithm.
+func TestVerifySettingsUnknownAlgorithm(t *testing.T) {
+	rConn, hConn := net.Pipe()
+	defer rConn.Close()
+	defer hConn.Close()
+	host := modules.HostDBEntry{
+		PublicKey: types.SiaPublicKey{
+			Algorithm: types.Specifier{'u', 'n', 'k', 'n', 'o', 'w', 'n'},
+		},
+	}
+	if _, err := verifySettings(rConn, host); err != errUnknownSignatureAlgorithm {
+		t.Fatalf("expected %q, got %v", errUnknownSignatureAlgorithm, err)
+	}
+}
+
+// TestNewUploadRevisionMissedProofPolicy checks the missed proof outputs of an
+// upload revision under each missed proof policy, and that the revision does
+// not change the sum of either set of outputs.
+func TestNewUploadRevisionMissedProofPolicy(t *testing.T) {
+	sc := types.NewCurrency64
+	current := types.FileContractRevision{
+		NewValidProofOutputs: []types.SiacoinOutput{
+			{Value: sc(1000)}, // renter
+			{Value: sc(500)},  // host
+		},
+		NewMissedProofOutputs: []types.SiacoinOutput{
+			{Value: sc(1000)}, // renter
+			{Value: sc(500)},  // host
+			{Value: sc(0)},    // void
+		},
+	}
+	sum := func(outputs []types.SiacoinOutput) (total types.Currency) {
+		for _, o := range outputs {
+			total = total.Add(o.Value)
+		}
+		return
+	}
+
+	tests := []struct {
+		policy             MissedProofPolicy
+		renter, host, void uint64
+	}{
+		// the renter's payment and the host's collateral are burned
+		{BurnPayments, 900, 450, 150},
+		// the renter's payment stays with the renter; only the collateral is
+		// burned
+		{RefundPayments, 1000, 450, 50},
+	}
+	for _, test := range tests {
+		rev := newUploadRevision(current, crypto.Hash{}, sc(100), sc(50), test.policy)
+		if !rev.NewValidProofOutputs[0].Value.Equals(sc(900)) || !rev.NewValidProofOutputs[1].Value.Equals(sc(600)) {
+			t.Errorf("policy %v: wrong valid proof outputs %v", test.policy, rev.NewValidProofOutputs)
+		}
+		missed := rev.NewMissedProofOutputs
+		if !missed[0].Value.Equals(sc(test.renter)) || !missed[1].Value.Equals(sc(test.host)) || !missed[2].Value.Equals(sc(test.void)) {
+			t.Errorf("policy %v: wrong missed proof outputs %v", test.policy, missed)
+		}
+		if !sum(rev.NewValidProofOutputs).Equals(sum(current.NewValidProofOutputs)) || !sum(missed).Equals(sum(current.NewMissedProofOutputs)) {
+			t.Errorf("policy %v: revision changed the contract payout", test.policy)
+		}
+		// the renter must not have an incentive to see the host fail
+		if rev.NewValidProofOutputs[0].Value.Cmp(missed[0].Value) > 0 {
+			t.Errorf("policy %v: renter's valid output exceeds its missed output", test.policy)
+		}
+		// the current revision must not be modified
+		if !current.NewMissedProofOutputs[0].Value.Equals(sc(1000)) {
+			t.Fatal("newUploadRevision modified the current revision")
+		}
+	}
+
+	// A download under RefundPayments leaves every missed output untouched.
+	rev := newDownloadRevision(current, sc(100), RefundPayments)
+	for i := range rev.NewMissedProofOutputs {
+		if !rev.NewMissedProofOutputs[i].Value.Equals(current.NewMissedProofOutputs[i].Value) {
+			t.Error("download revision changed missed output", i)
+		}
+	}
+}
@@ -1,8 +1,13 @@
 package proto
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"sync"
+	"time"
 
+	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
@@ -36,9 +41,125 @@ type ContractParams struct {
 	StartHeight   types.BlockHeight
 	EndHeight     types.BlockHeight
 	RefundAddress types.UnlockHash
+	Timeouts      NegotiationTimeouts
+	// Metrics, if non-nil, receives the duration of each phase of the
+	// negotiation.
+	Metrics *modules.NegotiationMetrics
+	// MissedProofPolicy determines whether the storage fees carried over
+	// into a renewed contract are burned or refunded to the renter if the
+	// host misses its storage proof.
+	MissedProofPolicy MissedProofPolicy
+	// Dialer is used to connect to the host. If nil, StdDialer is used.
+	Dialer Dialer
+	// LocalAddr, if non-nil, is the local address that the connection to
+	// the host originates from.
+	LocalAddr net.Addr
+	// MaxTxnSetSize is the maximum total encoded size of the parents,
+	// inputs, and outputs that the host adds to the contract transaction. If
+	// zero, defaultMaxTxnSetSize is used.
+	MaxTxnSetSize uint64
 	// TODO: add optional keypair
 }
 
+// A MissedProofPolicy determines what happens to the money that the renter
+// has paid to the host if the host fails to submit a storage proof. Under
+// either policy the host forfeits its payments and collateral; the policy
+// only controls where the renter's payments end up.
+type MissedProofPolicy int
+
+const (
+	// BurnPayments sends the renter's payments to the void, along with the
+	// host's collateral. This is the default.
+	BurnPayments MissedProofPolicy = iota
+
+	// RefundPayments leaves the renter's payments in the renter's missed
+	// proof output, so that the renter recovers the full amount it put into
+	// the contract.
+	RefundPayments
+)
+
+// NegotiationTimeouts control how long the renter waits on a host while
+// forming or renewing a contract. A zero value selects the default.
+type NegotiationTimeouts struct {
+	// Dial is the timeout for connecting to the host.
+	Dial time.Duration
+	// Contract is the time allotted for negotiating the contract after the
+	// host's settings have been verified. It defaults to
+	// modules.NegotiateFileContractTime when forming a contract and to
+	// modules.NegotiateRenewContractTime when renewing one.
+	Contract time.Duration
+	// TxnSet is the time allotted for reading the host's additions to the
+	// contract transaction. The read never extends past the Contract
+	// deadline.
+	TxnSet time.Duration
+}
+
+// A negotiationTimer divides the time spent on a negotiation into phases.
+// Ideally the phases would be measured with a monotonic clock, but the time
+// package only provides wall clock readings, so a phase that spans a clock
+// adjustment is measured incorrectly. lap only guards against the durations
+// going negative.
+type negotiationTimer struct {
+	last time.Time
+}
+
+// newNegotiationTimer returns a timer whose first phase begins now.
+func newNegotiationTimer() *negotiationTimer {
+	return &negotiationTimer{last: time.Now()}
+}
+
+// lap ends the current phase, returning its duration, and begins the next
+// phase. If the wall clock was set back during the phase, the duration is 0.
+func (t *negotiationTimer) lap() time.Duration {
+	now := time.Now()
+	d := now.Sub(t.last)
+	t.last = now
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// A Dialer connects to hosts.
+type Dialer interface {
+	// DialTimeout connects to addr, originating the connection from
+	// localAddr if it is non-nil.
+	DialTimeout(addr modules.NetAddress, localAddr net.Addr, timeout time.Duration) (net.Conn, error)
+}
+
+// StdDialer implements the Dialer interface via net.Dialer.
+type StdDialer struct{}
+
+// DialTimeout implements Dialer.
+func (StdDialer) DialTimeout(addr modules.NetAddress, localAddr net.Addr, timeout time.Duration) (net.Conn, error) {
+	d := net.Dialer{
+		Timeout:   timeout,
+		LocalAddr: localAddr,
+	}
+	return d.Dial("tcp", string(addr))
+}
+
+// dialHost connects to the host specified by params.
+func dialHost(params ContractParams) (net.Conn, error) {
+	return dialAddress(params.Dialer, params.Host.NetAddress, params.LocalAddr, timeoutOrDefault(params.Timeouts.Dial, defaultDialTimeout))
+}
+
+// dialAddress connects to addr using dialer, or StdDialer if dialer is nil.
+func dialAddress(dialer Dialer, addr modules.NetAddress, localAddr net.Addr, timeout time.Duration) (net.Conn, error) {
+	if dialer == nil {
+		dialer = StdDialer{}
+	}
+	return dialer.DialTimeout(addr, localAddr, timeout)
+}
+
+// timeoutOrDefault returns d if it is nonzero, and def otherwise.
+func timeoutOrDefault(d, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	return d
+}
+
 // A revisionSaver is called just before we send our revision signature to the host; this
 // allows the revision and Merkle roots to be reloaded later if we desync from the host.
 type revisionSaver func(types.FileContractRevision, []crypto.Hash) error
@@ -59,3 +180,95 @@ func IsRevisionMismatch(err error) bool {
 	_, ok := err.(*recentRevisionError)
 	return ok
 }
+
+// A settingsDiscrepancyError occurs if the settings reported by the host
+// differ materially from the settings recorded in the hostdb.
+type settingsDiscrepancyError struct {
+	field       string
+	known, recv interface{}
+	host        modules.HostDBEntry // host with the received settings
+}
+
+func (e *settingsDiscrepancyError) Error() string {
+	return fmt.Sprintf("host's %v (%v) does not match the value in the hostdb (%v)", e.field, e.recv, e.known)
+}
+
+// SettingsDiscrepancy returns the host with its freshly received settings if
+// err was caused by the host reporting settings that differ materially from
+// the settings recorded in the hostdb.
+func SettingsDiscrepancy(err error) (modules.HostDBEntry, bool) {
+	e, ok := err.(*settingsDiscrepancyError)
+	if !ok {
+		return modules.HostDBEntry{}, false
+	}
+	return e.host, true
+}
+
+var (
+	errBadPriceTolerance = errors.New("price tolerance must be between 0 and 1")
+
+	// priceTolerance is the relative amount by which a host's prices may
+	// rise, or its collateral may fall, between the hostdb's last scan and
+	// negotiation before verifySettings reports a discrepancy.
+	priceTolerance   = 0.05
+	priceToleranceMu sync.RWMutex
+)
+
+// SetPriceTolerance sets the relative tolerance that verifySettings applies
+// when comparing the prices quoted by a host to the prices recorded in the
+// hostdb.
+func SetPriceTolerance(tol float64) error {
+	if tol < 0 || tol > 1 {
+		return errBadPriceTolerance
+	}
+	priceToleranceMu.Lock()
+	priceTolerance = tol
+	priceToleranceMu.Unlock()
+	return nil
+}
+
+var (
+	errBadWindowSizeRange = errors.New("minimum window size must be nonzero and no greater than the maximum window size")
+
+	// minWindowSize and maxWindowSize bound the proof window that a host may
+	// request when forming a contract. A window that is too small leaves the
+	// host little time to submit a storage proof, and a window that is too
+	// large keeps the renter's funds locked long after the contract ends.
+	minWindowSize = build.Select(build.Var{
+		Standard: types.BlockHeight(18), // 3 hours
+		Dev:      types.BlockHeight(5),  // 1 minute
+		Testing:  types.BlockHeight(2),  // 2 seconds
+	}).(types.BlockHeight)
+	maxWindowSize = build.Select(build.Var{
+		Standard: types.BlockHeight(1008), // 1 week
+		Dev:      types.BlockHeight(1008), // 3.4 hours
+		Testing:  types.BlockHeight(200),  // 3.3 minutes
+	}).(types.BlockHeight)
+	windowSizeMu sync.RWMutex
+)
+
+// SetWindowSizeRange sets the range of proof window sizes that the renter
+// accepts from hosts when forming contracts.
+func SetWindowSizeRange(min, max types.BlockHeight) error {
+	if min == 0 || min > max {
+		return errBadWindowSizeRange
+	}
+	windowSizeMu.Lock()
+	minWindowSize, maxWindowSize = min, max
+	windowSizeMu.Unlock()
+	return nil
+}
+
+// checkWindowSize checks that the host's proof window size is within the
+// acceptable range.
+func checkWindowSize(settings modules.HostExternalSettings) error {
+	windowSizeMu.RLock()
+	min, max := minWindowSize, maxWindowSize
+	windowSizeMu.RUnlock()
+	if settings.WindowSize < min {
+		return fmt.Errorf("host's window size of %v blocks is below the minimum of %v blocks", settings.WindowSize, min)
+	} else if settings.WindowSize > max {
+		return fmt.Errorf("host's window size of %v blocks is above the maximum of %v blocks", settings.WindowSize, max)
+	}
+	return nil
+}
@@ -2,7 +2,6 @@ package proto
 
 import (
 	"errors"
-	"net"
 	"time"
 
 	"github.com/NebulousLabs/Sia/crypto"
@@ -47,6 +46,16 @@ func Renew(contract modules.RenterContract, params ContractParams, txnBuilder tr
 		return modules.RenterContract{}, errors.New("new collateral smaller than old collateral")
 	}
 
+	// If the host misses its proof, the storage fees for the data already
+	// covered by the contract go to the void along with the collateral being
+	// risked, unless the renter has chosen to have its payments refunded.
+	renterMissedOutput := types.PostTax(startHeight, payout).Sub(hostPayout)
+	voidOutput := basePrice.Add(baseCollateral)
+	if params.MissedProofPolicy == RefundPayments {
+		renterMissedOutput = renterMissedOutput.Add(basePrice)
+		voidOutput = baseCollateral
+	}
+
 	// create file contract
 	fc := types.FileContract{
 		FileSize:       contract.LastRevision.NewFileSize,
@@ -64,11 +73,12 @@ func Renew(contract modules.RenterContract, params ContractParams, txnBuilder tr
 		},
 		MissedProofOutputs: []types.SiacoinOutput{
 			// renter
-			{Value: types.PostTax(startHeight, payout).Sub(hostPayout), UnlockHash: refundAddress},
+			{Value: renterMissedOutput, UnlockHash: refundAddress},
 			// host gets its unused collateral back, plus the contract price
 			{Value: hostCollateral.Sub(baseCollateral).Add(host.ContractPrice), UnlockHash: host.UnlockHash},
-			// void gets the spent storage fees, plus the collateral being risked
-			{Value: basePrice.Add(baseCollateral), UnlockHash: types.UnlockHash{}},
+			// void gets the collateral being risked, and possibly the spent
+			// storage fees
+			{Value: voidOutput, UnlockHash: types.UnlockHash{}},
 		},
 	}
 
@@ -91,7 +101,7 @@ func Renew(contract modules.RenterContract, params ContractParams, txnBuilder tr
 	txnSet := append(parentTxns, txn)
 
 	// initiate connection
-	conn, err := net.DialTimeout("tcp", string(host.NetAddress), 15*time.Second)
+	conn, err := dialHost(params)
 	if err != nil {
 		return modules.RenterContract{}, err
 	}
@@ -116,7 +126,8 @@ func Renew(contract modules.RenterContract, params ContractParams, txnBuilder tr
 	}
 
 	// allot time for negotiation
-	extendDeadline(conn, modules.NegotiateRenewContractTime)
+	deadline := time.Now().Add(timeoutOrDefault(params.Timeouts.Contract, modules.NegotiateRenewContractTime))
+	_ = conn.SetDeadline(deadline)
 
 	// send acceptance, txn signed by us, and pubkey
 	if err = modules.WriteNegotiationAcceptance(conn); err != nil {
@@ -135,17 +146,15 @@ func Renew(contract modules.RenterContract, params ContractParams, txnBuilder tr
 	}
 	// host now sends any new parent transactions, inputs and outputs that
 	// were added to the transaction
-	var newParents []types.Transaction
-	var newInputs []types.SiacoinInput
-	var newOutputs []types.SiacoinOutput
-	if err = encoding.ReadObject(conn, &newParents, types.BlockSizeLimit); err != nil {
-		return modules.RenterContract{}, errors.New("couldn't read the host's added parents: " + err.Error())
-	}
-	if err = encoding.ReadObject(conn, &newInputs, types.BlockSizeLimit); err != nil {
-		return modules.RenterContract{}, errors.New("couldn't read the host's added inputs: " + err.Error())
+	newParents, newInputs, newOutputs, err := readHostAdditions(conn, params, deadline)
+	if err != nil {
+		return modules.RenterContract{}, err
 	}
-	if err = encoding.ReadObject(conn, &newOutputs, types.BlockSizeLimit); err != nil {
-		return modules.RenterContract{}, errors.New("couldn't read the host's added outputs: " + err.Error())
+
+	// the host must not spend any of our inputs or the outputs of our parent
+	// transactions
+	if err = checkHostInputs(txnSet, newInputs); err != nil {
+		return modules.RenterContract{}, modules.WriteNegotiationRejection(conn, err)
 	}
 
 	// merge txnAdditions with txnSet
@@ -233,6 +242,9 @@ func Renew(contract modules.RenterContract, params ContractParams, txnBuilder tr
 	// Construct the final transaction.
 	txn, parentTxns = txnBuilder.View()
 	txnSet = append(parentTxns, txn)
+	if err = checkContractTxn(txn, fc, startHeight); err != nil {
+		return modules.RenterContract{}, err
+	}
 
 	// Submit to blockchain.
 	err = tpool.AcceptTransactionSet(txnSet)
@@ -249,6 +261,7 @@ func Renew(contract modules.RenterContract, params ContractParams, txnBuilder tr
 
 	return modules.RenterContract{
 		FileContract:    fc,
+		HostPublicKey:   host.PublicKey,
 		ID:              fcid,
 		LastRevision:    initRevision,
 		LastRevisionTxn: revisionTxn,
@@ -257,6 +270,14 @@ func Renew(contract modules.RenterContract, params ContractParams, txnBuilder tr
 		SecretKey:       ourSK,
 		StartHeight:     startHeight,
 
+		// the new allocation is in addition to the data already in the
+		// contract
+		Capacity: contract.LastRevision.NewFileSize + filesize,
+
+		// the storage fees for the data already in the contract are paid to
+		// the host up front
+		StorageSpending: basePrice,
+
 		TotalCost:   renterCost,
 		ContractFee: host.ContractPrice,
 		TxnFee:      txnFee,
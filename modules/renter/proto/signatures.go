@@ -0,0 +1,75 @@
+package proto
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// A signatureVerifier checks that sig is a valid signature of hash by the
+// public key pk, where pk is the Key of a types.SiaPublicKey.
+type signatureVerifier func(pk []byte, hash crypto.Hash, sig crypto.Signature) error
+
+var (
+	// errUnknownSignatureAlgorithm is returned when a host's public key uses
+	// a signature algorithm that has no registered verifier.
+	errUnknownSignatureAlgorithm = errors.New("host used unsupported signature algorithm")
+
+	// signatureVerifiers maps each supported signature algorithm to the
+	// function that verifies its signatures.
+	signatureVerifiers = map[types.Specifier]signatureVerifier{
+		types.SignatureEd25519: verifyEd25519,
+	}
+	signatureVerifiersMu sync.RWMutex
+)
+
+// registerSignatureVerifier registers the verifier used for signatures made
+// with the given algorithm, replacing any existing verifier.
+func registerSignatureVerifier(algorithm types.Specifier, v signatureVerifier) {
+	signatureVerifiersMu.Lock()
+	signatureVerifiers[algorithm] = v
+	signatureVerifiersMu.Unlock()
+}
+
+// verifyEd25519 verifies an Ed25519 signature.
+func verifyEd25519(pk []byte, hash crypto.Hash, sig crypto.Signature) error {
+	if len(pk) != crypto.PublicKeySize {
+		return errors.New("ed25519 public key has the wrong length")
+	}
+	var key crypto.PublicKey
+	copy(key[:], pk)
+	return crypto.VerifyHash(hash, key, sig)
+}
+
+// readSignedObject reads a signed object from r, in the format written by
+// crypto.WriteSignedObject, and verifies the signature using the verifier
+// registered for pk's algorithm.
+func readSignedObject(r io.Reader, obj interface{}, maxLen uint64, pk types.SiaPublicKey) error {
+	signatureVerifiersMu.RLock()
+	verify, ok := signatureVerifiers[pk.Algorithm]
+	signatureVerifiersMu.RUnlock()
+	if !ok {
+		return errUnknownSignatureAlgorithm
+	}
+
+	// read the signature
+	var sig crypto.Signature
+	if err := encoding.NewDecoder(r).Decode(&sig); err != nil {
+		return err
+	}
+	// read the encoded object
+	encObj, err := encoding.ReadPrefix(r, maxLen)
+	if err != nil {
+		return err
+	}
+	// verify the signature
+	if err := verify(pk.Key, crypto.HashBytes(encObj), sig); err != nil {
+		return err
+	}
+	// decode the object
+	return encoding.Unmarshal(encObj, obj)
+}
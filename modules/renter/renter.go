@@ -9,7 +9,10 @@ package renter
 
 import (
 	"errors"
+	"io"
+	"sync/atomic"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/renter/contractor"
 	"github.com/NebulousLabs/Sia/modules/renter/hostdb"
@@ -23,6 +26,8 @@ var (
 	errNilCS         = errors.New("cannot create renter with nil consensus set")
 	errNilTpool      = errors.New("cannot create renter with nil transaction pool")
 	errNilHdb        = errors.New("cannot create renter with nil hostdb")
+
+	errNegativeUploadLimit = errors.New("upload concurrency limit cannot be negative")
 )
 
 // A hostDB is a database of hosts that the renter can use for figuring out who
@@ -44,6 +49,10 @@ type hostDB interface {
 
 	// Host returns the HostDBEntry for a given host.
 	Host(modules.NetAddress) (modules.HostDBEntry, bool)
+
+	// HostWeight returns the weight of the host with the given public key,
+	// if the host has been weighted.
+	HostWeight(types.SiaPublicKey) (types.Currency, bool)
 }
 
 // A hostContractor negotiates, revises, renews, and provides access to file
@@ -55,13 +64,25 @@ type hostContractor interface {
 	// soon as SetAllowance is called; that is, it may block.
 	SetAllowance(modules.Allowance) error
 
+	// ValidateAllowance returns the error that SetAllowance would return for
+	// the allowance, without setting it.
+	ValidateAllowance(modules.Allowance) error
+
 	// Allowance returns the current allowance
 	Allowance() modules.Allowance
 
+	// BackupContracts writes the current contracts, including their secret
+	// keys, to w.
+	BackupContracts(w io.Writer) error
+
+	// CancelContract removes a contract from the current contract set.
+	CancelContract(types.FileContractID) error
+
 	// Contract returns the latest contract formed with the specified host.
 	Contract(modules.NetAddress) (modules.RenterContract, bool)
 
-	// Contracts returns the contracts formed by the contractor.
+	// Contracts returns the contracts formed by the contractor whose hosts
+	// are online.
 	Contracts() []modules.RenterContract
 
 	// CurrentPeriod returns the height at which the current allowance period
@@ -72,9 +93,63 @@ type hostContractor interface {
 	// insertion, deletion, and modification of sectors.
 	Editor(types.FileContractID) (contractor.Editor, error)
 
+	// EstimateContracts estimates the contracts that would be formed if the
+	// allowance were set to a, without forming them.
+	EstimateContracts(a modules.Allowance) (modules.RenterContractEstimate, error)
+
+	// ExpiringContracts returns the contracts whose proof window starts
+	// within the specified number of blocks, soonest first.
+	ExpiringContracts(within types.BlockHeight) []modules.RenterContract
+
 	// IsOffline reports whether the specified host is considered offline.
 	IsOffline(types.FileContractID) bool
 
+	// PriceEstimation estimates the cost of forming contracts with the
+	// current set of hosts.
+	PriceEstimation() (modules.RenterPriceEstimation, error)
+
+	// RecentFailures returns the most recent failed attempts to form a
+	// contract with each host.
+	RecentFailures() []modules.HostFailure
+
+	// ResolveID returns the ID of the most recent renewal of the specified
+	// contract. Files keep the ID of the contract they were uploaded to.
+	ResolveID(types.FileContractID) types.FileContractID
+
+	// RestoreContracts adds the contracts written by BackupContracts to the
+	// current contract set, returning the number of contracts added.
+	RestoreContracts(r io.Reader) (int, error)
+
+	// SetLogVerbosity sets how much detail the contractor writes to its log.
+	SetLogVerbosity(contractor.Verbosity) error
+
+	// WillRenew reports whether the contractor intends to renew the specified
+	// contract.
+	WillRenew(types.FileContractID) bool
+
+	// ReservedFunds returns the amount of the allowance that is held back
+	// when sizing contracts.
+	ReservedFunds() types.Currency
+
+	// BandwidthReserve returns the amount of the allowance that was held
+	// back for upload and download costs when the current contracts were
+	// sized.
+	BandwidthReserve() types.Currency
+
+	// SetMaxHosts, SetFundingMargin, and SetBandwidthReserve set the limits
+	// that control how the allowance is divided among contracts, and
+	// MaxHosts, FundingMargin, and BandwidthShare return them.
+	SetMaxHosts(uint64) error
+	SetFundingMargin(float64) error
+	SetBandwidthReserve(float64) error
+	MaxHosts() uint64
+	FundingMargin() float64
+	BandwidthShare() float64
+
+	// NegotiationMetrics returns the durations of the negotiation phases of
+	// each current contract.
+	NegotiationMetrics() []modules.NegotiationMetrics
+
 	// Downloader creates a Downloader from the specified contract ID,
 	// allowing the retrieval of sectors.
 	Downloader(types.FileContractID) (contractor.Downloader, error)
@@ -87,6 +162,9 @@ type hostContractor interface {
 type trackedFile struct {
 	// location of original file on disk
 	RepairPath string
+
+	// hosts that the file's pieces are restricted to; empty means any host
+	Hosts []types.SiaPublicKey `json:",omitempty"`
 }
 
 // A Renter is responsible for tracking all of the files that a user has
@@ -99,6 +177,19 @@ type Renter struct {
 	files    map[string]*file
 	tracking map[string]trackedFile // map from nickname to metadata
 
+	// uploadKeys records the result of each upload submitted with an
+	// idempotency key, so that retried uploads are not processed twice.
+	// Entries expire after uploadKeyTTL and are not persisted.
+	uploadKeys map[string]*uploadKey
+
+	// sectors indexes the sectors uploaded by the renter, so that identical
+	// pieces are only uploaded once. sectorsDirty is set when the index has
+	// changes that have not been saved yet. dedupSecret is mixed into the
+	// master key of each uploaded file.
+	sectors      sectorIndex
+	sectorsDirty bool
+	dedupSecret  crypto.Hash
+
 	// Work management.
 	//
 	// chunkQueue contains a list of incomplete work that the download loop
@@ -107,11 +198,21 @@ type Renter struct {
 	//
 	// downloadQueue contains a complete history of work that has been
 	// submitted to the download loop.
-	chunkQueue    []*chunkDownload // Accessed without locks.
-	downloadQueue []*download
-	newDownloads  chan *download
-	newRepairs    chan *file
-	workerPool    map[types.FileContractID]*worker
+	//
+	// maxConcurrentUploads limits the number of files that the repair loop
+	// uploads at once, with 0 meaning no limit. atomicQueuedUploads is the
+	// number of files that are waiting for an upload slot.
+	chunkQueue           []*chunkDownload // Accessed without locks.
+	downloadQueue        []*download
+	newDownloads         chan *download
+	newRepairs           chan *file
+	workerPool           map[types.FileContractID]*worker
+	maxConcurrentUploads int
+	atomicQueuedUploads  uint64
+
+	// debugLogging is set if the contractor logs its host selection
+	// decisions. It is persisted so that it survives restarts.
+	debugLogging bool
 
 	// Utilities.
 	cs             modules.ConsensusSet
@@ -157,6 +258,8 @@ func newRenter(cs modules.ConsensusSet, tpool modules.TransactionPool, hdb hostD
 		newRepairs: make(chan *file),
 		files:      make(map[string]*file),
 		tracking:   make(map[string]trackedFile),
+		uploadKeys: make(map[string]*uploadKey),
+		sectors:    newSectorIndex(nil),
 
 		newDownloads: make(chan *download),
 		workerPool:   make(map[types.FileContractID]*worker),
@@ -188,34 +291,117 @@ func (r *Renter) Close() error {
 
 // SetSettings will update the settings for the renter.
 func (r *Renter) SetSettings(s modules.RenterSettings) error {
-	err := r.hostContractor.SetAllowance(s.Allowance)
+	if s.MaxConcurrentUploads < 0 {
+		return errNegativeUploadLimit
+	}
+	// The limits are set first so that they apply to the new allowance. If
+	// the allowance is rejected, the previous limits are restored.
+	prev := r.Settings()
+	err := r.setContractorLimits(s)
+	if err == nil {
+		err = r.hostContractor.SetAllowance(s.Allowance)
+	}
+	if err != nil {
+		r.setContractorLimits(prev)
+		return err
+	}
+	err = r.hostContractor.SetLogVerbosity(logVerbosity(s.DebugLogging))
 	if err != nil {
 		return err
 	}
 
 	id := r.mu.Lock()
 	r.updateWorkerPool()
+	r.maxConcurrentUploads = s.MaxConcurrentUploads
+	r.debugLogging = s.DebugLogging
+	err = r.saveSync()
 	r.mu.Unlock(id)
-	return nil
+	return err
 }
 
 // hostdb passthroughs
 func (r *Renter) ActiveHosts() []modules.HostDBEntry { return r.hostDB.ActiveHosts() }
 func (r *Renter) AllHosts() []modules.HostDBEntry    { return r.hostDB.AllHosts() }
+func (r *Renter) HostWeight(pk types.SiaPublicKey) (types.Currency, bool) {
+	return r.hostDB.HostWeight(pk)
+}
 
 // contractor passthroughs
+func (r *Renter) CancelContract(id types.FileContractID) error {
+	return r.hostContractor.CancelContract(id)
+}
 func (r *Renter) Contracts() []modules.RenterContract { return r.hostContractor.Contracts() }
 func (r *Renter) CurrentPeriod() types.BlockHeight    { return r.hostContractor.CurrentPeriod() }
+func (r *Renter) EstimateContracts(a modules.Allowance) (modules.RenterContractEstimate, error) {
+	return r.hostContractor.EstimateContracts(a)
+}
+func (r *Renter) ExpiringContracts(within types.BlockHeight) []modules.RenterContract {
+	return r.hostContractor.ExpiringContracts(within)
+}
+func (r *Renter) ValidateAllowance(a modules.Allowance) error {
+	return r.hostContractor.ValidateAllowance(a)
+}
+func (r *Renter) PriceEstimation() (modules.RenterPriceEstimation, error) {
+	return r.hostContractor.PriceEstimation()
+}
+func (r *Renter) RecentFailures() []modules.HostFailure  { return r.hostContractor.RecentFailures() }
+func (r *Renter) ReservedFunds() types.Currency          { return r.hostContractor.ReservedFunds() }
+func (r *Renter) BandwidthReserve() types.Currency       { return r.hostContractor.BandwidthReserve() }
+func (r *Renter) WillRenew(id types.FileContractID) bool { return r.hostContractor.WillRenew(id) }
+func (r *Renter) NegotiationMetrics() []modules.NegotiationMetrics {
+	return r.hostContractor.NegotiationMetrics()
+}
 func (r *Renter) Settings() modules.RenterSettings {
+	id := r.mu.RLock()
+	maxUploads := r.maxConcurrentUploads
+	debugLogging := r.debugLogging
+	r.mu.RUnlock(id)
 	return modules.RenterSettings{
-		Allowance: r.hostContractor.Allowance(),
+		Allowance:            r.hostContractor.Allowance(),
+		MaxHosts:             r.hostContractor.MaxHosts(),
+		FundingMargin:        r.hostContractor.FundingMargin(),
+		BandwidthReserve:     r.hostContractor.BandwidthShare(),
+		MaxConcurrentUploads: maxUploads,
+		DebugLogging:         debugLogging,
 	}
 }
+
+// setContractorLimits applies the settings that control how the contractor
+// divides the allowance among contracts.
+func (r *Renter) setContractorLimits(s modules.RenterSettings) error {
+	if err := r.hostContractor.SetMaxHosts(s.MaxHosts); err != nil {
+		return err
+	}
+	if err := r.hostContractor.SetFundingMargin(s.FundingMargin); err != nil {
+		return err
+	}
+	return r.hostContractor.SetBandwidthReserve(s.BandwidthReserve)
+}
+
+// logVerbosity returns the contractor log verbosity for the DebugLogging
+// setting.
+func logVerbosity(debug bool) contractor.Verbosity {
+	if debug {
+		return contractor.VerbosityDebug
+	}
+	return contractor.VerbosityNormal
+}
+
+// UploadQueueDepth returns the number of files that are waiting for an upload
+// slot.
+func (r *Renter) UploadQueueDepth() int {
+	return int(atomic.LoadUint64(&r.atomicQueuedUploads))
+}
 func (r *Renter) AllContracts() []modules.RenterContract {
 	return r.hostContractor.(interface {
 		AllContracts() []modules.RenterContract
 	}).AllContracts()
 }
+func (r *Renter) CachedAddress() (bool, int) {
+	return r.hostContractor.(interface {
+		CachedAddress() (bool, int)
+	}).CachedAddress()
+}
 
 // enforce that Renter satisfies the modules.Renter interface
 var _ modules.Renter = (*Renter)(nil)
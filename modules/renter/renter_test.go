@@ -1,6 +1,7 @@
 package renter
 
 import (
+	"io"
 	"path/filepath"
 
 	"github.com/NebulousLabs/Sia/build"
@@ -171,20 +172,47 @@ func (stubHostDB) AllHosts() []modules.HostDBEntry      { return nil }
 func (stubHostDB) AverageContractPrice() types.Currency { return types.Currency{} }
 func (stubHostDB) Close() error                         { return nil }
 func (stubHostDB) IsOffline(modules.NetAddress) bool    { return true }
+func (stubHostDB) HostWeight(types.SiaPublicKey) (types.Currency, bool) {
+	return types.Currency{}, false
+}
 
 // stubContractor is the minimal implementation of the hostContractor
 // interface.
 type stubContractor struct{}
 
-func (stubContractor) SetAllowance(modules.Allowance) error { return nil }
-func (stubContractor) Allowance() modules.Allowance         { return modules.Allowance{} }
+func (stubContractor) SetAllowance(modules.Allowance) error       { return nil }
+func (stubContractor) ValidateAllowance(modules.Allowance) error  { return nil }
+func (stubContractor) Allowance() modules.Allowance               { return modules.Allowance{} }
+func (stubContractor) CancelContract(types.FileContractID) error  { return nil }
+func (stubContractor) BackupContracts(io.Writer) error            { return nil }
+func (stubContractor) RestoreContracts(io.Reader) (int, error)    { return 0, nil }
+func (stubContractor) SetLogVerbosity(contractor.Verbosity) error { return nil }
+func (stubContractor) WillRenew(types.FileContractID) bool        { return false }
+func (stubContractor) ReservedFunds() types.Currency              { return types.ZeroCurrency }
+func (stubContractor) BandwidthReserve() types.Currency           { return types.ZeroCurrency }
+func (stubContractor) SetMaxHosts(uint64) error                   { return nil }
+func (stubContractor) SetFundingMargin(float64) error             { return nil }
+func (stubContractor) SetBandwidthReserve(float64) error          { return nil }
+func (stubContractor) MaxHosts() uint64                           { return 0 }
+func (stubContractor) FundingMargin() float64                     { return 0 }
+func (stubContractor) BandwidthShare() float64                    { return 0 }
 func (stubContractor) Contract(modules.NetAddress) (modules.RenterContract, bool) {
 	return modules.RenterContract{}, false
 }
 func (stubContractor) Contracts() []modules.RenterContract                    { return nil }
 func (stubContractor) CurrentPeriod() types.BlockHeight                       { return 0 }
 func (stubContractor) IsOffline(modules.NetAddress) bool                      { return false }
+func (stubContractor) ResolveID(id types.FileContractID) types.FileContractID { return id }
 func (stubContractor) Editor(types.FileContractID) (contractor.Editor, error) { return nil, nil }
 func (stubContractor) Downloader(types.FileContractID) (contractor.Downloader, error) {
 	return nil, nil
 }
+func (stubContractor) EstimateContracts(modules.Allowance) (modules.RenterContractEstimate, error) {
+	return modules.RenterContractEstimate{}, nil
+}
+func (stubContractor) ExpiringContracts(types.BlockHeight) []modules.RenterContract { return nil }
+func (stubContractor) PriceEstimation() (modules.RenterPriceEstimation, error) {
+	return modules.RenterPriceEstimation{}, nil
+}
+func (stubContractor) RecentFailures() []modules.HostFailure            { return nil }
+func (stubContractor) NegotiationMetrics() []modules.NegotiationMetrics { return nil }
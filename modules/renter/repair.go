@@ -9,9 +9,11 @@ import (
 	"errors"
 	"io"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -24,8 +26,20 @@ var (
 	// errFileDeleted indicates that a chunk which is trying to be repaired
 	// cannot be found in the renter.
 	errFileDeleted = errors.New("cannot repair chunk as the file is not being tracked by the renter")
+
+	// errInsufficientRepairHosts indicates that a chunk is missing pieces,
+	// but there are no hosts left that the pieces could be uploaded to.
+	errInsufficientRepairHosts = errors.New("not enough hosts to repair the file to full redundancy")
 )
 
+// maxRepairFailures is the number of consecutive failed repairs after which a
+// file reports an upload error.
+var maxRepairFailures = build.Select(build.Var{
+	Standard: 3,
+	Dev:      3,
+	Testing:  1,
+}).(int)
+
 type (
 	// chunkStatus contains information about a chunk to assist with repairing
 	// the chunk.
@@ -38,8 +52,12 @@ type (
 		//
 		// recordedGaps indicates the value that this chunk has recorded in the
 		// gapCounts map.
+		//
+		// hosts is the set of host public keys that the chunk's file is pinned
+		// to. If it is nil, pieces may be uploaded to any host.
 		activePieces int
 		contracts    map[types.FileContractID]struct{}
+		hosts        map[string]struct{}
 		pieces       map[uint64]struct{}
 		recordedGaps int
 		totalPieces  int
@@ -68,14 +86,35 @@ type (
 		// aren't being used.
 		//
 		// workerSet tracks the set of workers which can be used for uploading.
+		//
+		// contractHosts maps the contract of each worker to the public key of
+		// its host, so that chunks pinned to specific hosts can be matched to
+		// workers.
+		//
+		// activeFiles is the set of files that have chunks in
+		// incompleteChunks, each of which occupies an upload slot.
+		// queuedFiles are files that are waiting for a slot to free up.
+		activeFiles      map[string]struct{}
 		activeWorkers    map[types.FileContractID]*worker
 		availableWorkers map[types.FileContractID]*worker
+		contractHosts    map[types.FileContractID]string
 		gapCounts        map[int]int
 		incompleteChunks map[chunkID]*chunkStatus
+		queuedFiles      []*file
 		resultChan       chan finishedUpload
 	}
 )
 
+// allowed reports whether pieces of the chunk may be uploaded to the host of
+// the specified contract.
+func (cs *chunkStatus) allowed(rs *repairState, contract types.FileContractID) bool {
+	if cs.hosts == nil {
+		return true
+	}
+	_, exists := cs.hosts[rs.contractHosts[contract]]
+	return exists
+}
+
 // numGaps returns the number of gaps that a chunk has.
 func (cs *chunkStatus) numGaps(rs *repairState) int {
 	incompatContracts := 0
@@ -86,6 +125,19 @@ func (cs *chunkStatus) numGaps(rs *repairState) int {
 			incompatContracts++
 		}
 	}
+	// Workers whose hosts the chunk is not pinned to cannot fill any gaps.
+	if cs.hosts != nil {
+		for contract := range rs.activeWorkers {
+			if _, exists := cs.contracts[contract]; !exists && !cs.allowed(rs, contract) {
+				incompatContracts++
+			}
+		}
+		for contract := range rs.availableWorkers {
+			if _, exists := cs.contracts[contract]; !exists && !cs.allowed(rs, contract) {
+				incompatContracts++
+			}
+		}
+	}
 	contractGaps := len(rs.activeWorkers) + len(rs.availableWorkers) - incompatContracts
 	pieceGaps := cs.totalPieces - len(cs.pieces)
 
@@ -98,6 +150,25 @@ func (cs *chunkStatus) numGaps(rs *repairState) int {
 // addFileToRepairState will take a file and add each of the incomplete chunks
 // to the repair state, along with data about which pieces need attention.
 func (r *Renter) addFileToRepairState(rs *repairState, file *file) {
+	// Ignore files whose upload has been canceled.
+	file.mu.RLock()
+	canceled := file.uploadCanceled()
+	file.mu.RUnlock()
+	if canceled {
+		return
+	}
+
+	// Fetch the hosts that the file is pinned to, if any.
+	var hosts map[string]struct{}
+	id := r.mu.RLock()
+	if pinned := r.tracking[file.name].Hosts; len(pinned) > 0 {
+		hosts = make(map[string]struct{}, len(pinned))
+		for _, pk := range pinned {
+			hosts[pk.String()] = struct{}{}
+		}
+	}
+	r.mu.RUnlock(id)
+
 	// Fetch the list of potential contracts from the repair state.
 	contracts := make([]types.FileContractID, 0)
 	for contract := range rs.activeWorkers {
@@ -158,6 +229,7 @@ func (r *Renter) addFileToRepairState(rs *repairState, file *file) {
 		// chunks.
 		cs := &chunkStatus{
 			contracts:   utilizedContracts[i],
+			hosts:       hosts,
 			pieces:      availablePieces[i],
 			totalPieces: file.erasureCode.NumPieces(),
 		}
@@ -167,23 +239,91 @@ func (r *Renter) addFileToRepairState(rs *repairState, file *file) {
 	}
 }
 
+// managedQueueRepair adds a file to the repair state if the renter is
+// uploading fewer than maxConcurrentUploads files. Otherwise the file is
+// queued until an upload slot frees up.
+func (r *Renter) managedQueueRepair(rs *repairState, file *file) {
+	id := r.mu.RLock()
+	limit := r.maxConcurrentUploads
+	r.mu.RUnlock(id)
+
+	// Files that are already being uploaded do not need another slot.
+	_, active := rs.activeFiles[file.name]
+	if active || limit == 0 || len(rs.activeFiles) < limit {
+		r.startFileRepair(rs, file)
+		return
+	}
+	for _, queued := range rs.queuedFiles {
+		if queued.name == file.name {
+			return
+		}
+	}
+	rs.queuedFiles = append(rs.queuedFiles, file)
+	atomic.StoreUint64(&r.atomicQueuedUploads, uint64(len(rs.queuedFiles)))
+}
+
+// managedReleaseUploadSlots frees the upload slots of files that no longer
+// have any incomplete chunks, and starts as many queued files as there are
+// free slots.
+func (r *Renter) managedReleaseUploadSlots(rs *repairState) {
+	remaining := make(map[string]struct{})
+	for cid := range rs.incompleteChunks {
+		remaining[cid.filename] = struct{}{}
+	}
+	for name := range rs.activeFiles {
+		if _, exists := remaining[name]; !exists {
+			delete(rs.activeFiles, name)
+		}
+	}
+
+	id := r.mu.RLock()
+	limit := r.maxConcurrentUploads
+	r.mu.RUnlock(id)
+	for len(rs.queuedFiles) > 0 && (limit == 0 || len(rs.activeFiles) < limit) {
+		file := rs.queuedFiles[0]
+		rs.queuedFiles = rs.queuedFiles[1:]
+		r.startFileRepair(rs, file)
+	}
+	atomic.StoreUint64(&r.atomicQueuedUploads, uint64(len(rs.queuedFiles)))
+}
+
+// startFileRepair adds a file to the repair state. The file only occupies an
+// upload slot if it has chunks that need repairing.
+func (r *Renter) startFileRepair(rs *repairState, file *file) {
+	numChunks := len(rs.incompleteChunks)
+	r.addFileToRepairState(rs, file)
+	if len(rs.incompleteChunks) > numChunks {
+		rs.activeFiles[file.name] = struct{}{}
+	}
+}
+
 // managedRepairIteration does a full file repair iteration, which includes
 // scanning all of the files for missing pieces and attempting repair them by
 // uploading to chunks.
 func (r *Renter) managedRepairIteration(rs *repairState) {
+	// Start any queued files that fit in the upload slots of files that have
+	// finished.
+	r.managedReleaseUploadSlots(rs)
+
 	// Wait for work if there is nothing to do.
 	if len(rs.activeWorkers) == 0 && len(rs.incompleteChunks) == 0 {
+		r.managedSaveSectorIndex()
 		select {
 		case <-r.tg.StopChan():
 			return
 		case file := <-r.newRepairs:
-			r.addFileToRepairState(rs, file)
+			r.managedQueueRepair(rs, file)
 			return
 		}
 	}
 
 	// Reset the available workers.
+	contractHosts := make(map[types.FileContractID]string)
+	for _, c := range r.hostContractor.Contracts() {
+		contractHosts[c.ID] = c.HostPublicKey.String()
+	}
 	id := r.mu.Lock()
+	rs.contractHosts = contractHosts
 	r.updateWorkerPool()
 	rs.availableWorkers = make(map[types.FileContractID]*worker)
 	for id, worker := range r.workerPool {
@@ -236,6 +376,13 @@ func (r *Renter) managedRepairIteration(rs *repairState) {
 		// completed and there are no workers still working on it.
 		if numGaps == 0 && chunkStatus.activePieces == 0 {
 			chunksToDelete = append(chunksToDelete, chunkID)
+			// A chunk without gaps can still be missing pieces if every
+			// available host already stores one of its pieces.
+			if len(chunkStatus.pieces) < chunkStatus.totalPieces {
+				r.managedRecordRepairResult(chunkID.filename, errInsufficientRepairHosts)
+			} else {
+				r.managedRecordRepairResult(chunkID.filename, nil)
+			}
 			continue
 		}
 
@@ -249,7 +396,7 @@ func (r *Renter) managedRepairIteration(rs *repairState) {
 		var usefulWorkers []types.FileContractID
 		for workerID := range rs.availableWorkers {
 			_, exists := chunkStatus.contracts[workerID]
-			if !exists {
+			if !exists && chunkStatus.allowed(rs, workerID) {
 				usefulWorkers = append(usefulWorkers, workerID)
 			}
 		}
@@ -268,8 +415,14 @@ func (r *Renter) managedRepairIteration(rs *repairState) {
 
 		// Send off the work.
 		err := r.managedScheduleChunkRepair(rs, chunkID, chunkStatus, usefulWorkers)
-		if err != nil {
+		if err == errFileDeleted {
+			// The file was deleted or its upload was canceled, which is not
+			// a repair failure.
+			chunksToDelete = append(chunksToDelete, chunkID)
+			continue
+		} else if err != nil {
 			r.log.Println("Unable to repair chunk:", err)
+			r.managedRecordRepairResult(chunkID.filename, err)
 			chunksToDelete = append(chunksToDelete, chunkID)
 			continue
 		}
@@ -277,6 +430,9 @@ func (r *Renter) managedRepairIteration(rs *repairState) {
 	for _, cid := range chunksToDelete {
 		delete(rs.incompleteChunks, cid)
 	}
+	if len(chunksToDelete) > 0 {
+		r.managedSaveSectorIndex()
+	}
 
 	// Block until some of the workers return.
 	r.managedWaitOnRepairWork(rs)
@@ -330,6 +486,15 @@ func (r *Renter) managedScheduleChunkRepair(rs *repairState, chunkID chunkID, ch
 		}
 	}
 
+	// Reference the missing pieces that are already stored on a host instead
+	// of uploading them again.
+	hashes := make(map[uint64]crypto.Hash, len(missingPieces))
+	for _, missingPiece := range missingPieces {
+		key := deriveKey(file.masterKey, chunkIndex, missingPiece)
+		hashes[missingPiece] = pieceHash(key, pieces[missingPiece])
+	}
+	missingPieces, usefulWorkers = r.managedDeduplicatePieces(rs, file, chunkID, chunkStatus, hashes, missingPieces, usefulWorkers)
+
 	// Truncate the pieces so that they match the size of the useful workers.
 	if len(usefulWorkers) < len(missingPieces) {
 		missingPieces = missingPieces[:len(usefulWorkers)]
@@ -350,6 +515,7 @@ func (r *Renter) managedScheduleChunkRepair(rs *repairState, chunkID chunkID, ch
 			chunkID:    chunkID,
 			data:       pieces[missingPieces[0]],
 			file:       file,
+			pieceHash:  hashes[missingPieces[0]],
 			pieceIndex: missingPieces[0],
 
 			resultChan: rs.resultChan,
@@ -384,6 +550,72 @@ func (r *Renter) managedScheduleChunkRepair(rs *repairState, chunkID chunkID, ch
 	return nil
 }
 
+// managedDeduplicatePieces adds the missing pieces of a chunk that are
+// already stored on a host to the file, so that they do not need to be
+// uploaded. A sector is only referenced if its contract has a worker and does
+// not store another piece of the chunk. The pieces that still need to be
+// uploaded and the workers that can still be used are returned.
+func (r *Renter) managedDeduplicatePieces(rs *repairState, file *file, chunkID chunkID, chunkStatus *chunkStatus, hashes map[uint64]crypto.Hash, missingPieces []uint64, usefulWorkers []types.FileContractID) ([]uint64, []types.FileContractID) {
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	file.mu.Lock()
+	defer file.mu.Unlock()
+
+	var remaining []uint64
+	for _, missingPiece := range missingPieces {
+		s, exists := r.sectors.lookup(hashes[missingPiece])
+		if !exists {
+			remaining = append(remaining, missingPiece)
+			continue
+		}
+		_, active := rs.activeWorkers[s.Contract]
+		_, available := rs.availableWorkers[s.Contract]
+		_, used := chunkStatus.contracts[s.Contract]
+		if (!active && !available) || used || !chunkStatus.allowed(rs, s.Contract) {
+			remaining = append(remaining, missingPiece)
+			continue
+		}
+
+		contract, exists := file.contracts[s.Contract]
+		if !exists {
+			contract = fileContract{
+				ID:          s.Contract,
+				IP:          s.IP,
+				WindowStart: s.WindowStart,
+			}
+		}
+		contract.Pieces = append(contract.Pieces, pieceData{
+			Chunk:      chunkID.index,
+			Piece:      missingPiece,
+			MerkleRoot: s.MerkleRoot,
+		})
+		file.contracts[s.Contract] = contract
+		r.sectors.insert(s.PieceHash, s.MerkleRoot, contract)
+
+		chunkStatus.contracts[s.Contract] = struct{}{}
+		chunkStatus.pieces[missingPiece] = struct{}{}
+		for i, workerID := range usefulWorkers {
+			if workerID == s.Contract {
+				usefulWorkers = append(usefulWorkers[:i], usefulWorkers[i+1:]...)
+				break
+			}
+		}
+	}
+	if len(remaining) == len(missingPieces) {
+		return remaining, usefulWorkers
+	}
+
+	// Update the number of gaps for this chunk.
+	numGaps := chunkStatus.numGaps(rs)
+	rs.gapCounts[chunkStatus.recordedGaps]--
+	rs.gapCounts[numGaps]++
+	chunkStatus.recordedGaps = numGaps
+
+	r.saveFile(file)
+	r.sectorsDirty = true
+	return remaining, usefulWorkers
+}
+
 // managedWaitOnRepairWork will block until a worker returns from an upload,
 // handling the results.
 func (r *Renter) managedWaitOnRepairWork(rs *repairState) {
@@ -397,7 +629,7 @@ func (r *Renter) managedWaitOnRepairWork(rs *repairState) {
 	select {
 	case finishedUpload = <-rs.resultChan:
 	case file := <-r.newRepairs:
-		r.addFileToRepairState(rs, file)
+		r.managedQueueRepair(rs, file)
 		return
 	case <-r.tg.StopChan():
 		return
@@ -424,6 +656,7 @@ func (r *Renter) managedWaitOnRepairWork(rs *repairState) {
 
 	// Log the error and retire the worker.
 	r.log.Debugln("Error while performing upload to", finishedUpload.workerID, "::", finishedUpload.err)
+	r.managedRecordRepairResult(finishedUpload.chunkID.filename, finishedUpload.err)
 	delete(rs.activeWorkers, finishedUpload.workerID)
 
 	// Indicate in the set of incomplete chunks that this piece was not
@@ -431,6 +664,72 @@ func (r *Renter) managedWaitOnRepairWork(rs *repairState) {
 	rs.incompleteChunks[finishedUpload.chunkID].pieces[finishedUpload.pieceIndex] = struct{}{}
 }
 
+// managedRecordRepairResult records the outcome of a repair of one of a
+// file's chunks. A nil error means that the chunk reached full redundancy,
+// which clears the file's upload error. Otherwise the failure is counted, and
+// the file reports err once maxRepairFailures consecutive repairs have failed.
+func (r *Renter) managedRecordRepairResult(filename string, err error) {
+	id := r.mu.RLock()
+	f, exists := r.files[filename]
+	r.mu.RUnlock(id)
+	if !exists {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		f.repairFailures = 0
+		f.uploadError = ""
+		return
+	}
+	f.repairFailures++
+	if f.repairFailures >= maxRepairFailures {
+		f.uploadError = err.Error()
+	}
+}
+
+// Repair queues the file at siaPath, or every file if siaPath is empty, for
+// repair without waiting for the periodic repair pass. Only files that are
+// missing pieces on the renter's current contracts are queued. It returns the
+// number of files that needed repair.
+func (r *Renter) Repair(siaPath string) (int, error) {
+	live := r.liveContracts()
+
+	id := r.mu.RLock()
+	var files []*file
+	if siaPath != "" {
+		f, exists := r.files[siaPath]
+		if !exists {
+			r.mu.RUnlock(id)
+			return 0, ErrUnknownPath
+		}
+		files = append(files, f)
+	} else {
+		for _, f := range r.files {
+			files = append(files, f)
+		}
+	}
+	r.mu.RUnlock(id)
+
+	var repairs []*file
+	for _, f := range files {
+		f.mu.RLock()
+		if f.needsRepair(r.healthyContracts(f, live)) {
+			repairs = append(repairs, f)
+		}
+		f.mu.RUnlock()
+	}
+	for _, f := range repairs {
+		select {
+		case r.newRepairs <- f:
+		case <-r.tg.StopChan():
+			return 0, errors.New("repair interrupted by shutdown")
+		}
+	}
+	return len(repairs), nil
+}
+
 // threadedQueueRepairs is a goroutine that runs in the background and
 // continuously adds files to the repair loop, slow enough that it's not a
 // resource burden but fast enough that no file is ever at risk.
@@ -480,17 +779,37 @@ func (r *Renter) threadedQueueRepairs() {
 // before the file reaches full redundancy.
 func (r *Renter) threadedRepairLoop() {
 	rs := &repairState{
+		activeFiles:      make(map[string]struct{}),
 		activeWorkers:    make(map[types.FileContractID]*worker),
 		availableWorkers: make(map[types.FileContractID]*worker),
+		contractHosts:    make(map[types.FileContractID]string),
 		gapCounts:        make(map[int]int),
 		incompleteChunks: make(map[chunkID]*chunkStatus),
 		resultChan:       make(chan finishedUpload),
 	}
 	for {
 		if r.tg.Add() != nil {
+			r.managedSaveSectorIndex()
 			return
 		}
 		r.managedRepairIteration(rs)
 		r.tg.Done()
 	}
 }
+
+// managedSaveSectorIndex saves the renter's metadata if the sector index has
+// changed since it was last saved. Saving rewrites the whole index, so the
+// changes made by individual piece uploads are saved together once a chunk
+// completes or the repair loop goes idle.
+func (r *Renter) managedSaveSectorIndex() {
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	if !r.sectorsDirty {
+		return
+	}
+	if err := r.save(); err != nil {
+		r.log.Println("WARN: unable to save the sector index:", err)
+		return
+	}
+	r.sectorsDirty = false
+}
@@ -0,0 +1,162 @@
+package renter
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/sync"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestUploadConcurrencyLimit tests that the repair loop only uploads
+// maxConcurrentUploads files at once, queueing the remaining files until an
+// upload finishes.
+func TestUploadConcurrencyLimit(t *testing.T) {
+	r := &Renter{
+		tracking:             make(map[string]trackedFile),
+		maxConcurrentUploads: 1,
+		mu:                   sync.New(modules.SafeMutexDelay, 1),
+	}
+	rs := &repairState{
+		activeFiles:      make(map[string]struct{}),
+		activeWorkers:    make(map[types.FileContractID]*worker),
+		availableWorkers: make(map[types.FileContractID]*worker),
+		gapCounts:        make(map[int]int),
+		incompleteChunks: make(map[chunkID]*chunkStatus),
+	}
+
+	// Start more uploads than the limit allows.
+	rsc, _ := NewRSCode(1, 1)
+	files := []*file{
+		newFile("foo", rsc, 100, 100),
+		newFile("bar", rsc, 100, 100),
+		newFile("baz", rsc, 100, 100),
+	}
+	for _, f := range files {
+		r.managedQueueRepair(rs, f)
+	}
+	uploading := func() string {
+		if len(rs.activeFiles) != 1 {
+			t.Fatal("expected 1 active upload, got", len(rs.activeFiles))
+		}
+		for cid := range rs.incompleteChunks {
+			if _, exists := rs.activeFiles[cid.filename]; !exists {
+				t.Fatal("chunk of queued file is being repaired:", cid.filename)
+			}
+		}
+		for name := range rs.activeFiles {
+			return name
+		}
+		return ""
+	}
+	if name := uploading(); name != "foo" {
+		t.Fatal("expected foo to be uploading, got", name)
+	}
+	if depth := r.UploadQueueDepth(); depth != 2 {
+		t.Fatal("expected 2 queued uploads, got", depth)
+	}
+
+	// Queueing a file that is already queued should not queue it twice.
+	r.managedQueueRepair(rs, files[1])
+	if depth := r.UploadQueueDepth(); depth != 2 {
+		t.Fatal("expected 2 queued uploads, got", depth)
+	}
+
+	// Finish the upload; the next file should take its slot.
+	finish := func(name string) {
+		for cid := range rs.incompleteChunks {
+			if cid.filename == name {
+				delete(rs.incompleteChunks, cid)
+			}
+		}
+		r.managedReleaseUploadSlots(rs)
+	}
+	finish("foo")
+	if name := uploading(); name != "bar" {
+		t.Fatal("expected bar to be uploading, got", name)
+	}
+	if depth := r.UploadQueueDepth(); depth != 1 {
+		t.Fatal("expected 1 queued upload, got", depth)
+	}
+	finish("bar")
+	if name := uploading(); name != "baz" {
+		t.Fatal("expected baz to be uploading, got", name)
+	}
+	if depth := r.UploadQueueDepth(); depth != 0 {
+		t.Fatal("expected no queued uploads, got", depth)
+	}
+
+	// Without a limit, every file should be uploaded at once.
+	finish("baz")
+	r.maxConcurrentUploads = 0
+	for _, f := range files {
+		r.managedQueueRepair(rs, f)
+	}
+	if len(rs.activeFiles) != len(files) || r.UploadQueueDepth() != 0 {
+		t.Fatal("expected all files to be uploading without a limit")
+	}
+}
+
+// TestRenterRepair tests that Repair queues only the files that are missing
+// pieces on the renter's contracts.
+func TestRenterRepair(t *testing.T) {
+	// Create two files with 1 data piece and 1 parity piece. Both are stored
+	// on contract 1; foo is also stored on contract 2, and bar on contract 3.
+	rsc, _ := NewRSCode(1, 1)
+	foo := newFile("foo", rsc, 100, 100)
+	bar := newFile("bar", rsc, 100, 100)
+	store := func(f *file, id types.FileContractID, piece uint64) {
+		fc := f.contracts[id]
+		fc.ID = id
+		fc.Pieces = append(fc.Pieces, pieceData{Chunk: 0, Piece: piece})
+		f.contracts[id] = fc
+	}
+	store(foo, types.FileContractID{1}, 0)
+	store(foo, types.FileContractID{2}, 1)
+	store(bar, types.FileContractID{1}, 0)
+	store(bar, types.FileContractID{3}, 1)
+
+	// Contract 3 is gone, degrading the redundancy of bar.
+	hc := &recoverableContractor{contracts: []modules.RenterContract{
+		{ID: types.FileContractID{1}},
+		{ID: types.FileContractID{2}},
+	}}
+	r := &Renter{
+		files:          map[string]*file{foo.name: foo, bar.name: bar},
+		hostContractor: hc,
+		newRepairs:     make(chan *file, 2),
+		mu:             sync.New(modules.SafeMutexDelay, 1),
+		tg:             new(sync.ThreadGroup),
+	}
+
+	n, err := r.Repair("")
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatal("expected 1 file to need repair, got", n)
+	}
+	if f := <-r.newRepairs; f != bar {
+		t.Fatal("expected bar to be queued for repair, got", f.name)
+	}
+
+	// Scoping the repair to foo should not queue anything.
+	if n, err := r.Repair("foo"); err != nil || n != 0 {
+		t.Fatal("expected foo not to need repair:", n, err)
+	}
+	if _, err := r.Repair("baz"); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+
+	// Renewing contract 2 should not make foo need repair, even though foo
+	// still refers to it by its original ID.
+	hc.contracts[1].ID = types.FileContractID{5}
+	hc.renewed = map[types.FileContractID]types.FileContractID{
+		{2}: {5},
+	}
+	if n, err := r.Repair("foo"); err != nil || n != 0 {
+		t.Fatal("expected foo not to need repair after a renewal:", n, err)
+	}
+	if len(r.newRepairs) != 0 {
+		t.Fatal("files were queued for repair unnecessarily")
+	}
+}
@@ -0,0 +1,158 @@
+package renter
+
+import (
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// Pieces are encrypted with a random nonce, so two uploads of the same piece
+// never produce the same sector. Instead, the renter derives the master key
+// of each uploaded file from the file's contents, so that identical files
+// encrypt each piece under the same key. A piece can then be identified by
+// the hash of its key and plaintext, and an identical piece can reference the
+// sector that is already stored on a host instead of being uploaded again.
+//
+// Since the key of each piece is derived from the master key and the piece's
+// position, deduplication only applies between files that are byte-for-byte
+// identical and use the same erasure code. Files that merely share some
+// sectors' worth of data encrypt that data under different keys, and their
+// pieces are stored separately.
+
+type (
+	// indexedSector is a sector stored on a host that may be referenced by
+	// the pieces of several files. refs is not persisted; it is recomputed
+	// from the files when the renter loads.
+	indexedSector struct {
+		PieceHash   crypto.Hash          `json:"piecehash"`
+		MerkleRoot  crypto.Hash          `json:"merkleroot"`
+		Contract    types.FileContractID `json:"contract"`
+		IP          modules.NetAddress   `json:"ip"`
+		WindowStart types.BlockHeight    `json:"windowstart"`
+
+		refs int
+	}
+
+	// sectorIndex maps the hashes of uploaded pieces to the sectors storing
+	// them. Sectors are indexed by Merkle root as well, so that the
+	// references held by a file can be released when the file is deleted.
+	sectorIndex struct {
+		pieces map[crypto.Hash]*indexedSector
+		roots  map[crypto.Hash]*indexedSector
+	}
+)
+
+// pieceHash returns the hash identifying a piece, given the key the piece is
+// encrypted with and its plaintext.
+func pieceHash(key crypto.TwofishKey, piece []byte) crypto.Hash {
+	return crypto.HashAll(key, crypto.HashBytes(piece))
+}
+
+// convergentKey returns the master key for a file, derived from the hash of
+// the file's contents and its erasure code. The renter's secret prevents
+// anyone else from deriving the key of a file they know the contents of.
+// Because the whole file is hashed, only identical files share piece keys.
+func convergentKey(secret, contentHash crypto.Hash, code modules.ErasureCoder) crypto.TwofishKey {
+	return crypto.TwofishKey(crypto.HashAll(secret, contentHash, code.MinPieces(), code.NumPieces()))
+}
+
+// newSectorIndex returns an index containing the provided sectors, none of
+// which are referenced yet.
+func newSectorIndex(sectors []indexedSector) sectorIndex {
+	si := sectorIndex{
+		pieces: make(map[crypto.Hash]*indexedSector),
+		roots:  make(map[crypto.Hash]*indexedSector),
+	}
+	for i := range sectors {
+		s := sectors[i]
+		s.refs = 0
+		si.pieces[s.PieceHash] = &s
+		si.roots[s.MerkleRoot] = &s
+	}
+	return si
+}
+
+// lookup returns the sector storing the piece with the given hash.
+func (si *sectorIndex) lookup(h crypto.Hash) (*indexedSector, bool) {
+	s, exists := si.pieces[h]
+	return s, exists
+}
+
+// insert records that a piece was uploaded to the contract as the sector
+// with the given Merkle root, and references the sector.
+func (si *sectorIndex) insert(h, root crypto.Hash, fc fileContract) {
+	if si.pieces == nil {
+		*si = newSectorIndex(nil)
+	}
+	if s, exists := si.roots[root]; exists {
+		s.refs++
+		return
+	}
+	s := &indexedSector{
+		PieceHash:   h,
+		MerkleRoot:  root,
+		Contract:    fc.ID,
+		IP:          fc.IP,
+		WindowStart: fc.WindowStart,
+		refs:        1,
+	}
+	si.pieces[h] = s
+	si.roots[root] = s
+}
+
+// addRefs references each indexed sector that holds one of the file's pieces.
+// The file's lock must be held.
+func (si *sectorIndex) addRefs(f *file) {
+	for _, fc := range f.contracts {
+		for _, p := range fc.Pieces {
+			if s, exists := si.roots[p.MerkleRoot]; exists {
+				s.refs++
+			}
+		}
+	}
+}
+
+// removeRefs releases the references held by the file's pieces, removing
+// sectors that are no longer referenced from the index. It reports whether
+// each of the file's sectors may be deleted from its host, i.e. whether no
+// other file references it. The file's lock must be held.
+func (si *sectorIndex) removeRefs(f *file) map[crypto.Hash]bool {
+	unused := make(map[crypto.Hash]bool)
+	for _, fc := range f.contracts {
+		for _, p := range fc.Pieces {
+			s, exists := si.roots[p.MerkleRoot]
+			if !exists {
+				unused[p.MerkleRoot] = true
+				continue
+			}
+			s.refs--
+			if s.refs > 0 {
+				unused[p.MerkleRoot] = false
+				continue
+			}
+			unused[p.MerkleRoot] = true
+			delete(si.pieces, s.PieceHash)
+			delete(si.roots, s.MerkleRoot)
+		}
+	}
+	return unused
+}
+
+// prune removes the sectors that are not referenced by any file.
+func (si *sectorIndex) prune() {
+	for root, s := range si.roots {
+		if s.refs <= 0 {
+			delete(si.pieces, s.PieceHash)
+			delete(si.roots, root)
+		}
+	}
+}
+
+// sectors returns the indexed sectors, for persistence.
+func (si *sectorIndex) sectors() []indexedSector {
+	sectors := make([]indexedSector, 0, len(si.roots))
+	for _, s := range si.roots {
+		sectors = append(sectors, *s)
+	}
+	return sectors
+}
@@ -0,0 +1,62 @@
+package renter
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestSectorIndexRefs checks that the sector index counts the references
+// held by files, and only reports a sector as unused once no file references
+// it.
+func TestSectorIndexRefs(t *testing.T) {
+	fc := fileContract{ID: types.FileContractID{1}, IP: "foo.com:1234", WindowStart: 10}
+	h, root := crypto.Hash{2}, crypto.Hash{3}
+	fc.Pieces = []pieceData{{Chunk: 0, Piece: 0, MerkleRoot: root}}
+	f1 := &file{contracts: map[types.FileContractID]fileContract{fc.ID: fc}}
+	f2 := &file{contracts: map[types.FileContractID]fileContract{fc.ID: fc}}
+
+	// Uploading the piece indexes it, and a second file referencing the
+	// sector adds a reference.
+	var si sectorIndex
+	si.insert(h, root, fc)
+	si.insert(h, root, fc)
+	s, exists := si.lookup(h)
+	if !exists || s.MerkleRoot != root || s.Contract != fc.ID || s.refs != 2 {
+		t.Fatal("piece was not indexed correctly:", s, exists)
+	}
+
+	// Deleting the first file must keep the sector.
+	if unused := si.removeRefs(f1); unused[root] {
+		t.Fatal("sector referenced by another file was reported as unused")
+	}
+	if _, exists := si.lookup(h); !exists {
+		t.Fatal("sector referenced by another file was removed from the index")
+	}
+
+	// Deleting the second file releases the sector.
+	if unused := si.removeRefs(f2); !unused[root] {
+		t.Fatal("unreferenced sector was not reported as unused")
+	}
+	if _, exists := si.lookup(h); exists {
+		t.Fatal("unreferenced sector is still indexed")
+	}
+
+	// Loading the index from disk recounts the references of the files, and
+	// prunes sectors that are not referenced.
+	unreferenced := indexedSector{PieceHash: crypto.Hash{4}, MerkleRoot: crypto.Hash{5}}
+	si = newSectorIndex([]indexedSector{{PieceHash: h, MerkleRoot: root, Contract: fc.ID}, unreferenced})
+	si.addRefs(f1)
+	si.addRefs(f2)
+	si.prune()
+	if s, exists := si.lookup(h); !exists || s.refs != 2 {
+		t.Fatal("references were not recounted:", s, exists)
+	}
+	if _, exists := si.lookup(unreferenced.PieceHash); exists {
+		t.Fatal("unreferenced sector was not pruned")
+	}
+	if sectors := si.sectors(); len(sectors) != 1 || sectors[0].PieceHash != h {
+		t.Fatal("unexpected persisted sectors:", sectors)
+	}
+}
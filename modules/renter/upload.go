@@ -3,16 +3,34 @@ package renter
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/renter/contractor"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// deleteSectorsAttempts is the number of times the renter tries to
+	// acquire an editor for a contract when deleting the pieces of a
+	// canceled upload, waiting deleteSectorsRetryDelay between attempts.
+	deleteSectorsAttempts   = 10
+	deleteSectorsRetryDelay = 500 * time.Millisecond
 )
 
 var (
 	errInsufficientContracts = errors.New("not enough contracts to upload file")
+	errUploadComplete        = errors.New("upload has already completed")
+
+	// errNoPinnedContract is returned when an upload is pinned to a host
+	// that the renter does not have a contract with.
+	errNoPinnedContract = errors.New("no contract with pinned host")
 
 	// Erasure-coded piece size
 	pieceSize = modules.SectorSize - crypto.TwofishOverhead
@@ -43,11 +61,65 @@ var (
 		}
 		panic("undefined defaultParityPieces")
 	}()
+
+	// uploadKeyTTL is how long the renter remembers the result of an upload
+	// submitted with an idempotency key.
+	uploadKeyTTL = build.Select(build.Var{
+		Standard: 24 * time.Hour,
+		Dev:      time.Hour,
+		Testing:  time.Minute,
+	}).(time.Duration)
 )
 
+// An uploadKey is the result of an upload submitted with an idempotency key.
+// done is closed once the upload has been processed and err has been set.
+type uploadKey struct {
+	done    chan struct{}
+	err     error
+	expires time.Time
+}
+
 // Upload instructs the renter to start tracking a file. The renter will
-// automatically upload and repair tracked files using a background loop.
+// automatically upload and repair tracked files using a background loop. If
+// up.IdempotencyKey matches an upload processed within the last uploadKeyTTL,
+// the result of that upload is returned instead.
 func (r *Renter) Upload(up modules.FileUploadParams) error {
+	if up.IdempotencyKey == "" {
+		return r.managedUpload(up)
+	}
+
+	// Return the result of an earlier upload with the same key, waiting for
+	// it to finish if it is still being processed.
+	lockID := r.mu.Lock()
+	now := time.Now()
+	for key, uk := range r.uploadKeys {
+		if !uk.expires.IsZero() && !now.Before(uk.expires) {
+			delete(r.uploadKeys, key)
+		}
+	}
+	uk, exists := r.uploadKeys[up.IdempotencyKey]
+	if !exists {
+		uk = &uploadKey{done: make(chan struct{})}
+		r.uploadKeys[up.IdempotencyKey] = uk
+	}
+	r.mu.Unlock(lockID)
+	if exists {
+		<-uk.done
+		return uk.err
+	}
+
+	err := r.managedUpload(up)
+	lockID = r.mu.Lock()
+	uk.err = err
+	uk.expires = time.Now().Add(uploadKeyTTL)
+	r.mu.Unlock(lockID)
+	close(uk.done)
+	return err
+}
+
+// managedUpload validates the upload params and adds the file to the renter,
+// queueing it for upload.
+func (r *Renter) managedUpload(up modules.FileUploadParams) error {
 	// Enforce nickname rules.
 	if strings.HasPrefix(up.SiaPath, "/") {
 		return errors.New("nicknames cannot begin with /")
@@ -69,26 +141,59 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 	if err != nil {
 		return err
 	}
-	if up.ErasureCode == nil {
+	customCode := up.ErasureCode != nil
+	if !customCode {
 		up.ErasureCode, _ = NewRSCode(defaultDataPieces, defaultParityPieces)
+	} else if up.ErasureCode.MinPieces() < 1 {
+		return ErrZeroDataPieces
 	}
 
 	// Check that we have contracts to upload to. We need at least (data +
 	// parity/2) contracts; since NumPieces = data + parity, we arrive at the
-	// expression below.
-	if nContracts := len(r.hostContractor.Contracts()); nContracts < (up.ErasureCode.NumPieces()+up.ErasureCode.MinPieces())/2 && build.Release != "testing" {
+	// expression below. Erasure codes chosen for a specific file must also
+	// have a piece for every contract.
+	nContracts := len(r.hostContractor.Contracts())
+	if nContracts < (up.ErasureCode.NumPieces()+up.ErasureCode.MinPieces())/2 && build.Release != "testing" {
 		return fmt.Errorf("not enough contracts to upload file: got %v, needed %v", nContracts, (up.ErasureCode.NumPieces()+up.ErasureCode.MinPieces())/2)
 	}
+	if customCode && nContracts < up.ErasureCode.NumPieces() && build.Release != "testing" {
+		return fmt.Errorf("not enough contracts to upload file with %v pieces: got %v", up.ErasureCode.NumPieces(), nContracts)
+	}
+
+	// Check that every pinned host has a contract, and that there are
+	// enough of them to recover the file. Each host stores at most one piece
+	// of each chunk.
+	if len(up.Hosts) > 0 {
+		if err := r.checkPinnedHosts(up.Hosts); err != nil {
+			return err
+		}
+		if len(up.Hosts) < up.ErasureCode.MinPieces() {
+			return fmt.Errorf("not enough pinned hosts to recover file: got %v, needed %v", len(up.Hosts), up.ErasureCode.MinPieces())
+		}
+	}
+
+	// Derive the file's master key from its contents, so that pieces shared
+	// with previously uploaded files are recognized by the sector index. The
+	// key must be final before the file is added to the renter, as it is read
+	// without the file's lock.
+	contentHash, err := hashFile(up.Source)
+	if err != nil {
+		return err
+	}
 
 	// Create file object.
 	f := newFile(up.SiaPath, up.ErasureCode, pieceSize, uint64(fileInfo.Size()))
 	f.mode = uint32(fileInfo.Mode())
+	lockID = r.mu.RLock()
+	f.masterKey = convergentKey(r.dedupSecret, contentHash, up.ErasureCode)
+	r.mu.RUnlock(lockID)
 
 	// Add file to renter.
 	lockID = r.mu.Lock()
 	r.files[up.SiaPath] = f
 	r.tracking[up.SiaPath] = trackedFile{
 		RepairPath: up.Source,
+		Hosts:      up.Hosts,
 	}
 	r.saveSync()
 	err = r.saveFile(f)
@@ -101,3 +206,120 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 	r.newRepairs <- f
 	return nil
 }
+
+// checkPinnedHosts returns an error if the renter does not have a contract with
+// each of the specified hosts.
+func (r *Renter) checkPinnedHosts(hosts []types.SiaPublicKey) error {
+	contracted := make(map[string]struct{})
+	for _, c := range r.hostContractor.Contracts() {
+		contracted[c.HostPublicKey.String()] = struct{}{}
+	}
+	for _, pk := range hosts {
+		if _, ok := contracted[pk.String()]; !ok {
+			return fmt.Errorf("%v %v", errNoPinnedContract, pk)
+		}
+	}
+	return nil
+}
+
+// CancelUpload stops the upload of a file and removes the partially uploaded
+// file from the renter. The repair loop and the workers drop any remaining
+// work for the file, and the pieces that have already been uploaded are
+// deleted from the hosts in the background.
+func (r *Renter) CancelUpload(siapath string) error {
+	lockID := r.mu.Lock()
+	f, exists := r.files[siapath]
+	if !exists {
+		r.mu.Unlock(lockID)
+		return ErrUnknownPath
+	}
+	f.mu.Lock()
+	if f.uploadProgress() >= 100 {
+		f.mu.Unlock()
+		r.mu.Unlock(lockID)
+		return errUploadComplete
+	}
+	// Files loaded from disk do not have a cancel channel.
+	if f.cancel == nil {
+		f.cancel = make(chan struct{})
+	}
+	close(f.cancel)
+	// Only the sectors that no other file references are deleted.
+	unused := r.sectors.removeRefs(f)
+	contracts := make([]fileContract, 0, len(f.contracts))
+	for _, fc := range f.contracts {
+		var pieces []pieceData
+		for _, p := range fc.Pieces {
+			if unused[p.MerkleRoot] {
+				pieces = append(pieces, p)
+			}
+		}
+		fc.Pieces = pieces
+		contracts = append(contracts, fc)
+	}
+	f.mu.Unlock()
+
+	delete(r.files, siapath)
+	delete(r.tracking, siapath)
+	os.RemoveAll(filepath.Join(r.persistDir, f.name+ShareExtension))
+	err := r.saveSync()
+	r.mu.Unlock(lockID)
+
+	go r.threadedDeleteSectors(contracts)
+	return err
+}
+
+// hashFile returns the hash of the contents of the file at path.
+func hashFile(path string) (crypto.Hash, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return crypto.Hash{}, err
+	}
+	defer file.Close()
+
+	h := crypto.NewHash()
+	if _, err := io.Copy(h, file); err != nil {
+		return crypto.Hash{}, err
+	}
+	var sum crypto.Hash
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// threadedDeleteSectors deletes the pieces stored in each of the contracts
+// from their hosts.
+func (r *Renter) threadedDeleteSectors(contracts []fileContract) {
+	if r.tg.Add() != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	for _, fc := range contracts {
+		// A worker may still be uploading to the contract, so retry a few
+		// times if the contract is busy.
+		var e contractor.Editor
+		var err error
+		for i := 0; i < deleteSectorsAttempts; i++ {
+			e, err = r.hostContractor.Editor(fc.ID)
+			if err == nil {
+				break
+			}
+			select {
+			case <-time.After(deleteSectorsRetryDelay):
+			case <-r.tg.StopChan():
+				return
+			}
+		}
+		if err != nil {
+			r.log.Debugln("Unable to delete pieces from", fc.ID, "::", err)
+			continue
+		}
+		for _, piece := range fc.Pieces {
+			if err := e.Delete(piece.MerkleRoot); err != nil {
+				r.log.Debugln("Unable to delete piece from", fc.ID, "::", err)
+				break
+			}
+		}
+		e.Close()
+	}
+}
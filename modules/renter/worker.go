@@ -53,6 +53,7 @@ type (
 		chunkID    chunkID
 		data       []byte
 		file       *file
+		pieceHash  crypto.Hash
 		pieceIndex uint64
 
 		// resultChan is a channel that the worker will use to return the
@@ -113,6 +114,19 @@ func (w *worker) download(dw downloadWork) {
 
 // upload will perform some upload work.
 func (w *worker) upload(uw uploadWork) {
+	// Skip the work if the upload was canceled while it was queued. The
+	// worker did nothing wrong, so no error is reported.
+	uw.file.mu.RLock()
+	canceled := uw.file.uploadCanceled()
+	uw.file.mu.RUnlock()
+	if canceled {
+		select {
+		case uw.resultChan <- finishedUpload{uw.chunkID, crypto.Hash{}, nil, uw.pieceIndex, w.contractID}:
+		case <-w.renter.tg.StopChan():
+		}
+		return
+	}
+
 	e, err := w.renter.hostContractor.Editor(w.contractID)
 	if err != nil {
 		w.recentUploadFailure = time.Now()
@@ -139,9 +153,22 @@ func (w *worker) upload(uw uploadWork) {
 	// Success - reset the consecutive upload failures count.
 	w.consecutiveUploadFailures = 0
 
-	// Update the renter metadata.
+	// Update the renter metadata. If the upload was canceled while the piece
+	// was in flight, remove the piece from the host instead.
 	id := w.renter.mu.Lock()
 	uw.file.mu.Lock()
+	if uw.file.uploadCanceled() {
+		uw.file.mu.Unlock()
+		w.renter.mu.Unlock(id)
+		if err := e.Delete(root); err != nil {
+			w.renter.log.Debugln("Unable to delete piece of canceled upload from", w.contractID, "::", err)
+		}
+		select {
+		case uw.resultChan <- finishedUpload{uw.chunkID, root, nil, uw.pieceIndex, w.contractID}:
+		case <-w.renter.tg.StopChan():
+		}
+		return
+	}
 	contract, exists := uw.file.contracts[w.contractID]
 	if !exists {
 		contract = fileContract{
@@ -156,7 +183,9 @@ func (w *worker) upload(uw uploadWork) {
 		MerkleRoot: root,
 	})
 	uw.file.contracts[w.contractID] = contract
+	w.renter.sectors.insert(uw.pieceHash, root, contract)
 	w.renter.saveFile(uw.file)
+	w.renter.sectorsDirty = true
 	uw.file.mu.Unlock()
 	w.renter.mu.Unlock(id)
 
@@ -19,6 +19,11 @@ import (
 	"github.com/NebulousLabs/Sia/encoding"
 )
 
+const (
+	// maxCurrencyLen is the maximum length, in bytes, of an encoded Currency.
+	maxCurrencyLen = 256
+)
+
 type (
 	// A Currency represents a number of siacoins or siafunds. Internally, a
 	// Currency value is unbounded; however, Currency values sent over the wire
@@ -41,6 +46,10 @@ var (
 	// ErrUint64Overflow is the error that is returned if converting to a
 	// unit64 would cause an overflow.
 	ErrUint64Overflow = errors.New("cannot return the uint64 of this currency - result is an overflow")
+
+	// ErrCurrencyOverflow is the error that is returned by the checked
+	// arithmetic methods if the result would be too large to encode.
+	ErrCurrencyOverflow = errors.New("currency is too large to encode - result is an overflow")
 )
 
 // NewCurrency creates a Currency value from a big.Int. Undefined behavior
@@ -118,6 +127,22 @@ func (x Currency) Mul64(y uint64) (c Currency) {
 	return
 }
 
+// MulChecked returns a new Currency value c = x * y. ErrCurrencyOverflow is
+// returned if c is too large to be encoded.
+func (x Currency) MulChecked(y Currency) (Currency, error) {
+	c := x.Mul(y)
+	if c.i.BitLen() > 8*maxCurrencyLen {
+		return Currency{}, ErrCurrencyOverflow
+	}
+	return c, nil
+}
+
+// Mul64Checked returns a new Currency value c = x * y. ErrCurrencyOverflow is
+// returned if c is too large to be encoded.
+func (x Currency) Mul64Checked(y uint64) (Currency, error) {
+	return x.MulChecked(NewCurrency64(y))
+}
+
 // COMPATv0.4.0 - until the first 10e3 blocks have been archived, MulFloat is
 // needed while verifying the first set of blocks.
 //
@@ -211,14 +236,18 @@ func (c Currency) MarshalJSON() ([]byte, error) {
 func (c *Currency) UnmarshalJSON(b []byte) error {
 	// UnmarshalJSON does not expect quotes
 	b = bytes.Trim(b, `"`)
-	err := c.i.UnmarshalJSON(b)
+	// Decode into a new big.Int instead of c.i, whose backing array may be
+	// shared with the Currency it was copied from.
+	var i big.Int
+	err := i.UnmarshalJSON(b)
 	if err != nil {
 		return err
 	}
-	if c.i.Sign() < 0 {
+	if i.Sign() < 0 {
 		c.i = *big.NewInt(0)
 		return ErrNegativeCurrency
 	}
+	c.i = i
 	return nil
 }
 
@@ -232,7 +261,7 @@ func (c Currency) MarshalSia(w io.Writer) error {
 
 // UnmarshalSia implements the encoding.SiaUnmarshaler interface.
 func (c *Currency) UnmarshalSia(r io.Reader) error {
-	b, err := encoding.ReadPrefix(r, 256)
+	b, err := encoding.ReadPrefix(r, maxCurrencyLen)
 	if err != nil {
 		return err
 	}
@@ -248,12 +277,16 @@ func (c Currency) String() string {
 // Scan implements the fmt.Scanner interface, allowing Currency values to be
 // scanned from text.
 func (c *Currency) Scan(s fmt.ScanState, ch rune) error {
-	err := c.i.Scan(s, ch)
+	// Scan into a new big.Int instead of c.i, whose backing array may be
+	// shared with the Currency it was copied from.
+	var i big.Int
+	err := i.Scan(s, ch)
 	if err != nil {
 		return err
 	}
-	if c.i.Sign() < 0 {
+	if i.Sign() < 0 {
 		return ErrNegativeCurrency
 	}
+	c.i = i
 	return nil
 }
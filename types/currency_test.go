@@ -189,6 +189,41 @@ func TestCurrencyMul64(t *testing.T) {
 	}
 }
 
+// TestCurrencyMulChecked probes the MulChecked and Mul64Checked functions of
+// the currency type.
+func TestCurrencyMulChecked(t *testing.T) {
+	c5 := NewCurrency64(5)
+	c6 := NewCurrency64(6)
+	c30 := NewCurrency64(30)
+	if c, err := c5.MulChecked(c6); err != nil || c.Cmp(c30) != 0 {
+		t.Error("Multiplying 5 by 6 should equal 30:", c, err)
+	}
+	if c, err := c5.Mul64Checked(6); err != nil || c.Cmp(c30) != 0 {
+		t.Error("Multiplying 5 by 6 should equal 30:", c, err)
+	}
+
+	// The largest value that can be encoded should not overflow, but
+	// doubling it should.
+	max := NewCurrency(new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 8*maxCurrencyLen), big.NewInt(1)))
+	if c, err := max.Mul64Checked(1); err != nil || c.Cmp(max) != 0 {
+		t.Error("Multiplying the maximum currency by 1 should not overflow:", err)
+	}
+	if _, err := max.Mul64Checked(2); err != ErrCurrencyOverflow {
+		t.Error("expected ErrCurrencyOverflow, got", err)
+	}
+	if _, err := max.MulChecked(max); err != ErrCurrencyOverflow {
+		t.Error("expected ErrCurrencyOverflow, got", err)
+	}
+
+	// The maximum value should survive an encoding round trip.
+	var decoded Currency
+	if err := encoding.Unmarshal(encoding.Marshal(max), &decoded); err != nil {
+		t.Fatal(err)
+	} else if decoded.Cmp(max) != 0 {
+		t.Error("maximum currency did not survive encoding")
+	}
+}
+
 // TestCurrencyMulRat probes the MulRat function of the currency type.
 func TestCurrencyMulRat(t *testing.T) {
 	c5 := NewCurrency64(5)
@@ -326,6 +361,30 @@ func TestCurrencyScan(t *testing.T) {
 	}
 }
 
+// TestCurrencyScanCopy checks that scanning into a copy of a currency does
+// not modify the original.
+func TestCurrencyScanCopy(t *testing.T) {
+	orig := NewCurrency64(81293)
+	c := orig
+	if _, err := fmt.Sscan("12345", &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Cmp64(12345) != 0 {
+		t.Error("scanned number does not equal expected value")
+	}
+	if orig.Cmp64(81293) != 0 {
+		t.Error("scanning into a copy modified the original:", orig)
+	}
+
+	c = orig
+	if err := c.UnmarshalJSON([]byte(`"12345"`)); err != nil {
+		t.Fatal(err)
+	}
+	if orig.Cmp64(81293) != 0 {
+		t.Error("unmarshalling into a copy modified the original:", orig)
+	}
+}
+
 // TestCurrencyEncoding checks that a currency can encode and decode without
 // error.
 func TestCurrencyEncoding(t *testing.T) {
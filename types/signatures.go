@@ -9,6 +9,7 @@ package types
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
@@ -25,6 +26,7 @@ var (
 	ErrEntropyKey                = errors.New("transaction tries to sign an entproy public key")
 	ErrFrivolousSignature        = errors.New("transaction contains a frivolous signature")
 	ErrInvalidPubKeyIndex        = errors.New("transaction contains a signature that points to a nonexistent public key")
+	ErrInvalidPublicKeyString    = errors.New("public key string is not of the form algorithm:hexkey")
 	ErrInvalidUnlockHashChecksum = errors.New("provided unlock hash has an invalid checksum")
 	ErrMissingSignatures         = errors.New("transaction has inputs with missing signatures")
 	ErrPrematureSignature        = errors.New("timelock on signature has not expired")
@@ -397,3 +399,20 @@ func (t *Transaction) validSignatures(currentHeight BlockHeight) error {
 func (spk *SiaPublicKey) String() string {
 	return spk.Algorithm.String() + ":" + fmt.Sprintf("%x", spk.Key)
 }
+
+// LoadString loads a SiaPublicKey from its String representation, i.e. the
+// key type followed by a colon and the hex-encoded key.
+func (spk *SiaPublicKey) LoadString(s string) error {
+	i := strings.Index(s, ":")
+	if i < 0 || i > SpecifierLen {
+		return ErrInvalidPublicKeyString
+	}
+	var key []byte
+	if _, err := fmt.Sscanf(s[i+1:], "%x", &key); err != nil {
+		return ErrInvalidPublicKeyString
+	}
+	spk.Algorithm = Specifier{}
+	copy(spk.Algorithm[:], s[:i])
+	spk.Key = key
+	return nil
+}
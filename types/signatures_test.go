@@ -1,6 +1,7 @@
 package types
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/NebulousLabs/Sia/crypto"
@@ -366,3 +367,25 @@ func TestSiaPublicKeyString(t *testing.T) {
 		t.Error("got wrong value for spk.String():", spk.String())
 	}
 }
+
+// TestSiaPublicKeyLoadString checks that a SiaPublicKey can be recovered from
+// the output of String, and that malformed strings are rejected.
+func TestSiaPublicKeyLoadString(t *testing.T) {
+	spk := SiaPublicKey{
+		Algorithm: SignatureEd25519,
+		Key:       []byte{1, 2, 3, 4},
+	}
+	var loaded SiaPublicKey
+	if err := loaded.LoadString(spk.String()); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Algorithm != spk.Algorithm || !bytes.Equal(loaded.Key, spk.Key) {
+		t.Error("loaded key does not match original:", loaded.String())
+	}
+
+	for _, s := range []string{"", "ed25519", "ed25519:zz", "averyveryverylongalgorithm:00"} {
+		if err := loaded.LoadString(s); err != ErrInvalidPublicKeyString {
+			t.Errorf("expected %v for %q, got %v", ErrInvalidPublicKeyString, s, err)
+		}
+	}
+}